@@ -184,11 +184,13 @@ class ApiClient {
     required String title,
     required String description,
     String? initialBody,
+    List<Map<String, dynamic>>? initialSteps,
   }) async {
     final response = await _post('/v1/protocols', body: {
       'title': title,
       'description': description,
       'initialBody': (initialBody ?? description).trim(),
+      if (initialSteps != null) 'initialSteps': initialSteps,
     });
     return _decode(response);
   }
@@ -209,11 +211,13 @@ class ApiClient {
   Future<Map<String, dynamic>> publishProtocolVersion({
     required String protocolId,
     required String body,
+    List<Map<String, dynamic>>? steps,
     String? changeSummary,
     String? changeLog,
   }) async {
     final response = await _post('/v1/protocols/$protocolId/publish', body: {
       'body': body,
+      if (steps != null) 'steps': steps,
       'changeSummary': (changeSummary ?? changeLog ?? '').trim(),
     });
     return _decode(response);
@@ -297,15 +301,76 @@ class ApiClient {
   Future<Map<String, dynamic>> search({
     required String query,
     String? tag,
+    List<String>? types,
+    Map<String, Set<String>> facets = const {},
+    bool effectiveOnly = false,
   }) async {
     var qs = '?q=${Uri.encodeQueryComponent(query)}';
+    if (effectiveOnly) qs += '&effectiveOnly=true';
     if (tag != null && tag.isNotEmpty) {
       qs += '&tag=${Uri.encodeQueryComponent(tag)}';
     }
+    if (types != null && types.isNotEmpty) {
+      qs += '&types=${Uri.encodeQueryComponent(types.join(','))}';
+    }
+    facets.forEach((name, values) {
+      for (final v in values) {
+        qs += '&$name=${Uri.encodeQueryComponent(v)}';
+      }
+    });
     final response = await _get('/v1/search$qs');
     return _decode(response);
   }
 
+  Future<Map<String, dynamic>> createSavedSearch({
+    required String name,
+    required String query,
+    List<String>? types,
+    Map<String, Set<String>> facets = const {},
+    bool effectiveOnly = false,
+    bool subscribed = false,
+  }) async {
+    final response = await _post('/v1/saved-searches', body: {
+      'name': name,
+      'query': query,
+      if (types != null) 'types': types,
+      'facets': facets.map((name, values) => MapEntry(name, values.toList())),
+      'effectiveOnly': effectiveOnly,
+      'subscribed': subscribed,
+    });
+    return _decode(response);
+  }
+
+  Future<List<Map<String, dynamic>>> listSavedSearches() async {
+    final response = await _get('/v1/saved-searches');
+    final json = _decode(response);
+    return (json['savedSearches'] as List<dynamic>? ?? <dynamic>[])
+        .cast<Map<String, dynamic>>();
+  }
+
+  Future<Map<String, dynamic>> updateSavedSearch({
+    required String savedSearchId,
+    required String name,
+    required Map<String, dynamic> criteria,
+    required bool subscribed,
+  }) async {
+    final response = await _put('/v1/saved-searches/$savedSearchId', body: {
+      'name': name,
+      ...criteria,
+      'subscribed': subscribed,
+    });
+    return _decode(response);
+  }
+
+  Future<Map<String, dynamic>> runSavedSearch(String savedSearchId) async {
+    final response = await _get('/v1/saved-searches/$savedSearchId/run');
+    return _decode(response);
+  }
+
+  Future<void> deleteSavedSearch(String savedSearchId) async {
+    await _request('DELETE', '/v1/saved-searches/$savedSearchId', withAuth: true);
+  }
+
   // -------------------------------------------------------------------------
   // Users
   // -------------------------------------------------------------------------
@@ -491,7 +556,7 @@ class ApiClient {
     required String title,
     required String xColumn,
     required List<String> yColumns,
-    Map<String, dynamic>? options,
+    Map<String, dynamic>? spec,
   }) async {
     final response = await _post('/v1/charts', body: {
       'experimentId': experimentId,
@@ -500,7 +565,7 @@ class ApiClient {
       'title': title,
       'xColumn': xColumn,
       'yColumns': yColumns,
-      if (options != null) 'options': options,
+      if (spec != null) 'spec': spec,
     });
     return _decode(response);
   }
@@ -512,6 +577,22 @@ class ApiClient {
         .cast<Map<String, dynamic>>();
   }
 
+  /// Renders a chart on the server; [format] is `png` or `svg`.
+  Future<Uint8List> getChartImage(
+    String chartId, {
+    String format = 'png',
+    int? width,
+    int? height,
+  }) async {
+    final query = <String>[
+      'format=$format',
+      if (width != null) 'width=$width',
+      if (height != null) 'height=$height',
+    ].join('&');
+    final response = await _get('/v1/charts/$chartId/image?$query');
+    return response.bodyBytes;
+  }
+
   // -------------------------------------------------------------------------
   // Templates
   // -------------------------------------------------------------------------
@@ -616,6 +697,17 @@ class ApiClient {
         .cast<Map<String, dynamic>>();
   }
 
+  Future<List<Map<String, dynamic>>> relatedExperiments(
+    String experimentId, {
+    int limit = 10,
+  }) async {
+    final response =
+        await _get('/v1/experiments/$experimentId/related?limit=$limit');
+    final json = _decode(response);
+    return (json['related'] as List<dynamic>? ?? <dynamic>[])
+        .cast<Map<String, dynamic>>();
+  }
+
   // -------------------------------------------------------------------------
   // Previews / Thumbnails
   // -------------------------------------------------------------------------
@@ -378,7 +378,7 @@ class ChartConfigRecord {
     required this.title,
     required this.xColumn,
     required this.yColumns,
-    required this.options,
+    required this.spec,
     required this.createdAt,
   });
 
@@ -389,7 +389,7 @@ class ChartConfigRecord {
   final String title;
   final String xColumn;
   final List<String> yColumns;
-  final Map<String, dynamic> options;
+  final Map<String, dynamic> spec;
   final DateTime createdAt;
 
   factory ChartConfigRecord.fromJson(Map<String, dynamic> json) {
@@ -402,7 +402,7 @@ class ChartConfigRecord {
       xColumn: json['xColumn'] as String? ?? '',
       yColumns: (json['yColumns'] as List<dynamic>? ?? <dynamic>[])
           .cast<String>(),
-      options: json['options'] as Map<String, dynamic>? ?? <String, dynamic>{},
+      spec: json['spec'] as Map<String, dynamic>? ?? <String, dynamic>{},
       createdAt: DateTime.parse(json['createdAt'] as String),
     );
   }
@@ -1294,6 +1294,20 @@ class _ExperimentDetailScreenState extends State<_ExperimentDetailScreen> {
   Future<void> _exportPdf() async {
     final experiment = _experiment;
     if (experiment == null) return;
+    // Charts are rendered server-side; an offline export goes out without them.
+    final charts = <(String, pw.MemoryImage)>[];
+    if (experiment.serverId != null) {
+      try {
+        for (final chart in await widget.sync.api.listCharts(experiment.serverId!)) {
+          final chartId = chart['chartConfigId'] as String?;
+          if (chartId == null) continue;
+          final png = await widget.sync.api.getChartImage(chartId, width: 1000, height: 600);
+          charts.add((chart['title'] as String? ?? '', pw.MemoryImage(png)));
+        }
+      } on Exception {
+        charts.clear();
+      }
+    }
     final doc = pw.Document();
     doc.addPage(
       pw.MultiPage(
@@ -1315,6 +1329,20 @@ class _ExperimentDetailScreenState extends State<_ExperimentDetailScreen> {
                   ],
                 ),
               )),
+          if (charts.isNotEmpty) ...[
+            pw.SizedBox(height: 12),
+            pw.Text('Charts', style: pw.TextStyle(fontWeight: pw.FontWeight.bold)),
+            ...charts.map((c) => pw.Padding(
+                  padding: const pw.EdgeInsets.only(bottom: 12),
+                  child: pw.Column(
+                    crossAxisAlignment: pw.CrossAxisAlignment.start,
+                    children: [
+                      if (c.$1.isNotEmpty) pw.Text(c.$1),
+                      pw.Image(c.$2),
+                    ],
+                  ),
+                )),
+          ],
         ],
       ),
     );
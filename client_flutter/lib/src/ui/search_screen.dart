@@ -14,6 +14,10 @@ class SearchScreen extends StatefulWidget {
 class _SearchScreenState extends State<SearchScreen> {
   final _queryController = TextEditingController();
   List<dynamic> _results = const [];
+  List<dynamic> _facets = const [];
+  String? _didYouMean;
+  bool _effectiveOnly = false;
+  final Map<String, Set<String>> _selected = {};
   bool _searching = false;
   bool _hasSearched = false;
 
@@ -33,11 +37,17 @@ class _SearchScreenState extends State<SearchScreen> {
     });
 
     try {
-      final response = await widget.sync.api.search(query: q);
-      final results = (response['results'] as List<dynamic>?) ?? [];
+      final response = await widget.sync.api.search(
+        query: q,
+        facets: _selected,
+        effectiveOnly: _effectiveOnly,
+      );
+      final results = (response['hits'] as List<dynamic>?) ?? [];
       if (!mounted) return;
       setState(() {
         _results = results;
+        _facets = (response['facets'] as List<dynamic>?) ?? [];
+        _didYouMean = response['didYouMean'] as String?;
         _searching = false;
       });
     } on ApiException catch (e) {
@@ -47,6 +57,163 @@ class _SearchScreenState extends State<SearchScreen> {
     }
   }
 
+  void _toggleFacet(String name, String value) {
+    final values = _selected.putIfAbsent(name, () => <String>{});
+    if (!values.remove(value)) values.add(value);
+    if (values.isEmpty) _selected.remove(name);
+    _doSearch();
+  }
+
+  Widget _buildFacets() {
+    final chips = <Widget>[];
+    for (final f in _facets) {
+      final facet = f as Map<String, dynamic>;
+      final name = facet['name'] as String;
+      for (final v in (facet['values'] as List<dynamic>? ?? const [])) {
+        final value = v as Map<String, dynamic>;
+        final key = value['value'] as String;
+        chips.add(FilterChip(
+          label: Text('$name: ${value['label']} (${value['count']})'),
+          selected: _selected[name]?.contains(key) ?? false,
+          onSelected: (_) => _toggleFacet(name, key),
+        ));
+      }
+    }
+    if (chips.isEmpty) return const SizedBox.shrink();
+    return SizedBox(
+      height: 48,
+      child: ListView.separated(
+        scrollDirection: Axis.horizontal,
+        padding: const EdgeInsets.symmetric(horizontal: 16),
+        itemCount: chips.length,
+        separatorBuilder: (_, __) => const SizedBox(width: 6),
+        itemBuilder: (_, i) => Center(child: chips[i]),
+      ),
+    );
+  }
+
+  Future<void> _saveSearch() async {
+    final q = _queryController.text.trim();
+    if (q.isEmpty) return;
+    final nameController = TextEditingController(text: q);
+    var subscribed = false;
+    final save = await showDialog<bool>(
+      context: context,
+      builder: (context) => StatefulBuilder(
+        builder: (context, setDialogState) => AlertDialog(
+          title: const Text('Save search'),
+          content: Column(
+            mainAxisSize: MainAxisSize.min,
+            children: [
+              TextField(
+                controller: nameController,
+                decoration: const InputDecoration(labelText: 'Name'),
+              ),
+              CheckboxListTile(
+                contentPadding: EdgeInsets.zero,
+                title: const Text('Notify me about new matches'),
+                value: subscribed,
+                onChanged: (v) => setDialogState(() => subscribed = v ?? false),
+              ),
+            ],
+          ),
+          actions: [
+            TextButton(
+              onPressed: () => Navigator.pop(context, false),
+              child: const Text('Cancel'),
+            ),
+            FilledButton(
+              onPressed: () => Navigator.pop(context, true),
+              child: const Text('Save'),
+            ),
+          ],
+        ),
+      ),
+    );
+    final name = nameController.text.trim();
+    nameController.dispose();
+    if (save != true || name.isEmpty) return;
+
+    try {
+      await widget.sync.api.createSavedSearch(
+        name: name,
+        query: q,
+        facets: _selected,
+        subscribed: subscribed,
+        effectiveOnly: _effectiveOnly,
+      );
+      if (!mounted) return;
+      ScaffoldMessenger.of(context).showSnackBar(SnackBar(content: Text('Saved "$name"')));
+    } on ApiException catch (e) {
+      if (!mounted) return;
+      ScaffoldMessenger.of(context).showSnackBar(SnackBar(content: Text(e.message)));
+    }
+  }
+
+  Future<void> _openSavedSearches() async {
+    final List<Map<String, dynamic>> saved;
+    try {
+      saved = await widget.sync.api.listSavedSearches();
+    } on ApiException catch (e) {
+      if (!mounted) return;
+      ScaffoldMessenger.of(context).showSnackBar(SnackBar(content: Text(e.message)));
+      return;
+    }
+    if (!mounted) return;
+    final chosen = await showModalBottomSheet<Map<String, dynamic>>(
+      context: context,
+      builder: (context) => saved.isEmpty
+          ? const Padding(
+              padding: EdgeInsets.all(24),
+              child: Text('No saved searches'),
+            )
+          : ListView(
+              shrinkWrap: true,
+              children: [
+                for (final s in saved)
+                  ListTile(
+                    leading: Icon(
+                      s['subscribed'] == true ? Icons.notifications_active : Icons.bookmark_outline,
+                    ),
+                    title: Text(s['name'] as String? ?? ''),
+                    subtitle: Text((s['criteria'] as Map<String, dynamic>?)?['query'] as String? ?? ''),
+                    onTap: () => Navigator.pop(context, s),
+                  ),
+              ],
+            ),
+    );
+    if (chosen == null) return;
+
+    final criteria = chosen['criteria'] as Map<String, dynamic>? ?? const {};
+    _queryController.text = criteria['query'] as String? ?? '';
+    _effectiveOnly = criteria['effectiveOnly'] == true;
+    _selected
+      ..clear()
+      ..addAll({
+        for (final e in (criteria['facets'] as Map<String, dynamic>? ?? const {}).entries)
+          e.key: (e.value as List<dynamic>).cast<String>().toSet(),
+      });
+    _doSearch();
+  }
+
+  Widget _buildNoResults() {
+    final suggestion = _didYouMean;
+    if (suggestion == null) return const Text('No results found');
+    return Column(
+      mainAxisSize: MainAxisSize.min,
+      children: [
+        const Text('No results found'),
+        TextButton(
+          onPressed: () {
+            _queryController.text = suggestion;
+            _doSearch();
+          },
+          child: Text('Did you mean: $suggestion'),
+        ),
+      ],
+    );
+  }
+
   @override
   Widget build(BuildContext context) {
     return Column(
@@ -59,7 +226,7 @@ class _SearchScreenState extends State<SearchScreen> {
                 child: TextField(
                   controller: _queryController,
                   decoration: const InputDecoration(
-                    hintText: 'Search experiments and protocols...',
+                    hintText: 'Search, e.g. tag:crispr status:completed "exact phrase" -contaminated',
                     prefixIcon: Icon(Icons.search),
                     border: OutlineInputBorder(),
                     isDense: true,
@@ -72,34 +239,64 @@ class _SearchScreenState extends State<SearchScreen> {
                 onPressed: _searching ? null : _doSearch,
                 child: const Text('Search'),
               ),
+              IconButton(
+                tooltip: 'Save search',
+                icon: const Icon(Icons.bookmark_add_outlined),
+                onPressed: _searching ? null : _saveSearch,
+              ),
+              IconButton(
+                tooltip: 'Saved searches',
+                icon: const Icon(Icons.bookmarks_outlined),
+                onPressed: _openSavedSearches,
+              ),
             ],
           ),
         ),
+        Padding(
+          padding: const EdgeInsets.symmetric(horizontal: 16),
+          child: Align(
+            alignment: Alignment.centerLeft,
+            child: FilterChip(
+              label: const Text('Effective content only'),
+              selected: _effectiveOnly,
+              onSelected: (v) {
+                setState(() => _effectiveOnly = v);
+                _doSearch();
+              },
+            ),
+          ),
+        ),
+        _buildFacets(),
         Expanded(
           child: _searching
               ? const Center(child: CircularProgressIndicator())
               : !_hasSearched
                   ? const Center(child: Text('Enter a query to search'))
                   : _results.isEmpty
-                      ? const Center(child: Text('No results found'))
+                      ? Center(child: _buildNoResults())
                       : ListView.separated(
                           itemCount: _results.length,
                           separatorBuilder: (_, __) => const Divider(height: 1),
                           itemBuilder: (context, i) {
                             final r = _results[i] as Map<String, dynamic>;
-                            final kind = r['kind'] as String? ?? 'experiment';
-                            final headline = r['headline'] as String? ?? '';
+                            final type = r['type'] as String? ?? 'experiment';
+                            final subtype = r['subtype'] as String? ?? '';
+                            // ts_headline marks matches with <b> tags.
+                            final snippet = (r['snippet'] as String? ?? '')
+                                .replaceAll(RegExp(r'</?b>'), '');
                             return ListTile(
-                              leading: Icon(
-                                kind == 'protocol' ? Icons.article : Icons.science,
-                                color: kind == 'protocol' ? Colors.blue : Colors.teal,
-                              ),
+                              leading: Icon(_hitIcon(type), color: Colors.teal),
                               title: Text(r['title'] as String? ?? '(untitled)'),
                               subtitle: Text(
-                                headline.isNotEmpty ? headline : kind.toUpperCase(),
+                                snippet.isNotEmpty
+                                    ? snippet
+                                    : (subtype.isNotEmpty ? subtype : type).toUpperCase(),
                                 maxLines: 2,
                                 overflow: TextOverflow.ellipsis,
                               ),
+                              trailing: Text(
+                                  _hitLabel(type, subtype, r['entryState'] as String?),
+                                  style: Theme.of(context).textTheme.labelSmall),
                             );
                           },
                         ),
@@ -107,4 +304,35 @@ class _SearchScreenState extends State<SearchScreen> {
       ],
     );
   }
+
+  static IconData _hitIcon(String type) {
+    switch (type) {
+      case 'entry':
+        return Icons.notes;
+      case 'protocol':
+        return Icons.article;
+      case 'comment':
+        return Icons.comment;
+      case 'proposal':
+        return Icons.lightbulb_outline;
+      case 'attachment':
+        return Icons.attach_file;
+      case 'dataExtract':
+        return Icons.table_chart;
+      case 'template':
+        return Icons.description;
+      case 'reagent':
+        return Icons.inventory_2;
+      default:
+        return Icons.science;
+    }
+  }
+
+  static String _hitLabel(String type, String subtype, String? entryState) {
+    if (type == 'reagent' && subtype.isNotEmpty) return 'reagent · $subtype';
+    // Matches in text a later addendum superseded.
+    if (entryState == 'historical') return '$type · historical';
+    if (type == 'dataExtract') return 'data';
+    return type;
+  }
 }
@@ -1,12 +1,23 @@
 package integration_test
 
 import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
+	"image"
+	"image/color"
+	"image/png"
 	"net/http"
+	"net/url"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/mjhen/elnote/server/internal/config"
 )
 
 func TestMandatoryAcceptanceSuite(t *testing.T) {
@@ -330,6 +341,1763 @@ func TestMandatoryAcceptanceSuite(t *testing.T) {
 		}
 	})
 
+	t.Run("AttachmentCompletionVerification", func(t *testing.T) {
+		exp := env.createExperiment(ownerATokenDeviceA, "Attachment verification", "original")
+		experimentID := getString(t, exp, "experimentId")
+
+		completeWithObject := func(objectKey string, body []byte, reportedChecksum string) map[string]any {
+			t.Helper()
+			status, _, _, initiateResp := env.doJSON(http.MethodPost, "/v1/attachments/initiate", ownerATokenDeviceA, map[string]any{
+				"experimentId": experimentID,
+				"objectKey":    objectKey,
+				"sizeBytes":    len(body),
+				"mimeType":     "application/octet-stream",
+			})
+			if status != http.StatusCreated {
+				t.Fatalf("attachment initiate failed: status=%d body=%v", status, initiateResp)
+			}
+			attachmentID := getString(t, asMap(t, initiateResp), "attachmentId")
+			env.objectStore.putObject(objectKey, body, "")
+
+			status, _, _, completeResp := env.doJSON(http.MethodPost, "/v1/attachments/"+attachmentID+"/complete", ownerATokenDeviceA, map[string]any{
+				"checksum":  reportedChecksum,
+				"sizeBytes": len(body),
+			})
+			if status != http.StatusOK {
+				t.Fatalf("attachment complete failed: status=%d body=%v", status, completeResp)
+			}
+			return asMap(t, completeResp)
+		}
+
+		body := []byte("plate-reader-export")
+		sum := sha256.Sum256(body)
+		digest := hex.EncodeToString(sum[:])
+
+		verified := completeWithObject("verify/match.bin", body, digest)
+		if got := getString(t, verified, "verificationStatus"); got != "verified" {
+			t.Fatalf("expected verified completion, got %v", verified)
+		}
+		if got := getString(t, verified, "verifiedSha256"); got != digest {
+			t.Fatalf("expected verified sha256 %s, got %s", digest, got)
+		}
+
+		flagged := completeWithObject("verify/mismatch.bin", body, strings.Repeat("0", 64))
+		if got := getString(t, flagged, "verificationStatus"); got != "mismatch" {
+			t.Fatalf("expected mismatch to be flagged on completion, got %v", flagged)
+		}
+	})
+
+	t.Run("AttachmentContentScanning", func(t *testing.T) {
+		scanEnv := env.withConfig(func(cfg *config.Config) {
+			cfg.AttachmentScanEnabled = true
+			cfg.AttachmentScanMagicBytes = true
+			cfg.AttachmentScanBatchSize = 100
+			cfg.AttachmentScanMaxAttempts = 5
+		})
+		experimentID := getString(t, scanEnv.createExperiment(ownerATokenDeviceA, "Scanned uploads", "original"), "experimentId")
+
+		upload := func(objectKey, mimeType string, body []byte) string {
+			t.Helper()
+			status, _, _, initiateResp := scanEnv.doJSON(http.MethodPost, "/v1/attachments/initiate", ownerATokenDeviceA, map[string]any{
+				"experimentId": experimentID,
+				"objectKey":    objectKey,
+				"sizeBytes":    len(body),
+				"mimeType":     mimeType,
+			})
+			if status != http.StatusCreated {
+				t.Fatalf("attachment initiate failed: status=%d body=%v", status, initiateResp)
+			}
+			attachmentID := getString(t, asMap(t, initiateResp), "attachmentId")
+			scanEnv.objectStore.putObject(objectKey, body, "")
+			sum := sha256.Sum256(body)
+			status, _, _, completeResp := scanEnv.doJSON(http.MethodPost, "/v1/attachments/"+attachmentID+"/complete", ownerATokenDeviceA, map[string]any{
+				"checksum":  hex.EncodeToString(sum[:]),
+				"sizeBytes": len(body),
+			})
+			if status != http.StatusOK {
+				t.Fatalf("attachment complete failed: status=%d body=%v", status, completeResp)
+			}
+			if got := getString(t, asMap(t, completeResp), "scanStatus"); got != "pending_scan" {
+				t.Fatalf("expected completion to hold the upload for scanning, got %q", got)
+			}
+			return attachmentID
+		}
+		downloadStatus := func(attachmentID string) int {
+			status, _, _, _ := scanEnv.doJSON(http.MethodGet, "/v1/attachments/"+attachmentID+"/download", ownerATokenDeviceA, nil)
+			return status
+		}
+
+		disguisedKey := fmt.Sprintf("scan/%d/gel.png", now)
+		disguisedID := upload(disguisedKey, "image/png", []byte("MZ\x90\x00\x03\x00\x00\x00 not really a gel image"))
+		missingKey := fmt.Sprintf("scan/%d/notes.txt", now)
+		missingID := upload(missingKey, "text/plain", []byte("lane 1: ladder"))
+		scanEnv.objectStore.deleteObject(missingKey)
+
+		if status := downloadStatus(disguisedID); status != http.StatusConflict {
+			t.Fatalf("expected a pending_scan download to be refused with 409, got %d", status)
+		}
+
+		status, _, _, scanResp := scanEnv.doJSON(http.MethodPost, "/v1/ops/attachments/scan", adminToken, map[string]any{})
+		if status != http.StatusOK {
+			t.Fatalf("scan attachments failed: status=%d body=%v", status, scanResp)
+		}
+		quarantined := false
+		for _, q := range asSlice(t, asMap(t, scanResp)["quarantined"]) {
+			item := asMap(t, q)
+			if getString(t, item, "attachmentId") == disguisedID {
+				quarantined = true
+				if getString(t, item, "scanner") != "magic_bytes" {
+					t.Fatalf("expected the magic-byte scanner to quarantine, got %v", item)
+				}
+			}
+		}
+		if !quarantined {
+			t.Fatalf("expected %s to be quarantined, got %v", disguisedID, scanResp)
+		}
+
+		var scanStatus string
+		if err := env.db.QueryRow(`SELECT scan_status FROM attachments WHERE id = $1::uuid`, missingID).Scan(&scanStatus); err != nil {
+			t.Fatalf("read scan status: %v", err)
+		}
+		if scanStatus != "scan_failed" {
+			t.Fatalf("expected an unreadable object to fail its scan, got %q", scanStatus)
+		}
+
+		if _, err := env.db.Exec(`UPDATE attachments SET scan_attempts = 4 WHERE id = $1::uuid`, missingID); err != nil {
+			t.Fatalf("advance scan attempts: %v", err)
+		}
+		status, _, _, scanResp = scanEnv.doJSON(http.MethodPost, "/v1/ops/attachments/scan", adminToken, map[string]any{})
+		if status != http.StatusOK {
+			t.Fatalf("rescan attachments failed: status=%d body=%v", status, scanResp)
+		}
+		exhausted := false
+		for _, f := range asSlice(t, asMap(t, scanResp)["exhausted"]) {
+			if getString(t, asMap(t, f), "attachmentId") == missingID {
+				exhausted = true
+			}
+		}
+		if !exhausted {
+			t.Fatalf("expected %s to exhaust its scan attempts, got %v", missingID, scanResp)
+		}
+		var exhaustedNotices int
+		if err := env.db.QueryRow(
+			`SELECT COUNT(*) FROM notifications n JOIN users u ON u.id = n.user_id
+			 WHERE u.role = 'admin' AND n.event_type = 'attachment.scan_failed' AND n.reference_id = $1::uuid`,
+			missingID,
+		).Scan(&exhaustedNotices); err != nil {
+			t.Fatalf("count scan failure notifications: %v", err)
+		}
+		if exhaustedNotices == 0 {
+			t.Fatalf("expected admins to be notified that %s exhausted its scan attempts", missingID)
+		}
+
+		if status := downloadStatus(disguisedID); status != http.StatusLocked {
+			t.Fatalf("expected a quarantined download to be refused with 423, got %d", status)
+		}
+		if status := downloadStatus(missingID); status != http.StatusConflict {
+			t.Fatalf("expected a scan_failed download to be refused with 409, got %d", status)
+		}
+
+		var auditCount int
+		if err := env.db.QueryRow(
+			`SELECT COUNT(*) FROM audit_log WHERE event_type = 'attachment.scan.quarantined' AND entity_type = 'attachment' AND entity_id = $1::uuid`,
+			disguisedID,
+		).Scan(&auditCount); err != nil {
+			t.Fatalf("count audit events: %v", err)
+		}
+		if auditCount != 1 {
+			t.Fatalf("expected one attachment.scan.quarantined audit event, got %d", auditCount)
+		}
+
+		// A deduplicated link inherits the clean verdict only under the same
+		// declared type; any other declaration is scanned against the content.
+		pngBody := []byte(fmt.Sprintf("\x89PNG\r\n\x1a\n gel %d", now))
+		pngID := upload(fmt.Sprintf("scan/%d/blot.png", now), "image/png", pngBody)
+		if status, _, _, resp := scanEnv.doJSON(http.MethodPost, "/v1/ops/attachments/scan", adminToken, map[string]any{}); status != http.StatusOK {
+			t.Fatalf("scan attachments failed: status=%d body=%v", status, resp)
+		}
+		if status := downloadStatus(pngID); status != http.StatusOK {
+			t.Fatalf("expected the clean png to download, got %d", status)
+		}
+		pngSum := sha256.Sum256(pngBody)
+		link := func(objectKey, mimeType string) map[string]any {
+			t.Helper()
+			status, _, _, resp := scanEnv.doJSON(http.MethodPost, "/v1/attachments/initiate", ownerATokenDeviceA, map[string]any{
+				"experimentId": experimentID,
+				"objectKey":    objectKey,
+				"sizeBytes":    len(pngBody),
+				"mimeType":     mimeType,
+				"sha256":       hex.EncodeToString(pngSum[:]),
+			})
+			if status != http.StatusCreated {
+				t.Fatalf("attachment initiate failed: status=%d body=%v", status, resp)
+			}
+			linked := asMap(t, resp)
+			if linked["deduplicated"] != true {
+				t.Fatalf("expected a deduplicated link, got %v", linked)
+			}
+			return linked
+		}
+		if same := link(fmt.Sprintf("scan/%d/blot-copy.png", now), "image/png"); getString(t, same, "scanStatus") != "clean" {
+			t.Fatalf("expected a same-type link to inherit the clean verdict, got %v", same)
+		}
+		relabeled := link(fmt.Sprintf("scan/%d/blot.pdf", now), "application/pdf")
+		if getString(t, relabeled, "scanStatus") != "pending_scan" {
+			t.Fatalf("expected a relabeled link to wait for a scan, got %v", relabeled)
+		}
+		if status, _, _, resp := scanEnv.doJSON(http.MethodPost, "/v1/ops/attachments/scan", adminToken, map[string]any{}); status != http.StatusOK {
+			t.Fatalf("scan attachments failed: status=%d body=%v", status, resp)
+		}
+		if status := downloadStatus(getString(t, relabeled, "attachmentId")); status != http.StatusLocked {
+			t.Fatalf("expected the png declared as pdf to be quarantined, got %d", status)
+		}
+	})
+
+	t.Run("AttachmentContentDeduplication", func(t *testing.T) {
+		body := []byte(fmt.Sprintf("reference-pdf-%d", now))
+		sum := sha256.Sum256(body)
+		digest := hex.EncodeToString(sum[:])
+		sourceKey := fmt.Sprintf("dedup-%d-source.pdf", now)
+
+		initiate := func(token, experimentID, objectKey string) map[string]any {
+			t.Helper()
+			status, _, _, resp := env.doJSON(http.MethodPost, "/v1/attachments/initiate", token, map[string]any{
+				"experimentId": experimentID,
+				"objectKey":    objectKey,
+				"sizeBytes":    len(body),
+				"mimeType":     "application/pdf",
+				"sha256":       digest,
+			})
+			if status != http.StatusCreated {
+				t.Fatalf("attachment initiate failed: status=%d body=%v", status, resp)
+			}
+			return asMap(t, resp)
+		}
+
+		first := env.createExperiment(ownerATokenDeviceA, "Dedup source", "original")
+		source := initiate(ownerATokenDeviceA, getString(t, first, "experimentId"), sourceKey)
+		if source["deduplicated"] != false || getString(t, source, "uploadUrl") == "" {
+			t.Fatalf("expected first upload to require an upload URL, got %v", source)
+		}
+		env.objectStore.putObject(sourceKey, body, "")
+		status, _, _, completeResp := env.doJSON(http.MethodPost, "/v1/attachments/"+getString(t, source, "attachmentId")+"/complete", ownerATokenDeviceA, map[string]any{
+			"checksum":  digest,
+			"sizeBytes": len(body),
+		})
+		if status != http.StatusOK {
+			t.Fatalf("attachment complete failed: status=%d body=%v", status, completeResp)
+		}
+
+		second := env.createExperiment(ownerATokenDeviceA, "Dedup reuse", "original")
+		linked := initiate(ownerATokenDeviceA, getString(t, second, "experimentId"), fmt.Sprintf("dedup-%d-copy.pdf", now))
+		if linked["deduplicated"] != true || getString(t, linked, "status") != "completed" {
+			t.Fatalf("expected deduplicated completed attachment, got %v", linked)
+		}
+		if _, ok := linked["uploadUrl"]; ok {
+			t.Fatalf("deduplicated attachment must not issue an upload URL: %v", linked)
+		}
+		if got := getString(t, linked, "deduplicatedFromAttachmentId"); got != getString(t, source, "attachmentId") {
+			t.Fatalf("expected dedup source %s, got %s", getString(t, source, "attachmentId"), got)
+		}
+
+		status, _, _, downloadResp := env.doJSON(http.MethodGet, "/v1/attachments/"+getString(t, linked, "attachmentId")+"/download", ownerATokenDeviceA, nil)
+		if status != http.StatusOK {
+			t.Fatalf("deduplicated download failed: status=%d body=%v", status, downloadResp)
+		}
+		if downloadURL := getString(t, asMap(t, downloadResp), "downloadUrl"); !strings.Contains(downloadURL, sourceKey) {
+			t.Fatalf("expected download of shared object %s, got %q", sourceKey, downloadURL)
+		}
+
+		other := env.createExperiment(ownerBToken, "Dedup other owner", "original")
+		unlinked := initiate(ownerBToken, getString(t, other, "experimentId"), fmt.Sprintf("dedup-%d-other.pdf", now))
+		if unlinked["deduplicated"] != false {
+			t.Fatalf("content must not be shared across owners, got %v", unlinked)
+		}
+	})
+
+	t.Run("ServerSidePreviewJobs", func(t *testing.T) {
+		exp := env.createExperiment(ownerATokenDeviceA, "Preview jobs", "original")
+		experimentID := getString(t, exp, "experimentId")
+
+		img := image.NewRGBA(image.Rect(0, 0, 640, 320))
+		for y := 0; y < 320; y++ {
+			for x := 0; x < 640; x++ {
+				img.Set(x, y, color.RGBA{uint8(x % 256), uint8(y % 256), 0x80, 0xff})
+			}
+		}
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			t.Fatalf("encode png: %v", err)
+		}
+		body := buf.Bytes()
+		sum := sha256.Sum256(body)
+		objectKey := fmt.Sprintf("previews/%d/gel.png", now)
+
+		status, _, _, initiateResp := env.doJSON(http.MethodPost, "/v1/attachments/initiate", ownerATokenDeviceA, map[string]any{
+			"experimentId": experimentID,
+			"objectKey":    objectKey,
+			"sizeBytes":    len(body),
+			"mimeType":     "image/png",
+		})
+		if status != http.StatusCreated {
+			t.Fatalf("attachment initiate failed: status=%d body=%v", status, initiateResp)
+		}
+		attachmentID := getString(t, asMap(t, initiateResp), "attachmentId")
+		env.objectStore.putObject(objectKey, body, "")
+		status, _, _, completeResp := env.doJSON(http.MethodPost, "/v1/attachments/"+attachmentID+"/complete", ownerATokenDeviceA, map[string]any{
+			"checksum":  hex.EncodeToString(sum[:]),
+			"sizeBytes": len(body),
+		})
+		if status != http.StatusOK {
+			t.Fatalf("attachment complete failed: status=%d body=%v", status, completeResp)
+		}
+
+		status, _, _, jobResp := env.doJSON(http.MethodGet, "/v1/attachments/"+attachmentID+"/preview-job", ownerATokenDeviceA, nil)
+		if status != http.StatusOK || getString(t, asMap(t, jobResp), "status") != "queued" {
+			t.Fatalf("expected queued preview job after completion: status=%d body=%v", status, jobResp)
+		}
+
+		status, _, _, processResp := env.doJSON(http.MethodPost, "/v1/ops/previews/process", adminToken, map[string]any{"limit": 500})
+		if status != http.StatusOK {
+			t.Fatalf("process previews failed: status=%d body=%v", status, processResp)
+		}
+
+		status, _, _, jobResp = env.doJSON(http.MethodGet, "/v1/attachments/"+attachmentID+"/preview-job", ownerATokenDeviceA, nil)
+		if status != http.StatusOK || getString(t, asMap(t, jobResp), "status") != "succeeded" {
+			t.Fatalf("expected succeeded preview job: status=%d body=%v", status, jobResp)
+		}
+
+		status, _, _, previewResp := env.doJSON(http.MethodGet, "/v1/attachments/"+attachmentID+"/preview", ownerATokenDeviceA, nil)
+		if status != http.StatusOK {
+			t.Fatalf("get preview failed: status=%d body=%v", status, previewResp)
+		}
+		preview := asMap(t, previewResp)
+		if width, _ := preview["width"].(float64); width != 256 {
+			t.Fatalf("expected thumbnail scaled to 256px wide, got %v", preview)
+		}
+
+		// The source is 640px wide, so no large rendition exists and the
+		// request falls back to the native-size medium rendition.
+		status, _, _, previewResp = env.doJSON(http.MethodGet, "/v1/attachments/"+attachmentID+"/preview?size=large", ownerATokenDeviceA, nil)
+		if status != http.StatusOK {
+			t.Fatalf("get large preview failed: status=%d body=%v", status, previewResp)
+		}
+		preview = asMap(t, previewResp)
+		if getString(t, preview, "previewType") != "medium" {
+			t.Fatalf("expected medium rendition fallback, got %v", preview["previewType"])
+		}
+		if width, _ := preview["width"].(float64); width != 640 {
+			t.Fatalf("expected medium rendition at native 640px, got %v", preview["width"])
+		}
+
+		status, _, _, _ = env.doJSON(http.MethodGet, "/v1/attachments/"+attachmentID+"/preview?size=huge", ownerATokenDeviceA, nil)
+		if status != http.StatusBadRequest {
+			t.Fatalf("expected 400 for unknown rendition, got %d", status)
+		}
+	})
+
+	t.Run("ScientificImagePreviews", func(t *testing.T) {
+		experimentID := getString(t, env.createExperiment(ownerATokenDeviceA, "Microscopy previews", "original"), "experimentId")
+
+		uploadTIFF := func(name string, body []byte) string {
+			t.Helper()
+			objectKey := fmt.Sprintf("previews/%d/%s", now, name)
+			status, _, _, initiateResp := env.doJSON(http.MethodPost, "/v1/attachments/initiate", ownerATokenDeviceA, map[string]any{
+				"experimentId": experimentID,
+				"objectKey":    objectKey,
+				"sizeBytes":    len(body),
+				"mimeType":     "image/tiff",
+			})
+			if status != http.StatusCreated {
+				t.Fatalf("attachment initiate failed: status=%d body=%v", status, initiateResp)
+			}
+			attachmentID := getString(t, asMap(t, initiateResp), "attachmentId")
+			env.objectStore.putObject(objectKey, body, "")
+			sum := sha256.Sum256(body)
+			status, _, _, completeResp := env.doJSON(http.MethodPost, "/v1/attachments/"+attachmentID+"/complete", ownerATokenDeviceA, map[string]any{
+				"checksum":  hex.EncodeToString(sum[:]),
+				"sizeBytes": len(body),
+			})
+			if status != http.StatusOK {
+				t.Fatalf("attachment complete failed: status=%d body=%v", status, completeResp)
+			}
+			return attachmentID
+		}
+		decodePNG := func(data []byte) image.Image {
+			t.Helper()
+			img, err := png.Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("decode preview png: %v", err)
+			}
+			return img
+		}
+		gray := func(img image.Image, x, y int) uint8 {
+			return color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y
+		}
+
+		// A 16-bit ramp: the display window is the 0.5th to 99.5th
+		// percentile, here 1000 to 7000, so 8000 saturates.
+		rampID := uploadTIFF("ramp.tif", encodeGray16TIFF(4, 2, [][]uint16{{1000, 2000, 3000, 4000, 5000, 6000, 7000, 8000}}))
+		// A three-frame stack with one bright pixel per frame, in a
+		// different place on each.
+		stackID := uploadTIFF("stack.tif", encodeGray16TIFF(2, 2, [][]uint16{
+			{60000, 100, 100, 100},
+			{100, 60000, 100, 100},
+			{100, 100, 60000, 100},
+		}))
+
+		status, _, _, processResp := env.doJSON(http.MethodPost, "/v1/ops/previews/process", adminToken, map[string]any{"limit": 500})
+		if status != http.StatusOK {
+			t.Fatalf("process previews failed: status=%d body=%v", status, processResp)
+		}
+
+		status, _, _, previewResp := env.doJSON(http.MethodGet, "/v1/attachments/"+rampID+"/preview", ownerATokenDeviceA, nil)
+		if status != http.StatusOK {
+			t.Fatalf("get ramp preview failed: status=%d body=%v", status, previewResp)
+		}
+		preview := asMap(t, previewResp)
+		meta := asMap(t, preview["imageMetadata"])
+		if meta["format"] != "tiff" || meta["bitDepth"] != float64(16) || meta["pageCount"] != float64(1) {
+			t.Fatalf("expected 16-bit single-page tiff metadata, got %v", meta)
+		}
+		if meta["displayMin"] != float64(1000) || meta["displayMax"] != float64(7000) {
+			t.Fatalf("expected display window 1000..7000, got %v..%v", meta["displayMin"], meta["displayMax"])
+		}
+		data, err := base64.StdEncoding.DecodeString(getString(t, preview, "dataBase64"))
+		if err != nil {
+			t.Fatalf("decode thumbnail data: %v", err)
+		}
+		thumb := decodePNG(data)
+		for _, want := range []struct {
+			x, y  int
+			value uint8
+		}{{0, 0, 0}, {3, 0, 128}, {2, 1, 255}, {3, 1, 255}} {
+			if got := gray(thumb, want.x, want.y); got != want.value {
+				t.Fatalf("expected windowed pixel (%d,%d) = %d, got %d", want.x, want.y, want.value, got)
+			}
+		}
+
+		status, _, _, previewResp = env.doJSON(http.MethodGet, "/v1/attachments/"+stackID+"/preview", ownerATokenDeviceA, nil)
+		if status != http.StatusOK {
+			t.Fatalf("get stack preview failed: status=%d body=%v", status, previewResp)
+		}
+		if pages := asMap(t, asMap(t, previewResp)["imageMetadata"])["pageCount"]; pages != float64(3) {
+			t.Fatalf("expected a three-page stack, got pageCount=%v", pages)
+		}
+		// The experiment listing carries only thumbnails inline; pages are
+		// fetched from their href.
+		status, _, _, listResp := env.doJSON(http.MethodGet, "/v1/experiments/"+experimentID+"/previews", ownerATokenDeviceA, nil)
+		if status != http.StatusOK {
+			t.Fatalf("list previews failed: status=%d body=%v", status, listResp)
+		}
+		hrefs := map[string]string{}
+		for _, item := range asSlice(t, asMap(t, listResp)["previews"]) {
+			p := asMap(t, item)
+			inline := p["dataBase64"] != nil || p["url"] != nil
+			if p["previewType"] == "thumbnail" {
+				if !inline {
+					t.Fatalf("expected the thumbnail listed with its bytes, got %v", p)
+				}
+				continue
+			}
+			if inline || p["href"] == nil || p["sizeBytes"] == float64(0) {
+				t.Fatalf("expected %v listed by size and href only, got %v", p["previewType"], p)
+			}
+			if getString(t, p, "attachmentId") == stackID {
+				hrefs[getString(t, p, "previewType")] = getString(t, p, "href")
+			}
+		}
+		for page, bright := range []image.Point{{0, 0}, {1, 0}, {0, 1}} {
+			href, ok := hrefs[fmt.Sprintf("page-%d", page+1)]
+			if !ok {
+				t.Fatalf("expected page-%d in the listing, got %v", page+1, hrefs)
+			}
+			status, _, _, pageResp := env.doJSON(http.MethodGet, href, ownerATokenDeviceA, nil)
+			if status != http.StatusOK {
+				t.Fatalf("get page-%d preview failed: status=%d body=%v", page+1, status, pageResp)
+			}
+			pageData, err := base64.StdEncoding.DecodeString(getString(t, asMap(t, pageResp), "dataBase64"))
+			if err != nil {
+				t.Fatalf("decode page-%d data: %v", page+1, err)
+			}
+			frame := decodePNG(pageData)
+			for y := 0; y < 2; y++ {
+				for x := 0; x < 2; x++ {
+					want := uint8(0)
+					if (image.Point{x, y}) == bright {
+						want = 255
+					}
+					if got := gray(frame, x, y); got != want {
+						t.Fatalf("page-%d: expected pixel (%d,%d) = %d, got %d", page+1, x, y, want, got)
+					}
+				}
+			}
+		}
+	})
+
+	t.Run("TextualPreviews", func(t *testing.T) {
+		exp := env.createExperiment(ownerATokenDeviceA, "Textual previews", "original")
+		experimentID := getString(t, exp, "experimentId")
+
+		body := []byte(">seq1 plasmid fragment\nACGTGC\nGG\n>seq2\nATAT\n")
+		sum := sha256.Sum256(body)
+		objectKey := fmt.Sprintf("previews/%d/construct.fasta", now)
+		status, _, _, initiateResp := env.doJSON(http.MethodPost, "/v1/attachments/initiate", ownerATokenDeviceA, map[string]any{
+			"experimentId": experimentID,
+			"objectKey":    objectKey,
+			"sizeBytes":    len(body),
+			"mimeType":     "text/plain",
+		})
+		if status != http.StatusCreated {
+			t.Fatalf("attachment initiate failed: status=%d body=%v", status, initiateResp)
+		}
+		attachmentID := getString(t, asMap(t, initiateResp), "attachmentId")
+		env.objectStore.putObject(objectKey, body, "")
+		status, _, _, completeResp := env.doJSON(http.MethodPost, "/v1/attachments/"+attachmentID+"/complete", ownerATokenDeviceA, map[string]any{
+			"checksum":  hex.EncodeToString(sum[:]),
+			"sizeBytes": len(body),
+		})
+		if status != http.StatusOK {
+			t.Fatalf("attachment complete failed: status=%d body=%v", status, completeResp)
+		}
+
+		status, _, _, processResp := env.doJSON(http.MethodPost, "/v1/ops/previews/process", adminToken, map[string]any{"limit": 500})
+		if status != http.StatusOK {
+			t.Fatalf("process previews failed: status=%d body=%v", status, processResp)
+		}
+
+		status, _, _, listResp := env.doJSON(http.MethodGet, "/v1/experiments/"+experimentID+"/previews", ownerATokenDeviceA, nil)
+		if status != http.StatusOK {
+			t.Fatalf("list previews failed: status=%d body=%v", status, listResp)
+		}
+		previewList := asSlice(t, asMap(t, listResp)["previews"])
+		if len(previewList) != 1 {
+			t.Fatalf("expected one sequence preview, got %v", listResp)
+		}
+		preview := asMap(t, previewList[0])
+		if getString(t, preview, "previewType") != "sequence" {
+			t.Fatalf("expected sequence preview, got %v", preview)
+		}
+		content := asMap(t, preview["content"])
+		if count, _ := content["recordCount"].(float64); count != 2 {
+			t.Fatalf("expected 2 FASTA records, got %v", content)
+		}
+		if gc, _ := content["gcPercent"].(float64); gc < 58 || gc > 59 {
+			t.Fatalf("expected GC%% of 7/12, got %v", content["gcPercent"])
+		}
+	})
+
+	t.Run("DataExtractFullRowsAndChartData", func(t *testing.T) {
+		exp := env.createExperiment(ownerATokenDeviceA, "Full dataset", "original")
+		experimentID := getString(t, exp, "experimentId")
+
+		var csvData strings.Builder
+		csvData.WriteString("time (s),od600\n")
+		for i := 0; i < 2500; i++ {
+			fmt.Fprintf(&csvData, "%d,%d\n", i, i%97)
+		}
+		status, _, _, extractResp := env.doJSON(http.MethodPost, "/v1/data/parse-csv", ownerATokenDeviceA, map[string]any{
+			"experimentId": experimentID,
+			"csvData":      csvData.String(),
+		})
+		if status != http.StatusCreated {
+			t.Fatalf("parse csv failed: status=%d body=%v", status, extractResp)
+		}
+		extract := asMap(t, extractResp)
+		extractID := getString(t, extract, "dataExtractId")
+		if extract["rowsStored"] != true || len(asSlice(t, extract["sampleRows"])) != 100 {
+			t.Fatalf("expected full rows stored with a 100-row sample, got rowsStored=%v", extract["rowsStored"])
+		}
+
+		status, _, _, getResp := env.doJSON(http.MethodGet, "/v1/data/extracts/"+extractID, ownerATokenDeviceA, nil)
+		if status != http.StatusOK {
+			t.Fatalf("get extract failed: status=%d body=%v", status, getResp)
+		}
+		columns := asSlice(t, asMap(t, getResp)["columns"])
+		timeColumn := asMap(t, columns[0])
+		if timeColumn["type"] != "integer" || timeColumn["unit"] != "s" || timeColumn["label"] != "time" {
+			t.Fatalf("expected integer time column in seconds, got %v", timeColumn)
+		}
+		if timeColumn["count"] != float64(2500) || timeColumn["max"] != float64(2499) {
+			t.Fatalf("expected statistics over all 2500 rows, got %v", timeColumn)
+		}
+
+		// An extract parsed before profiling existed is profiled on its
+		// first read and keeps the result.
+		if _, err := env.db.Exec(`UPDATE data_extracts SET column_profiles = '[]' WHERE id = $1`, extractID); err != nil {
+			t.Fatalf("clear column profiles: %v", err)
+		}
+		status, _, _, getResp = env.doJSON(http.MethodGet, "/v1/data/extracts/"+extractID, ownerATokenDeviceA, nil)
+		if status != http.StatusOK {
+			t.Fatalf("get unprofiled extract failed: status=%d body=%v", status, getResp)
+		}
+		if got := asMap(t, asSlice(t, asMap(t, getResp)["columns"])[0]); got["count"] != float64(2500) {
+			t.Fatalf("expected the unprofiled extract to be profiled over all rows, got %v", got)
+		}
+		var storedProfiles int
+		if err := env.db.QueryRow(`SELECT jsonb_array_length(column_profiles) FROM data_extracts WHERE id = $1`, extractID).Scan(&storedProfiles); err != nil {
+			t.Fatalf("read stored column profiles: %v", err)
+		}
+		if storedProfiles != len(columns) {
+			t.Fatalf("expected %d column profiles to be stored after the first read, got %d", len(columns), storedProfiles)
+		}
+
+		// The page spans the boundary between the second and third chunk.
+		status, _, _, rowsResp := env.doJSON(http.MethodGet, "/v1/data/extracts/"+extractID+"/rows?offset=1990&limit=20", ownerATokenDeviceA, nil)
+		if status != http.StatusOK {
+			t.Fatalf("get extract rows failed: status=%d body=%v", status, rowsResp)
+		}
+		page := asMap(t, rowsResp)
+		rows := asSlice(t, page["rows"])
+		if len(rows) != 20 || page["totalRows"] != float64(2500) {
+			t.Fatalf("expected 20 of 2500 rows, got %d of %v", len(rows), page["totalRows"])
+		}
+		if first := asSlice(t, rows[0]); first[0] != "1990" {
+			t.Fatalf("expected page to start at row 1990, got %v", first)
+		}
+
+		status, _, _, chartResp := env.doJSON(http.MethodPost, "/v1/charts", ownerATokenDeviceA, map[string]any{
+			"experimentId":  experimentID,
+			"dataExtractId": extractID,
+			"chartType":     "line",
+			"xColumn":       "time (s)",
+			"yColumns":      []string{"od600"},
+		})
+		if status != http.StatusCreated {
+			t.Fatalf("create chart failed: status=%d body=%v", status, chartResp)
+		}
+		chartID := getString(t, asMap(t, chartResp), "chartConfigId")
+
+		status, _, _, dataResp := env.doJSON(http.MethodGet, "/v1/charts/"+chartID+"/data", ownerATokenDeviceA, nil)
+		if status != http.StatusOK {
+			t.Fatalf("get chart data failed: status=%d body=%v", status, dataResp)
+		}
+		series := asMap(t, asSlice(t, asMap(t, dataResp)["series"])[0])
+		if n := len(asSlice(t, series["y"])); n != 2500 {
+			t.Fatalf("expected the complete series of 2500 points, got %d", n)
+		}
+
+		status, _, _, dataResp = env.doJSON(http.MethodGet, "/v1/charts/"+chartID+"/data?maxPoints=200", ownerATokenDeviceA, nil)
+		if status != http.StatusOK {
+			t.Fatalf("get downsampled chart data failed: status=%d body=%v", status, dataResp)
+		}
+		data := asMap(t, dataResp)
+		series = asMap(t, asSlice(t, data["series"])[0])
+		if n := len(asSlice(t, series["y"])); n != 200 || data["downsampled"] != true {
+			t.Fatalf("expected 200 downsampled points, got %d (downsampled=%v)", n, data["downsampled"])
+		}
+
+		status, headers, raw, _ := env.doJSON(http.MethodGet, "/v1/charts/"+chartID+"/image?format=png&width=640&height=400", ownerATokenDeviceA, nil)
+		if status != http.StatusOK || headers.Get("Content-Type") != "image/png" || !bytes.HasPrefix(raw, []byte("\x89PNG\r\n\x1a\n")) {
+			t.Fatalf("expected a png chart image, got status=%d type=%q", status, headers.Get("Content-Type"))
+		}
+		status, headers, raw, _ = env.doJSON(http.MethodGet, "/v1/charts/"+chartID+"/image", ownerATokenDeviceA, nil)
+		if status != http.StatusOK || headers.Get("Content-Type") != "image/svg+xml" || !bytes.Contains(raw, []byte("<polyline")) {
+			t.Fatalf("expected an svg chart image with the series line, got status=%d type=%q", status, headers.Get("Content-Type"))
+		}
+
+		status, _, _, exportResp := env.doJSON(http.MethodGet, "/v1/ops/forensic/export?experimentId="+experimentID, adminToken, nil)
+		if status != http.StatusOK {
+			t.Fatalf("forensic export failed: status=%d body=%v", status, exportResp)
+		}
+		var exported map[string]any
+		for _, c := range asSlice(t, asMap(t, exportResp)["charts"]) {
+			if chart := asMap(t, c); chart["chartConfigId"] == chartID {
+				exported = chart
+			}
+		}
+		if exported == nil {
+			t.Fatalf("expected chart %s in the forensic export", chartID)
+		}
+		if svg, _ := exported["svg"].(string); !strings.HasPrefix(svg, "<svg") || !strings.Contains(svg, "<polyline") {
+			t.Fatalf("expected the forensic export to embed the rendered svg, got %v", exported)
+		}
+
+		// A blank x cell drops its point rather than making the axis
+		// categorical.
+		status, _, _, extractResp = env.doJSON(http.MethodPost, "/v1/data/parse-csv", ownerATokenDeviceA, map[string]any{
+			"experimentId": experimentID,
+			"csvData":      "time (s),od600\n0,0.1\n,0.2\n2,0.3\n",
+		})
+		if status != http.StatusCreated {
+			t.Fatalf("parse csv with a blank x failed: status=%d body=%v", status, extractResp)
+		}
+		status, _, _, chartResp = env.doJSON(http.MethodPost, "/v1/charts", ownerATokenDeviceA, map[string]any{
+			"experimentId":  experimentID,
+			"dataExtractId": getString(t, asMap(t, extractResp), "dataExtractId"),
+			"chartType":     "line",
+			"xColumn":       "time (s)",
+			"yColumns":      []string{"od600"},
+		})
+		if status != http.StatusCreated {
+			t.Fatalf("create chart failed: status=%d body=%v", status, chartResp)
+		}
+		status, _, _, dataResp = env.doJSON(http.MethodGet, "/v1/charts/"+getString(t, asMap(t, chartResp), "chartConfigId")+"/data", ownerATokenDeviceA, nil)
+		if status != http.StatusOK {
+			t.Fatalf("get chart data failed: status=%d body=%v", status, dataResp)
+		}
+		data = asMap(t, dataResp)
+		series = asMap(t, asSlice(t, data["series"])[0])
+		if data["xNumeric"] != true || len(asSlice(t, series["x"])) != 2 || series["skippedRows"] != float64(1) {
+			t.Fatalf("expected a numeric x axis without the blank row, got %v", data)
+		}
+	})
+
+	t.Run("ChartSpecValidationAndTypes", func(t *testing.T) {
+		exp := env.createExperiment(ownerATokenDeviceA, "Plate chart specs", "original")
+		experimentID := getString(t, exp, "experimentId")
+
+		csvData := "row,column,od600 (AU),treatment,day\n" +
+			"A,1,0.10,ctrl,1\nA,2,0.20,ctrl,1\nA,3,0.00,drug,1\nB,1,0.30,ctrl,1\nB,2,0.40,drug,1\nB,3,0.50,drug,1\n" +
+			"A,1,0.15,ctrl,2\nA,2,0.25,ctrl,2\nA,3,0.35,drug,2\nB,1,0.45,ctrl,2\nB,2,0.55,drug,2\nB,3,0.65,drug,2\n"
+		status, _, _, extractResp := env.doJSON(http.MethodPost, "/v1/data/parse-csv", ownerATokenDeviceA, map[string]any{
+			"experimentId": experimentID,
+			"csvData":      csvData,
+		})
+		if status != http.StatusCreated {
+			t.Fatalf("parse csv failed: status=%d body=%v", status, extractResp)
+		}
+		extractID := getString(t, asMap(t, extractResp), "dataExtractId")
+		createChart := func(body map[string]any) (int, any) {
+			body["experimentId"] = experimentID
+			body["dataExtractId"] = extractID
+			status, _, _, resp := env.doJSON(http.MethodPost, "/v1/charts", ownerATokenDeviceA, body)
+			return status, resp
+		}
+
+		for name, body := range map[string]map[string]any{
+			"categorical y":      {"chartType": "line", "xColumn": "column", "yColumns": []string{"treatment"}},
+			"log y with zero":    {"chartType": "scatter", "xColumn": "column", "yColumns": []string{"od600 (AU)"}, "spec": map[string]any{"yAxis": map[string]any{"scale": "log"}}},
+			"heatmap no rows":    {"chartType": "heatmap", "xColumn": "column", "yColumns": []string{"od600 (AU)"}},
+			"unknown spec field": {"chartType": "line", "xColumn": "column", "yColumns": []string{"od600 (AU)"}, "spec": map[string]any{"colour": "red"}},
+		} {
+			if status, resp := createChart(body); status != http.StatusBadRequest {
+				t.Fatalf("expected %s chart to be rejected, got status=%d body=%v", name, status, resp)
+			}
+		}
+
+		status, resp := createChart(map[string]any{
+			"chartType": "heatmap", "title": "OD600 by well", "xColumn": "column", "yColumns": []string{"od600 (AU)"},
+			"spec": map[string]any{"rowColumn": "row", "facetBy": "day"},
+		})
+		if status != http.StatusCreated {
+			t.Fatalf("create heatmap failed: status=%d body=%v", status, resp)
+		}
+		heatmapID := getString(t, asMap(t, resp), "chartConfigId")
+		status, _, _, dataResp := env.doJSON(http.MethodGet, "/v1/charts/"+heatmapID+"/data", ownerATokenDeviceA, nil)
+		if status != http.StatusOK {
+			t.Fatalf("get heatmap data failed: status=%d body=%v", status, dataResp)
+		}
+		series := asSlice(t, asMap(t, dataResp)["series"])
+		if len(series) != 2 || asMap(t, series[1])["facet"] != "2" {
+			t.Fatalf("expected one heatmap per day, got %v", series)
+		}
+		cells := asMap(t, asMap(t, series[1])["cells"])
+		if row := asSlice(t, asSlice(t, cells["values"])[1]); row[2] != 0.65 {
+			t.Fatalf("expected B3 of day 2 to be 0.65, got %v", row)
+		}
+
+		status, resp = createChart(map[string]any{
+			"chartType": "box", "xColumn": "treatment", "yColumns": []string{"od600 (AU)"},
+			"spec": map[string]any{"groupBy": "day", "yAxis": map[string]any{"label": "Optical density"}},
+		})
+		if status != http.StatusCreated {
+			t.Fatalf("create box chart failed: status=%d body=%v", status, resp)
+		}
+		boxID := getString(t, asMap(t, resp), "chartConfigId")
+		status, _, _, dataResp = env.doJSON(http.MethodGet, "/v1/charts/"+boxID+"/data", ownerATokenDeviceA, nil)
+		if status != http.StatusOK {
+			t.Fatalf("get box chart data failed: status=%d body=%v", status, dataResp)
+		}
+		data := asMap(t, dataResp)
+		if yAxis := asMap(t, data["yAxis"]); yAxis["label"] != "Optical density" || yAxis["unit"] != "AU" {
+			t.Fatalf("expected the spec label with the header unit, got %v", yAxis)
+		}
+		first := asMap(t, asSlice(t, data["series"])[0])
+		if first["group"] != "1" || len(asSlice(t, first["boxes"])) != 2 {
+			t.Fatalf("expected day 1 boxes for both treatments, got %v", first)
+		}
+		status, headers, _, _ := env.doJSON(http.MethodGet, "/v1/charts/"+boxID+"/image?format=png", ownerATokenDeviceA, nil)
+		if status != http.StatusOK || headers.Get("Content-Type") != "image/png" {
+			t.Fatalf("expected a png box plot, got status=%d", status)
+		}
+
+		// Older clients send the spec as options, with keys a spec lacks.
+		status, resp = createChart(map[string]any{
+			"chartType": "scatter", "xColumn": "column", "yColumns": []string{"od600 (AU)"},
+			"options": map[string]any{"yAxis": map[string]any{"label": "OD"}, "showLegend": true},
+		})
+		if status != http.StatusCreated {
+			t.Fatalf("create chart with legacy options failed: status=%d body=%v", status, resp)
+		}
+		legacyID := getString(t, asMap(t, resp), "chartConfigId")
+		if status, resp := createChart(map[string]any{
+			"chartType": "scatter", "xColumn": "column", "yColumns": []string{"od600 (AU)"},
+			"spec": map[string]any{}, "options": map[string]any{},
+		}); status != http.StatusBadRequest {
+			t.Fatalf("expected spec with options to be rejected, got status=%d body=%v", status, resp)
+		}
+		status, _, _, listResp := env.doJSON(http.MethodGet, "/v1/charts?experimentId="+experimentID, ownerATokenDeviceA, nil)
+		if status != http.StatusOK {
+			t.Fatalf("list charts failed: status=%d body=%v", status, listResp)
+		}
+		found := false
+		for _, c := range asSlice(t, asMap(t, listResp)["charts"]) {
+			chart := asMap(t, c)
+			if chart["chartConfigId"] != legacyID {
+				continue
+			}
+			found = true
+			for _, field := range []string{"spec", "options"} {
+				if label := asMap(t, asMap(t, chart[field])["yAxis"])["label"]; label != "OD" {
+					t.Fatalf("expected %s.yAxis.label OD, got %v", field, chart[field])
+				}
+			}
+		}
+		if !found {
+			t.Fatalf("expected chart %s in the listing, got %v", legacyID, listResp)
+		}
+	})
+
+	t.Run("ChartImagesWithExtremeValues", func(t *testing.T) {
+		exp := env.createExperiment(ownerATokenDeviceA, "Extreme values", "original")
+		experimentID := getString(t, exp, "experimentId")
+
+		// The spans and the y ± error sums overflow float64.
+		csvData := "x,y,err\n0,-1e308,1e308\n1,0,1e308\n2,1e308,1e308\n"
+		status, _, _, extractResp := env.doJSON(http.MethodPost, "/v1/data/parse-csv", ownerATokenDeviceA, map[string]any{
+			"experimentId": experimentID,
+			"csvData":      csvData,
+		})
+		if status != http.StatusCreated {
+			t.Fatalf("parse csv failed: status=%d body=%v", status, extractResp)
+		}
+		extractID := getString(t, asMap(t, extractResp), "dataExtractId")
+
+		for _, body := range []map[string]any{
+			{"chartType": "line", "xColumn": "x", "yColumns": []string{"y"}, "spec": map[string]any{"errorColumns": []string{"err"}}},
+			{"chartType": "histogram", "yColumns": []string{"y"}},
+		} {
+			body["experimentId"] = experimentID
+			body["dataExtractId"] = extractID
+			status, _, _, resp := env.doJSON(http.MethodPost, "/v1/charts", ownerATokenDeviceA, body)
+			if status != http.StatusCreated {
+				t.Fatalf("create %v chart failed: status=%d body=%v", body["chartType"], status, resp)
+			}
+			chartID := getString(t, asMap(t, resp), "chartConfigId")
+			for _, format := range []string{"svg", "png"} {
+				status, _, raw, _ := env.doJSON(http.MethodGet, "/v1/charts/"+chartID+"/image?format="+format, ownerATokenDeviceA, nil)
+				if status != http.StatusOK || len(raw) == 0 {
+					t.Fatalf("expected a %s %v chart, got status=%d", format, body["chartType"], status)
+				}
+				if format == "svg" && (bytes.Contains(raw, []byte("NaN")) || bytes.Contains(raw, []byte("Inf"))) {
+					t.Fatalf("expected finite coordinates in the %v chart svg", body["chartType"])
+				}
+			}
+		}
+	})
+
+	t.Run("DataExtractDelimitedAndWorkbookSources", func(t *testing.T) {
+		exp := env.createExperiment(ownerATokenDeviceA, "Instrument exports", "original")
+		experimentID := getString(t, exp, "experimentId")
+
+		status, _, _, resp := env.doJSON(http.MethodPost, "/v1/data/parse", ownerATokenDeviceA, map[string]any{
+			"experimentId": experimentID,
+			"data":         "Instrument: Reader 5\nOperator;A. Lab\n\nwell;od600;temp (C)\nA1;0,51;37\nA2;0,73;37\n",
+		})
+		if status != http.StatusCreated {
+			t.Fatalf("parse semicolon data failed: status=%d body=%v", status, resp)
+		}
+		extracts := asSlice(t, asMap(t, resp)["dataExtracts"])
+		extract := asMap(t, extracts[0])
+		if len(extracts) != 1 || extract["headerRow"] != float64(4) || extract["sourceFormat"] != "csv" {
+			t.Fatalf("expected one csv extract with the header on line 4, got %v", resp)
+		}
+		if od := asMap(t, asSlice(t, extract["columns"])[1]); od["type"] != "numeric" {
+			t.Fatalf("expected decimal commas to parse as numbers, got %v", od)
+		}
+
+		// A number among dates makes the column categorical, not a
+		// datetime starting at year one.
+		status, _, _, resp = env.doJSON(http.MethodPost, "/v1/data/parse", ownerATokenDeviceA, map[string]any{
+			"experimentId": experimentID,
+			"data":         "mixed,dated\n1,2026-01-01\n2026-01-01,2026-03-01\n",
+		})
+		if status != http.StatusCreated {
+			t.Fatalf("parse mixed dates failed: status=%d body=%v", status, resp)
+		}
+		columns := asSlice(t, asMap(t, asSlice(t, asMap(t, resp)["dataExtracts"])[0])["columns"])
+		if mixed := asMap(t, columns[0]); mixed["type"] != "categorical" || mixed["minTime"] != nil {
+			t.Fatalf("expected the mixed column to be categorical, got %v", mixed)
+		}
+		if dated := asMap(t, columns[1]); dated["type"] != "datetime" || !strings.HasPrefix(getString(t, dated, "minTime"), "2026-01-01") {
+			t.Fatalf("expected a datetime column from 2026-01-01, got %v", dated)
+		}
+
+		var workbook bytes.Buffer
+		zw := zip.NewWriter(&workbook)
+		for name, body := range map[string]string{
+			"xl/workbook.xml": `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+				`<sheets><sheet name="Plate 1" sheetId="1" r:id="rId1"/><sheet name="Plate 2" sheetId="2" r:id="rId2"/></sheets></workbook>`,
+			"xl/_rels/workbook.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+				`<Relationship Id="rId1" Target="worksheets/sheet1.xml"/><Relationship Id="rId2" Target="worksheets/sheet2.xml"/></Relationships>`,
+			"xl/worksheets/sheet1.xml": `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>` +
+				`<row r="1"><c r="A1" t="inlineStr"><is><t>well</t></is></c><c r="B1" t="inlineStr"><is><t>signal</t></is></c></row>` +
+				`<row r="2"><c r="A2" t="inlineStr"><is><t>A1</t></is></c><c r="B2"><v>1.5</v></c></row></sheetData></worksheet>`,
+			"xl/worksheets/sheet2.xml": `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>` +
+				`<row r="1"><c r="A1" t="inlineStr"><is><t>well</t></is></c><c r="B1" t="inlineStr"><is><t>signal</t></is></c></row>` +
+				`<row r="2"><c r="A2" t="inlineStr"><is><t>B1</t></is></c><c r="B2"><v>2.5</v></c></row></sheetData></worksheet>`,
+		} {
+			w, err := zw.Create(name)
+			if err != nil {
+				t.Fatalf("create workbook part: %v", err)
+			}
+			w.Write([]byte(body))
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatalf("close workbook: %v", err)
+		}
+
+		status, _, _, resp = env.doJSON(http.MethodPost, "/v1/data/parse", ownerATokenDeviceA, map[string]any{
+			"experimentId": experimentID,
+			"dataBase64":   base64.StdEncoding.EncodeToString(workbook.Bytes()),
+		})
+		if status != http.StatusCreated {
+			t.Fatalf("parse workbook failed: status=%d body=%v", status, resp)
+		}
+		extracts = asSlice(t, asMap(t, resp)["dataExtracts"])
+		if len(extracts) != 2 || asMap(t, extracts[1])["sheetName"] != "Plate 2" || asMap(t, extracts[1])["sourceFormat"] != "xlsx" {
+			t.Fatalf("expected one xlsx extract per sheet, got %v", resp)
+		}
+
+		// One cell in the last column of each row would pad every row to
+		// 16384 cells; past the cell limit the upload is rejected.
+		var sparseSheet strings.Builder
+		sparseSheet.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+		for r := 1; r <= 1100; r++ {
+			fmt.Fprintf(&sparseSheet, `<row r="%d"><c r="XFD%d"><v>1</v></c></row>`, r, r)
+		}
+		sparseSheet.WriteString(`</sheetData></worksheet>`)
+		var sparse bytes.Buffer
+		zw = zip.NewWriter(&sparse)
+		for name, body := range map[string]string{
+			"xl/workbook.xml": `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+				`<sheets><sheet name="Sparse" sheetId="1" r:id="rId1"/></sheets></workbook>`,
+			"xl/_rels/workbook.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+				`<Relationship Id="rId1" Target="worksheets/sheet1.xml"/></Relationships>`,
+			"xl/worksheets/sheet1.xml": sparseSheet.String(),
+		} {
+			w, err := zw.Create(name)
+			if err != nil {
+				t.Fatalf("create workbook part: %v", err)
+			}
+			w.Write([]byte(body))
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatalf("close workbook: %v", err)
+		}
+		// A header 16384 columns wide over many one-value lines pads the
+		// same way.
+		wide := strings.Repeat("h,", 16383) + "h\n" + strings.Repeat("1\n", 1100)
+		for name, body := range map[string]map[string]any{
+			"sparse workbook": {"dataBase64": base64.StdEncoding.EncodeToString(sparse.Bytes())},
+			"wide csv":        {"data": wide},
+		} {
+			body["experimentId"] = experimentID
+			if status, _, _, resp := env.doJSON(http.MethodPost, "/v1/data/parse", ownerATokenDeviceA, body); status != http.StatusBadRequest {
+				t.Fatalf("expected the %s to exceed the cell limit, got status=%d body=%v", name, status, resp)
+			}
+		}
+
+		status, _, _, resp = env.doJSON(http.MethodPost, "/v1/data/parse", ownerBToken, map[string]any{
+			"experimentId": experimentID,
+			"data":         "a,b\n1,2\n",
+		})
+		if status != http.StatusForbidden {
+			t.Fatalf("expected non-owner parse to be forbidden, got status=%d body=%v", status, resp)
+		}
+	})
+
+	t.Run("PlateReaderExtractWithLayout", func(t *testing.T) {
+		exp := env.createExperiment(ownerATokenDeviceA, "ELISA plate", "original")
+		experimentID := getString(t, exp, "experimentId")
+
+		status, _, _, layoutResp := env.doJSON(http.MethodPost, "/v1/data/plate-layouts", ownerATokenDeviceA, map[string]any{
+			"experimentId": experimentID,
+			"name":         "Standard curve",
+			"plateFormat":  96,
+			"assignments": []map[string]any{
+				{"wells": "A1:A2", "role": "standard", "group": "S1", "concentration": 100},
+				{"wells": "H12", "role": "blank"},
+			},
+		})
+		if status != http.StatusCreated {
+			t.Fatalf("create plate layout failed: status=%d body=%v", status, layoutResp)
+		}
+		layoutID := getString(t, asMap(t, layoutResp), "plateLayoutId")
+
+		var export strings.Builder
+		export.WriteString("Reader export\n\nAbsorbance 450nm\n,1,2,3,4,5,6,7,8,9,10,11,12\n")
+		for r := 0; r < 8; r++ {
+			export.WriteString(string(rune('A' + r)))
+			for c := 0; c < 12; c++ {
+				fmt.Fprintf(&export, ",%.2f", float64(r*12+c)/100)
+			}
+			export.WriteString("\n")
+		}
+		status, _, _, extractResp := env.doJSON(http.MethodPost, "/v1/data/parse-plate", ownerATokenDeviceA, map[string]any{
+			"experimentId":  experimentID,
+			"data":          export.String(),
+			"plateLayoutId": layoutID,
+		})
+		if status != http.StatusCreated {
+			t.Fatalf("parse plate failed: status=%d body=%v", status, extractResp)
+		}
+		extract := asMap(t, extractResp)
+		if extract["plateFormat"] != float64(96) || extract["rowCount"] != float64(96) || extract["plateLayoutId"] != layoutID {
+			t.Fatalf("expected 96 tidy well rows with the layout applied, got %v", extract)
+		}
+		first := asSlice(t, asSlice(t, extract["sampleRows"])[0])
+		if first[0] != "A1" || first[3] != "Absorbance 450nm" || first[5] != "standard" || first[8] != "100" {
+			t.Fatalf("unexpected first well row: %v", first)
+		}
+
+		status, _, _, resp := env.doJSON(http.MethodPost, "/v1/data/plate-layouts", ownerATokenDeviceA, map[string]any{
+			"experimentId": experimentID,
+			"name":         "Overlapping",
+			"plateFormat":  96,
+			"assignments":  []map[string]any{{"wells": "A1:B2", "role": "sample"}, {"wells": "B2", "role": "blank"}},
+		})
+		if status != http.StatusBadRequest {
+			t.Fatalf("expected overlapping assignments to be rejected, got status=%d body=%v", status, resp)
+		}
+	})
+
+	t.Run("ExtractAnalyses", func(t *testing.T) {
+		exp := env.createExperiment(ownerATokenDeviceA, "Bradford assay", "original")
+		experimentID := getString(t, exp, "experimentId")
+
+		csvData := "sample,role,concentration,absorbance\n" +
+			"std0,standard,0,0.10\nstd1,standard,10,0.20\nstd2,standard,20,0.30\nstd3,standard,40,0.50\n" +
+			"ctrl,sample,,0.25\nctrl,sample,,0.26\nctrl,sample,,0.25\ntreated,sample,,0.40\ntreated,sample,,0.42\ntreated,sample,,0.41\n"
+		status, _, _, extractResp := env.doJSON(http.MethodPost, "/v1/data/parse-csv", ownerATokenDeviceA, map[string]any{
+			"experimentId": experimentID,
+			"csvData":      csvData,
+		})
+		if status != http.StatusCreated {
+			t.Fatalf("parse csv failed: status=%d body=%v", status, extractResp)
+		}
+		extractID := getString(t, asMap(t, extractResp), "dataExtractId")
+
+		status, _, _, resp := env.doJSON(http.MethodPost, "/v1/data/analyses", ownerATokenDeviceA, map[string]any{
+			"experimentId":  experimentID,
+			"dataExtractId": extractID,
+			"analysisType":  "interpolation",
+			"parameters":    map[string]any{"xColumn": "concentration", "yColumn": "absorbance", "labelColumn": "sample"},
+		})
+		if status != http.StatusCreated {
+			t.Fatalf("create interpolation failed: status=%d body=%v", status, resp)
+		}
+		analysis := asMap(t, resp)
+		results := asMap(t, analysis["results"])
+		fit := asMap(t, results["fit"])
+		if fit["rSquared"] != float64(1) {
+			t.Fatalf("expected an exact linear standard curve, got %v", fit)
+		}
+		unknown := asMap(t, asSlice(t, results["unknowns"])[0])
+		if v, ok := unknown["value"].(float64); !ok || v < 14.99 || v > 15.01 {
+			t.Fatalf("expected ctrl to interpolate to 15, got %v", unknown)
+		}
+
+		status, _, _, resp = env.doJSON(http.MethodPost, "/v1/data/analyses", ownerATokenDeviceA, map[string]any{
+			"experimentId":  experimentID,
+			"dataExtractId": extractID,
+			"analysisType":  "t_test",
+			"parameters":    map[string]any{"valueColumn": "absorbance", "groupColumn": "sample", "groupA": "ctrl", "groupB": "treated"},
+		})
+		if status != http.StatusCreated {
+			t.Fatalf("create t-test failed: status=%d body=%v", status, resp)
+		}
+		if p, ok := asMap(t, asMap(t, resp)["results"])["pValue"].(float64); !ok || p <= 0 || p >= 0.05 {
+			t.Fatalf("expected a significant difference, got %v", resp)
+		}
+
+		status, _, _, resp = env.doJSON(http.MethodGet, "/v1/data/analyses?experimentId="+experimentID, ownerATokenDeviceA, nil)
+		if status != http.StatusOK || len(asSlice(t, asMap(t, resp)["analyses"])) != 2 {
+			t.Fatalf("expected two stored analyses, got status=%d body=%v", status, resp)
+		}
+
+		if _, err := env.db.Exec(`UPDATE data_analyses SET results = '{}' WHERE id = $1`, getString(t, analysis, "analysisId")); err == nil {
+			t.Fatalf("expected stored analyses to be immutable")
+		}
+	})
+
+	t.Run("QPCRDeltaDeltaCtAnalysis", func(t *testing.T) {
+		exp := env.createExperiment(ownerATokenDeviceA, "IL6 induction", "original")
+		experimentID := getString(t, exp, "experimentId")
+
+		csvData := "Sample\tTarget\tCt\n" +
+			"ctrl\tGAPDH\t18.0\nctrl\tGAPDH\t18.1\nctrl\tGAPDH\t17.9\n" +
+			"ctrl\tIL6\t28.0\nctrl\tIL6\t28.2\nctrl\tIL6\t27.8\n" +
+			"lps\tGAPDH\t18.0\nlps\tGAPDH\t18.0\nlps\tGAPDH\t19.5\n" +
+			"lps\tIL6\t25.0\nlps\tIL6\tUndetermined\nlps\tIL6\t25.0\n"
+		status, _, _, extractResp := env.doJSON(http.MethodPost, "/v1/data/parse-csv", ownerATokenDeviceA, map[string]any{
+			"experimentId": experimentID,
+			"csvData":      csvData,
+		})
+		if status != http.StatusCreated {
+			t.Fatalf("parse qPCR export failed: status=%d body=%v", status, extractResp)
+		}
+
+		status, _, _, resp := env.doJSON(http.MethodPost, "/v1/data/analyses", ownerATokenDeviceA, map[string]any{
+			"experimentId":  experimentID,
+			"dataExtractId": getString(t, asMap(t, extractResp), "dataExtractId"),
+			"analysisType":  "qpcr_ddct",
+			"parameters": map[string]any{
+				"ctColumn":         "Ct",
+				"sampleColumn":     "Sample",
+				"targetColumn":     "Target",
+				"referenceTargets": []string{"GAPDH"},
+				"controlSample":    "ctrl",
+				"excludeOutliers":  true,
+			},
+		})
+		if status != http.StatusCreated {
+			t.Fatalf("create qPCR analysis failed: status=%d body=%v", status, resp)
+		}
+		results := asMap(t, asMap(t, resp)["results"])
+		var lps map[string]any
+		for _, r := range asSlice(t, results["results"]) {
+			if m := asMap(t, r); m["sample"] == "lps" {
+				lps = m
+			}
+		}
+		// ΔCt(lps) = 25.0 - 18.0 with the 19.5 GAPDH outlier excluded;
+		// ΔCt(ctrl) = 10, so ΔΔCt = -3 and the fold change is 8.
+		if lps == nil || lps["deltaDeltaCt"] != float64(-3) || lps["foldChange"] != float64(8) {
+			t.Fatalf("expected an 8-fold induction for lps, got %v", results)
+		}
+	})
+
+	t.Run("UnifiedSearchTypedHits", func(t *testing.T) {
+		token := fmt.Sprintf("zeocin%d", now)
+		exp := env.createExperiment(ownerATokenDeviceA, "Selection curve", "original")
+		experimentID := getString(t, exp, "experimentId")
+
+		status, _, _, extractResp := env.doJSON(http.MethodPost, "/v1/data/parse-csv", ownerATokenDeviceA, map[string]any{
+			"experimentId": experimentID,
+			"csvData":      "day," + token + " (ug/mL)\n1,50\n2,100\n",
+		})
+		if status != http.StatusCreated {
+			t.Fatalf("parse csv failed: status=%d body=%v", status, extractResp)
+		}
+		extractID := getString(t, asMap(t, extractResp), "dataExtractId")
+
+		status, _, _, templateResp := env.doJSON(http.MethodPost, "/v1/templates", ownerATokenDeviceA, map[string]any{
+			"title":        token + " kill curve",
+			"bodyTemplate": "Day 1",
+		})
+		if status != http.StatusCreated {
+			t.Fatalf("create template failed: status=%d body=%v", status, templateResp)
+		}
+		templateID := getString(t, asMap(t, templateResp), "templateId")
+
+		status, _, _, searchResp := env.doJSON(http.MethodGet, "/v1/search?q="+token, ownerATokenDeviceA, nil)
+		if status != http.StatusOK {
+			t.Fatalf("search failed: status=%d body=%v", status, searchResp)
+		}
+		found := map[string]map[string]any{}
+		for _, h := range asSlice(t, asMap(t, searchResp)["hits"]) {
+			hit := asMap(t, h)
+			found[getString(t, hit, "type")] = hit
+		}
+		if hit := found["dataExtract"]; hit == nil || hit["id"] != extractID || hit["experimentId"] != experimentID ||
+			!strings.Contains(getString(t, hit, "snippet"), token) {
+			t.Fatalf("expected a data extract hit with a header snippet, got %v", searchResp)
+		}
+		if hit := found["template"]; hit == nil || hit["id"] != templateID {
+			t.Fatalf("expected a template hit, got %v", searchResp)
+		}
+
+		status, _, _, searchResp = env.doJSON(http.MethodGet, "/v1/search?q="+token+"&types=template", ownerATokenDeviceA, nil)
+		if status != http.StatusOK {
+			t.Fatalf("filtered search failed: status=%d body=%v", status, searchResp)
+		}
+		if hits := asSlice(t, asMap(t, searchResp)["hits"]); len(hits) != 1 || asMap(t, hits[0])["type"] != "template" {
+			t.Fatalf("expected only the template hit, got %v", hits)
+		}
+
+		status, _, _, searchResp = env.doJSON(http.MethodGet, "/v1/search?q="+token, ownerBToken, nil)
+		if status != http.StatusOK {
+			t.Fatalf("search as other owner failed: status=%d body=%v", status, searchResp)
+		}
+		if hits := asSlice(t, asMap(t, searchResp)["hits"]); len(hits) != 0 {
+			t.Fatalf("expected no hits on another owner's records, got %v", hits)
+		}
+
+		status, _, _, _ = env.doJSON(http.MethodGet, "/v1/search?q="+token+"&types=spreadsheet", ownerATokenDeviceA, nil)
+		if status != http.StatusBadRequest {
+			t.Fatalf("expected unknown hit type to be rejected, got status=%d", status)
+		}
+	})
+
+	t.Run("SearchQueryLanguage", func(t *testing.T) {
+		token := fmt.Sprintf("mycoplasma%d", now)
+		alpha := getString(t, env.createExperiment(ownerATokenDeviceA, token+" alpha screen", "original"), "experimentId")
+		beta := getString(t, env.createExperiment(ownerATokenDeviceA, token+" beta screen", "original"), "experimentId")
+
+		search := func(q string) (int, map[string]any) {
+			status, _, _, resp := env.doJSON(http.MethodGet, "/v1/search?q="+url.QueryEscape(q), ownerATokenDeviceA, nil)
+			m, _ := resp.(map[string]any)
+			return status, m
+		}
+		experimentIDs := func(resp map[string]any) []string {
+			var ids []string
+			for _, e := range asSlice(t, resp["experiments"]) {
+				ids = append(ids, getString(t, asMap(t, e), "experimentId"))
+			}
+			return ids
+		}
+
+		status, resp := search(token + " -beta")
+		if ids := experimentIDs(resp); status != http.StatusOK || len(ids) != 1 || ids[0] != alpha {
+			t.Fatalf("expected negation to leave only %s, got status=%d %v", alpha, status, resp)
+		}
+		status, resp = search(`"` + token + ` beta" OR nonexistentterm`)
+		if ids := experimentIDs(resp); status != http.StatusOK || len(ids) != 1 || ids[0] != beta {
+			t.Fatalf("expected the phrase to match only %s, got status=%d %v", beta, status, resp)
+		}
+		status, resp = search(token + " status:completed")
+		if ids := experimentIDs(resp); status != http.StatusOK || len(ids) != 0 {
+			t.Fatalf("expected status:completed to exclude drafts, got status=%d %v", status, resp)
+		}
+		status, resp = search(token + " created:>=" + time.Now().UTC().AddDate(0, 0, -1).Format("2006-01-02") + " owner:" + strings.Split(ownerAEmail, "@")[0])
+		if ids := experimentIDs(resp); status != http.StatusOK || len(ids) != 2 {
+			t.Fatalf("expected created and owner filters to keep both experiments, got status=%d %v", status, resp)
+		}
+
+		status, resp = search(token + ` protocol:"Western Blot`)
+		if status != http.StatusBadRequest || !strings.Contains(fmt.Sprint(resp["error"]), "column") {
+			t.Fatalf("expected a parse error with its column, got status=%d %v", status, resp)
+		}
+		status, _ = search(token + " species:mouse")
+		if status != http.StatusBadRequest {
+			t.Fatalf("expected an unknown field to be rejected, got status=%d", status)
+		}
+	})
+
+	t.Run("SearchFacets", func(t *testing.T) {
+		token := fmt.Sprintf("organoid%d", now)
+		env.createExperiment(ownerATokenDeviceA, token+" day 7", "original")
+		env.createExperiment(ownerATokenDeviceA, token+" day 14", "original")
+		month := time.Now().UTC().Format("2006-01")
+
+		facetValues := func(resp map[string]any, name string) map[string]map[string]any {
+			values := map[string]map[string]any{}
+			for _, f := range asSlice(t, resp["facets"]) {
+				if facet := asMap(t, f); facet["name"] == name {
+					for _, v := range asSlice(t, facet["values"]) {
+						value := asMap(t, v)
+						values[getString(t, value, "value")] = value
+					}
+				}
+			}
+			return values
+		}
+
+		status, _, _, resp := env.doJSON(http.MethodGet, "/v1/search?q="+token, ownerATokenDeviceA, nil)
+		if status != http.StatusOK {
+			t.Fatalf("search failed: status=%d body=%v", status, resp)
+		}
+		result := asMap(t, resp)
+		if v := facetValues(result, "status")["draft"]; v == nil || v["count"] != float64(2) {
+			t.Fatalf("expected 2 drafts in the status facet, got %v", result["facets"])
+		}
+		if v := facetValues(result, "month")[month]; v == nil || v["count"] != float64(2) {
+			t.Fatalf("expected 2 experiments in %s, got %v", month, result["facets"])
+		}
+		if owners := facetValues(result, "owner"); len(owners) != 1 {
+			t.Fatalf("expected a single owner, got %v", owners)
+		}
+
+		// Selecting a status narrows the results but leaves the status
+		// facet counted without its own selection.
+		status, _, _, resp = env.doJSON(http.MethodGet, "/v1/search?q="+token+"&status=completed", ownerATokenDeviceA, nil)
+		if status != http.StatusOK {
+			t.Fatalf("faceted search failed: status=%d body=%v", status, resp)
+		}
+		result = asMap(t, resp)
+		if n := len(asSlice(t, result["experiments"])); n != 0 {
+			t.Fatalf("expected no completed experiments, got %d", n)
+		}
+		if v := facetValues(result, "status")["draft"]; v == nil || v["count"] != float64(2) || v["selected"] != false {
+			t.Fatalf("expected the draft count to remain visible, got %v", result["facets"])
+		}
+		if months := facetValues(result, "month"); len(months) != 0 {
+			t.Fatalf("expected other facets to follow the selection, got %v", months)
+		}
+
+		status, _, _, _ = env.doJSON(http.MethodGet, "/v1/search?q="+token+"&month=2026-13", ownerATokenDeviceA, nil)
+		if status != http.StatusBadRequest {
+			t.Fatalf("expected a malformed month to be rejected, got status=%d", status)
+		}
+	})
+
+	t.Run("FuzzySearchAndSuggestions", func(t *testing.T) {
+		catalogNo := fmt.Sprintf("sc-%d", now)
+		status, _, _, _ := env.doJSON(http.MethodPost, "/v1/reagents/antibodies", ownerATokenDeviceA, map[string]any{
+			"antibodyName": "Anti-pSTAT3(Y705)",
+			"catalogNo":    catalogNo,
+			"company":      "Santa Cruz",
+		})
+		if status != http.StatusCreated {
+			t.Fatalf("create antibody failed: status=%d", status)
+		}
+		word := fmt.Sprintf("lentivirus%d", now)
+		experimentID := getString(t, env.createExperiment(ownerATokenDeviceA, word+" transduction", "original"), "experimentId")
+
+		search := func(q string) map[string]any {
+			status, _, _, resp := env.doJSON(http.MethodGet, "/v1/search?q="+url.QueryEscape(q), ownerATokenDeviceA, nil)
+			if status != http.StatusOK {
+				t.Fatalf("search %q failed: status=%d body=%v", q, status, resp)
+			}
+			return asMap(t, resp)
+		}
+
+		// A catalog number prefix finds the antibody.
+		found := false
+		for _, h := range asSlice(t, search(catalogNo[:len(catalogNo)-2])["hits"]) {
+			hit := asMap(t, h)
+			if hit["type"] == "reagent" && hit["subtype"] == "antibody" {
+				found = true
+			}
+		}
+		if !found {
+			t.Fatalf("expected the catalog number prefix to find the antibody")
+		}
+
+		// A misspelled title word still finds the experiment.
+		typo := strings.Replace(word, "lenti", "lemti", 1)
+		found = false
+		for _, e := range asSlice(t, search(typo)["experiments"]) {
+			if getString(t, asMap(t, e), "experimentId") == experimentID {
+				found = true
+			}
+		}
+		if !found {
+			t.Fatalf("expected %q to find the experiment titled %q", typo, word)
+		}
+
+		result := search(typo + " nonexistentzzz")
+		if n := len(asSlice(t, result["experiments"])); n != 0 {
+			t.Fatalf("expected no results, got %d", n)
+		}
+		if suggestion, _ := result["didYouMean"].(string); !strings.Contains(suggestion, word) {
+			t.Fatalf("expected a suggestion containing %q, got %v", word, result["didYouMean"])
+		}
+	})
+
+	t.Run("SavedSearchAlerts", func(t *testing.T) {
+		tag := fmt.Sprintf("mouse-colony-%d", now)
+		name := "Completed colony work " + tag
+		status, _, _, savedResp := env.doJSON(http.MethodPost, "/v1/saved-searches", adminToken, map[string]any{
+			"name":       name,
+			"query":      "tag:" + tag + " status:completed",
+			"subscribed": true,
+		})
+		if status != http.StatusCreated {
+			t.Fatalf("save search failed: status=%d body=%v", status, savedResp)
+		}
+		savedSearchID := getString(t, asMap(t, savedResp), "savedSearchId")
+
+		status, _, _, _ = env.doJSON(http.MethodPost, "/v1/saved-searches", adminToken, map[string]any{
+			"name": name, "query": "tag:" + tag,
+		})
+		if status != http.StatusConflict {
+			t.Fatalf("expected a duplicate name to conflict, got status=%d", status)
+		}
+		status, _, _, _ = env.doJSON(http.MethodPost, "/v1/saved-searches", adminToken, map[string]any{
+			"name": name + " broken", "query": `"unterminated`,
+		})
+		if status != http.StatusBadRequest {
+			t.Fatalf("expected an unparsable query to be rejected, got status=%d", status)
+		}
+
+		processAlerts := func() map[string]bool {
+			status, _, _, resp := env.doJSON(http.MethodPost, "/v1/ops/saved-searches/alerts", adminToken, map[string]any{"limit": 100000})
+			if status != http.StatusOK {
+				t.Fatalf("process alerts failed: status=%d body=%v", status, resp)
+			}
+			alerted := map[string]bool{}
+			for _, a := range asSlice(t, asMap(t, resp)["alerts"]) {
+				alert := asMap(t, a)
+				if alert["savedSearchId"] == savedSearchID {
+					alerted[getString(t, alert, "recordId")] = true
+				}
+			}
+			return alerted
+		}
+
+		experimentID := getString(t, env.createExperiment(ownerATokenDeviceA, "Colony genotyping", "original"), "experimentId")
+		status, _, _, tagResp := env.doJSON(http.MethodPost, "/v1/experiments/"+experimentID+"/tags", ownerATokenDeviceA, map[string]any{"tag": tag})
+		if status != http.StatusCreated {
+			t.Fatalf("tag experiment failed: status=%d body=%v", status, tagResp)
+		}
+		if alerted := processAlerts(); alerted[experimentID] {
+			t.Fatalf("expected no alert before the experiment is completed")
+		}
+
+		status, _, _, completeResp := env.doJSON(http.MethodPost, "/v1/experiments/"+experimentID+"/complete", ownerATokenDeviceA, map[string]any{})
+		if status != http.StatusOK {
+			t.Fatalf("complete experiment failed: status=%d body=%v", status, completeResp)
+		}
+		if alerted := processAlerts(); !alerted[experimentID] {
+			t.Fatalf("expected an alert for the completed experiment %s", experimentID)
+		}
+		if alerted := processAlerts(); alerted[experimentID] {
+			t.Fatalf("expected the experiment to alert only once")
+		}
+
+		status, _, _, notifResp := env.doJSON(http.MethodGet, "/v1/notifications", adminToken, nil)
+		if status != http.StatusOK {
+			t.Fatalf("list notifications failed: status=%d body=%v", status, notifResp)
+		}
+		notified := false
+		for _, n := range asSlice(t, asMap(t, notifResp)["notifications"]) {
+			notif := asMap(t, n)
+			if notif["eventType"] == "search.alert" && notif["referenceId"] == experimentID {
+				notified = true
+			}
+		}
+		if !notified {
+			t.Fatalf("expected a search.alert notification for %s, got %v", experimentID, notifResp)
+		}
+
+		status, _, _, runResp := env.doJSON(http.MethodGet, "/v1/saved-searches/"+savedSearchID+"/run", adminToken, nil)
+		if status != http.StatusOK {
+			t.Fatalf("run saved search failed: status=%d body=%v", status, runResp)
+		}
+		if experiments := asSlice(t, asMap(t, runResp)["experiments"]); len(experiments) != 1 || getString(t, asMap(t, experiments[0]), "experimentId") != experimentID {
+			t.Fatalf("expected the re-run to find %s, got %v", experimentID, experiments)
+		}
+
+		status, _, _, _ = env.doJSON(http.MethodGet, "/v1/saved-searches/"+savedSearchID, ownerATokenDeviceA, nil)
+		if status != http.StatusNotFound {
+			t.Fatalf("expected another user's saved search to be hidden, got status=%d", status)
+		}
+		status, _, _, _ = env.doJSON(http.MethodDelete, "/v1/saved-searches/"+savedSearchID, adminToken, nil)
+		if status != http.StatusNoContent {
+			t.Fatalf("delete saved search failed: status=%d", status)
+		}
+	})
+
+	t.Run("SearchEffectiveEntries", func(t *testing.T) {
+		token := fmt.Sprintf("trypsin%d", now)
+		exp := env.createExperiment(ownerATokenDeviceA, "Digest conditions", "Digested with "+token+" for 10 min")
+		experimentID := getString(t, exp, "experimentId")
+		originalEntryID := getString(t, exp, "originalEntryId")
+		status, _, _, addendumResp := env.doJSON(http.MethodPost, "/v1/experiments/"+experimentID+"/addendums", ownerATokenDeviceA, map[string]any{
+			"baseEntryId": originalEntryID,
+			"body":        "Correction: digested with " + token + " for 30 min",
+		})
+		if status != http.StatusCreated {
+			t.Fatalf("create addendum failed: status=%d body=%v", status, addendumResp)
+		}
+		addendumEntryID := getString(t, asMap(t, addendumResp), "entryId")
+
+		entryHits := func(params string) map[string]map[string]any {
+			status, _, _, resp := env.doJSON(http.MethodGet, "/v1/search?types=entry&q="+token+params, ownerATokenDeviceA, nil)
+			if status != http.StatusOK {
+				t.Fatalf("search failed: status=%d body=%v", status, resp)
+			}
+			hits := map[string]map[string]any{}
+			for _, h := range asSlice(t, asMap(t, resp)["hits"]) {
+				hit := asMap(t, h)
+				hits[getString(t, hit, "entryId")] = hit
+			}
+			return hits
+		}
+
+		hits := entryHits("")
+		if len(hits) != 2 {
+			t.Fatalf("expected both entries to match, got %v", hits)
+		}
+		if state := hits[originalEntryID]["entryState"]; state != "historical" {
+			t.Fatalf("expected the original entry to be historical, got %v", state)
+		}
+		if state := hits[addendumEntryID]["entryState"]; state != "effective" {
+			t.Fatalf("expected the addendum to be effective, got %v", state)
+		}
+		if snippet, _ := hits[addendumEntryID]["snippet"].(string); !strings.Contains(snippet, "<b>") {
+			t.Fatalf("expected a highlighted snippet, got %q", snippet)
+		}
+
+		hits = entryHits("&effectiveOnly=true")
+		if len(hits) != 1 || hits[addendumEntryID] == nil {
+			t.Fatalf("expected only the effective entry, got %v", hits)
+		}
+	})
+
+	t.Run("RelatedExperiments", func(t *testing.T) {
+		tag := fmt.Sprintf("organoid-%d", now)
+		body := fmt.Sprintf("Cultured organoid%d spheroids in matrigel dome, passaged with dispase, imaged brightfield daily for budding morphology", now)
+		create := func(title, body string, tagged bool) string {
+			experimentID := getString(t, env.createExperiment(ownerATokenDeviceA, title, body), "experimentId")
+			if tagged {
+				status, _, _, tagResp := env.doJSON(http.MethodPost, "/v1/experiments/"+experimentID+"/tags", ownerATokenDeviceA, map[string]any{"tag": tag})
+				if status != http.StatusCreated {
+					t.Fatalf("tag experiment failed: status=%d body=%v", status, tagResp)
+				}
+			}
+			return experimentID
+		}
+		sourceID := create("Organoid culture", body, true)
+		relatedID := create("Organoid culture repeat", body+" with a second donor line", true)
+		unrelatedID := create("Buffer inventory", fmt.Sprintf("Counted buffer%d stock bottles on shelf", now), false)
+
+		status, _, _, resp := env.doJSON(http.MethodGet, "/v1/experiments/"+sourceID+"/related", ownerATokenDeviceA, nil)
+		if status != http.StatusOK {
+			t.Fatalf("related experiments failed: status=%d body=%v", status, resp)
+		}
+		var found map[string]any
+		for _, r := range asSlice(t, asMap(t, resp)["related"]) {
+			rel := asMap(t, r)
+			switch getString(t, rel, "experimentId") {
+			case relatedID:
+				found = rel
+			case sourceID:
+				t.Fatalf("expected the experiment not to relate to itself")
+			case unrelatedID:
+				t.Fatalf("expected the unrelated experiment to be absent, got %v", rel)
+			}
+		}
+		if found == nil {
+			t.Fatalf("expected %s to be related, got %v", relatedID, resp)
+		}
+		kinds := map[string]bool{}
+		for _, r := range asSlice(t, found["reasons"]) {
+			kinds[getString(t, asMap(t, r), "kind")] = true
+		}
+		if !kinds["tags"] || !kinds["text"] {
+			t.Fatalf("expected tags and text reasons, got %v", found["reasons"])
+		}
+
+		status, _, _, _ = env.doJSON(http.MethodGet, "/v1/experiments/"+sourceID+"/related", ownerBToken, nil)
+		if status != http.StatusNotFound {
+			t.Fatalf("expected another user's experiment to be hidden, got status=%d", status)
+		}
+	})
+
+	t.Run("StructuredProtocolSteps", func(t *testing.T) {
+		status, _, _, createResp := env.doJSON(http.MethodPost, "/v1/protocols", ownerATokenDeviceA, map[string]any{
+			"title":       fmt.Sprintf("Heat denaturation %d", now),
+			"initialBody": "Free-text draft",
+		})
+		if status != http.StatusCreated {
+			t.Fatalf("create protocol failed: status=%d body=%v", status, createResp)
+		}
+		protocolID := getString(t, asMap(t, createResp), "protocolId")
+
+		steps := []map[string]any{{
+			"title":        "Denature",
+			"instructions": "Heat the samples.",
+			"parameters": []map[string]any{
+				{"kind": "temperature", "value": 95, "unit": "C"},
+				{"kind": "duration", "value": 5, "unit": "min", "timer": true},
+			},
+			"reagents": []map[string]any{
+				{"name": "Laemmli buffer", "quantity": map[string]any{"kind": "volume", "value": 10, "unit": "uL"}},
+			},
+			"safetyNotes": []string{"Heat block is hot"},
+			"steps":       []map[string]any{{"title": "Cool on ice"}},
+		}}
+		status, _, _, publishResp := env.doJSON(http.MethodPost, "/v1/protocols/"+protocolID+"/publish", ownerATokenDeviceA, map[string]any{
+			"body":          "Denature samples before loading.",
+			"steps":         steps,
+			"changeSummary": "Structured steps",
+		})
+		if status != http.StatusCreated {
+			t.Fatalf("publish structured version failed: status=%d body=%v", status, publishResp)
+		}
+
+		steps[0]["parameters"] = []map[string]any{{"kind": "volume", "value": 5, "unit": "min"}}
+		status, _, _, _ = env.doJSON(http.MethodPost, "/v1/protocols/"+protocolID+"/publish", ownerATokenDeviceA, map[string]any{"steps": steps})
+		if status != http.StatusBadRequest {
+			t.Fatalf("expected a mismatched unit to be rejected, got status=%d", status)
+		}
+
+		status, _, _, versionsResp := env.doJSON(http.MethodGet, "/v1/protocols/"+protocolID+"/versions", ownerATokenDeviceA, nil)
+		if status != http.StatusOK {
+			t.Fatalf("list versions failed: status=%d body=%v", status, versionsResp)
+		}
+		versions := asSlice(t, asMap(t, versionsResp)["versions"])
+		if len(versions) != 2 {
+			t.Fatalf("expected two versions, got %v", versions)
+		}
+		latest := asMap(t, versions[0])
+		body := getString(t, latest, "body")
+		for _, want := range []string{"Denature samples before loading.", "1. Denature", "95 °C", "5 min (timer)", "Laemmli buffer (10 µL)", "Safety: Heat block is hot", "1.1. Cool on ice"} {
+			if !strings.Contains(body, want) {
+				t.Fatalf("expected the rendered body to contain %q, got %q", want, body)
+			}
+		}
+		structured := asSlice(t, latest["steps"])
+		params := asSlice(t, asMap(t, structured[0])["parameters"])
+		if unit := getString(t, asMap(t, params[0]), "unit"); unit != "°C" {
+			t.Fatalf("expected the unit to be stored as °C, got %q", unit)
+		}
+		if _, ok := asMap(t, versions[1])["steps"]; ok {
+			t.Fatalf("expected the free-text version to have no steps, got %v", versions[1])
+		}
+	})
+
+	t.Run("AttachmentVersionSupersession", func(t *testing.T) {
+		exp := env.createExperiment(ownerATokenDeviceA, "Attachment versions", "original")
+		experimentID := getString(t, exp, "experimentId")
+
+		uploadVersion := func(objectKey, supersedesID string) (int, map[string]any) {
+			t.Helper()
+			body := map[string]any{
+				"experimentId": experimentID,
+				"objectKey":    objectKey,
+				"sizeBytes":    16,
+				"mimeType":     "text/csv",
+			}
+			if supersedesID != "" {
+				body["supersedesAttachmentId"] = supersedesID
+			}
+			status, _, _, initiateResp := env.doJSON(http.MethodPost, "/v1/attachments/initiate", ownerATokenDeviceA, body)
+			if status != http.StatusCreated {
+				return status, nil
+			}
+			attachmentID := getString(t, asMap(t, initiateResp), "attachmentId")
+			status, _, _, completeResp := env.doJSON(http.MethodPost, "/v1/attachments/"+attachmentID+"/complete", ownerATokenDeviceA, map[string]any{
+				"checksum":  "abc123",
+				"sizeBytes": 16,
+			})
+			if status != http.StatusOK {
+				t.Fatalf("attachment complete failed: status=%d body=%v", status, completeResp)
+			}
+			return status, asMap(t, completeResp)
+		}
+
+		_, v1 := uploadVersion(fmt.Sprintf("versions/%d/v1.csv", now), "")
+		v1ID := getString(t, v1, "attachmentId")
+		status, v2 := uploadVersion(fmt.Sprintf("versions/%d/v2.csv", now), v1ID)
+		if v2 == nil {
+			t.Fatalf("initiate superseding version failed: status=%d", status)
+		}
+		v2ID := getString(t, v2, "attachmentId")
+		if getString(t, v2, "lineageId") != v1ID {
+			t.Fatalf("expected v2 to share lineage %s, got %v", v1ID, v2)
+		}
+
+		if status, _ := uploadVersion(fmt.Sprintf("versions/%d/v2b.csv", now), v1ID); status != http.StatusConflict {
+			t.Fatalf("superseding an already-superseded attachment should conflict, got status=%d", status)
+		}
+
+		status, _, _, listResp := env.doJSON(http.MethodGet, "/v1/experiments/"+experimentID+"/attachments", ownerATokenDeviceA, nil)
+		if status != http.StatusOK {
+			t.Fatalf("list attachments failed: status=%d body=%v", status, listResp)
+		}
+		listed := asSlice(t, asMap(t, listResp)["attachments"])
+		if len(listed) != 1 || getString(t, asMap(t, listed[0]), "id") != v2ID {
+			t.Fatalf("expected only effective version %s to be listed, got %v", v2ID, listed)
+		}
+
+		status, _, _, historyResp := env.doJSON(http.MethodGet, "/v1/attachments/"+v1ID+"/versions", ownerATokenDeviceA, nil)
+		if status != http.StatusOK {
+			t.Fatalf("attachment versions failed: status=%d body=%v", status, historyResp)
+		}
+		history := asMap(t, historyResp)
+		if len(asSlice(t, history["versions"])) != 2 || getString(t, history, "effectiveAttachmentId") != v2ID {
+			t.Fatalf("expected two versions with %s effective, got %v", v2ID, history)
+		}
+
+		status, _, _, pendingResp := env.doJSON(http.MethodPost, "/v1/attachments/initiate", ownerATokenDeviceA, map[string]any{
+			"experimentId": experimentID,
+			"objectKey":    fmt.Sprintf("versions/%d/pending.csv", now),
+			"sizeBytes":    16,
+			"mimeType":     "text/csv",
+		})
+		if status != http.StatusCreated {
+			t.Fatalf("initiate pending attachment failed: status=%d body=%v", status, pendingResp)
+		}
+		pendingID := getString(t, asMap(t, pendingResp), "attachmentId")
+		status, _, _, historyResp = env.doJSON(http.MethodGet, "/v1/attachments/"+pendingID+"/versions", ownerATokenDeviceA, nil)
+		if status != http.StatusOK {
+			t.Fatalf("pending attachment versions failed: status=%d body=%v", status, historyResp)
+		}
+		if effective, ok := asMap(t, historyResp)["effectiveAttachmentId"]; ok {
+			t.Fatalf("expected an uncompleted upload to have no effective version, got %v", effective)
+		}
+	})
+
+	t.Run("AttachmentsBoundToEntries", func(t *testing.T) {
+		exp := env.createExperiment(ownerATokenDeviceA, "Entry attachments", "original")
+		experimentID := getString(t, exp, "experimentId")
+		originalEntryID := getString(t, exp, "originalEntryId")
+
+		status, _, _, initiateResp := env.doJSON(http.MethodPost, "/v1/attachments/initiate", ownerATokenDeviceA, map[string]any{
+			"experimentId": experimentID,
+			"entryId":      originalEntryID,
+			"objectKey":    fmt.Sprintf("entries/%d/gel.png", now),
+			"sizeBytes":    32,
+			"mimeType":     "image/png",
+		})
+		if status != http.StatusCreated {
+			t.Fatalf("attachment initiate failed: status=%d body=%v", status, initiateResp)
+		}
+		gelID := getString(t, asMap(t, initiateResp), "attachmentId")
+
+		status, _, _, badAddendum := env.doJSON(http.MethodPost, "/v1/experiments/"+experimentID+"/addendums", ownerATokenDeviceA, map[string]any{
+			"baseEntryId": originalEntryID,
+			"body":        "see [[attachment:00000000-0000-0000-0000-000000000000]]",
+		})
+		if status != http.StatusBadRequest {
+			t.Fatalf("addendum referencing unknown attachment should fail, got status=%d body=%v", status, badAddendum)
+		}
+
+		status, _, _, badExperiment := env.doJSON(http.MethodPost, "/v1/experiments", ownerATokenDeviceA, map[string]any{
+			"title":        "Borrowed gel",
+			"originalBody": "see [[attachment:" + gelID + "]]",
+		})
+		if status != http.StatusBadRequest {
+			t.Fatalf("original entry referencing another experiment's attachment should fail, got status=%d body=%v", status, badExperiment)
+		}
+
+		status, _, _, addendumResp := env.doJSON(http.MethodPost, "/v1/experiments/"+experimentID+"/addendums", ownerATokenDeviceA, map[string]any{
+			"baseEntryId": originalEntryID,
+			"body":        "corrected lanes, see [[attachment:" + gelID + "]]",
+		})
+		if status != http.StatusCreated {
+			t.Fatalf("create addendum failed: status=%d body=%v", status, addendumResp)
+		}
+
+		status, _, _, historyResp := env.doJSON(http.MethodGet, "/v1/experiments/"+experimentID+"/history", ownerATokenDeviceA, nil)
+		if status != http.StatusOK {
+			t.Fatalf("get history failed: status=%d body=%v", status, historyResp)
+		}
+		entries := asSlice(t, asMap(t, historyResp)["entries"])
+		originalAttachments := asSlice(t, asMap(t, entries[0])["attachments"])
+		if len(originalAttachments) != 1 || !asMap(t, originalAttachments[0])["boundToEntry"].(bool) {
+			t.Fatalf("expected gel bound to original entry, got %v", originalAttachments)
+		}
+		addendumAttachments := asSlice(t, asMap(t, entries[1])["attachments"])
+		if len(addendumAttachments) != 1 || !asMap(t, addendumAttachments[0])["referencedInline"].(bool) {
+			t.Fatalf("expected gel referenced inline from addendum, got %v", addendumAttachments)
+		}
+
+		status, _, _, effectiveResp := env.doJSON(http.MethodGet, "/v1/experiments/"+experimentID, ownerATokenDeviceA, nil)
+		if status != http.StatusOK {
+			t.Fatalf("get effective view failed: status=%d body=%v", status, effectiveResp)
+		}
+		effectiveAttachments := asSlice(t, asMap(t, effectiveResp)["attachments"])
+		if len(effectiveAttachments) != 1 || getString(t, asMap(t, effectiveAttachments[0]), "attachmentId") != gelID {
+			t.Fatalf("expected effective view to carry referenced gel, got %v", effectiveAttachments)
+		}
+	})
+
 	t.Run("AttachmentReconcileObjectDrift", func(t *testing.T) {
 		exp := env.createExperiment(ownerATokenDeviceA, "Attachment drift", "original")
 		experimentID := getString(t, exp, "experimentId")
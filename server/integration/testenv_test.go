@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"database/sql"
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -29,6 +30,7 @@ import (
 type testEnv struct {
 	t           *testing.T
 	db          *sql.DB
+	cfg         config.Config
 	app         *app.App
 	httpSrv     *httptest.Server
 	objectSrv   *httptest.Server
@@ -127,6 +129,7 @@ func setupIntegrationEnv(t *testing.T) *testEnv {
 	env := &testEnv{
 		t:           t,
 		db:          db,
+		cfg:         cfg,
 		app:         application,
 		httpSrv:     httpSrv,
 		objectSrv:   objectSrv,
@@ -341,6 +344,30 @@ func quoteIdent(v string) string {
 	return `"` + strings.ReplaceAll(v, `"`, `""`) + `"`
 }
 
+// withConfig serves a second app over the same database and object store,
+// with the config adjusted, for subtests that need settings the shared app
+// does not run with. Tokens from the shared app are valid against it.
+func (e *testEnv) withConfig(adjust func(*config.Config)) *testEnv {
+	e.t.Helper()
+
+	cfg := e.cfg
+	adjust(&cfg)
+	application, err := app.New(cfg, e.db)
+	if err != nil {
+		e.t.Fatalf("build app: %v", err)
+	}
+	// The app is not closed: closing it would close the shared database.
+	httpSrv := httptest.NewServer(application)
+	e.t.Cleanup(httpSrv.Close)
+
+	other := *e
+	other.cfg = cfg
+	other.app = application
+	other.httpSrv = httpSrv
+	other.baseURL = httpSrv.URL
+	return &other
+}
+
 func (e *testEnv) login(email, password, deviceName string) string {
 	e.t.Helper()
 	status, _, _, body := e.doJSON(http.MethodPost, "/v1/auth/login", "", map[string]any{
@@ -467,3 +494,48 @@ func getBool(t *testing.T, m map[string]any, key string) bool {
 	}
 	return b
 }
+
+// encodeGray16TIFF writes an uncompressed little-endian TIFF with one
+// 16-bit grayscale page per entry of pages, each stored as a single strip.
+func encodeGray16TIFF(width, height int, pages [][]uint16) []byte {
+	le := binary.LittleEndian
+	var buf bytes.Buffer
+	buf.WriteString("II*\x00")
+	_ = binary.Write(&buf, le, uint32(8))
+
+	const entries = 9
+	for i, pixels := range pages {
+		dataOffset := buf.Len() + 2 + entries*12 + 4
+		next := 0
+		if i < len(pages)-1 {
+			next = dataOffset + len(pixels)*2
+		}
+		_ = binary.Write(&buf, le, uint16(entries))
+		for _, e := range []struct {
+			tag, typ uint16
+			value    uint32
+		}{
+			{256, 3, uint32(width)},           // ImageWidth
+			{257, 3, uint32(height)},          // ImageLength
+			{258, 3, 16},                      // BitsPerSample
+			{259, 3, 1},                       // Compression: none
+			{262, 3, 1},                       // Photometric: black is zero
+			{273, 4, uint32(dataOffset)},      // StripOffsets
+			{277, 3, 1},                       // SamplesPerPixel
+			{278, 3, uint32(height)},          // RowsPerStrip
+			{279, 4, uint32(len(pixels) * 2)}, // StripByteCounts
+		} {
+			_ = binary.Write(&buf, le, e.tag)
+			_ = binary.Write(&buf, le, e.typ)
+			_ = binary.Write(&buf, le, uint32(1))
+			if e.typ == 3 {
+				_ = binary.Write(&buf, le, [2]uint16{uint16(e.value), 0})
+			} else {
+				_ = binary.Write(&buf, le, e.value)
+			}
+		}
+		_ = binary.Write(&buf, le, uint32(next))
+		_ = binary.Write(&buf, le, pixels)
+	}
+	return buf.Bytes()
+}
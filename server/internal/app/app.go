@@ -65,6 +65,31 @@ func New(cfg config.Config, db *sql.DB) (*App, error) {
 		return nil, fmt.Errorf("build attachment signer: %w", err)
 	}
 	objectInspector := attachments.NewSignedURLObjectInspector(signer, cfg.ObjectStoreInventoryURL, cfg.ObjectStoreProbeTimeout)
+	verificationPolicy := attachments.VerificationPolicy{
+		Mode:         cfg.AttachmentVerifyMode,
+		HashMaxBytes: cfg.AttachmentHashMaxBytes,
+	}
+	previewJobPolicy := previews.JobPolicy{
+		MaxAttempts:  cfg.PreviewMaxAttempts,
+		RetryBackoff: cfg.PreviewRetryBackoff,
+	}
+	previewStorage := previews.StoragePolicy{
+		ObjectStoreMinBytes: cfg.PreviewObjectStoreMinBytes,
+		URLTTL:              cfg.AttachmentDownloadURLTTL,
+	}
+	var scanners []attachments.ContentScanner
+	if cfg.AttachmentScanEnabled {
+		if cfg.AttachmentScanMagicBytes {
+			scanners = append(scanners, attachments.NewMagicByteScanner())
+		}
+		if cfg.ClamdAddress != "" {
+			clamd, err := attachments.NewClamdScanner(cfg.ClamdAddress, cfg.ClamdTimeout)
+			if err != nil {
+				return nil, fmt.Errorf("build clamd scanner: %w", err)
+			}
+			scanners = append(scanners, clamd)
+		}
+	}
 
 	return &App{
 		cfg:               cfg,
@@ -74,16 +99,16 @@ func New(cfg config.Config, db *sql.DB) (*App, error) {
 		expService:        experiments.NewService(db, syncService),
 		adminService:      admin.NewService(db, syncService),
 		syncService:       syncService,
-		attachmentService: attachments.NewService(db, syncService, signer, objectInspector, cfg.AttachmentUploadURLTTL, cfg.AttachmentDownloadURLTTL),
+		attachmentService: attachments.NewService(db, syncService, signer, objectInspector, cfg.AttachmentUploadURLTTL, cfg.AttachmentDownloadURLTTL, verificationPolicy, scanners),
 		opsService:        ops.NewService(db),
 		protocolService:   protocols.NewService(db, syncService),
 		searchService:     search.NewService(db),
 		userService:       users.NewService(db),
 		signatureService:  signatures.NewService(db, syncService),
 		notifService:      notifications.NewService(db),
-		datavisService:    datavis.NewService(db, syncService),
+		datavisService:    datavis.NewService(db, syncService, objectInspector, cfg.DataExtractMaxSourceBytes),
 		templateService:   templates.NewService(db, syncService),
-		previewService:    previews.NewService(db),
+		previewService:    previews.NewService(db, objectInspector, signer, cfg.PreviewMaxSizeBytes, previewJobPolicy, previewStorage),
 		reagentService:    reagents.NewService(db),
 	}, nil
 }
@@ -195,6 +220,15 @@ func (a *App) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	case r.Method == http.MethodGet && r.URL.Path == "/v1/search":
 		a.handleSearch(w, r)
 		return
+	case r.Method == http.MethodPost && r.URL.Path == "/v1/saved-searches":
+		a.handleCreateSavedSearch(w, r)
+		return
+	case r.Method == http.MethodGet && r.URL.Path == "/v1/saved-searches":
+		a.handleListSavedSearches(w, r)
+		return
+	case strings.HasPrefix(r.URL.Path, "/v1/saved-searches/"):
+		a.routeSavedSearchScope(w, r)
+		return
 
 	// --- Users (admin) ---
 	case r.Method == http.MethodPost && r.URL.Path == "/v1/users":
@@ -245,6 +279,32 @@ func (a *App) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// --- Data Visualization ---
 	case r.Method == http.MethodPost && r.URL.Path == "/v1/data/parse-csv":
 		a.handleParseCSV(w, r)
+	case r.Method == http.MethodPost && r.URL.Path == "/v1/data/parse":
+		a.handleParseData(w, r)
+		return
+	case r.Method == http.MethodPost && r.URL.Path == "/v1/data/parse-plate":
+		a.handleParsePlate(w, r)
+		return
+	case r.Method == http.MethodPost && r.URL.Path == "/v1/data/plate-layouts":
+		a.handleCreatePlateLayout(w, r)
+		return
+	case r.Method == http.MethodGet && r.URL.Path == "/v1/data/plate-layouts":
+		a.handleListPlateLayouts(w, r)
+		return
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/v1/data/plate-layouts/"):
+		a.handleGetPlateLayout(w, r)
+		return
+	case r.Method == http.MethodPost && r.URL.Path == "/v1/data/analyses":
+		a.handleCreateAnalysis(w, r)
+		return
+	case r.Method == http.MethodGet && r.URL.Path == "/v1/data/analyses":
+		a.handleListAnalyses(w, r)
+		return
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/v1/data/analyses/"):
+		a.handleGetAnalysis(w, r)
+		return
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/v1/data/extracts/") && strings.HasSuffix(r.URL.Path, "/rows"):
+		a.handleGetExtractRows(w, r)
 		return
 	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/v1/data/extracts/"):
 		a.handleGetDataExtract(w, r)
@@ -255,6 +315,12 @@ func (a *App) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	case r.Method == http.MethodGet && r.URL.Path == "/v1/charts":
 		a.handleListCharts(w, r)
 		return
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/v1/charts/") && strings.HasSuffix(r.URL.Path, "/data"):
+		a.handleGetChartData(w, r)
+		return
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/v1/charts/") && strings.HasSuffix(r.URL.Path, "/image"):
+		a.handleGetChartImage(w, r)
+		return
 
 	// --- Templates ---
 	case r.Method == http.MethodPost && r.URL.Path == "/v1/templates":
@@ -274,6 +340,9 @@ func (a *App) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	case r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/v1/attachments/") && strings.HasSuffix(r.URL.Path, "/generate-preview"):
 		a.handleGeneratePreview(w, r)
 		return
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/v1/attachments/") && strings.HasSuffix(r.URL.Path, "/preview-job"):
+		a.handleGetPreviewJob(w, r)
+		return
 
 	// --- Tags ---
 	case r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/v1/experiments/") && strings.HasSuffix(r.URL.Path, "/tags"):
@@ -297,6 +366,15 @@ func (a *App) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	case r.Method == http.MethodPost && r.URL.Path == "/v1/ops/attachments/reconcile":
 		a.handleOpsAttachmentReconcile(w, r)
 		return
+	case r.Method == http.MethodPost && r.URL.Path == "/v1/ops/attachments/scan":
+		a.handleOpsAttachmentScan(w, r)
+		return
+	case r.Method == http.MethodPost && r.URL.Path == "/v1/ops/previews/process":
+		a.handleOpsProcessPreviews(w, r)
+		return
+	case r.Method == http.MethodPost && r.URL.Path == "/v1/ops/saved-searches/alerts":
+		a.handleOpsProcessSearchAlerts(w, r)
+		return
 	case r.Method == http.MethodGet && r.URL.Path == "/v1/ops/forensic/export":
 		a.handleOpsForensicExport(w, r)
 		return
@@ -353,6 +431,8 @@ func (a *App) routeExperimentScope(w http.ResponseWriter, r *http.Request) {
 		a.handleAddTag(w, r, experimentID)
 	case r.Method == http.MethodGet && action == "tags":
 		a.handleListTags(w, r, experimentID)
+	case r.Method == http.MethodGet && action == "related":
+		a.handleRelatedExperiments(w, r, experimentID)
 	case r.Method == http.MethodGet && action == "data-extracts":
 		a.handleListDataExtracts(w, r, experimentID)
 	case r.Method == http.MethodGet && action == "previews":
@@ -393,6 +473,8 @@ func (a *App) routeAttachmentScope(w http.ResponseWriter, r *http.Request) {
 		a.handleAttachmentComplete(w, r, attachmentID)
 	case r.Method == http.MethodGet && action == "download":
 		a.handleAttachmentDownload(w, r, attachmentID)
+	case r.Method == http.MethodGet && action == "versions":
+		a.handleAttachmentVersions(w, r, attachmentID)
 	default:
 		http.NotFound(w, r)
 	}
@@ -1227,10 +1309,13 @@ func (a *App) handleAttachmentInitiate(w http.ResponseWriter, r *http.Request) {
 	}
 
 	type request struct {
-		ExperimentID string `json:"experimentId"`
-		ObjectKey    string `json:"objectKey"`
-		SizeBytes    int64  `json:"sizeBytes"`
-		MimeType     string `json:"mimeType"`
+		ExperimentID           string `json:"experimentId"`
+		ObjectKey              string `json:"objectKey"`
+		SizeBytes              int64  `json:"sizeBytes"`
+		MimeType               string `json:"mimeType"`
+		EntryID                string `json:"entryId"`
+		SupersedesAttachmentID string `json:"supersedesAttachmentId"`
+		SHA256                 string `json:"sha256"`
 	}
 	var req request
 	if err := httpx.DecodeJSON(r, &req); err != nil {
@@ -1239,17 +1324,23 @@ func (a *App) handleAttachmentInitiate(w http.ResponseWriter, r *http.Request) {
 	}
 
 	resp, err := a.attachmentService.Initiate(r.Context(), attachments.InitiateInput{
-		ExperimentID: req.ExperimentID,
-		OwnerUserID:  user.ID,
-		DeviceID:     user.DeviceID,
-		ObjectKey:    req.ObjectKey,
-		SizeBytes:    req.SizeBytes,
-		MimeType:     req.MimeType,
+		ExperimentID:           req.ExperimentID,
+		OwnerUserID:            user.ID,
+		DeviceID:               user.DeviceID,
+		ObjectKey:              req.ObjectKey,
+		SizeBytes:              req.SizeBytes,
+		MimeType:               req.MimeType,
+		EntryID:                req.EntryID,
+		SupersedesAttachmentID: req.SupersedesAttachmentID,
+		SHA256:                 req.SHA256,
 	})
 	if err != nil {
 		a.writeAttachmentError(w, err)
 		return
 	}
+	if resp.Deduplicated {
+		a.enqueuePreview(r.Context(), resp.AttachmentID, user.ID)
+	}
 
 	httpx.WriteJSON(w, http.StatusCreated, resp)
 }
@@ -1286,6 +1377,7 @@ func (a *App) handleAttachmentComplete(w http.ResponseWriter, r *http.Request, a
 		a.writeAttachmentError(w, err)
 		return
 	}
+	a.enqueuePreview(r.Context(), resp.AttachmentID, user.ID)
 
 	httpx.WriteJSON(w, http.StatusOK, resp)
 }
@@ -1310,6 +1402,26 @@ func (a *App) handleAttachmentDownload(w http.ResponseWriter, r *http.Request, a
 	httpx.WriteJSON(w, http.StatusOK, resp)
 }
 
+func (a *App) handleAttachmentVersions(w http.ResponseWriter, r *http.Request, attachmentID string) {
+	user, err := a.authenticate(r)
+	if err != nil {
+		httpx.WriteError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	resp, err := a.attachmentService.History(r.Context(), attachments.HistoryInput{
+		AttachmentID: attachmentID,
+		ViewerUserID: user.ID,
+		ViewerRole:   user.Role,
+	})
+	if err != nil {
+		a.writeAttachmentError(w, err)
+		return
+	}
+
+	httpx.WriteJSON(w, http.StatusOK, resp)
+}
+
 func (a *App) handleListExperimentAttachments(w http.ResponseWriter, r *http.Request, experimentID string) {
 	user, err := a.authenticate(r)
 	if err != nil {
@@ -1400,6 +1512,95 @@ func (a *App) handleOpsAttachmentReconcile(w http.ResponseWriter, r *http.Reques
 	httpx.WriteJSON(w, http.StatusOK, resp)
 }
 
+func (a *App) handleOpsAttachmentScan(w http.ResponseWriter, r *http.Request) {
+	if _, ok := a.requireAdmin(r); !ok {
+		httpx.WriteError(w, http.StatusForbidden, "admin role required")
+		return
+	}
+
+	type request struct {
+		Limit int `json:"limit"`
+	}
+	req := request{}
+	if err := httpx.DecodeJSON(r, &req); err != nil {
+		httpx.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	limit := a.cfg.AttachmentScanBatchSize
+	if req.Limit > 0 {
+		limit = req.Limit
+	}
+
+	resp, err := a.attachmentService.ScanPending(r.Context(), attachments.ScanInput{
+		Limit:       limit,
+		MaxAttempts: a.cfg.AttachmentScanMaxAttempts,
+	})
+	if err != nil {
+		a.writeAttachmentError(w, err)
+		return
+	}
+	a.notifyQuarantinedAttachments(r.Context(), resp.Quarantined)
+	a.notifyExhaustedScans(r.Context(), resp.Exhausted)
+
+	httpx.WriteJSON(w, http.StatusOK, resp)
+}
+
+func (a *App) handleOpsProcessPreviews(w http.ResponseWriter, r *http.Request) {
+	if _, ok := a.requireAdmin(r); !ok {
+		httpx.WriteError(w, http.StatusForbidden, "admin role required")
+		return
+	}
+
+	type request struct {
+		Limit int `json:"limit"`
+	}
+	req := request{}
+	if err := httpx.DecodeJSON(r, &req); err != nil {
+		httpx.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	limit := a.cfg.PreviewBatchSize
+	if req.Limit > 0 {
+		limit = req.Limit
+	}
+
+	resp, err := a.previewService.ProcessJobs(r.Context(), previews.ProcessInput{Limit: limit})
+	if err != nil {
+		a.writePreviewError(w, err)
+		return
+	}
+
+	httpx.WriteJSON(w, http.StatusOK, resp)
+}
+
+func (a *App) handleOpsProcessSearchAlerts(w http.ResponseWriter, r *http.Request) {
+	if _, ok := a.requireAdmin(r); !ok {
+		httpx.WriteError(w, http.StatusForbidden, "admin role required")
+		return
+	}
+
+	type request struct {
+		Limit int `json:"limit"`
+	}
+	req := request{}
+	if err := httpx.DecodeJSON(r, &req); err != nil {
+		httpx.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	limit := a.cfg.SavedSearchAlertBatchSize
+	if req.Limit > 0 {
+		limit = req.Limit
+	}
+
+	resp, err := a.searchService.ProcessAlerts(r.Context(), limit, a.notifySearchAlert)
+	if err != nil {
+		a.writeSearchError(w, err)
+		return
+	}
+
+	httpx.WriteJSON(w, http.StatusOK, resp)
+}
+
 func (a *App) handleOpsForensicExport(w http.ResponseWriter, r *http.Request) {
 	user, ok := a.requireAdmin(r)
 	if !ok {
@@ -1418,6 +1619,12 @@ func (a *App) handleOpsForensicExport(w http.ResponseWriter, r *http.Request) {
 		a.writeOpsError(w, err)
 		return
 	}
+	charts, err := a.datavisService.RenderExperimentCharts(r.Context(), experimentID, user.ID, user.Role)
+	if err != nil {
+		a.writeDatavisError(w, err)
+		return
+	}
+	resp["charts"] = charts
 
 	if err := a.opsService.LogForensicExport(r.Context(), user.ID, experimentID); err != nil {
 		a.writeOpsError(w, err)
@@ -1473,9 +1680,10 @@ func (a *App) handleCreateProtocol(w http.ResponseWriter, r *http.Request) {
 	}
 
 	type request struct {
-		Title       string `json:"title"`
-		Description string `json:"description"`
-		InitialBody string `json:"initialBody"`
+		Title        string           `json:"title"`
+		Description  string           `json:"description"`
+		InitialBody  string           `json:"initialBody"`
+		InitialSteps []protocols.Step `json:"initialSteps"`
 	}
 	var req request
 	if err := httpx.DecodeJSON(r, &req); err != nil {
@@ -1484,16 +1692,17 @@ func (a *App) handleCreateProtocol(w http.ResponseWriter, r *http.Request) {
 	}
 
 	initialBody := strings.TrimSpace(req.InitialBody)
-	if initialBody == "" {
+	if initialBody == "" && req.InitialSteps == nil {
 		// Backward compatibility for older clients that only send title/description.
 		initialBody = strings.TrimSpace(req.Description)
 	}
 
 	resp, err := a.protocolService.CreateProtocol(r.Context(), protocols.CreateProtocolInput{
-		OwnerUserID: user.ID,
-		Title:       req.Title,
-		Description: req.Description,
-		InitialBody: initialBody,
+		OwnerUserID:  user.ID,
+		Title:        req.Title,
+		Description:  req.Description,
+		InitialBody:  initialBody,
+		InitialSteps: req.InitialSteps,
 	})
 	if err != nil {
 		a.writeProtocolError(w, err)
@@ -1543,9 +1752,10 @@ func (a *App) handlePublishProtocolVersion(w http.ResponseWriter, r *http.Reques
 	}
 
 	type request struct {
-		Body          string `json:"body"`
-		ChangeLog     string `json:"changeLog"`
-		ChangeSummary string `json:"changeSummary"`
+		Body          string           `json:"body"`
+		Steps         []protocols.Step `json:"steps"`
+		ChangeLog     string           `json:"changeLog"`
+		ChangeSummary string           `json:"changeSummary"`
 	}
 	var req request
 	if err := httpx.DecodeJSON(r, &req); err != nil {
@@ -1562,6 +1772,7 @@ func (a *App) handlePublishProtocolVersion(w http.ResponseWriter, r *http.Reques
 		ProtocolID:    protocolID,
 		AuthorUserID:  user.ID,
 		Body:          req.Body,
+		Steps:         req.Steps,
 		ChangeSummary: changeSummary,
 	})
 	if err != nil {
@@ -1750,26 +1961,256 @@ func (a *App) handleSearch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tag := strings.TrimSpace(r.URL.Query().Get("tag"))
-	var tags []string
-	if tag != "" {
-		tags = []string{tag}
+	// Facet selections: ?status=completed&tag=crispr&tag=mouse&month=2026-03.
+	facets := map[string][]string{}
+	for _, name := range search.FacetNames {
+		for _, v := range r.URL.Query()[name] {
+			if v = strings.TrimSpace(v); v != "" {
+				facets[name] = append(facets[name], v)
+			}
+		}
+	}
+
+	var types []string
+	if raw := strings.TrimSpace(r.URL.Query().Get("types")); raw != "" {
+		types = strings.Split(raw, ",")
+	}
+	limit, err := parseIntQuery(r, "limit", 50)
+	if err != nil {
+		httpx.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	offset, err := parseIntQuery(r, "offset", 0)
+	if err != nil {
+		httpx.WriteError(w, http.StatusBadRequest, err.Error())
+		return
 	}
 
 	resp, err := a.searchService.Search(r.Context(), search.SearchInput{
 		Query:  q,
 		UserID: user.ID,
 		Role:   user.Role,
-		Tags:   tags,
+		Types:  types,
+		Facets: facets,
+		Limit:  limit,
+		Offset: offset,
+
+		EffectiveOnly: strings.TrimSpace(r.URL.Query().Get("effectiveOnly")) == "true",
 	})
 	if err != nil {
-		httpx.WriteError(w, http.StatusInternalServerError, err.Error())
+		a.writeSearchError(w, err)
+		return
+	}
+
+	httpx.WriteJSON(w, http.StatusOK, resp)
+}
+
+func (a *App) routeSavedSearchScope(w http.ResponseWriter, r *http.Request) {
+	savedSearchID, action, ok := parseSubResourcePath(r.URL.Path, "/v1/saved-searches/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && action == "":
+		a.handleGetSavedSearch(w, r, savedSearchID)
+	case r.Method == http.MethodPut && action == "":
+		a.handleUpdateSavedSearch(w, r, savedSearchID)
+	case r.Method == http.MethodDelete && action == "":
+		a.handleDeleteSavedSearch(w, r, savedSearchID)
+	case r.Method == http.MethodGet && action == "run":
+		a.handleRunSavedSearch(w, r, savedSearchID)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+type savedSearchRequest struct {
+	Name          string              `json:"name"`
+	Query         string              `json:"query"`
+	Types         []string            `json:"types"`
+	Facets        map[string][]string `json:"facets"`
+	EffectiveOnly bool                `json:"effectiveOnly"`
+	Subscribed    bool                `json:"subscribed"`
+}
+
+func (req savedSearchRequest) input(savedSearchID, ownerUserID string) search.SaveSearchInput {
+	return search.SaveSearchInput{
+		SavedSearchID: savedSearchID,
+		OwnerUserID:   ownerUserID,
+		Name:          req.Name,
+		Criteria: search.SearchCriteria{
+			Query:         req.Query,
+			Types:         req.Types,
+			Facets:        req.Facets,
+			EffectiveOnly: req.EffectiveOnly,
+		},
+		Subscribed: req.Subscribed,
+	}
+}
+
+func (a *App) handleCreateSavedSearch(w http.ResponseWriter, r *http.Request) {
+	user, err := a.authenticate(r)
+	if err != nil {
+		httpx.WriteError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	var req savedSearchRequest
+	if err := httpx.DecodeJSON(r, &req); err != nil {
+		httpx.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	resp, err := a.searchService.CreateSavedSearch(r.Context(), req.input("", user.ID))
+	if err != nil {
+		a.writeSearchError(w, err)
+		return
+	}
+
+	httpx.WriteJSON(w, http.StatusCreated, resp)
+}
+
+func (a *App) handleListSavedSearches(w http.ResponseWriter, r *http.Request) {
+	user, err := a.authenticate(r)
+	if err != nil {
+		httpx.WriteError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	resp, err := a.searchService.ListSavedSearches(r.Context(), user.ID)
+	if err != nil {
+		a.writeSearchError(w, err)
+		return
+	}
+
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{"savedSearches": resp})
+}
+
+func (a *App) handleGetSavedSearch(w http.ResponseWriter, r *http.Request, savedSearchID string) {
+	user, err := a.authenticate(r)
+	if err != nil {
+		httpx.WriteError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	resp, err := a.searchService.GetSavedSearch(r.Context(), savedSearchID, user.ID)
+	if err != nil {
+		a.writeSearchError(w, err)
+		return
+	}
+
+	httpx.WriteJSON(w, http.StatusOK, resp)
+}
+
+func (a *App) handleUpdateSavedSearch(w http.ResponseWriter, r *http.Request, savedSearchID string) {
+	user, err := a.authenticate(r)
+	if err != nil {
+		httpx.WriteError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	var req savedSearchRequest
+	if err := httpx.DecodeJSON(r, &req); err != nil {
+		httpx.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	resp, err := a.searchService.UpdateSavedSearch(r.Context(), req.input(savedSearchID, user.ID))
+	if err != nil {
+		a.writeSearchError(w, err)
+		return
+	}
+
+	httpx.WriteJSON(w, http.StatusOK, resp)
+}
+
+func (a *App) handleDeleteSavedSearch(w http.ResponseWriter, r *http.Request, savedSearchID string) {
+	user, err := a.authenticate(r)
+	if err != nil {
+		httpx.WriteError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	if err := a.searchService.DeleteSavedSearch(r.Context(), savedSearchID, user.ID); err != nil {
+		a.writeSearchError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *App) handleRunSavedSearch(w http.ResponseWriter, r *http.Request, savedSearchID string) {
+	user, err := a.authenticate(r)
+	if err != nil {
+		httpx.WriteError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	limit, err := parseIntQuery(r, "limit", 50)
+	if err != nil {
+		httpx.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	offset, err := parseIntQuery(r, "offset", 0)
+	if err != nil {
+		httpx.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	resp, err := a.searchService.RunSavedSearch(r.Context(), savedSearchID, user.ID, user.Role, limit, offset)
+	if err != nil {
+		a.writeSearchError(w, err)
 		return
 	}
 
 	httpx.WriteJSON(w, http.StatusOK, resp)
 }
 
+func (a *App) handleRelatedExperiments(w http.ResponseWriter, r *http.Request, experimentID string) {
+	user, err := a.authenticate(r)
+	if err != nil {
+		httpx.WriteError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	limit, err := parseIntQuery(r, "limit", 10)
+	if err != nil {
+		httpx.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	related, err := a.searchService.Related(r.Context(), search.RelatedInput{
+		ExperimentID: experimentID,
+		UserID:       user.ID,
+		Role:         user.Role,
+		Limit:        limit,
+	})
+	if err != nil {
+		a.writeSearchError(w, err)
+		return
+	}
+
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{
+		"experimentId": experimentID,
+		"related":      related,
+	})
+}
+
+func (a *App) writeSearchError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, search.ErrNotFound):
+		httpx.WriteError(w, http.StatusNotFound, "not found")
+	case errors.Is(err, search.ErrConflict):
+		httpx.WriteError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, search.ErrInvalidInput):
+		httpx.WriteError(w, http.StatusBadRequest, err.Error())
+	default:
+		httpx.WriteError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
 // ---------------------------------------------------------------------------
 // User management handlers
 // ---------------------------------------------------------------------------
@@ -2159,138 +2600,436 @@ func (a *App) handleListSignatures(w http.ResponseWriter, r *http.Request, exper
 	httpx.WriteJSON(w, http.StatusOK, map[string]any{"signatures": resp})
 }
 
-func (a *App) handleVerifySignatures(w http.ResponseWriter, r *http.Request, experimentID string) {
+func (a *App) handleVerifySignatures(w http.ResponseWriter, r *http.Request, experimentID string) {
+	user, err := a.authenticate(r)
+	if err != nil {
+		httpx.WriteError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	resp, err := a.signatureService.VerifySignatures(r.Context(), experimentID, user.ID, user.Role)
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	httpx.WriteJSON(w, http.StatusOK, resp)
+}
+
+// ---------------------------------------------------------------------------
+// Notification handlers
+// ---------------------------------------------------------------------------
+
+func (a *App) handleListNotifications(w http.ResponseWriter, r *http.Request) {
+	user, err := a.authenticate(r)
+	if err != nil {
+		httpx.WriteError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	unreadOnly := strings.TrimSpace(r.URL.Query().Get("unreadOnly")) == "true"
+	limit, err2 := parseIntQuery(r, "limit", 50)
+	if err2 != nil {
+		httpx.WriteError(w, http.StatusBadRequest, err2.Error())
+		return
+	}
+
+	resp, err := a.notifService.List(r.Context(), notifications.ListInput{
+		UserID:     user.ID,
+		UnreadOnly: unreadOnly,
+		Limit:      limit,
+	})
+	if err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{"notifications": resp})
+}
+
+func (a *App) handleMarkNotificationRead(w http.ResponseWriter, r *http.Request) {
+	user, err := a.authenticate(r)
+	if err != nil {
+		httpx.WriteError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	// Extract notification ID from path: /v1/notifications/{id}/read
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 4 {
+		http.NotFound(w, r)
+		return
+	}
+	notifID := parts[2]
+
+	if err := a.notifService.MarkRead(r.Context(), notifID, user.ID); err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *App) handleMarkAllNotificationsRead(w http.ResponseWriter, r *http.Request) {
+	user, err := a.authenticate(r)
+	if err != nil {
+		httpx.WriteError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	if _, err := a.notifService.MarkAllRead(r.Context(), user.ID); err != nil {
+		httpx.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ---------------------------------------------------------------------------
+// Data Visualization handlers
+// ---------------------------------------------------------------------------
+
+func (a *App) handleParseCSV(w http.ResponseWriter, r *http.Request) {
+	user, err := a.authenticate(r)
+	if err != nil {
+		httpx.WriteError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	type request struct {
+		AttachmentID string `json:"attachmentId"`
+		ExperimentID string `json:"experimentId"`
+		CsvData      string `json:"csvData"`
+	}
+	var req request
+	if err := httpx.DecodeJSON(r, &req); err != nil {
+		httpx.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	resp, err := a.datavisService.ParseCSV(r.Context(), datavis.ParseCSVInput{
+		AttachmentID: req.AttachmentID,
+		ExperimentID: req.ExperimentID,
+		CSVData:      []byte(req.CsvData),
+		ActorUserID:  user.ID,
+	})
+	if err != nil {
+		a.writeDatavisError(w, err)
+		return
+	}
+
+	httpx.WriteJSON(w, http.StatusCreated, resp)
+}
+
+// handleParseData creates extracts from CSV, TSV or XLSX content. Text is
+// sent in data, binary workbooks in dataBase64; with neither, the stored
+// attachment is read.
+func (a *App) handleParseData(w http.ResponseWriter, r *http.Request) {
+	user, err := a.authenticate(r)
+	if err != nil {
+		httpx.WriteError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	type request struct {
+		AttachmentID string   `json:"attachmentId"`
+		ExperimentID string   `json:"experimentId"`
+		Format       string   `json:"format"`
+		Data         string   `json:"data"`
+		DataBase64   string   `json:"dataBase64"`
+		HeaderRow    int      `json:"headerRow"`
+		Sheets       []string `json:"sheets"`
+	}
+	var req request
+	if err := httpx.DecodeJSON(r, &req); err != nil {
+		httpx.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	data, err := decodeDataUpload(req.Data, req.DataBase64)
+	if err != nil {
+		httpx.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	extracts, err := a.datavisService.ParseTable(r.Context(), datavis.ParseInput{
+		AttachmentID: req.AttachmentID,
+		ExperimentID: req.ExperimentID,
+		ActorUserID:  user.ID,
+		Data:         data,
+		Format:       req.Format,
+		HeaderRow:    req.HeaderRow,
+		Sheets:       req.Sheets,
+	})
+	if err != nil {
+		a.writeDatavisError(w, err)
+		return
+	}
+
+	httpx.WriteJSON(w, http.StatusCreated, map[string]any{"dataExtracts": extracts})
+}
+
+// decodeDataUpload returns text sent in data or binary content sent in
+// dataBase64.
+func decodeDataUpload(data, dataBase64 string) ([]byte, error) {
+	if dataBase64 == "" {
+		return []byte(data), nil
+	}
+	if data != "" {
+		return nil, errors.New("data and dataBase64 are mutually exclusive")
+	}
+	decoded, err := base64.StdEncoding.DecodeString(dataBase64)
+	if err != nil {
+		return nil, errors.New("dataBase64 is not valid base64")
+	}
+	return decoded, nil
+}
+
+// handleParsePlate creates a tidy well-level extract from a plate-reader
+// export, optionally applying a plate layout.
+func (a *App) handleParsePlate(w http.ResponseWriter, r *http.Request) {
+	user, err := a.authenticate(r)
+	if err != nil {
+		httpx.WriteError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	type request struct {
+		AttachmentID  string `json:"attachmentId"`
+		ExperimentID  string `json:"experimentId"`
+		Format        string `json:"format"`
+		Data          string `json:"data"`
+		DataBase64    string `json:"dataBase64"`
+		Sheet         string `json:"sheet"`
+		PlateFormat   int    `json:"plateFormat"`
+		PlateLayoutID string `json:"plateLayoutId"`
+	}
+	var req request
+	if err := httpx.DecodeJSON(r, &req); err != nil {
+		httpx.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	data, err := decodeDataUpload(req.Data, req.DataBase64)
+	if err != nil {
+		httpx.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	resp, err := a.datavisService.ParsePlate(r.Context(), datavis.ParsePlateInput{
+		AttachmentID:  req.AttachmentID,
+		ExperimentID:  req.ExperimentID,
+		ActorUserID:   user.ID,
+		Data:          data,
+		Format:        req.Format,
+		Sheet:         req.Sheet,
+		PlateFormat:   req.PlateFormat,
+		PlateLayoutID: req.PlateLayoutID,
+	})
+	if err != nil {
+		a.writeDatavisError(w, err)
+		return
+	}
+
+	httpx.WriteJSON(w, http.StatusCreated, resp)
+}
+
+func (a *App) handleCreatePlateLayout(w http.ResponseWriter, r *http.Request) {
+	user, err := a.authenticate(r)
+	if err != nil {
+		httpx.WriteError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	type request struct {
+		ExperimentID string                   `json:"experimentId"`
+		Name         string                   `json:"name"`
+		PlateFormat  int                      `json:"plateFormat"`
+		Assignments  []datavis.WellAssignment `json:"assignments"`
+	}
+	var req request
+	if err := httpx.DecodeJSON(r, &req); err != nil {
+		httpx.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	resp, err := a.datavisService.CreatePlateLayout(r.Context(), datavis.CreatePlateLayoutInput{
+		ExperimentID:  req.ExperimentID,
+		CreatorUserID: user.ID,
+		DeviceID:      user.DeviceID,
+		Name:          req.Name,
+		PlateFormat:   req.PlateFormat,
+		Assignments:   req.Assignments,
+	})
+	if err != nil {
+		a.writeDatavisError(w, err)
+		return
+	}
+
+	httpx.WriteJSON(w, http.StatusCreated, resp)
+}
+
+func (a *App) handleListPlateLayouts(w http.ResponseWriter, r *http.Request) {
+	user, err := a.authenticate(r)
+	if err != nil {
+		httpx.WriteError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	experimentID := strings.TrimSpace(r.URL.Query().Get("experimentId"))
+	if experimentID == "" {
+		httpx.WriteError(w, http.StatusBadRequest, "experimentId is required")
+		return
+	}
+
+	resp, err := a.datavisService.ListPlateLayouts(r.Context(), experimentID, user.ID, user.Role)
+	if err != nil {
+		a.writeDatavisError(w, err)
+		return
+	}
+
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{"plateLayouts": resp})
+}
+
+func (a *App) handleGetPlateLayout(w http.ResponseWriter, r *http.Request) {
 	user, err := a.authenticate(r)
 	if err != nil {
 		httpx.WriteError(w, http.StatusUnauthorized, "unauthorized")
 		return
 	}
 
-	resp, err := a.signatureService.VerifySignatures(r.Context(), experimentID, user.ID, user.Role)
+	layoutID := strings.TrimPrefix(r.URL.Path, "/v1/data/plate-layouts/")
+	layoutID = strings.TrimSuffix(layoutID, "/")
+
+	resp, err := a.datavisService.GetPlateLayout(r.Context(), layoutID, user.ID, user.Role)
 	if err != nil {
-		httpx.WriteError(w, http.StatusInternalServerError, err.Error())
+		a.writeDatavisError(w, err)
 		return
 	}
 
 	httpx.WriteJSON(w, http.StatusOK, resp)
 }
 
-// ---------------------------------------------------------------------------
-// Notification handlers
-// ---------------------------------------------------------------------------
-
-func (a *App) handleListNotifications(w http.ResponseWriter, r *http.Request) {
+func (a *App) handleCreateAnalysis(w http.ResponseWriter, r *http.Request) {
 	user, err := a.authenticate(r)
 	if err != nil {
 		httpx.WriteError(w, http.StatusUnauthorized, "unauthorized")
 		return
 	}
 
-	unreadOnly := strings.TrimSpace(r.URL.Query().Get("unreadOnly")) == "true"
-	limit, err2 := parseIntQuery(r, "limit", 50)
-	if err2 != nil {
-		httpx.WriteError(w, http.StatusBadRequest, err2.Error())
+	type request struct {
+		ExperimentID  string                     `json:"experimentId"`
+		DataExtractID string                     `json:"dataExtractId"`
+		AnalysisType  string                     `json:"analysisType"`
+		Parameters    datavis.AnalysisParameters `json:"parameters"`
+	}
+	var req request
+	if err := httpx.DecodeJSON(r, &req); err != nil {
+		httpx.WriteError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	resp, err := a.notifService.List(r.Context(), notifications.ListInput{
-		UserID:     user.ID,
-		UnreadOnly: unreadOnly,
-		Limit:      limit,
+	resp, err := a.datavisService.CreateAnalysis(r.Context(), datavis.CreateAnalysisInput{
+		ExperimentID:  req.ExperimentID,
+		DataExtractID: req.DataExtractID,
+		CreatorUserID: user.ID,
+		DeviceID:      user.DeviceID,
+		AnalysisType:  req.AnalysisType,
+		Parameters:    req.Parameters,
 	})
 	if err != nil {
-		httpx.WriteError(w, http.StatusInternalServerError, err.Error())
+		a.writeDatavisError(w, err)
 		return
 	}
 
-	httpx.WriteJSON(w, http.StatusOK, map[string]any{"notifications": resp})
+	httpx.WriteJSON(w, http.StatusCreated, resp)
 }
 
-func (a *App) handleMarkNotificationRead(w http.ResponseWriter, r *http.Request) {
+func (a *App) handleListAnalyses(w http.ResponseWriter, r *http.Request) {
 	user, err := a.authenticate(r)
 	if err != nil {
 		httpx.WriteError(w, http.StatusUnauthorized, "unauthorized")
 		return
 	}
 
-	// Extract notification ID from path: /v1/notifications/{id}/read
-	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
-	if len(parts) < 4 {
-		http.NotFound(w, r)
+	experimentID := strings.TrimSpace(r.URL.Query().Get("experimentId"))
+	if experimentID == "" {
+		httpx.WriteError(w, http.StatusBadRequest, "experimentId is required")
 		return
 	}
-	notifID := parts[2]
 
-	if err := a.notifService.MarkRead(r.Context(), notifID, user.ID); err != nil {
-		httpx.WriteError(w, http.StatusInternalServerError, err.Error())
+	resp, err := a.datavisService.ListAnalyses(r.Context(), experimentID, user.ID, user.Role)
+	if err != nil {
+		a.writeDatavisError(w, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusNoContent)
+	httpx.WriteJSON(w, http.StatusOK, map[string]any{"analyses": resp})
 }
 
-func (a *App) handleMarkAllNotificationsRead(w http.ResponseWriter, r *http.Request) {
+func (a *App) handleGetAnalysis(w http.ResponseWriter, r *http.Request) {
 	user, err := a.authenticate(r)
 	if err != nil {
 		httpx.WriteError(w, http.StatusUnauthorized, "unauthorized")
 		return
 	}
 
-	if _, err := a.notifService.MarkAllRead(r.Context(), user.ID); err != nil {
-		httpx.WriteError(w, http.StatusInternalServerError, err.Error())
+	analysisID := strings.TrimPrefix(r.URL.Path, "/v1/data/analyses/")
+	analysisID = strings.TrimSuffix(analysisID, "/")
+
+	resp, err := a.datavisService.GetAnalysis(r.Context(), analysisID, user.ID, user.Role)
+	if err != nil {
+		a.writeDatavisError(w, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusNoContent)
+	httpx.WriteJSON(w, http.StatusOK, resp)
 }
 
-// ---------------------------------------------------------------------------
-// Data Visualization handlers
-// ---------------------------------------------------------------------------
-
-func (a *App) handleParseCSV(w http.ResponseWriter, r *http.Request) {
+func (a *App) handleGetDataExtract(w http.ResponseWriter, r *http.Request) {
 	user, err := a.authenticate(r)
 	if err != nil {
 		httpx.WriteError(w, http.StatusUnauthorized, "unauthorized")
 		return
 	}
 
-	type request struct {
-		AttachmentID string `json:"attachmentId"`
-		ExperimentID string `json:"experimentId"`
-		CsvData      string `json:"csvData"`
-	}
-	var req request
-	if err := httpx.DecodeJSON(r, &req); err != nil {
-		httpx.WriteError(w, http.StatusBadRequest, err.Error())
-		return
-	}
+	extractID := strings.TrimPrefix(r.URL.Path, "/v1/data/extracts/")
+	extractID = strings.TrimSuffix(extractID, "/")
 
-	resp, err := a.datavisService.ParseCSV(r.Context(), datavis.ParseCSVInput{
-		AttachmentID: req.AttachmentID,
-		ExperimentID: req.ExperimentID,
-		CSVData:      []byte(req.CsvData),
-		ActorUserID:  user.ID,
-	})
+	resp, err := a.datavisService.GetDataExtract(r.Context(), extractID, user.ID, user.Role)
 	if err != nil {
 		a.writeDatavisError(w, err)
 		return
 	}
 
-	httpx.WriteJSON(w, http.StatusCreated, resp)
+	httpx.WriteJSON(w, http.StatusOK, resp)
 }
 
-func (a *App) handleGetDataExtract(w http.ResponseWriter, r *http.Request) {
+func (a *App) handleGetExtractRows(w http.ResponseWriter, r *http.Request) {
 	user, err := a.authenticate(r)
 	if err != nil {
 		httpx.WriteError(w, http.StatusUnauthorized, "unauthorized")
 		return
 	}
 
-	extractID := strings.TrimPrefix(r.URL.Path, "/v1/data/extracts/")
-	extractID = strings.TrimSuffix(extractID, "/")
+	// /v1/data/extracts/{id}/rows
+	extractID := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v1/data/extracts/"), "/rows")
+	offset, err := parseIntQuery(r, "offset", 0)
+	if err != nil {
+		httpx.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	limit, err := parseIntQuery(r, "limit", 100)
+	if err != nil {
+		httpx.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
-	resp, err := a.datavisService.GetDataExtract(r.Context(), extractID, user.ID, user.Role)
+	resp, err := a.datavisService.GetExtractRows(r.Context(), datavis.ExtractRowsInput{
+		DataExtractID: extractID,
+		UserID:        user.ID,
+		Role:          user.Role,
+		Offset:        offset,
+		Limit:         limit,
+	})
 	if err != nil {
 		a.writeDatavisError(w, err)
 		return
@@ -2322,20 +3061,37 @@ func (a *App) handleCreateChart(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// options is the spec's name from before specs were typed. It is read
+	// leniently, as stored options are, so keys a spec does not have are
+	// dropped rather than rejected.
 	type request struct {
-		ExperimentID  string         `json:"experimentId"`
-		DataExtractID string         `json:"dataExtractId"`
-		ChartType     string         `json:"chartType"`
-		Title         string         `json:"title"`
-		XColumn       string         `json:"xColumn"`
-		YColumns      []string       `json:"yColumns"`
-		Options       map[string]any `json:"options"`
+		ExperimentID  string             `json:"experimentId"`
+		DataExtractID string             `json:"dataExtractId"`
+		ChartType     string             `json:"chartType"`
+		Title         string             `json:"title"`
+		XColumn       string             `json:"xColumn"`
+		YColumns      []string           `json:"yColumns"`
+		Spec          *datavis.ChartSpec `json:"spec"`
+		Options       json.RawMessage    `json:"options"`
 	}
 	var req request
 	if err := httpx.DecodeJSON(r, &req); err != nil {
 		httpx.WriteError(w, http.StatusBadRequest, err.Error())
 		return
 	}
+	var spec datavis.ChartSpec
+	switch {
+	case req.Spec != nil && len(req.Options) > 0:
+		httpx.WriteError(w, http.StatusBadRequest, "send spec or options, not both")
+		return
+	case req.Spec != nil:
+		spec = *req.Spec
+	case len(req.Options) > 0 && string(req.Options) != "null":
+		if err := json.Unmarshal(req.Options, &spec); err != nil {
+			httpx.WriteError(w, http.StatusBadRequest, "invalid options: "+err.Error())
+			return
+		}
+	}
 
 	resp, err := a.datavisService.CreateChartConfig(r.Context(), datavis.CreateChartInput{
 		ExperimentID:  req.ExperimentID,
@@ -2346,7 +3102,7 @@ func (a *App) handleCreateChart(w http.ResponseWriter, r *http.Request) {
 		Title:         req.Title,
 		XColumn:       req.XColumn,
 		YColumns:      req.YColumns,
-		Options:       req.Options,
+		Spec:          spec,
 	})
 	if err != nil {
 		a.writeDatavisError(w, err)
@@ -2378,6 +3134,74 @@ func (a *App) handleListCharts(w http.ResponseWriter, r *http.Request) {
 	httpx.WriteJSON(w, http.StatusOK, map[string]any{"charts": resp})
 }
 
+func (a *App) handleGetChartData(w http.ResponseWriter, r *http.Request) {
+	user, err := a.authenticate(r)
+	if err != nil {
+		httpx.WriteError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	// /v1/charts/{id}/data
+	chartID := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v1/charts/"), "/data")
+	maxPoints, err := parseIntQuery(r, "maxPoints", 0)
+	if err != nil {
+		httpx.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	resp, err := a.datavisService.GetChartData(r.Context(), datavis.ChartDataInput{
+		ChartConfigID: chartID,
+		UserID:        user.ID,
+		Role:          user.Role,
+		MaxPoints:     maxPoints,
+	})
+	if err != nil {
+		a.writeDatavisError(w, err)
+		return
+	}
+
+	httpx.WriteJSON(w, http.StatusOK, resp)
+}
+
+func (a *App) handleGetChartImage(w http.ResponseWriter, r *http.Request) {
+	user, err := a.authenticate(r)
+	if err != nil {
+		httpx.WriteError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	// /v1/charts/{id}/image
+	chartID := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v1/charts/"), "/image")
+	width, err := parseIntQuery(r, "width", 0)
+	if err != nil {
+		httpx.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	height, err := parseIntQuery(r, "height", 0)
+	if err != nil {
+		httpx.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	img, err := a.datavisService.RenderChart(r.Context(), datavis.ChartImageInput{
+		ChartConfigID: chartID,
+		UserID:        user.ID,
+		Role:          user.Role,
+		Format:        strings.TrimSpace(r.URL.Query().Get("format")),
+		Width:         width,
+		Height:        height,
+	})
+	if err != nil {
+		a.writeDatavisError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", img.ContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(img.Data)))
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(img.Data)
+}
+
 // ---------------------------------------------------------------------------
 // Template handlers
 // ---------------------------------------------------------------------------
@@ -2604,7 +3428,23 @@ func (a *App) handleGetAttachmentPreview(w http.ResponseWriter, r *http.Request)
 	}
 	attachmentID := parts[2]
 
-	resp, err := a.previewService.GetPreviewForAttachment(r.Context(), attachmentID, user.ID, user.Role)
+	want := previews.RenditionRequest{Name: strings.TrimSpace(r.URL.Query().Get("size"))}
+	if want.Name != "" {
+		if err := previews.ValidateRenditionName(want.Name); err != nil {
+			httpx.WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if raw := strings.TrimSpace(r.URL.Query().Get("maxDim")); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			httpx.WriteError(w, http.StatusBadRequest, "maxDim must be a positive integer")
+			return
+		}
+		want.MaxDim = n
+	}
+
+	resp, err := a.previewService.GetPreviewForAttachment(r.Context(), attachmentID, user.ID, user.Role, want)
 	if err != nil {
 		a.writePreviewError(w, err)
 		return
@@ -2628,59 +3468,39 @@ func (a *App) handleGeneratePreview(w http.ResponseWriter, r *http.Request) {
 	}
 	attachmentID := parts[2]
 
-	// Read raw image data from multipart or base64 JSON body
-	var imageData []byte
-	var sourceMime string
+	// Previews are rendered by the worker from the stored object; this only
+	// queues the job, or requeues one that has exhausted its retries.
+	resp, err := a.previewService.RequestPreview(r.Context(), attachmentID, user.ID, user.Role)
+	if err != nil {
+		a.writePreviewError(w, err)
+		return
+	}
 
-	ct := r.Header.Get("Content-Type")
-	if strings.HasPrefix(ct, "multipart/") {
-		if err := r.ParseMultipartForm(10 << 20); err != nil { // 10 MB max
-			httpx.WriteError(w, http.StatusBadRequest, "invalid multipart data")
-			return
-		}
-		file, header, err := r.FormFile("image")
-		if err != nil {
-			httpx.WriteError(w, http.StatusBadRequest, "image field is required")
-			return
-		}
-		defer file.Close()
-		imageData, err = io.ReadAll(file)
-		if err != nil {
-			httpx.WriteError(w, http.StatusBadRequest, "cannot read image data")
-			return
-		}
-		sourceMime = header.Header.Get("Content-Type")
-	} else {
-		type request struct {
-			ImageBase64 string `json:"imageBase64"`
-			MimeType    string `json:"mimeType"`
-		}
-		var req request
-		if err := httpx.DecodeJSON(r, &req); err != nil {
-			httpx.WriteError(w, http.StatusBadRequest, err.Error())
-			return
-		}
-		decoded, err := decodeBase64(req.ImageBase64)
-		if err != nil {
-			httpx.WriteError(w, http.StatusBadRequest, "invalid base64 image data")
-			return
-		}
-		imageData = decoded
-		sourceMime = req.MimeType
+	httpx.WriteJSON(w, http.StatusAccepted, resp)
+}
+
+func (a *App) handleGetPreviewJob(w http.ResponseWriter, r *http.Request) {
+	user, err := a.authenticate(r)
+	if err != nil {
+		httpx.WriteError(w, http.StatusUnauthorized, "unauthorized")
+		return
 	}
 
-	resp, err := a.previewService.GenerateThumbnail(r.Context(), previews.GenerateInput{
-		AttachmentID: attachmentID,
-		ImageData:    imageData,
-		SourceMime:   sourceMime,
-		ActorUserID:  user.ID,
-	})
+	// /v1/attachments/{id}/preview-job
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 4 {
+		http.NotFound(w, r)
+		return
+	}
+	attachmentID := parts[2]
+
+	resp, err := a.previewService.GetJobForAttachment(r.Context(), attachmentID, user.ID, user.Role)
 	if err != nil {
 		a.writePreviewError(w, err)
 		return
 	}
 
-	httpx.WriteJSON(w, http.StatusCreated, resp)
+	httpx.WriteJSON(w, http.StatusOK, resp)
 }
 
 func (a *App) handleListExperimentPreviews(w http.ResponseWriter, r *http.Request, experimentID string) {
@@ -2725,28 +3545,36 @@ func (a *App) handleAddTag(w http.ResponseWriter, r *http.Request, experimentID
 		return
 	}
 
-	// Upsert tag, then link
+	// Upsert the tag in the user's namespace, then link
 	_, err = a.db.ExecContext(r.Context(),
-		`INSERT INTO tags (name) VALUES ($1) ON CONFLICT (name) DO NOTHING`, tag)
+		`INSERT INTO tags (owner_user_id, name) VALUES ($1, $2) ON CONFLICT (owner_user_id, name) DO NOTHING`, user.ID, tag)
 	if err != nil {
 		httpx.WriteError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
 	var tagID string
-	err = a.db.QueryRowContext(r.Context(), `SELECT id FROM tags WHERE name = $1`, tag).Scan(&tagID)
+	err = a.db.QueryRowContext(r.Context(), `SELECT id FROM tags WHERE owner_user_id = $1 AND name = $2`, user.ID, tag).Scan(&tagID)
 	if err != nil {
 		httpx.WriteError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	_, err = a.db.ExecContext(r.Context(),
-		`INSERT INTO experiment_tags (experiment_id, tag_id, added_by) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`,
-		experimentID, tagID, user.ID)
+	result, err := a.db.ExecContext(r.Context(),
+		`INSERT INTO experiment_tags (experiment_id, tag_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`,
+		experimentID, tagID)
 	if err != nil {
 		httpx.WriteError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+	// Audited so that saved search alerts see newly tagged experiments.
+	if n, _ := result.RowsAffected(); n > 0 {
+		if err := internaldb.AppendAuditEvent(r.Context(), a.db, user.ID, "experiment.tag_added", "experiment", experimentID, map[string]any{
+			"tag": tag,
+		}); err != nil {
+			log.Printf("WARN: audit tag %q on experiment %s failed: %v", tag, experimentID, err)
+		}
+	}
 
 	httpx.WriteJSON(w, http.StatusCreated, map[string]string{"tagId": tagID, "tag": tag})
 }
@@ -2791,10 +3619,6 @@ func (a *App) handleListTags(w http.ResponseWriter, r *http.Request, experimentI
 // Utility
 // ---------------------------------------------------------------------------
 
-func decodeBase64(s string) ([]byte, error) {
-	return base64.StdEncoding.DecodeString(s)
-}
-
 // Ensure json and io imports are used
 var (
 	_ = json.Unmarshal
@@ -2932,6 +3756,14 @@ func (a *App) writeAttachmentError(w http.ResponseWriter, err error) {
 		httpx.WriteError(w, http.StatusNotFound, "not found")
 	case errors.Is(err, attachments.ErrInvalidInput):
 		httpx.WriteError(w, http.StatusBadRequest, "invalid input")
+	case errors.Is(err, attachments.ErrIntegrityMismatch):
+		httpx.WriteError(w, http.StatusConflict, "uploaded object does not match reported checksum or size")
+	case errors.Is(err, attachments.ErrVersionConflict):
+		httpx.WriteError(w, http.StatusConflict, "attachment has already been superseded by a newer version")
+	case errors.Is(err, attachments.ErrScanPending):
+		httpx.WriteError(w, http.StatusConflict, "attachment is awaiting content scan")
+	case errors.Is(err, attachments.ErrQuarantined):
+		httpx.WriteError(w, http.StatusLocked, "attachment is quarantined")
 	default:
 		httpx.WriteError(w, http.StatusInternalServerError, err.Error())
 	}
@@ -3974,6 +4806,15 @@ func (a *App) Run(ctx context.Context) error {
 	if a.cfg.ReconcileScheduleEnabled {
 		go a.runReconcileScheduler(ctx)
 	}
+	if a.attachmentService.ScanningEnabled() {
+		go a.runAttachmentScanWorker(ctx)
+	}
+	if a.cfg.PreviewWorkerEnabled {
+		go a.runPreviewWorker(ctx)
+	}
+	if a.cfg.SavedSearchAlertsEnabled {
+		go a.runSearchAlertWorker(ctx)
+	}
 
 	srv := &http.Server{
 		Addr:              a.cfg.HTTPAddr,
@@ -4068,6 +4909,131 @@ func (a *App) runReconcileSchedulerTick(ctx context.Context) {
 	})
 }
 
+func (a *App) runAttachmentScanWorker(ctx context.Context) {
+	ticker := time.NewTicker(a.cfg.AttachmentScanInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			out, err := a.attachmentService.ScanPending(ctx, attachments.ScanInput{
+				Limit:       a.cfg.AttachmentScanBatchSize,
+				MaxAttempts: a.cfg.AttachmentScanMaxAttempts,
+			})
+			if err != nil {
+				log.Printf("WARN: attachment scan run failed: %v", err)
+			}
+			a.notifyQuarantinedAttachments(ctx, out.Quarantined)
+			a.notifyExhaustedScans(ctx, out.Exhausted)
+		}
+	}
+}
+
+func (a *App) runPreviewWorker(ctx context.Context) {
+	ticker := time.NewTicker(a.cfg.PreviewWorkerInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := a.previewService.EnqueueCompleted(ctx, a.cfg.PreviewBatchSize); err != nil {
+				log.Printf("WARN: preview backfill failed: %v", err)
+			}
+			if _, err := a.previewService.ProcessJobs(ctx, previews.ProcessInput{Limit: a.cfg.PreviewBatchSize}); err != nil {
+				log.Printf("WARN: preview worker run failed: %v", err)
+			}
+		}
+	}
+}
+
+func (a *App) runSearchAlertWorker(ctx context.Context) {
+	ticker := time.NewTicker(a.cfg.SavedSearchAlertInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := a.searchService.ProcessAlerts(ctx, a.cfg.SavedSearchAlertBatchSize, a.notifySearchAlert); err != nil {
+				log.Printf("WARN: saved search alert run failed: %v", err)
+			}
+		}
+	}
+}
+
+// notifySearchAlert notifies the owner of a subscribed saved search about
+// a record that started matching it, in the transaction recording the alert.
+func (a *App) notifySearchAlert(ctx context.Context, tx *sql.Tx, alert search.Alert) error {
+	recordID := alert.RecordID
+	title := fmt.Sprintf("New match for %q", alert.SearchName)
+	body := fmt.Sprintf("The %s %q now matches your saved search %q.", alert.RecordType, alert.Title, alert.SearchName)
+	return a.notifService.CreateWith(ctx, tx, alert.OwnerUserID, "search.alert", title, body, alert.RecordType, &recordID)
+}
+
+// enqueuePreview queues preview generation for a completed upload. Failures
+// are only logged; the worker's backfill picks up missed attachments.
+func (a *App) enqueuePreview(ctx context.Context, attachmentID, actorUserID string) {
+	if _, err := a.previewService.Enqueue(ctx, attachmentID, actorUserID); err != nil {
+		log.Printf("WARN: enqueue preview for attachment %s failed: %v", attachmentID, err)
+	}
+}
+
+// notifyQuarantinedAttachments alerts every admin and the experiment owner
+// about attachments a content scanner has quarantined.
+func (a *App) notifyQuarantinedAttachments(ctx context.Context, quarantined []attachments.QuarantinedAttachment) {
+	if len(quarantined) == 0 {
+		return
+	}
+	admins, err := a.userService.ListAdminUsers(ctx)
+	if err != nil {
+		log.Printf("list admins for quarantine notification failed: %v", err)
+	}
+	for _, q := range quarantined {
+		attachmentID := q.AttachmentID
+		title := "Attachment quarantined"
+		body := fmt.Sprintf("Object: %s\nScanner: %s\nReason: %s", q.ObjectKey, q.Scanner, q.Reason)
+		for _, admin := range admins {
+			if notifyErr := a.notifService.Create(ctx, admin.ID, "attachment.quarantined", title, body, "attachment", &attachmentID); notifyErr != nil {
+				log.Printf("notify admin %s for quarantined attachment failed: %v", admin.Email, notifyErr)
+			}
+		}
+		if notifyErr := a.notifService.CreateForExperimentOwner(ctx, q.ExperimentID, "attachment.quarantined", title, body); notifyErr != nil {
+			log.Printf("notify owner for quarantined attachment failed: %v", notifyErr)
+		}
+	}
+}
+
+// notifyExhaustedScans alerts every admin and the experiment owner about
+// attachments whose scans failed on every allowed attempt, since nothing
+// retries them afterwards.
+func (a *App) notifyExhaustedScans(ctx context.Context, exhausted []attachments.ExhaustedScan) {
+	if len(exhausted) == 0 {
+		return
+	}
+	admins, err := a.userService.ListAdminUsers(ctx)
+	if err != nil {
+		log.Printf("list admins for scan failure notification failed: %v", err)
+	}
+	for _, f := range exhausted {
+		attachmentID := f.AttachmentID
+		title := "Attachment scan failed"
+		body := fmt.Sprintf("Object: %s\nScanner: %s\nError: %s\nGave up after %d attempts; the attachment cannot be downloaded.", f.ObjectKey, f.Scanner, f.Error, f.Attempts)
+		for _, admin := range admins {
+			if notifyErr := a.notifService.Create(ctx, admin.ID, "attachment.scan_failed", title, body, "attachment", &attachmentID); notifyErr != nil {
+				log.Printf("notify admin %s for failed attachment scan failed: %v", admin.Email, notifyErr)
+			}
+		}
+		if notifyErr := a.notifService.CreateForExperimentOwner(ctx, f.ExperimentID, "attachment.scan_failed", title, body); notifyErr != nil {
+			log.Printf("notify owner for failed attachment scan failed: %v", notifyErr)
+		}
+	}
+}
+
 func (a *App) resolveReconcileSchedulerActorUserID(ctx context.Context) (string, error) {
 	actorEmail := strings.TrimSpace(a.cfg.ReconcileScheduleActorEmail)
 	if actorEmail == "" {
@@ -0,0 +1,126 @@
+package attachments
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+const clamdChunkSize = 64 * 1024
+
+// ClamdScanner streams object content to a ClamAV daemon using the clamd
+// INSTREAM command.
+type ClamdScanner struct {
+	network string
+	address string
+	timeout time.Duration
+}
+
+// NewClamdScanner accepts "tcp://host:port", "unix:///path/to/clamd.sock" or a
+// bare "host:port".
+func NewClamdScanner(address string, timeout time.Duration) (*ClamdScanner, error) {
+	address = strings.TrimSpace(address)
+	network := "tcp"
+	switch {
+	case strings.HasPrefix(address, "unix://"):
+		network = "unix"
+		address = strings.TrimPrefix(address, "unix://")
+	case strings.HasPrefix(address, "tcp://"):
+		address = strings.TrimPrefix(address, "tcp://")
+	}
+	if address == "" {
+		return nil, errors.New("clamd address is required")
+	}
+	if timeout <= 0 {
+		timeout = 60 * time.Second
+	}
+	return &ClamdScanner{network: network, address: address, timeout: timeout}, nil
+}
+
+func (c *ClamdScanner) Name() string {
+	return "clamd"
+}
+
+func (c *ClamdScanner) Scan(ctx context.Context, target ScanTarget, content io.Reader) (ScanVerdict, error) {
+	dialer := net.Dialer{Timeout: c.timeout}
+	conn, err := dialer.DialContext(ctx, c.network, c.address)
+	if err != nil {
+		return ScanVerdict{}, fmt.Errorf("connect clamd: %w", err)
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(c.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		return ScanVerdict{}, fmt.Errorf("set clamd deadline: %w", err)
+	}
+
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return ScanVerdict{}, fmt.Errorf("send clamd command: %w", err)
+	}
+
+	buf := make([]byte, clamdChunkSize)
+	var sizePrefix [4]byte
+	var streamed int64
+	for {
+		n, readErr := content.Read(buf)
+		if n > 0 {
+			binary.BigEndian.PutUint32(sizePrefix[:], uint32(n))
+			if _, err := conn.Write(sizePrefix[:]); err != nil {
+				return ScanVerdict{}, fmt.Errorf("stream to clamd: %w", err)
+			}
+			if _, err := conn.Write(buf[:n]); err != nil {
+				return ScanVerdict{}, fmt.Errorf("stream to clamd: %w", err)
+			}
+			streamed += int64(n)
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return ScanVerdict{}, fmt.Errorf("read object for clamd: %w", readErr)
+		}
+	}
+	binary.BigEndian.PutUint32(sizePrefix[:], 0)
+	if _, err := conn.Write(sizePrefix[:]); err != nil {
+		return ScanVerdict{}, fmt.Errorf("finish clamd stream: %w", err)
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && !(errors.Is(err, io.EOF) && reply != "") {
+		return ScanVerdict{}, fmt.Errorf("read clamd reply: %w", err)
+	}
+	return parseClamdReply(strings.TrimRight(reply, "\x00\n"), streamed)
+}
+
+// parseClamdReply interprets "stream: OK", "stream: <signature> FOUND" and
+// "<message> ERROR" replies.
+func parseClamdReply(reply string, streamed int64) (ScanVerdict, error) {
+	verdict := ScanVerdict{
+		Scanner: "clamd",
+		Details: map[string]any{"bytesScanned": streamed},
+	}
+	body := strings.TrimSpace(strings.TrimPrefix(reply, "stream:"))
+	switch {
+	case body == "OK":
+		verdict.Clean = true
+		return verdict, nil
+	case strings.HasSuffix(body, " FOUND"):
+		signature := strings.TrimSpace(strings.TrimSuffix(body, " FOUND"))
+		verdict.Reason = "malware signature detected: " + signature
+		verdict.Details["signature"] = signature
+		return verdict, nil
+	case strings.HasSuffix(body, " ERROR"):
+		return ScanVerdict{}, fmt.Errorf("clamd error: %s", strings.TrimSpace(strings.TrimSuffix(body, " ERROR")))
+	default:
+		return ScanVerdict{}, fmt.Errorf("unexpected clamd reply %q", reply)
+	}
+}
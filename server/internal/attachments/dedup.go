@@ -0,0 +1,249 @@
+package attachments
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	internaldb "github.com/mjhen/elnote/server/internal/db"
+	"github.com/mjhen/elnote/server/internal/syncer"
+)
+
+// dedupSource is a verified stored object that a new attachment can link to
+// instead of uploading the same bytes again.
+type dedupSource struct {
+	attachmentID     string
+	contentObjectKey string
+	scanStatus       string
+	mimeType         string
+}
+
+// findDedupSource looks for a verified object with the given digest and size.
+// Matches are limited to objects already referenced from the caller's own
+// experiments so that a digest cannot be used to probe other users' files.
+// Content that is quarantined or still awaiting a scan verdict is never
+// reused.
+func findDedupSource(ctx context.Context, tx *sql.Tx, ownerUserID, sha256 string, sizeBytes int64) (dedupSource, bool, error) {
+	var src dedupSource
+	err := tx.QueryRowContext(ctx, `
+		SELECT a.id::text, o.object_key, a.scan_status, a.mime_type
+		FROM attachment_objects o
+		JOIN attachments a ON a.content_object_key = o.object_key
+		JOIN experiments e ON e.id = a.experiment_id
+		WHERE o.sha256 = $1
+		  AND o.size_bytes = $2
+		  AND o.ref_count > 0
+		  AND a.status = 'completed'
+		  AND a.verification_status = 'verified'
+		  AND a.verified_sha256 = o.sha256
+		  AND a.scan_status IN ('not_scanned', 'clean')
+		  AND e.owner_user_id = $3::uuid
+		ORDER BY (a.scan_status = 'clean') DESC, a.completed_at ASC
+		LIMIT 1
+		FOR UPDATE OF o
+	`, sha256, sizeBytes, ownerUserID).Scan(&src.attachmentID, &src.contentObjectKey, &src.scanStatus, &src.mimeType)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return dedupSource{}, false, nil
+		}
+		return dedupSource{}, false, fmt.Errorf("look up deduplication source: %w", err)
+	}
+	return src, true, nil
+}
+
+// retainObject records one more completed attachment referencing a verified
+// stored object, registering the object on first use.
+func retainObject(ctx context.Context, tx *sql.Tx, objectKey, sha256 string, sizeBytes int64, attachmentID string) error {
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO attachment_objects (object_key, sha256, size_bytes, ref_count, first_attachment_id)
+		VALUES ($1, $2, $3, 1, $4::uuid)
+		ON CONFLICT (object_key) DO UPDATE
+		SET ref_count = attachment_objects.ref_count + 1,
+			updated_at = NOW()
+	`, objectKey, sha256, sizeBytes, attachmentID); err != nil {
+		return fmt.Errorf("retain attachment object: %w", err)
+	}
+	return nil
+}
+
+// normalizeClientSHA256 validates an optional client-supplied digest.
+func normalizeClientSHA256(value string) (string, error) {
+	digest := normalizeChecksum(value)
+	if digest == "" {
+		return "", nil
+	}
+	if !isSHA256Hex(digest) {
+		return "", fmt.Errorf("%w: sha256 must be a 64-character hex digest", ErrInvalidInput)
+	}
+	return digest, nil
+}
+
+// initiateDeduplicated inserts an attachment that is completed on creation
+// because its content already exists in storage. The caller has resolved the
+// entry and supersession links inside tx. A clean verdict is inherited only
+// when the declared MIME type matches the source's; otherwise the content
+// is scanned again against the new declaration.
+func (s *Service) initiateDeduplicated(ctx context.Context, tx *sql.Tx, in InitiateInput, digest string, src dedupSource, supersedesValue, entryValue any) (InitiateOutput, error) {
+	scanStatus := src.scanStatus
+	if s.ScanningEnabled() && (scanStatus == scanStatusNotScanned || normalizeDeclaredMime(in.MimeType) != normalizeDeclaredMime(src.mimeType)) {
+		scanStatus = scanStatusPending
+	}
+	scanDetails := map[string]any{}
+	if scanStatus == scanStatusClean {
+		scanDetails["inheritedFromAttachmentId"] = src.attachmentID
+	}
+	scanDetailsJSON, err := json.Marshal(scanDetails)
+	if err != nil {
+		return InitiateOutput{}, fmt.Errorf("marshal scan details: %w", err)
+	}
+	verificationJSON, err := json.Marshal(map[string]any{
+		"deduplicated":       true,
+		"sourceAttachmentId": src.attachmentID,
+		"contentObjectKey":   src.contentObjectKey,
+	})
+	if err != nil {
+		return InitiateOutput{}, fmt.Errorf("marshal verification details: %w", err)
+	}
+
+	out := InitiateOutput{Deduplicated: true}
+	var (
+		entry, supersedes, dedupFrom sql.NullString
+		completedAt                  time.Time
+	)
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO attachments (
+			experiment_id,
+			uploader_user_id,
+			object_key,
+			content_object_key,
+			deduplicated_from_attachment_id,
+			size_bytes,
+			mime_type,
+			checksum,
+			status,
+			completed_at,
+			verification_status,
+			verified_sha256,
+			verification_details,
+			verified_at,
+			scan_status,
+			scan_details,
+			scanned_at,
+			supersedes_attachment_id,
+			entry_id
+		) VALUES (
+			$1::uuid,
+			$2::uuid,
+			$3,
+			$4,
+			$5::uuid,
+			$6,
+			$7,
+			$8,
+			'completed',
+			NOW(),
+			'verified',
+			$8,
+			$9::jsonb,
+			NOW(),
+			$10,
+			$11::jsonb,
+			CASE WHEN $10::text = 'clean' THEN NOW() ELSE NULL END,
+			$12::uuid,
+			$13::uuid
+		)
+		RETURNING id::text, experiment_id::text, entry_id::text, object_key, lineage_id::text, version_number,
+			supersedes_attachment_id::text, deduplicated_from_attachment_id::text, status, scan_status, created_at, completed_at
+	`, in.ExperimentID, in.OwnerUserID, strings.TrimSpace(in.ObjectKey), src.contentObjectKey, src.attachmentID,
+		in.SizeBytes, strings.TrimSpace(in.MimeType), digest, string(verificationJSON), scanStatus, string(scanDetailsJSON),
+		supersedesValue, entryValue).Scan(
+		&out.AttachmentID,
+		&out.ExperimentID,
+		&entry,
+		&out.ObjectKey,
+		&out.LineageID,
+		&out.Version,
+		&supersedes,
+		&dedupFrom,
+		&out.Status,
+		&out.ScanStatus,
+		&out.CreatedAt,
+		&completedAt,
+	)
+	if err != nil {
+		return InitiateOutput{}, fmt.Errorf("insert deduplicated attachment: %w", err)
+	}
+	if entry.Valid {
+		out.EntryID = &entry.String
+	}
+	if supersedes.Valid {
+		out.SupersedesAttachmentID = &supersedes.String
+	}
+	if dedupFrom.Valid {
+		out.DeduplicatedFromAttachmentID = &dedupFrom.String
+	}
+
+	if err := retainObject(ctx, tx, src.contentObjectKey, digest, in.SizeBytes, out.AttachmentID); err != nil {
+		return InitiateOutput{}, err
+	}
+
+	if err := internaldb.AppendAuditEvent(ctx, tx, in.OwnerUserID, "attachment.deduplicate", "attachment", out.AttachmentID, map[string]any{
+		"experimentId":           in.ExperimentID,
+		"entryId":                entry.String,
+		"objectKey":              out.ObjectKey,
+		"contentObjectKey":       src.contentObjectKey,
+		"sourceAttachmentId":     src.attachmentID,
+		"sha256":                 digest,
+		"sizeBytes":              in.SizeBytes,
+		"mimeType":               in.MimeType,
+		"lineageId":              out.LineageID,
+		"version":                out.Version,
+		"supersedesAttachmentId": supersedes.String,
+		"scanStatus":             out.ScanStatus,
+	}); err != nil {
+		return InitiateOutput{}, err
+	}
+
+	if supersedes.Valid {
+		if err := s.recordNewVersion(ctx, tx, in.OwnerUserID, in.DeviceID, in.ExperimentID, CompleteOutput{
+			AttachmentID:           out.AttachmentID,
+			Status:                 out.Status,
+			LineageID:              out.LineageID,
+			Version:                out.Version,
+			SupersedesAttachmentID: out.SupersedesAttachmentID,
+			VerificationStatus:     verificationStatusVerified,
+			VerifiedSHA256:         digest,
+			ScanStatus:             out.ScanStatus,
+			CompletedAt:            completedAt,
+		}); err != nil {
+			return InitiateOutput{}, err
+		}
+	}
+
+	if _, err := s.sync.AppendEvent(ctx, tx, syncer.AppendEventInput{
+		OwnerUserID:   in.OwnerUserID,
+		ActorUserID:   in.OwnerUserID,
+		DeviceID:      in.DeviceID,
+		EventType:     "attachment.completed",
+		AggregateType: "attachment",
+		AggregateID:   out.AttachmentID,
+		Payload: map[string]any{
+			"experimentId":       in.ExperimentID,
+			"entryId":            entry.String,
+			"objectKey":          out.ObjectKey,
+			"lineageId":          out.LineageID,
+			"version":            out.Version,
+			"verificationStatus": verificationStatusVerified,
+			"scanStatus":         out.ScanStatus,
+			"deduplicated":       true,
+		},
+	}); err != nil {
+		return InitiateOutput{}, err
+	}
+
+	return out, nil
+}
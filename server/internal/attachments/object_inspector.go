@@ -1,6 +1,7 @@
 package attachments
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
@@ -13,7 +14,10 @@ import (
 	"time"
 )
 
-var ErrObjectListingUnsupported = errors.New("object listing unsupported")
+var (
+	ErrObjectListingUnsupported = errors.New("object listing unsupported")
+	ErrObjectNotFound           = errors.New("object not found")
+)
 
 type ObjectProbe struct {
 	Exists    bool
@@ -30,11 +34,13 @@ type ObjectInventoryEntry struct {
 type ObjectStoreInspector interface {
 	Probe(ctx context.Context, objectKey string) (ObjectProbe, error)
 	List(ctx context.Context, limit int) ([]ObjectInventoryEntry, error)
+	Open(ctx context.Context, objectKey string) (io.ReadCloser, error)
 }
 
 type SignedURLObjectInspector struct {
 	signer       URLSigner
 	client       *http.Client
+	streamClient *http.Client
 	inventoryURL string
 }
 
@@ -43,8 +49,14 @@ func NewSignedURLObjectInspector(signer URLSigner, inventoryURL string, timeout
 		timeout = 10 * time.Second
 	}
 	return &SignedURLObjectInspector{
-		signer:       signer,
-		client:       &http.Client{Timeout: timeout},
+		signer: signer,
+		client: &http.Client{Timeout: timeout},
+		// Object bodies can be large, so streaming reads are bounded by the
+		// caller's context rather than a whole-request timeout.
+		streamClient: &http.Client{Transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			ResponseHeaderTimeout: timeout,
+		}},
 		inventoryURL: strings.TrimSpace(inventoryURL),
 	}
 }
@@ -81,6 +93,81 @@ func (i *SignedURLObjectInspector) Probe(ctx context.Context, objectKey string)
 	}
 }
 
+// Open streams the object body through a short-lived signed download URL.
+// Callers must close the returned reader.
+func (i *SignedURLObjectInspector) Open(ctx context.Context, objectKey string) (io.ReadCloser, error) {
+	objectKey = strings.TrimSpace(objectKey)
+	if objectKey == "" {
+		return nil, fmt.Errorf("object key is required")
+	}
+	if i == nil || i.signer == nil {
+		return nil, fmt.Errorf("object inspector signer is not configured")
+	}
+
+	downloadURL, err := i.signer.SignDownload(objectKey, time.Now().UTC().Add(15*time.Minute))
+	if err != nil {
+		return nil, fmt.Errorf("sign open download url: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, downloadURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("build open request: %w", err)
+	}
+	resp, err := i.streamClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("open object: %w", err)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, ErrObjectNotFound
+	default:
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+		return nil, fmt.Errorf("open object returned status %d", resp.StatusCode)
+	}
+}
+
+// Put uploads data through a short-lived signed upload URL. It is used for
+// server-generated objects such as preview renditions.
+func (i *SignedURLObjectInspector) Put(ctx context.Context, objectKey, contentType string, data []byte) error {
+	objectKey = strings.TrimSpace(objectKey)
+	if objectKey == "" {
+		return fmt.Errorf("object key is required")
+	}
+	if i == nil || i.signer == nil {
+		return fmt.Errorf("object inspector signer is not configured")
+	}
+
+	uploadURL, err := i.signer.SignUpload(objectKey, time.Now().UTC().Add(15*time.Minute))
+	if err != nil {
+		return fmt.Errorf("sign put upload url: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, uploadURL, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("build put request: %w", err)
+	}
+	req.ContentLength = int64(len(data))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := i.streamClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("put object: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("put object returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
 func (i *SignedURLObjectInspector) probeWithRangeGet(ctx context.Context, downloadURL string) (ObjectProbe, error) {
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, downloadURL, nil)
 	if err != nil {
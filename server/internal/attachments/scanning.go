@@ -0,0 +1,436 @@
+package attachments
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	internaldb "github.com/mjhen/elnote/server/internal/db"
+	"github.com/mjhen/elnote/server/internal/syncer"
+)
+
+var (
+	ErrScanPending = errors.New("attachment is awaiting content scan")
+	ErrQuarantined = errors.New("attachment is quarantined")
+)
+
+const (
+	scanStatusNotScanned  = "not_scanned"
+	scanStatusPending     = "pending_scan"
+	scanStatusClean       = "clean"
+	scanStatusQuarantined = "quarantined"
+	scanStatusFailed      = "scan_failed"
+)
+
+// ScanTarget describes the stored object handed to a ContentScanner.
+type ScanTarget struct {
+	AttachmentID string
+	ObjectKey    string
+	MimeType     string
+	SizeBytes    int64
+}
+
+// ScanVerdict is a scanner's decision about one object. A verdict that is not
+// Clean quarantines the attachment.
+type ScanVerdict struct {
+	Scanner string
+	Clean   bool
+	Reason  string
+	Details map[string]any
+}
+
+// ContentScanner inspects uploaded content after Complete. Returning an error
+// means the scan could not be performed and will be retried.
+type ContentScanner interface {
+	Name() string
+	Scan(ctx context.Context, target ScanTarget, content io.Reader) (ScanVerdict, error)
+}
+
+// ---------------------------------------------------------------------------
+// Built-in MIME / magic-byte verifier
+// ---------------------------------------------------------------------------
+
+const magicSniffLen = 512
+
+type magicSignature struct {
+	mimeType string
+	offset   int
+	prefix   []byte
+}
+
+var magicSignatures = []magicSignature{
+	{"image/png", 0, []byte("\x89PNG\r\n\x1a\n")},
+	{"image/jpeg", 0, []byte{0xFF, 0xD8, 0xFF}},
+	{"image/gif", 0, []byte("GIF87a")},
+	{"image/gif", 0, []byte("GIF89a")},
+	{"image/tiff", 0, []byte("II*\x00")},
+	{"image/tiff", 0, []byte("MM\x00*")},
+	{"image/bmp", 0, []byte("BM")},
+	{"image/webp", 8, []byte("WEBP")},
+	{"application/pdf", 0, []byte("%PDF-")},
+	{"application/zip", 0, []byte("PK\x03\x04")},
+	{"application/gzip", 0, []byte{0x1F, 0x8B}},
+	{"application/x-msdownload", 0, []byte("MZ")},
+	{"application/x-executable", 0, []byte("\x7fELF")},
+	{"application/x-mach-binary", 0, []byte{0xFE, 0xED, 0xFA, 0xCE}},
+	{"application/x-mach-binary", 0, []byte{0xFE, 0xED, 0xFA, 0xCF}},
+	{"application/x-mach-binary", 0, []byte{0xCE, 0xFA, 0xED, 0xFE}},
+	{"application/x-mach-binary", 0, []byte{0xCF, 0xFA, 0xED, 0xFE}},
+}
+
+var executableMimeTypes = map[string]bool{
+	"application/x-msdownload":  true,
+	"application/x-executable":  true,
+	"application/x-mach-binary": true,
+}
+
+// zipContainerMimeTypes are declared types whose payload is a ZIP archive.
+var zipContainerMimeTypes = map[string]bool{
+	"application/zip":              true,
+	"application/x-zip-compressed": true,
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":         true,
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document":   true,
+	"application/vnd.openxmlformats-officedocument.presentationml.presentation": true,
+	"application/vnd.oasis.opendocument.spreadsheet":                            true,
+	"application/vnd.oasis.opendocument.text":                                   true,
+}
+
+var declaredMimeAliases = map[string]string{
+	"image/jpg":          "image/jpeg",
+	"image/pjpeg":        "image/jpeg",
+	"image/x-png":        "image/png",
+	"image/tif":          "image/tiff",
+	"application/x-gzip": "application/gzip",
+	"application/x-pdf":  "application/pdf",
+}
+
+// MagicByteScanner checks that the leading bytes of an object agree with the
+// mime_type declared at Initiate, and rejects executables disguised as data.
+type MagicByteScanner struct{}
+
+func NewMagicByteScanner() *MagicByteScanner {
+	return &MagicByteScanner{}
+}
+
+func (m *MagicByteScanner) Name() string {
+	return "magic_bytes"
+}
+
+func (m *MagicByteScanner) Scan(ctx context.Context, target ScanTarget, content io.Reader) (ScanVerdict, error) {
+	head := make([]byte, magicSniffLen)
+	n, err := io.ReadFull(content, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return ScanVerdict{}, fmt.Errorf("read object header: %w", err)
+	}
+	head = head[:n]
+
+	declared := normalizeDeclaredMime(target.MimeType)
+	detected := detectMagicMime(head)
+	verdict := ScanVerdict{
+		Scanner: m.Name(),
+		Details: map[string]any{
+			"declaredMimeType": declared,
+			"detectedMimeType": detected,
+		},
+	}
+
+	switch {
+	case executableMimeTypes[detected] && !executableMimeTypes[declared]:
+		verdict.Reason = fmt.Sprintf("executable content (%s) declared as %s", detected, declared)
+	case zipContainerMimeTypes[declared]:
+		if detected != "application/zip" {
+			verdict.Reason = fmt.Sprintf("declared %s but content is not a ZIP container", declared)
+		}
+	case hasMagicSignature(declared):
+		if detected != declared {
+			verdict.Reason = fmt.Sprintf("declared %s but content looks like %s", declared, detected)
+		}
+	case strings.HasPrefix(declared, "text/"):
+		if !looksLikeText(head) {
+			verdict.Reason = fmt.Sprintf("declared %s but content is binary (%s)", declared, detected)
+		}
+	}
+	verdict.Clean = verdict.Reason == ""
+	return verdict, nil
+}
+
+func normalizeDeclaredMime(v string) string {
+	mediaType, _, err := mime.ParseMediaType(v)
+	if err != nil {
+		mediaType = strings.TrimSpace(v)
+	}
+	mediaType = strings.ToLower(mediaType)
+	if alias, ok := declaredMimeAliases[mediaType]; ok {
+		return alias
+	}
+	return mediaType
+}
+
+func detectMagicMime(head []byte) string {
+	for _, sig := range magicSignatures {
+		if len(head) >= sig.offset+len(sig.prefix) && bytes.Equal(head[sig.offset:sig.offset+len(sig.prefix)], sig.prefix) {
+			if sig.mimeType == "image/webp" && !bytes.HasPrefix(head, []byte("RIFF")) {
+				continue
+			}
+			return sig.mimeType
+		}
+	}
+	detected, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	return detected
+}
+
+func hasMagicSignature(mimeType string) bool {
+	for _, sig := range magicSignatures {
+		if sig.mimeType == mimeType {
+			return true
+		}
+	}
+	return false
+}
+
+func looksLikeText(head []byte) bool {
+	if bytes.IndexByte(head, 0) >= 0 {
+		// UTF-16 text carries NULs; accept it only with a byte-order mark.
+		return bytes.HasPrefix(head, []byte{0xFF, 0xFE}) || bytes.HasPrefix(head, []byte{0xFE, 0xFF})
+	}
+	return strings.HasPrefix(http.DetectContentType(head), "text/")
+}
+
+// ---------------------------------------------------------------------------
+// Scan queue processing
+// ---------------------------------------------------------------------------
+
+type ScanInput struct {
+	Limit       int
+	MaxAttempts int
+}
+
+type QuarantinedAttachment struct {
+	AttachmentID string `json:"attachmentId"`
+	ExperimentID string `json:"experimentId"`
+	ObjectKey    string `json:"objectKey"`
+	Scanner      string `json:"scanner"`
+	Reason       string `json:"reason"`
+}
+
+// ExhaustedScan is an attachment whose scan failed on its last allowed
+// attempt. It stays scan_failed, and so undownloadable, until an admin
+// deals with it.
+type ExhaustedScan struct {
+	AttachmentID string `json:"attachmentId"`
+	ExperimentID string `json:"experimentId"`
+	ObjectKey    string `json:"objectKey"`
+	Scanner      string `json:"scanner"`
+	Error        string `json:"error"`
+	Attempts     int    `json:"attempts"`
+}
+
+type ScanOutput struct {
+	ScannedCount     int                     `json:"scannedCount"`
+	CleanCount       int                     `json:"cleanCount"`
+	QuarantinedCount int                     `json:"quarantinedCount"`
+	FailedCount      int                     `json:"failedCount"`
+	Quarantined      []QuarantinedAttachment `json:"quarantined"`
+	Exhausted        []ExhaustedScan         `json:"exhausted"`
+}
+
+// ScanningEnabled reports whether completed uploads are held for scanning.
+func (s *Service) ScanningEnabled() bool {
+	return len(s.scanners) > 0
+}
+
+// ScanPending runs every configured scanner over attachments awaiting a scan
+// (or whose previous scan failed) and records the verdict. Failed scans are
+// retried up to MaxAttempts times; those failing their last attempt are
+// returned in Exhausted.
+func (s *Service) ScanPending(ctx context.Context, in ScanInput) (ScanOutput, error) {
+	out := ScanOutput{Quarantined: []QuarantinedAttachment{}, Exhausted: []ExhaustedScan{}}
+	if !s.ScanningEnabled() {
+		return out, nil
+	}
+	if in.Limit <= 0 {
+		in.Limit = 20
+	}
+	if in.MaxAttempts <= 0 {
+		in.MaxAttempts = 5
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id::text, content_object_key, mime_type, size_bytes
+		FROM attachments
+		WHERE scan_status IN ('pending_scan', 'scan_failed')
+		  AND scan_attempts < $1
+		ORDER BY completed_at ASC
+		LIMIT $2
+	`, in.MaxAttempts, in.Limit)
+	if err != nil {
+		return ScanOutput{}, fmt.Errorf("query scan queue: %w", err)
+	}
+	var targets []ScanTarget
+	for rows.Next() {
+		var t ScanTarget
+		if err := rows.Scan(&t.AttachmentID, &t.ObjectKey, &t.MimeType, &t.SizeBytes); err != nil {
+			rows.Close()
+			return ScanOutput{}, fmt.Errorf("scan queued attachment: %w", err)
+		}
+		targets = append(targets, t)
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return ScanOutput{}, fmt.Errorf("iterate scan queue: %w", err)
+	}
+	rows.Close()
+
+	for _, target := range targets {
+		status, verdict, details := s.scanObject(ctx, target)
+		experimentID, attempts, recorded, err := s.recordScanResult(ctx, target, status, details)
+		if err != nil {
+			return out, err
+		}
+		if !recorded {
+			continue
+		}
+		out.ScannedCount++
+		switch status {
+		case scanStatusClean:
+			out.CleanCount++
+		case scanStatusQuarantined:
+			out.QuarantinedCount++
+			out.Quarantined = append(out.Quarantined, QuarantinedAttachment{
+				AttachmentID: target.AttachmentID,
+				ExperimentID: experimentID,
+				ObjectKey:    target.ObjectKey,
+				Scanner:      verdict.Scanner,
+				Reason:       verdict.Reason,
+			})
+		default:
+			out.FailedCount++
+			if attempts >= in.MaxAttempts {
+				out.Exhausted = append(out.Exhausted, ExhaustedScan{
+					AttachmentID: target.AttachmentID,
+					ExperimentID: experimentID,
+					ObjectKey:    target.ObjectKey,
+					Scanner:      verdict.Scanner,
+					Error:        verdict.Reason,
+					Attempts:     attempts,
+				})
+			}
+		}
+	}
+	return out, nil
+}
+
+// scanObject runs the scanners in order, stopping at the first verdict that
+// is not clean. A scanner error fails the scan, with the error as the
+// verdict's reason. Object-store reads happen outside any transaction.
+func (s *Service) scanObject(ctx context.Context, target ScanTarget) (string, ScanVerdict, map[string]any) {
+	results := make([]map[string]any, 0, len(s.scanners))
+	details := map[string]any{"results": results}
+	for _, scanner := range s.scanners {
+		verdict, err := s.runScanner(ctx, scanner, target)
+		if err != nil {
+			results = append(results, map[string]any{"scanner": scanner.Name(), "error": err.Error()})
+			details["results"] = results
+			return scanStatusFailed, ScanVerdict{Scanner: scanner.Name(), Reason: err.Error()}, details
+		}
+		results = append(results, map[string]any{
+			"scanner": verdict.Scanner,
+			"clean":   verdict.Clean,
+			"reason":  verdict.Reason,
+			"details": verdict.Details,
+		})
+		details["results"] = results
+		if !verdict.Clean {
+			details["quarantinedBy"] = verdict.Scanner
+			details["reason"] = verdict.Reason
+			return scanStatusQuarantined, verdict, details
+		}
+	}
+	return scanStatusClean, ScanVerdict{Clean: true}, details
+}
+
+func (s *Service) runScanner(ctx context.Context, scanner ContentScanner, target ScanTarget) (ScanVerdict, error) {
+	body, err := s.inspector.Open(ctx, target.ObjectKey)
+	if err != nil {
+		return ScanVerdict{}, err
+	}
+	defer body.Close()
+
+	verdict, err := scanner.Scan(ctx, target, body)
+	if err != nil {
+		return ScanVerdict{}, err
+	}
+	if verdict.Scanner == "" {
+		verdict.Scanner = scanner.Name()
+	}
+	return verdict, nil
+}
+
+func (s *Service) recordScanResult(ctx context.Context, target ScanTarget, status string, details map[string]any) (string, int, bool, error) {
+	detailsJSON, err := json.Marshal(details)
+	if err != nil {
+		return "", 0, false, fmt.Errorf("marshal scan details: %w", err)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", 0, false, fmt.Errorf("begin record scan tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	var experimentID, ownerUserID string
+	var attempts int
+	err = tx.QueryRowContext(ctx, `
+		UPDATE attachments a
+		SET scan_status = $2,
+			scan_attempts = a.scan_attempts + 1,
+			scan_details = $3::jsonb,
+			scanned_at = NOW()
+		FROM experiments e
+		WHERE a.id = $1::uuid
+		  AND e.id = a.experiment_id
+		  AND a.scan_status IN ('pending_scan', 'scan_failed')
+		RETURNING a.experiment_id::text, e.owner_user_id::text, a.scan_attempts
+	`, target.AttachmentID, status, string(detailsJSON)).Scan(&experimentID, &ownerUserID, &attempts)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			// Another worker recorded a verdict first.
+			return "", 0, false, nil
+		}
+		return "", 0, false, fmt.Errorf("record scan result: %w", err)
+	}
+
+	if err := internaldb.AppendAuditEvent(ctx, tx, "", "attachment.scan."+status, "attachment", target.AttachmentID, map[string]any{
+		"experimentId": experimentID,
+		"objectKey":    target.ObjectKey,
+		"scanStatus":   status,
+		"details":      details,
+	}); err != nil {
+		return "", 0, false, err
+	}
+
+	if _, err := s.sync.AppendEvent(ctx, tx, syncer.AppendEventInput{
+		OwnerUserID:   ownerUserID,
+		EventType:     "attachment.scanned",
+		AggregateType: "attachment",
+		AggregateID:   target.AttachmentID,
+		Payload: map[string]any{
+			"experimentId": experimentID,
+			"scanStatus":   status,
+		},
+	}); err != nil {
+		return "", 0, false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", 0, false, fmt.Errorf("commit record scan tx: %w", err)
+	}
+	return experimentID, attempts, true, nil
+}
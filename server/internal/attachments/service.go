@@ -36,6 +36,8 @@ type Service struct {
 	inspector      ObjectStoreInspector
 	uploadURLTTL   time.Duration
 	downloadURLTTL time.Duration
+	verification   VerificationPolicy
+	scanners       []ContentScanner
 }
 
 type InitiateInput struct {
@@ -45,15 +47,37 @@ type InitiateInput struct {
 	ObjectKey    string
 	SizeBytes    int64
 	MimeType     string
+	// EntryID optionally binds the attachment to an entry (original or
+	// addendum) of the experiment.
+	EntryID string
+	// SupersedesAttachmentID optionally marks the upload as a new version of
+	// an existing completed attachment in the same experiment. New versions
+	// inherit the superseded attachment's entry unless EntryID is set.
+	SupersedesAttachmentID string
+	// SHA256 is the optional client-computed digest of the content. When a
+	// verified object with the same digest and size is already stored for
+	// one of the owner's experiments, the attachment is linked to it and
+	// completed without a second upload.
+	SHA256 string
 }
 
 type InitiateOutput struct {
-	AttachmentID string    `json:"attachmentId"`
-	ExperimentID string    `json:"experimentId"`
-	ObjectKey    string    `json:"objectKey"`
-	UploadURL    string    `json:"uploadUrl"`
-	ExpiresAt    time.Time `json:"expiresAt"`
-	CreatedAt    time.Time `json:"createdAt"`
+	AttachmentID           string  `json:"attachmentId"`
+	ExperimentID           string  `json:"experimentId"`
+	EntryID                *string `json:"entryId,omitempty"`
+	ObjectKey              string  `json:"objectKey"`
+	LineageID              string  `json:"lineageId"`
+	Version                int     `json:"version"`
+	SupersedesAttachmentID *string `json:"supersedesAttachmentId,omitempty"`
+	Status                 string  `json:"status"`
+	// Deduplicated attachments are completed on creation, carry no upload URL
+	// and point at the attachment whose stored object they share.
+	Deduplicated                 bool       `json:"deduplicated"`
+	DeduplicatedFromAttachmentID *string    `json:"deduplicatedFromAttachmentId,omitempty"`
+	ScanStatus                   string     `json:"scanStatus,omitempty"`
+	UploadURL                    string     `json:"uploadUrl,omitempty"`
+	ExpiresAt                    *time.Time `json:"expiresAt,omitempty"`
+	CreatedAt                    time.Time  `json:"createdAt"`
 }
 
 type CompleteInput struct {
@@ -65,9 +89,15 @@ type CompleteInput struct {
 }
 
 type CompleteOutput struct {
-	AttachmentID string    `json:"attachmentId"`
-	Status       string    `json:"status"`
-	CompletedAt  time.Time `json:"completedAt"`
+	AttachmentID           string    `json:"attachmentId"`
+	Status                 string    `json:"status"`
+	LineageID              string    `json:"lineageId"`
+	Version                int       `json:"version"`
+	SupersedesAttachmentID *string   `json:"supersedesAttachmentId,omitempty"`
+	VerificationStatus     string    `json:"verificationStatus"`
+	VerifiedSHA256         string    `json:"verifiedSha256,omitempty"`
+	ScanStatus             string    `json:"scanStatus"`
+	CompletedAt            time.Time `json:"completedAt"`
 }
 
 type DownloadInput struct {
@@ -103,7 +133,7 @@ type ReconcileOutput struct {
 	TotalFindingsCreated    int       `json:"totalFindingsCreated"`
 }
 
-func NewService(db *sql.DB, syncService *syncer.Service, signer URLSigner, inspector ObjectStoreInspector, uploadTTL, downloadTTL time.Duration) *Service {
+func NewService(db *sql.DB, syncService *syncer.Service, signer URLSigner, inspector ObjectStoreInspector, uploadTTL, downloadTTL time.Duration, verification VerificationPolicy, scanners []ContentScanner) *Service {
 	if uploadTTL <= 0 {
 		uploadTTL = 15 * time.Minute
 	}
@@ -120,6 +150,8 @@ func NewService(db *sql.DB, syncService *syncer.Service, signer URLSigner, inspe
 		inspector:      inspector,
 		uploadURLTTL:   uploadTTL,
 		downloadURLTTL: downloadTTL,
+		verification:   normalizeVerificationPolicy(verification),
+		scanners:       scanners,
 	}
 }
 
@@ -127,6 +159,10 @@ func (s *Service) Initiate(ctx context.Context, in InitiateInput) (InitiateOutpu
 	if strings.TrimSpace(in.ExperimentID) == "" || strings.TrimSpace(in.OwnerUserID) == "" || strings.TrimSpace(in.ObjectKey) == "" || strings.TrimSpace(in.MimeType) == "" || in.SizeBytes <= 0 {
 		return InitiateOutput{}, ErrInvalidInput
 	}
+	digest, err := normalizeClientSHA256(in.SHA256)
+	if err != nil {
+		return InitiateOutput{}, err
+	}
 
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
@@ -142,7 +178,46 @@ func (s *Service) Initiate(ctx context.Context, in InitiateInput) (InitiateOutpu
 		return InitiateOutput{}, ErrForbidden
 	}
 
-	out := InitiateOutput{}
+	entryID := strings.TrimSpace(in.EntryID)
+	var supersedesValue any
+	if supersedesID := strings.TrimSpace(in.SupersedesAttachmentID); supersedesID != "" {
+		prevEntryID, err := lockSupersedableAttachment(ctx, tx, supersedesID, in.ExperimentID)
+		if err != nil {
+			return InitiateOutput{}, err
+		}
+		if entryID == "" {
+			entryID = prevEntryID
+		}
+		supersedesValue = supersedesID
+	}
+
+	var entryValue any
+	if entryID != "" {
+		if err := ensureEntryInExperiment(ctx, tx, entryID, in.ExperimentID); err != nil {
+			return InitiateOutput{}, err
+		}
+		entryValue = entryID
+	}
+
+	if digest != "" {
+		src, found, err := findDedupSource(ctx, tx, in.OwnerUserID, digest, in.SizeBytes)
+		if err != nil {
+			return InitiateOutput{}, err
+		}
+		if found {
+			out, err := s.initiateDeduplicated(ctx, tx, in, digest, src, supersedesValue, entryValue)
+			if err != nil {
+				return InitiateOutput{}, err
+			}
+			if err := tx.Commit(); err != nil {
+				return InitiateOutput{}, fmt.Errorf("commit initiate attachment tx: %w", err)
+			}
+			return out, nil
+		}
+	}
+
+	out := InitiateOutput{Status: "initiated"}
+	var entry, supersedes sql.NullString
 	err = tx.QueryRowContext(ctx, `
 		INSERT INTO attachments (
 			experiment_id,
@@ -150,38 +225,57 @@ func (s *Service) Initiate(ctx context.Context, in InitiateInput) (InitiateOutpu
 			object_key,
 			size_bytes,
 			mime_type,
-			status
+			status,
+			supersedes_attachment_id,
+			entry_id
 		) VALUES (
 			$1::uuid,
 			$2::uuid,
 			$3,
 			$4,
 			$5,
-			'initiated'
+			'initiated',
+			$6::uuid,
+			$7::uuid
 		)
-		RETURNING id::text, experiment_id::text, object_key, created_at
-	`, in.ExperimentID, in.OwnerUserID, strings.TrimSpace(in.ObjectKey), in.SizeBytes, strings.TrimSpace(in.MimeType)).Scan(
+		RETURNING id::text, experiment_id::text, entry_id::text, object_key, lineage_id::text, version_number, supersedes_attachment_id::text, created_at
+	`, in.ExperimentID, in.OwnerUserID, strings.TrimSpace(in.ObjectKey), in.SizeBytes, strings.TrimSpace(in.MimeType), supersedesValue, entryValue).Scan(
 		&out.AttachmentID,
 		&out.ExperimentID,
+		&entry,
 		&out.ObjectKey,
+		&out.LineageID,
+		&out.Version,
+		&supersedes,
 		&out.CreatedAt,
 	)
 	if err != nil {
 		return InitiateOutput{}, fmt.Errorf("insert attachment metadata: %w", err)
 	}
+	if entry.Valid {
+		out.EntryID = &entry.String
+	}
+	if supersedes.Valid {
+		out.SupersedesAttachmentID = &supersedes.String
+	}
 
-	out.ExpiresAt = time.Now().UTC().Add(s.uploadURLTTL)
-	uploadURL, err := s.signer.SignUpload(out.ObjectKey, out.ExpiresAt)
+	expiresAt := time.Now().UTC().Add(s.uploadURLTTL)
+	out.ExpiresAt = &expiresAt
+	uploadURL, err := s.signer.SignUpload(out.ObjectKey, expiresAt)
 	if err != nil {
 		return InitiateOutput{}, fmt.Errorf("sign upload URL: %w", err)
 	}
 	out.UploadURL = uploadURL
 
 	if err := internaldb.AppendAuditEvent(ctx, tx, in.OwnerUserID, "attachment.initiate", "attachment", out.AttachmentID, map[string]any{
-		"experimentId": in.ExperimentID,
-		"objectKey":    out.ObjectKey,
-		"sizeBytes":    in.SizeBytes,
-		"mimeType":     in.MimeType,
+		"experimentId":           in.ExperimentID,
+		"entryId":                entry.String,
+		"objectKey":              out.ObjectKey,
+		"sizeBytes":              in.SizeBytes,
+		"mimeType":               in.MimeType,
+		"lineageId":              out.LineageID,
+		"version":                out.Version,
+		"supersedesAttachmentId": supersedes.String,
 	}); err != nil {
 		return InitiateOutput{}, err
 	}
@@ -195,7 +289,10 @@ func (s *Service) Initiate(ctx context.Context, in InitiateInput) (InitiateOutpu
 		AggregateID:   out.AttachmentID,
 		Payload: map[string]any{
 			"experimentId": in.ExperimentID,
+			"entryId":      entry.String,
 			"objectKey":    out.ObjectKey,
+			"lineageId":    out.LineageID,
+			"version":      out.Version,
 		},
 	}); err != nil {
 		return InitiateOutput{}, err
@@ -213,66 +310,158 @@ func (s *Service) Complete(ctx context.Context, in CompleteInput) (CompleteOutpu
 		return CompleteOutput{}, ErrInvalidInput
 	}
 
+	// Verify the stored object before taking the row lock so object-store
+	// round trips never run inside the metadata transaction.
+	var (
+		objectKey string
+		ownerID   string
+		sizeBytes int64
+		status    string
+	)
+	err := s.db.QueryRowContext(ctx, `
+		SELECT a.content_object_key, e.owner_user_id::text, a.size_bytes, a.status
+		FROM attachments a
+		JOIN experiments e ON e.id = a.experiment_id
+		WHERE a.id = $1::uuid
+	`, in.AttachmentID).Scan(&objectKey, &ownerID, &sizeBytes, &status)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return CompleteOutput{}, ErrNotFound
+		}
+		return CompleteOutput{}, fmt.Errorf("load attachment metadata: %w", err)
+	}
+	if ownerID != in.OwnerUserID {
+		return CompleteOutput{}, ErrForbidden
+	}
+	if sizeBytes != in.SizeBytes || status == "completed" {
+		return CompleteOutput{}, ErrInvalidInput
+	}
+
+	verification, verifyErr := s.verifyObject(ctx, objectKey, in.SizeBytes, in.Checksum)
+	if s.verification.Mode == VerifyModeEnforce && verification.Status != verificationStatusVerified {
+		if err := internaldb.AppendAuditEvent(ctx, s.db, in.OwnerUserID, "attachment.complete_rejected", "attachment", in.AttachmentID, map[string]any{
+			"objectKey":          objectKey,
+			"checksum":           in.Checksum,
+			"sizeBytes":          in.SizeBytes,
+			"verificationStatus": verification.Status,
+			"details":            verification.Details,
+		}); err != nil {
+			return CompleteOutput{}, err
+		}
+		if verifyErr != nil {
+			return CompleteOutput{}, fmt.Errorf("verify attachment object: %w", verifyErr)
+		}
+		return CompleteOutput{}, ErrIntegrityMismatch
+	}
+
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return CompleteOutput{}, fmt.Errorf("begin complete attachment tx: %w", err)
 	}
 	defer tx.Rollback()
 
+	out := CompleteOutput{}
+
 	var (
 		experimentID string
-		ownerID      string
-		sizeBytes    int64
-		status       string
+		supersedes   sql.NullString
 	)
 	err = tx.QueryRowContext(ctx, `
-		SELECT
-			a.experiment_id::text,
-			e.owner_user_id::text,
-			a.size_bytes,
-			a.status
+		SELECT a.experiment_id::text, a.status, a.supersedes_attachment_id::text
 		FROM attachments a
-		JOIN experiments e ON e.id = a.experiment_id
 		WHERE a.id = $1::uuid
 		FOR UPDATE
-	`, in.AttachmentID).Scan(&experimentID, &ownerID, &sizeBytes, &status)
+	`, in.AttachmentID).Scan(&experimentID, &status, &supersedes)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return CompleteOutput{}, ErrNotFound
 		}
-		return CompleteOutput{}, fmt.Errorf("load attachment metadata: %w", err)
-	}
-	if ownerID != in.OwnerUserID {
-		return CompleteOutput{}, ErrForbidden
-	}
-	if sizeBytes != in.SizeBytes {
-		return CompleteOutput{}, ErrInvalidInput
+		return CompleteOutput{}, fmt.Errorf("lock attachment metadata: %w", err)
 	}
 	if status == "completed" {
 		return CompleteOutput{}, ErrInvalidInput
 	}
+	if supersedes.Valid {
+		if _, err := lockSupersedableAttachment(ctx, tx, supersedes.String, experimentID); err != nil {
+			return CompleteOutput{}, err
+		}
+		out.SupersedesAttachmentID = &supersedes.String
+	}
 
-	out := CompleteOutput{}
+	detailsJSON, err := json.Marshal(verification.Details)
+	if err != nil {
+		return CompleteOutput{}, fmt.Errorf("marshal verification details: %w", err)
+	}
+
+	scanStatus := scanStatusNotScanned
+	if s.ScanningEnabled() {
+		scanStatus = scanStatusPending
+	}
+
+	var verifiedSHA256 sql.NullString
 	err = tx.QueryRowContext(ctx, `
 		UPDATE attachments
 		SET checksum = $2,
 			status = 'completed',
-			completed_at = NOW()
+			completed_at = NOW(),
+			verification_status = $3,
+			verified_sha256 = NULLIF($4, ''),
+			verification_details = $5::jsonb,
+			verified_at = CASE WHEN $3::text = 'unverified' THEN NULL ELSE NOW() END,
+			scan_status = $6
 		WHERE id = $1::uuid
-		RETURNING id::text, status, completed_at
-	`, in.AttachmentID, strings.TrimSpace(in.Checksum)).Scan(&out.AttachmentID, &out.Status, &out.CompletedAt)
+		RETURNING id::text, status, lineage_id::text, version_number, verification_status, verified_sha256, scan_status, completed_at
+	`, in.AttachmentID, strings.TrimSpace(in.Checksum), verification.Status, verification.VerifiedSHA256, string(detailsJSON), scanStatus).Scan(
+		&out.AttachmentID,
+		&out.Status,
+		&out.LineageID,
+		&out.Version,
+		&out.VerificationStatus,
+		&verifiedSHA256,
+		&out.ScanStatus,
+		&out.CompletedAt,
+	)
 	if err != nil {
 		return CompleteOutput{}, fmt.Errorf("complete attachment metadata: %w", err)
 	}
+	out.VerifiedSHA256 = verifiedSHA256.String
+
+	if out.VerificationStatus == verificationStatusVerified {
+		if err := retainObject(ctx, tx, objectKey, out.VerifiedSHA256, in.SizeBytes, out.AttachmentID); err != nil {
+			return CompleteOutput{}, err
+		}
+	}
 
 	if err := internaldb.AppendAuditEvent(ctx, tx, in.OwnerUserID, "attachment.complete", "attachment", out.AttachmentID, map[string]any{
-		"experimentId": experimentID,
-		"checksum":     in.Checksum,
-		"sizeBytes":    in.SizeBytes,
+		"experimentId":       experimentID,
+		"checksum":           in.Checksum,
+		"sizeBytes":          in.SizeBytes,
+		"verificationStatus": verification.Status,
+		"verifiedSha256":     verification.VerifiedSHA256,
+		"lineageId":          out.LineageID,
+		"version":            out.Version,
+		"scanStatus":         out.ScanStatus,
 	}); err != nil {
 		return CompleteOutput{}, err
 	}
 
+	if supersedes.Valid {
+		if err := s.recordNewVersion(ctx, tx, in.OwnerUserID, in.DeviceID, experimentID, out); err != nil {
+			return CompleteOutput{}, err
+		}
+	}
+
+	if verification.Status == verificationStatusMismatch || verification.Status == verificationStatusMissing {
+		if err := internaldb.AppendAuditEvent(ctx, tx, in.OwnerUserID, "attachment.integrity_flagged", "attachment", out.AttachmentID, map[string]any{
+			"experimentId":       experimentID,
+			"objectKey":          objectKey,
+			"verificationStatus": verification.Status,
+			"details":            verification.Details,
+		}); err != nil {
+			return CompleteOutput{}, err
+		}
+	}
+
 	if _, err := s.sync.AppendEvent(ctx, tx, syncer.AppendEventInput{
 		OwnerUserID:   in.OwnerUserID,
 		ActorUserID:   in.OwnerUserID,
@@ -281,7 +470,11 @@ func (s *Service) Complete(ctx context.Context, in CompleteInput) (CompleteOutpu
 		AggregateType: "attachment",
 		AggregateID:   out.AttachmentID,
 		Payload: map[string]any{
-			"experimentId": experimentID,
+			"experimentId":       experimentID,
+			"lineageId":          out.LineageID,
+			"version":            out.Version,
+			"verificationStatus": verification.Status,
+			"scanStatus":         out.ScanStatus,
 		},
 	}); err != nil {
 		return CompleteOutput{}, err
@@ -304,18 +497,22 @@ func (s *Service) Download(ctx context.Context, in DownloadInput) (DownloadOutpu
 		experimentOwner  string
 		experimentStatus string
 		attachmentStatus string
+		scanStatus       string
+		contentKey       string
 	)
 	err := s.db.QueryRowContext(ctx, `
 		SELECT
 			a.id::text,
 			a.object_key,
+			a.content_object_key,
 			e.owner_user_id::text,
 			e.status,
-			a.status
+			a.status,
+			a.scan_status
 		FROM attachments a
 		JOIN experiments e ON e.id = a.experiment_id
 		WHERE a.id = $1::uuid
-	`, in.AttachmentID).Scan(&out.AttachmentID, &out.ObjectKey, &experimentOwner, &experimentStatus, &attachmentStatus)
+	`, in.AttachmentID).Scan(&out.AttachmentID, &out.ObjectKey, &contentKey, &experimentOwner, &experimentStatus, &attachmentStatus, &scanStatus)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return DownloadOutput{}, ErrNotFound
@@ -329,9 +526,15 @@ func (s *Service) Download(ctx context.Context, in DownloadInput) (DownloadOutpu
 	if attachmentStatus != "completed" {
 		return DownloadOutput{}, ErrInvalidInput
 	}
+	switch scanStatus {
+	case scanStatusQuarantined:
+		return DownloadOutput{}, ErrQuarantined
+	case scanStatusPending, scanStatusFailed:
+		return DownloadOutput{}, ErrScanPending
+	}
 
 	out.ExpiresAt = time.Now().UTC().Add(s.downloadURLTTL)
-	downloadURL, err := s.signer.SignDownload(out.ObjectKey, out.ExpiresAt)
+	downloadURL, err := s.signer.SignDownload(contentKey, out.ExpiresAt)
 	if err != nil {
 		return DownloadOutput{}, fmt.Errorf("sign download URL: %w", err)
 	}
@@ -345,16 +548,26 @@ func (s *Service) Download(ctx context.Context, in DownloadInput) (DownloadOutpu
 // ---------------------------------------------------------------------------
 
 type AttachmentInfo struct {
-	ID           string     `json:"id"`
-	ExperimentID string     `json:"experimentId"`
-	ObjectKey    string     `json:"objectKey"`
-	SizeBytes    int64      `json:"sizeBytes"`
-	MimeType     string     `json:"mimeType"`
-	Status       string     `json:"status"`
-	CreatedAt    time.Time  `json:"createdAt"`
-	CompletedAt  *time.Time `json:"completedAt,omitempty"`
+	ID                     string     `json:"id"`
+	ExperimentID           string     `json:"experimentId"`
+	EntryID                *string    `json:"entryId,omitempty"`
+	ObjectKey              string     `json:"objectKey"`
+	SizeBytes              int64      `json:"sizeBytes"`
+	MimeType               string     `json:"mimeType"`
+	Status                 string     `json:"status"`
+	LineageID              string     `json:"lineageId"`
+	Version                int        `json:"version"`
+	SupersedesAttachmentID *string    `json:"supersedesAttachmentId,omitempty"`
+	VerificationStatus     string     `json:"verificationStatus"`
+	VerifiedSHA256         *string    `json:"verifiedSha256,omitempty"`
+	ScanStatus             string     `json:"scanStatus"`
+	CreatedAt              time.Time  `json:"createdAt"`
+	CompletedAt            *time.Time `json:"completedAt,omitempty"`
 }
 
+// ListByExperiment returns the effective version of each logical attachment:
+// versions superseded by a completed successor are omitted, as are pending
+// uploads of a new version until they complete.
 func (s *Service) ListByExperiment(ctx context.Context, experimentID, viewerUserID, viewerRole string) ([]AttachmentInfo, error) {
 	if strings.TrimSpace(experimentID) == "" {
 		return nil, ErrInvalidInput
@@ -377,10 +590,17 @@ func (s *Service) ListByExperiment(ctx context.Context, experimentID, viewerUser
 		}
 	}
 	rows, err := s.db.QueryContext(ctx, `
-		SELECT id::text, experiment_id::text, object_key, size_bytes, mime_type, status, created_at, completed_at
-		FROM attachments
-		WHERE experiment_id = $1::uuid
-		ORDER BY created_at DESC
+		SELECT `+attachmentInfoColumns+`
+		FROM attachments a
+		WHERE a.experiment_id = $1::uuid
+		  AND (a.supersedes_attachment_id IS NULL OR a.status = 'completed')
+		  AND NOT EXISTS (
+			SELECT 1
+			FROM attachments successor
+			WHERE successor.supersedes_attachment_id = a.id
+			  AND successor.status = 'completed'
+		  )
+		ORDER BY a.created_at DESC
 	`, experimentID)
 	if err != nil {
 		return nil, fmt.Errorf("list attachments: %w", err)
@@ -389,12 +609,15 @@ func (s *Service) ListByExperiment(ctx context.Context, experimentID, viewerUser
 
 	var out []AttachmentInfo
 	for rows.Next() {
-		var a AttachmentInfo
-		if err := rows.Scan(&a.ID, &a.ExperimentID, &a.ObjectKey, &a.SizeBytes, &a.MimeType, &a.Status, &a.CreatedAt, &a.CompletedAt); err != nil {
-			return nil, fmt.Errorf("scan attachment: %w", err)
+		a, err := scanAttachmentInfo(rows)
+		if err != nil {
+			return nil, err
 		}
 		out = append(out, a)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate attachments: %w", err)
+	}
 	if out == nil {
 		out = []AttachmentInfo{}
 	}
@@ -514,7 +737,7 @@ func (s *Service) Reconcile(ctx context.Context, in ReconcileInput) (ReconcileOu
 	}
 
 	completedRows, err := tx.QueryContext(ctx, `
-		SELECT id::text, object_key, size_bytes, COALESCE(checksum, '')
+		SELECT id::text, content_object_key, size_bytes, COALESCE(checksum, ''), COALESCE(verified_sha256, '')
 		FROM attachments
 		WHERE status = 'completed'
 		ORDER BY completed_at DESC NULLS LAST
@@ -524,15 +747,16 @@ func (s *Service) Reconcile(ctx context.Context, in ReconcileInput) (ReconcileOu
 		return ReconcileOutput{}, fmt.Errorf("query completed attachments for object drift: %w", err)
 	}
 	type completedAttachment struct {
-		id        string
-		objectKey string
-		sizeBytes int64
-		checksum  string
+		id             string
+		objectKey      string
+		sizeBytes      int64
+		checksum       string
+		verifiedSHA256 string
 	}
 	var completedAttachments []completedAttachment
 	for completedRows.Next() {
 		var item completedAttachment
-		if err := completedRows.Scan(&item.id, &item.objectKey, &item.sizeBytes, &item.checksum); err != nil {
+		if err := completedRows.Scan(&item.id, &item.objectKey, &item.sizeBytes, &item.checksum, &item.verifiedSHA256); err != nil {
 			completedRows.Close()
 			return ReconcileOutput{}, fmt.Errorf("scan completed attachment for object drift: %w", err)
 		}
@@ -577,6 +801,9 @@ func (s *Service) Reconcile(ctx context.Context, in ReconcileInput) (ReconcileOu
 
 		expectedChecksum := normalizeChecksum(item.checksum)
 		observedChecksum := normalizeChecksum(probe.Checksum)
+		if item.verifiedSHA256 != "" && isSHA256Hex(observedChecksum) {
+			expectedChecksum = item.verifiedSHA256
+		}
 		sizeMismatch := item.sizeBytes > 0 && probe.SizeBytes > 0 && item.sizeBytes != probe.SizeBytes
 		checksumMismatch := expectedChecksum != "" && observedChecksum != "" && expectedChecksum != observedChecksum
 		if sizeMismatch || checksumMismatch {
@@ -614,11 +841,23 @@ func (s *Service) Reconcile(ctx context.Context, in ReconcileInput) (ReconcileOu
 					continue
 				}
 
+				// Deduplicated attachments share a stored object, so a key is
+				// referenced while any attachment points at it or its
+				// reference count is non-zero. Preview renditions written by the
+				// preview worker are referenced from attachment_previews.
 				var exists bool
 				if err := tx.QueryRowContext(ctx, `
 					SELECT EXISTS(
 						SELECT 1
 						FROM attachments
+						WHERE object_key = $1 OR content_object_key = $1
+					) OR EXISTS(
+						SELECT 1
+						FROM attachment_objects
+						WHERE object_key = $1 AND ref_count > 0
+					) OR EXISTS(
+						SELECT 1
+						FROM attachment_previews
 						WHERE object_key = $1
 					)
 				`, objectKey).Scan(&exists); err != nil {
@@ -713,6 +952,25 @@ func insertReconcileFinding(ctx context.Context, tx *sql.Tx, runID string, attac
 	return nil
 }
 
+func ensureEntryInExperiment(ctx context.Context, tx *sql.Tx, entryID, experimentID string) error {
+	var entryExperimentID string
+	err := tx.QueryRowContext(ctx, `
+		SELECT experiment_id::text
+		FROM experiment_entries
+		WHERE id = $1::uuid
+	`, entryID).Scan(&entryExperimentID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("load attachment entry: %w", err)
+	}
+	if entryExperimentID != experimentID {
+		return ErrInvalidInput
+	}
+	return nil
+}
+
 func experimentOwner(ctx context.Context, q interface {
 	QueryRowContext(context.Context, string, ...any) *sql.Row
 }, experimentID string) (string, error) {
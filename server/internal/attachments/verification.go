@@ -0,0 +1,177 @@
+package attachments
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var ErrIntegrityMismatch = errors.New("attachment integrity mismatch")
+
+const (
+	VerifyModeOff     = "off"
+	VerifyModeFlag    = "flag"
+	VerifyModeEnforce = "enforce"
+)
+
+const (
+	verificationStatusUnverified  = "unverified"
+	verificationStatusVerified    = "verified"
+	verificationStatusMismatch    = "mismatch"
+	verificationStatusMissing     = "missing"
+	verificationStatusProbeFailed = "probe_failed"
+)
+
+const defaultHashMaxBytes int64 = 1 << 30
+
+// VerificationPolicy controls how Complete checks the uploaded object against
+// the checksum and size reported by the client.
+//
+// In "flag" mode (the default) completion always succeeds and the verification
+// outcome is recorded on the attachment. In "enforce" mode completion is
+// rejected unless the object exists and matches.
+type VerificationPolicy struct {
+	Mode         string
+	HashMaxBytes int64
+}
+
+type objectVerification struct {
+	Status            string
+	VerifiedSHA256    string
+	ObservedSizeBytes int64
+	ObservedChecksum  string
+	Details           map[string]any
+}
+
+func normalizeVerificationPolicy(p VerificationPolicy) VerificationPolicy {
+	switch strings.ToLower(strings.TrimSpace(p.Mode)) {
+	case VerifyModeOff:
+		p.Mode = VerifyModeOff
+	case VerifyModeEnforce:
+		p.Mode = VerifyModeEnforce
+	default:
+		p.Mode = VerifyModeFlag
+	}
+	if p.HashMaxBytes <= 0 {
+		p.HashMaxBytes = defaultHashMaxBytes
+	}
+	return p
+}
+
+// verifyObject probes the stored object and establishes its SHA-256. Stores
+// that publish a SHA-256 (X-Amz-Meta-Sha256 or an equivalent ETag) are trusted
+// directly; otherwise the object is streamed and hashed.
+func (s *Service) verifyObject(ctx context.Context, objectKey string, declaredSize int64, declaredChecksum string) (objectVerification, error) {
+	out := objectVerification{
+		Status:  verificationStatusUnverified,
+		Details: map[string]any{},
+	}
+	if s.verification.Mode == VerifyModeOff || s.inspector == nil {
+		out.Details["reason"] = "verification_disabled"
+		return out, nil
+	}
+
+	probe, err := s.inspector.Probe(ctx, objectKey)
+	if err != nil {
+		out.Status = verificationStatusProbeFailed
+		out.Details["error"] = err.Error()
+		return out, err
+	}
+	if !probe.Exists {
+		out.Status = verificationStatusMissing
+		return out, nil
+	}
+	out.ObservedSizeBytes = probe.SizeBytes
+	out.ObservedChecksum = normalizeChecksum(probe.Checksum)
+
+	if probe.SizeBytes > 0 && probe.SizeBytes != declaredSize {
+		out.Status = verificationStatusMismatch
+		out.Details["sizeMismatch"] = true
+		out.Details["expectedSizeBytes"] = declaredSize
+		out.Details["observedSizeBytes"] = probe.SizeBytes
+		return out, nil
+	}
+
+	observedSHA256 := ""
+	if isSHA256Hex(out.ObservedChecksum) {
+		observedSHA256 = out.ObservedChecksum
+		out.Details["hashSource"] = "object_store"
+	} else {
+		if probe.SizeBytes > s.verification.HashMaxBytes {
+			out.Details["reason"] = "object_exceeds_hash_limit"
+			out.Details["hashMaxBytes"] = s.verification.HashMaxBytes
+			return out, nil
+		}
+		sum, hashedBytes, err := s.hashObject(ctx, objectKey)
+		if err != nil {
+			if errors.Is(err, ErrObjectNotFound) {
+				out.Status = verificationStatusMissing
+				return out, nil
+			}
+			out.Status = verificationStatusProbeFailed
+			out.Details["error"] = err.Error()
+			return out, err
+		}
+		if hashedBytes != declaredSize {
+			out.Status = verificationStatusMismatch
+			out.Details["sizeMismatch"] = true
+			out.Details["expectedSizeBytes"] = declaredSize
+			out.Details["observedSizeBytes"] = hashedBytes
+			return out, nil
+		}
+		out.ObservedSizeBytes = hashedBytes
+		observedSHA256 = sum
+		out.Details["hashSource"] = "stream"
+	}
+
+	expected := normalizeChecksum(declaredChecksum)
+	checksumMismatch := false
+	switch {
+	case isSHA256Hex(expected):
+		checksumMismatch = expected != observedSHA256
+	case out.ObservedChecksum != "" && !isSHA256Hex(out.ObservedChecksum):
+		// Legacy clients report the store's native checksum (e.g. an MD5 ETag).
+		checksumMismatch = expected != out.ObservedChecksum
+	}
+	if checksumMismatch {
+		out.Status = verificationStatusMismatch
+		out.Details["checksumMismatch"] = true
+		out.Details["expectedChecksum"] = expected
+		out.Details["observedSha256"] = observedSHA256
+		return out, nil
+	}
+
+	out.Status = verificationStatusVerified
+	out.VerifiedSHA256 = observedSHA256
+	return out, nil
+}
+
+func (s *Service) hashObject(ctx context.Context, objectKey string) (string, int64, error) {
+	body, err := s.inspector.Open(ctx, objectKey)
+	if err != nil {
+		return "", 0, err
+	}
+	defer body.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, io.LimitReader(body, s.verification.HashMaxBytes+1))
+	if err != nil {
+		return "", 0, fmt.Errorf("hash object body: %w", err)
+	}
+	if n > s.verification.HashMaxBytes {
+		return "", 0, fmt.Errorf("object exceeds hash limit of %d bytes", s.verification.HashMaxBytes)
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+func isSHA256Hex(v string) bool {
+	if len(v) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(v)
+	return err == nil
+}
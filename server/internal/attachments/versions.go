@@ -0,0 +1,207 @@
+package attachments
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	internaldb "github.com/mjhen/elnote/server/internal/db"
+	"github.com/mjhen/elnote/server/internal/syncer"
+)
+
+// ErrVersionConflict is returned when a new version targets an attachment
+// that has already been superseded by another completed version.
+var ErrVersionConflict = errors.New("attachment already superseded")
+
+const attachmentInfoColumns = `
+	a.id::text, a.experiment_id::text, a.entry_id::text, a.object_key, a.size_bytes, a.mime_type, a.status,
+	a.lineage_id::text, a.version_number, a.supersedes_attachment_id::text,
+	a.verification_status, a.verified_sha256, a.scan_status, a.created_at, a.completed_at`
+
+func scanAttachmentInfo(rows *sql.Rows) (AttachmentInfo, error) {
+	var (
+		a          AttachmentInfo
+		entryID    sql.NullString
+		supersedes sql.NullString
+	)
+	if err := rows.Scan(
+		&a.ID,
+		&a.ExperimentID,
+		&entryID,
+		&a.ObjectKey,
+		&a.SizeBytes,
+		&a.MimeType,
+		&a.Status,
+		&a.LineageID,
+		&a.Version,
+		&supersedes,
+		&a.VerificationStatus,
+		&a.VerifiedSHA256,
+		&a.ScanStatus,
+		&a.CreatedAt,
+		&a.CompletedAt,
+	); err != nil {
+		return AttachmentInfo{}, fmt.Errorf("scan attachment: %w", err)
+	}
+	if entryID.Valid {
+		a.EntryID = &entryID.String
+	}
+	if supersedes.Valid {
+		a.SupersedesAttachmentID = &supersedes.String
+	}
+	return a, nil
+}
+
+// lockSupersedableAttachment locks the attachment a new version will supersede
+// and checks it is the current completed head of its lineage. It returns the
+// entry the superseded attachment is bound to, if any.
+func lockSupersedableAttachment(ctx context.Context, tx *sql.Tx, attachmentID, experimentID string) (string, error) {
+	var (
+		prevExperimentID string
+		prevStatus       string
+		prevEntryID      sql.NullString
+	)
+	err := tx.QueryRowContext(ctx, `
+		SELECT experiment_id::text, status, entry_id::text
+		FROM attachments
+		WHERE id = $1::uuid
+		FOR UPDATE
+	`, attachmentID).Scan(&prevExperimentID, &prevStatus, &prevEntryID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrNotFound
+		}
+		return "", fmt.Errorf("lock superseded attachment: %w", err)
+	}
+	if prevExperimentID != experimentID || prevStatus != "completed" {
+		return "", ErrInvalidInput
+	}
+
+	var superseded bool
+	if err := tx.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1
+			FROM attachments
+			WHERE supersedes_attachment_id = $1::uuid
+			  AND status = 'completed'
+		)
+	`, attachmentID).Scan(&superseded); err != nil {
+		return "", fmt.Errorf("check attachment successor: %w", err)
+	}
+	if superseded {
+		return "", ErrVersionConflict
+	}
+	return prevEntryID.String, nil
+}
+
+func (s *Service) recordNewVersion(ctx context.Context, tx *sql.Tx, ownerUserID, deviceID, experimentID string, out CompleteOutput) error {
+	if err := internaldb.AppendAuditEvent(ctx, tx, ownerUserID, "attachment.version.create", "attachment", out.AttachmentID, map[string]any{
+		"experimentId":           experimentID,
+		"lineageId":              out.LineageID,
+		"version":                out.Version,
+		"supersedesAttachmentId": *out.SupersedesAttachmentID,
+	}); err != nil {
+		return err
+	}
+
+	if _, err := s.sync.AppendEvent(ctx, tx, syncer.AppendEventInput{
+		OwnerUserID:   ownerUserID,
+		ActorUserID:   ownerUserID,
+		DeviceID:      deviceID,
+		EventType:     "attachment.version.created",
+		AggregateType: "attachment",
+		AggregateID:   out.AttachmentID,
+		Payload: map[string]any{
+			"experimentId":           experimentID,
+			"lineageId":              out.LineageID,
+			"version":                out.Version,
+			"supersedesAttachmentId": *out.SupersedesAttachmentID,
+		},
+	}); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ---------------------------------------------------------------------------
+// Version history for a logical attachment
+// ---------------------------------------------------------------------------
+
+type HistoryInput struct {
+	AttachmentID string
+	ViewerUserID string
+	ViewerRole   string
+}
+
+type AttachmentHistory struct {
+	LineageID             string           `json:"lineageId"`
+	ExperimentID          string           `json:"experimentId"`
+	EffectiveAttachmentID *string          `json:"effectiveAttachmentId,omitempty"`
+	Versions              []AttachmentInfo `json:"versions"`
+}
+
+// History returns every version of the logical attachment that the given
+// attachment belongs to, oldest first. The effective version is the latest
+// completed one; a lineage with no completed version has none.
+func (s *Service) History(ctx context.Context, in HistoryInput) (AttachmentHistory, error) {
+	if strings.TrimSpace(in.AttachmentID) == "" || strings.TrimSpace(in.ViewerUserID) == "" {
+		return AttachmentHistory{}, ErrInvalidInput
+	}
+
+	var (
+		out              AttachmentHistory
+		experimentOwner  string
+		experimentStatus string
+	)
+	err := s.db.QueryRowContext(ctx, `
+		SELECT a.lineage_id::text, a.experiment_id::text, e.owner_user_id::text, e.status
+		FROM attachments a
+		JOIN experiments e ON e.id = a.experiment_id
+		WHERE a.id = $1::uuid
+	`, in.AttachmentID).Scan(&out.LineageID, &out.ExperimentID, &experimentOwner, &experimentStatus)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return AttachmentHistory{}, ErrNotFound
+		}
+		return AttachmentHistory{}, fmt.Errorf("load attachment lineage: %w", err)
+	}
+	if !(in.ViewerUserID == experimentOwner || (in.ViewerRole == "admin" && experimentStatus == "completed")) {
+		return AttachmentHistory{}, ErrForbidden
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+attachmentInfoColumns+`
+		FROM attachments a
+		WHERE a.lineage_id = $1::uuid
+		ORDER BY a.version_number ASC, a.created_at ASC
+	`, out.LineageID)
+	if err != nil {
+		return AttachmentHistory{}, fmt.Errorf("list attachment versions: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		a, err := scanAttachmentInfo(rows)
+		if err != nil {
+			return AttachmentHistory{}, err
+		}
+		out.Versions = append(out.Versions, a)
+	}
+	if err := rows.Err(); err != nil {
+		return AttachmentHistory{}, fmt.Errorf("iterate attachment versions: %w", err)
+	}
+
+	for i := range out.Versions {
+		v := out.Versions[i]
+		if v.Status == "completed" {
+			id := v.ID
+			out.EffectiveAttachmentID = &id
+		}
+	}
+	if out.Versions == nil {
+		out.Versions = []AttachmentInfo{}
+	}
+	return out, nil
+}
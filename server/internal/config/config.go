@@ -27,6 +27,15 @@ type Config struct {
 	ObjectStoreProbeTimeout     time.Duration
 	AttachmentUploadURLTTL      time.Duration
 	AttachmentDownloadURLTTL    time.Duration
+	AttachmentVerifyMode        string
+	AttachmentHashMaxBytes      int64
+	AttachmentScanEnabled       bool
+	AttachmentScanMagicBytes    bool
+	AttachmentScanInterval      time.Duration
+	AttachmentScanBatchSize     int
+	AttachmentScanMaxAttempts   int
+	ClamdAddress                string
+	ClamdTimeout                time.Duration
 	DefaultReconcileStaleAfter  time.Duration
 	DefaultReconcileScanLimit   int
 	ReconcileScheduleEnabled    bool
@@ -35,7 +44,17 @@ type Config struct {
 	ReconcileScheduleActorEmail string
 	SearchResultLimit           int
 	PreviewMaxSizeBytes         int64
+	PreviewWorkerEnabled        bool
+	PreviewWorkerInterval       time.Duration
+	PreviewBatchSize            int
+	PreviewMaxAttempts          int
+	PreviewRetryBackoff         time.Duration
+	PreviewObjectStoreMinBytes  int64
+	DataExtractMaxSourceBytes   int64
 	NotificationRetentionDays   int
+	SavedSearchAlertsEnabled    bool
+	SavedSearchAlertInterval    time.Duration
+	SavedSearchAlertBatchSize   int
 	SMTPHost                    string
 	SMTPPort                    int
 	SMTPUsername                string
@@ -63,6 +82,15 @@ func Load() (Config, error) {
 		ObjectStoreProbeTimeout:     getDurationEnv("OBJECT_STORE_PROBE_TIMEOUT", 10*time.Second),
 		AttachmentUploadURLTTL:      getDurationEnv("ATTACHMENT_UPLOAD_URL_TTL", 15*time.Minute),
 		AttachmentDownloadURLTTL:    getDurationEnv("ATTACHMENT_DOWNLOAD_URL_TTL", 15*time.Minute),
+		AttachmentVerifyMode:        strings.ToLower(getEnv("ATTACHMENT_VERIFY_MODE", "flag")),
+		AttachmentHashMaxBytes:      int64(getIntEnv("ATTACHMENT_HASH_MAX_BYTES", 1024*1024*1024)),
+		AttachmentScanEnabled:       getBoolEnv("ATTACHMENT_SCAN_ENABLED", false),
+		AttachmentScanMagicBytes:    getBoolEnv("ATTACHMENT_SCAN_MAGIC_BYTES", true),
+		AttachmentScanInterval:      getDurationEnv("ATTACHMENT_SCAN_INTERVAL", 30*time.Second),
+		AttachmentScanBatchSize:     getIntEnv("ATTACHMENT_SCAN_BATCH_SIZE", 20),
+		AttachmentScanMaxAttempts:   getIntEnv("ATTACHMENT_SCAN_MAX_ATTEMPTS", 5),
+		ClamdAddress:                strings.TrimSpace(os.Getenv("CLAMD_ADDRESS")),
+		ClamdTimeout:                getDurationEnv("CLAMD_TIMEOUT", 60*time.Second),
 		DefaultReconcileStaleAfter:  getDurationEnv("RECONCILE_STALE_AFTER", 24*time.Hour),
 		DefaultReconcileScanLimit:   getIntEnv("RECONCILE_SCAN_LIMIT", 500),
 		ReconcileScheduleEnabled:    getBoolEnv("RECONCILE_SCHEDULE_ENABLED", true),
@@ -71,7 +99,17 @@ func Load() (Config, error) {
 		ReconcileScheduleActorEmail: getEnv("RECONCILE_SCHEDULE_ACTOR_EMAIL", "labadmin"),
 		SearchResultLimit:           getIntEnv("SEARCH_RESULT_LIMIT", 50),
 		PreviewMaxSizeBytes:         int64(getIntEnv("PREVIEW_MAX_SIZE_BYTES", 10*1024*1024)),
+		PreviewWorkerEnabled:        getBoolEnv("PREVIEW_WORKER_ENABLED", true),
+		PreviewWorkerInterval:       getDurationEnv("PREVIEW_WORKER_INTERVAL", 10*time.Second),
+		PreviewBatchSize:            getIntEnv("PREVIEW_BATCH_SIZE", 10),
+		PreviewMaxAttempts:          getIntEnv("PREVIEW_MAX_ATTEMPTS", 5),
+		PreviewRetryBackoff:         getDurationEnv("PREVIEW_RETRY_BACKOFF", 30*time.Second),
+		PreviewObjectStoreMinBytes:  int64(getIntEnv("PREVIEW_OBJECT_STORE_MIN_BYTES", 0)),
+		DataExtractMaxSourceBytes:   int64(getIntEnv("DATA_EXTRACT_MAX_SOURCE_BYTES", 50*1024*1024)),
 		NotificationRetentionDays:   getIntEnv("NOTIFICATION_RETENTION_DAYS", 90),
+		SavedSearchAlertsEnabled:    getBoolEnv("SAVED_SEARCH_ALERTS_ENABLED", true),
+		SavedSearchAlertInterval:    getDurationEnv("SAVED_SEARCH_ALERT_INTERVAL", time.Minute),
+		SavedSearchAlertBatchSize:   getIntEnv("SAVED_SEARCH_ALERT_BATCH_SIZE", 500),
 		SMTPHost:                    strings.TrimSpace(os.Getenv("SMTP_HOST")),
 		SMTPPort:                    getIntEnv("SMTP_PORT", 587),
 		SMTPUsername:                strings.TrimSpace(os.Getenv("SMTP_USERNAME")),
@@ -100,6 +138,23 @@ func Load() (Config, error) {
 	if cfg.ObjectStoreProbeTimeout <= 0 {
 		cfg.ObjectStoreProbeTimeout = 10 * time.Second
 	}
+	switch cfg.AttachmentVerifyMode {
+	case "off", "flag", "enforce":
+	default:
+		return Config{}, errors.New("ATTACHMENT_VERIFY_MODE must be off, flag, or enforce")
+	}
+	if cfg.AttachmentScanEnabled && !cfg.AttachmentScanMagicBytes && cfg.ClamdAddress == "" {
+		return Config{}, errors.New("ATTACHMENT_SCAN_ENABLED requires ATTACHMENT_SCAN_MAGIC_BYTES or CLAMD_ADDRESS")
+	}
+	if cfg.AttachmentScanInterval <= 0 {
+		cfg.AttachmentScanInterval = 30 * time.Second
+	}
+	if cfg.PreviewWorkerInterval <= 0 {
+		cfg.PreviewWorkerInterval = 10 * time.Second
+	}
+	if cfg.SavedSearchAlertInterval <= 0 {
+		cfg.SavedSearchAlertInterval = time.Minute
+	}
 
 	return cfg, nil
 }
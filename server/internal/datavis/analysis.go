@@ -0,0 +1,691 @@
+package datavis
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	internaldb "github.com/mjhen/elnote/server/internal/db"
+	"github.com/mjhen/elnote/server/internal/syncer"
+)
+
+// Analysis types.
+const (
+	AnalysisLinearFit      = "linear_fit"
+	AnalysisLogistic4PL    = "logistic_4pl"
+	AnalysisInterpolation  = "interpolation"
+	AnalysisReplicateStats = "replicate_stats"
+	AnalysisTTest          = "t_test"
+)
+
+// AnalysisParameters configures an analysis; which fields apply depends on
+// the type. Where restricts the rows used to those whose cells equal the
+// given values, e.g. {"read": "Absorbance 450nm"} on a plate extract.
+//
+//   - linear_fit, logistic_4pl: XColumn, YColumn.
+//   - interpolation: XColumn (known amount of standards), YColumn
+//     (response), Model (linear_fit or logistic_4pl), RoleColumn, which
+//     marks standard, sample and blank rows as in plate layouts,
+//     LabelColumn naming the unknowns and SubtractBlank.
+//   - replicate_stats: ValueColumn, GroupColumns.
+//   - t_test: ValueColumn, GroupColumn, GroupA, GroupB and EqualVariance
+//     (Student's rather than Welch's test).
+//   - qpcr_ddct: CtColumn, SampleColumn, TargetColumn, ReferenceTargets
+//     (reference genes), ControlSample (calibrator), OutlierThreshold in
+//     cycles (default 0.5) and ExcludeOutliers.
+type AnalysisParameters struct {
+	XColumn       string   `json:"xColumn,omitempty"`
+	YColumn       string   `json:"yColumn,omitempty"`
+	Model         string   `json:"model,omitempty"`
+	RoleColumn    string   `json:"roleColumn,omitempty"`
+	LabelColumn   string   `json:"labelColumn,omitempty"`
+	SubtractBlank bool     `json:"subtractBlank,omitempty"`
+	ValueColumn   string   `json:"valueColumn,omitempty"`
+	GroupColumns  []string `json:"groupColumns,omitempty"`
+	GroupColumn   string   `json:"groupColumn,omitempty"`
+	GroupA        string   `json:"groupA,omitempty"`
+	GroupB        string   `json:"groupB,omitempty"`
+	EqualVariance bool     `json:"equalVariance,omitempty"`
+
+	CtColumn         string   `json:"ctColumn,omitempty"`
+	SampleColumn     string   `json:"sampleColumn,omitempty"`
+	TargetColumn     string   `json:"targetColumn,omitempty"`
+	ReferenceTargets []string `json:"referenceTargets,omitempty"`
+	ControlSample    string   `json:"controlSample,omitempty"`
+	OutlierThreshold float64  `json:"outlierThreshold,omitempty"`
+	ExcludeOutliers  bool     `json:"excludeOutliers,omitempty"`
+
+	Where map[string]string `json:"where,omitempty"`
+}
+
+// Analysis is a stored, immutable analysis. Results holds a FitResult,
+// InterpolationResult, ReplicateStatsResult, TTestResult or QPCRResult
+// according to AnalysisType.
+type Analysis struct {
+	ID            string             `json:"analysisId"`
+	ExperimentID  string             `json:"experimentId"`
+	DataExtractID string             `json:"dataExtractId"`
+	CreatorUserID string             `json:"creatorUserId"`
+	AnalysisType  string             `json:"analysisType"`
+	Parameters    AnalysisParameters `json:"parameters"`
+	Results       json.RawMessage    `json:"results"`
+	CreatedAt     time.Time          `json:"createdAt"`
+}
+
+type CreateAnalysisInput struct {
+	ExperimentID  string
+	DataExtractID string
+	CreatorUserID string
+	DeviceID      string
+	AnalysisType  string
+	Parameters    AnalysisParameters
+}
+
+// FitResult describes a fitted curve. Linear fits report slope and
+// intercept; 4PL fits report bottom (response at zero dose), top (response
+// at infinite dose), ec50 and hillSlope.
+type FitResult struct {
+	Model      string             `json:"model"`
+	Parameters map[string]float64 `json:"parameters"`
+	RSquared   float64            `json:"rSquared"`
+	ResidualSD float64            `json:"residualSd"`
+	N          int                `json:"n"`
+	XMin       float64            `json:"xMin"`
+	XMax       float64            `json:"xMax"`
+	Iterations int                `json:"iterations,omitempty"`
+}
+
+// InterpolationResult is a standard curve and the unknowns read from it.
+// Unknowns whose response lies outside the standards' responses are
+// flagged as extrapolated; Value is absent when the curve cannot be
+// inverted at that response.
+type InterpolationResult struct {
+	Fit      FitResult           `json:"fit"`
+	Blank    *float64            `json:"blank,omitempty"`
+	Unknowns []InterpolatedValue `json:"unknowns"`
+}
+
+type InterpolatedValue struct {
+	Row        int      `json:"row"`
+	Label      string   `json:"label,omitempty"`
+	Response   float64  `json:"response"`
+	Value      *float64 `json:"value"`
+	OutOfRange bool     `json:"outOfRange"`
+}
+
+type ReplicateStatsResult struct {
+	GroupColumns []string         `json:"groupColumns"`
+	Groups       []ReplicateGroup `json:"groups"`
+}
+
+// ReplicateGroup summarizes the values sharing Key (one entry per group
+// column). CV is the coefficient of variation in percent, absent when the
+// mean is zero.
+type ReplicateGroup struct {
+	Key  []string `json:"key"`
+	N    int      `json:"n"`
+	Mean float64  `json:"mean"`
+	SD   float64  `json:"sd"`
+	CV   *float64 `json:"cv,omitempty"`
+}
+
+type SampleSummary struct {
+	Group string  `json:"group"`
+	N     int     `json:"n"`
+	Mean  float64 `json:"mean"`
+	SD    float64 `json:"sd"`
+}
+
+// TTestResult is a two-sided two-sample t-test of GroupA against GroupB.
+type TTestResult struct {
+	GroupA         SampleSummary `json:"groupA"`
+	GroupB         SampleSummary `json:"groupB"`
+	MeanDifference float64       `json:"meanDifference"`
+	T              float64       `json:"t"`
+	DF             float64       `json:"df"`
+	PValue         float64       `json:"pValue"`
+	Welch          bool          `json:"welch"`
+}
+
+// analysisTable is the extract table with the Where filter applied.
+type analysisTable struct {
+	headers []string
+	rows    [][]string
+	// index is the extract row number of each filtered row.
+	index []int
+}
+
+func (t *analysisTable) column(name, param string) (int, error) {
+	if strings.TrimSpace(name) == "" {
+		return 0, fmt.Errorf("%w: %s is required", ErrInvalidInput, param)
+	}
+	idx := columnIndex(t.headers, name)
+	if idx < 0 {
+		return 0, fmt.Errorf("%w: %s %q is not in the extract", ErrInvalidInput, param, name)
+	}
+	return idx, nil
+}
+
+func (t *analysisTable) cell(row []string, idx int) string {
+	if idx < len(row) {
+		return strings.TrimSpace(row[idx])
+	}
+	return ""
+}
+
+// number returns the numeric value of column idx, with ok false for
+// missing or non-numeric cells.
+func (t *analysisTable) number(row []string, idx int) (float64, bool) {
+	v := t.cell(row, idx)
+	if isMissing(v) {
+		return 0, false
+	}
+	return parseNumber(v)
+}
+
+func filterRows(headers []string, rows [][]string, where map[string]string) (*analysisTable, error) {
+	t := &analysisTable{headers: headers}
+	type cond struct {
+		idx   int
+		value string
+	}
+	var conds []cond
+	for col, value := range where {
+		idx, err := t.column(col, "where column")
+		if err != nil {
+			return nil, err
+		}
+		conds = append(conds, cond{idx, strings.TrimSpace(value)})
+	}
+	for i, row := range rows {
+		keep := true
+		for _, c := range conds {
+			if t.cell(row, c.idx) != c.value {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			t.rows = append(t.rows, row)
+			t.index = append(t.index, i)
+		}
+	}
+	return t, nil
+}
+
+// runAnalysis validates the parameters, fills in defaults and computes the
+// results.
+func runAnalysis(analysisType string, params *AnalysisParameters, t *analysisTable) (any, error) {
+	switch analysisType {
+	case AnalysisLinearFit, AnalysisLogistic4PL:
+		x, y, _, err := xyPairs(t, params.XColumn, params.YColumn, nil)
+		if err != nil {
+			return nil, err
+		}
+		return fitCurve(analysisType, x, y)
+
+	case AnalysisInterpolation:
+		return interpolate(params, t)
+
+	case AnalysisReplicateStats:
+		return replicateStats(params, t)
+
+	case AnalysisTTest:
+		return tTest(params, t)
+
+	case AnalysisQPCRDeltaDeltaCt:
+		return qpcrDeltaDeltaCt(params, t)
+	}
+	return nil, fmt.Errorf("%w: analysisType must be linear_fit, logistic_4pl, interpolation, replicate_stats, t_test or qpcr_ddct", ErrInvalidInput)
+}
+
+// xyPairs collects the rows where both columns are numeric and keep (when
+// given) accepts the row. It returns the positions within t.rows.
+func xyPairs(t *analysisTable, xColumn, yColumn string, keep func(row []string) bool) (x, y []float64, at []int, err error) {
+	xi, err := t.column(xColumn, "xColumn")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	yi, err := t.column(yColumn, "yColumn")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	for i, row := range t.rows {
+		if keep != nil && !keep(row) {
+			continue
+		}
+		xv, okX := t.number(row, xi)
+		yv, okY := t.number(row, yi)
+		if okX && okY {
+			x, y, at = append(x, xv), append(y, yv), append(at, i)
+		}
+	}
+	return x, y, at, nil
+}
+
+func fitCurve(model string, x, y []float64) (*FitResult, error) {
+	res := &FitResult{Model: model, N: len(x)}
+	var predict func(float64) float64
+	switch model {
+	case AnalysisLinearFit:
+		if len(x) < 2 {
+			return nil, fmt.Errorf("%w: a linear fit needs at least 2 numeric points, found %d", ErrInvalidInput, len(x))
+		}
+		slope, intercept, err := linearFit(x, y)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidInput, err)
+		}
+		res.Parameters = map[string]float64{"slope": slope, "intercept": intercept}
+		predict = func(v float64) float64 { return slope*v + intercept }
+	case AnalysisLogistic4PL:
+		if len(x) < 5 {
+			return nil, fmt.Errorf("%w: a 4PL fit needs at least 5 numeric points, found %d", ErrInvalidInput, len(x))
+		}
+		for _, v := range x {
+			if v < 0 {
+				return nil, fmt.Errorf("%w: 4PL doses must not be negative", ErrInvalidInput)
+			}
+		}
+		p, iterations, err := fit4PL(x, y)
+		if err != nil {
+			return nil, fmt.Errorf("%w: 4PL %v", ErrInvalidInput, err)
+		}
+		res.Parameters = map[string]float64{"bottom": p[0], "hillSlope": p[1], "ec50": p[2], "top": p[3]}
+		res.Iterations = iterations
+		predict = func(v float64) float64 { return logistic4PL(p, v) }
+	default:
+		return nil, fmt.Errorf("%w: model must be linear_fit or logistic_4pl", ErrInvalidInput)
+	}
+
+	yhat := make([]float64, len(x))
+	res.XMin, res.XMax = x[0], x[0]
+	for i, v := range x {
+		yhat[i] = predict(v)
+		res.XMin, res.XMax = math.Min(res.XMin, v), math.Max(res.XMax, v)
+	}
+	res.RSquared = rSquared(y, yhat)
+	res.ResidualSD = residualSD(y, yhat, len(res.Parameters))
+	return res, nil
+}
+
+func interpolate(params *AnalysisParameters, t *analysisTable) (*InterpolationResult, error) {
+	if params.Model == "" {
+		params.Model = AnalysisLinearFit
+	}
+	if params.RoleColumn == "" {
+		params.RoleColumn = "role"
+	}
+	roleIdx, err := t.column(params.RoleColumn, "roleColumn")
+	if err != nil {
+		return nil, err
+	}
+	yIdx, err := t.column(params.YColumn, "yColumn")
+	if err != nil {
+		return nil, err
+	}
+	labelIdx := -1
+	if params.LabelColumn != "" {
+		if labelIdx, err = t.column(params.LabelColumn, "labelColumn"); err != nil {
+			return nil, err
+		}
+	}
+	hasRole := func(role string) func([]string) bool {
+		return func(row []string) bool { return strings.EqualFold(t.cell(row, roleIdx), role) }
+	}
+
+	out := &InterpolationResult{Unknowns: []InterpolatedValue{}}
+	var blank float64
+	if params.SubtractBlank {
+		var blanks []float64
+		for _, row := range t.rows {
+			if v, ok := t.number(row, yIdx); ok && hasRole(WellRoleBlank)(row) {
+				blanks = append(blanks, v)
+			}
+		}
+		if len(blanks) == 0 {
+			return nil, fmt.Errorf("%w: subtractBlank needs at least one %s row", ErrInvalidInput, WellRoleBlank)
+		}
+		blank = mean(blanks)
+		out.Blank = &blank
+	}
+
+	x, y, _, err := xyPairs(t, params.XColumn, params.YColumn, hasRole(WellRoleStandard))
+	if err != nil {
+		return nil, err
+	}
+	for i := range y {
+		y[i] -= blank
+	}
+	fit, err := fitCurve(params.Model, x, y)
+	if err != nil {
+		return nil, fmt.Errorf("standard curve: %w", err)
+	}
+	out.Fit = *fit
+	yMin, yMax := y[0], y[0]
+	for _, v := range y {
+		yMin, yMax = math.Min(yMin, v), math.Max(yMax, v)
+	}
+
+	for i, row := range t.rows {
+		if !hasRole(WellRoleSample)(row) {
+			continue
+		}
+		response, ok := t.number(row, yIdx)
+		if !ok {
+			continue
+		}
+		response -= blank
+		u := InterpolatedValue{Row: t.index[i], Response: response, OutOfRange: response < yMin || response > yMax}
+		if labelIdx >= 0 {
+			u.Label = t.cell(row, labelIdx)
+		}
+		var value float64
+		switch params.Model {
+		case AnalysisLinearFit:
+			if slope := fit.Parameters["slope"]; slope != 0 {
+				value, ok = (response-fit.Parameters["intercept"])/slope, true
+			} else {
+				ok = false
+			}
+		case AnalysisLogistic4PL:
+			p := [4]float64{fit.Parameters["bottom"], fit.Parameters["hillSlope"], fit.Parameters["ec50"], fit.Parameters["top"]}
+			value, ok = inverse4PL(p, response)
+		}
+		if ok {
+			u.Value = &value
+		}
+		out.Unknowns = append(out.Unknowns, u)
+	}
+	if len(out.Unknowns) == 0 {
+		return nil, fmt.Errorf("%w: no %s rows with a numeric %s", ErrInvalidInput, WellRoleSample, params.YColumn)
+	}
+	return out, nil
+}
+
+func replicateStats(params *AnalysisParameters, t *analysisTable) (*ReplicateStatsResult, error) {
+	valueIdx, err := t.column(params.ValueColumn, "valueColumn")
+	if err != nil {
+		return nil, err
+	}
+	if len(params.GroupColumns) == 0 {
+		return nil, fmt.Errorf("%w: at least one groupColumn is required", ErrInvalidInput)
+	}
+	groupIdx := make([]int, len(params.GroupColumns))
+	for i, col := range params.GroupColumns {
+		if groupIdx[i], err = t.column(col, "groupColumns"); err != nil {
+			return nil, err
+		}
+	}
+
+	values := map[string][]float64{}
+	keys := map[string][]string{}
+	var order []string
+	for _, row := range t.rows {
+		v, ok := t.number(row, valueIdx)
+		if !ok {
+			continue
+		}
+		key := make([]string, len(groupIdx))
+		for i, idx := range groupIdx {
+			key[i] = t.cell(row, idx)
+		}
+		k := strings.Join(key, "\x00")
+		if _, seen := values[k]; !seen {
+			order = append(order, k)
+			keys[k] = key
+		}
+		values[k] = append(values[k], v)
+	}
+	if len(order) == 0 {
+		return nil, fmt.Errorf("%w: %s has no numeric values", ErrInvalidInput, params.ValueColumn)
+	}
+
+	out := &ReplicateStatsResult{GroupColumns: params.GroupColumns, Groups: make([]ReplicateGroup, 0, len(order))}
+	for _, k := range order {
+		v := values[k]
+		g := ReplicateGroup{Key: keys[k], N: len(v), Mean: mean(v), SD: sampleSD(v)}
+		if g.Mean != 0 {
+			cv := 100 * g.SD / math.Abs(g.Mean)
+			g.CV = &cv
+		}
+		out.Groups = append(out.Groups, g)
+	}
+	sort.SliceStable(out.Groups, func(i, j int) bool {
+		return strings.Join(out.Groups[i].Key, "\x00") < strings.Join(out.Groups[j].Key, "\x00")
+	})
+	return out, nil
+}
+
+func tTest(params *AnalysisParameters, t *analysisTable) (*TTestResult, error) {
+	valueIdx, err := t.column(params.ValueColumn, "valueColumn")
+	if err != nil {
+		return nil, err
+	}
+	groupIdx, err := t.column(params.GroupColumn, "groupColumn")
+	if err != nil {
+		return nil, err
+	}
+	if params.GroupA == "" || params.GroupB == "" || params.GroupA == params.GroupB {
+		return nil, fmt.Errorf("%w: groupA and groupB must name two different groups", ErrInvalidInput)
+	}
+
+	var a, b []float64
+	for _, row := range t.rows {
+		v, ok := t.number(row, valueIdx)
+		if !ok {
+			continue
+		}
+		switch t.cell(row, groupIdx) {
+		case params.GroupA:
+			a = append(a, v)
+		case params.GroupB:
+			b = append(b, v)
+		}
+	}
+	if len(a) < 2 || len(b) < 2 {
+		return nil, fmt.Errorf("%w: each group needs at least 2 numeric values (found %d and %d)", ErrInvalidInput, len(a), len(b))
+	}
+
+	out := &TTestResult{
+		GroupA: SampleSummary{Group: params.GroupA, N: len(a), Mean: mean(a), SD: sampleSD(a)},
+		GroupB: SampleSummary{Group: params.GroupB, N: len(b), Mean: mean(b), SD: sampleSD(b)},
+		Welch:  !params.EqualVariance,
+	}
+	out.MeanDifference = out.GroupA.Mean - out.GroupB.Mean
+	na, nb := float64(len(a)), float64(len(b))
+	va, vb := out.GroupA.SD*out.GroupA.SD, out.GroupB.SD*out.GroupB.SD
+	var se float64
+	if out.Welch {
+		se = math.Sqrt(va/na + vb/nb)
+		if se > 0 {
+			out.DF = (va/na + vb/nb) * (va/na + vb/nb) / ((va/na)*(va/na)/(na-1) + (vb/nb)*(vb/nb)/(nb-1))
+		}
+	} else {
+		pooled := ((na-1)*va + (nb-1)*vb) / (na + nb - 2)
+		se = math.Sqrt(pooled * (1/na + 1/nb))
+		out.DF = na + nb - 2
+	}
+	if se == 0 {
+		return nil, fmt.Errorf("%w: both groups have zero variance", ErrInvalidInput)
+	}
+	out.T = out.MeanDifference / se
+	out.PValue = studentTTwoSided(out.T, out.DF)
+	return out, nil
+}
+
+// CreateAnalysis runs an analysis on the extract's full table and stores
+// the parameters and results. Only the experiment owner may run analyses.
+func (s *Service) CreateAnalysis(ctx context.Context, in CreateAnalysisInput) (*Analysis, error) {
+	if err := s.checkExperimentOwner(ctx, in.ExperimentID, in.CreatorUserID); err != nil {
+		return nil, err
+	}
+	info, err := s.loadExtractInfo(ctx, in.DataExtractID, in.CreatorUserID, "")
+	if err != nil {
+		return nil, err
+	}
+	if info.experimentID != in.ExperimentID {
+		return nil, fmt.Errorf("%w: data extract belongs to another experiment", ErrInvalidInput)
+	}
+	rows, complete, err := s.loadAllRows(ctx, info)
+	if err != nil {
+		return nil, err
+	}
+	if !complete {
+		return nil, fmt.Errorf("%w: extract only has sample rows; parse the data again to analyze it", ErrInvalidInput)
+	}
+	table, err := filterRows(info.headers, rows, in.Parameters.Where)
+	if err != nil {
+		return nil, err
+	}
+
+	params := in.Parameters
+	results, err := runAnalysis(in.AnalysisType, &params, table)
+	if err != nil {
+		return nil, err
+	}
+	paramsJSON, err := json.Marshal(params)
+	if err != nil {
+		return nil, fmt.Errorf("encode analysis parameters: %w", err)
+	}
+	resultsJSON, err := json.Marshal(results)
+	if err != nil {
+		return nil, fmt.Errorf("encode analysis results: %w", err)
+	}
+	return s.insertAnalysis(ctx, in, params, paramsJSON, resultsJSON)
+}
+
+// insertAnalysis stores a computed analysis with its audit and sync events.
+func (s *Service) insertAnalysis(ctx context.Context, in CreateAnalysisInput, params AnalysisParameters, paramsJSON, resultsJSON []byte) (*Analysis, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	var expOwner string
+	err = tx.QueryRowContext(ctx,
+		`SELECT owner_user_id FROM experiments WHERE id = $1`, in.ExperimentID,
+	).Scan(&expOwner)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("query experiment: %w", err)
+	}
+	if expOwner != in.CreatorUserID {
+		return nil, ErrForbidden
+	}
+
+	analysis := Analysis{
+		ExperimentID:  in.ExperimentID,
+		DataExtractID: in.DataExtractID,
+		CreatorUserID: in.CreatorUserID,
+		AnalysisType:  in.AnalysisType,
+		Parameters:    params,
+		Results:       resultsJSON,
+	}
+	err = tx.QueryRowContext(ctx,
+		`INSERT INTO data_analyses (experiment_id, data_extract_id, creator_user_id, analysis_type, parameters, results)
+		 VALUES ($1, $2, $3, $4, $5, $6)
+		 RETURNING id, created_at`,
+		in.ExperimentID, in.DataExtractID, in.CreatorUserID, in.AnalysisType, paramsJSON, resultsJSON,
+	).Scan(&analysis.ID, &analysis.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("insert analysis: %w", err)
+	}
+
+	payload := map[string]any{
+		"analysisId":    analysis.ID,
+		"analysisType":  in.AnalysisType,
+		"dataExtractId": in.DataExtractID,
+		"experimentId":  in.ExperimentID,
+	}
+	if err := internaldb.AppendAuditEvent(ctx, tx, in.CreatorUserID, "analysis.created", "experiment", in.ExperimentID, payload); err != nil {
+		return nil, fmt.Errorf("append analysis.created audit event: %w", err)
+	}
+
+	if _, err := s.sync.AppendEvent(ctx, tx, syncer.AppendEventInput{
+		OwnerUserID:   expOwner,
+		ActorUserID:   in.CreatorUserID,
+		DeviceID:      in.DeviceID,
+		EventType:     "analysis.created",
+		AggregateType: "experiment",
+		AggregateID:   in.ExperimentID,
+		Payload:       payload,
+	}); err != nil {
+		return nil, fmt.Errorf("append analysis.created sync event: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return &analysis, nil
+}
+
+const analysisColumnsSQL = `da.id, da.experiment_id, da.data_extract_id, da.creator_user_id, da.analysis_type, da.parameters, da.results, da.created_at`
+
+func scanAnalysis(row interface{ Scan(...any) error }) (*Analysis, error) {
+	var (
+		analysis   Analysis
+		paramsJSON []byte
+	)
+	if err := row.Scan(&analysis.ID, &analysis.ExperimentID, &analysis.DataExtractID, &analysis.CreatorUserID,
+		&analysis.AnalysisType, &paramsJSON, &analysis.Results, &analysis.CreatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(paramsJSON, &analysis.Parameters); err != nil {
+		return nil, fmt.Errorf("decode analysis parameters: %w", err)
+	}
+	return &analysis, nil
+}
+
+func (s *Service) GetAnalysis(ctx context.Context, analysisID, userID, role string) (*Analysis, error) {
+	analysis, err := scanAnalysis(s.db.QueryRowContext(ctx,
+		`SELECT `+analysisColumnsSQL+`
+		 FROM data_analyses da
+		 JOIN experiments e ON e.id = da.experiment_id
+		 WHERE da.id = $1 AND (e.owner_user_id = $2 OR ($3 = 'admin' AND e.status = 'completed'))`,
+		analysisID, userID, role,
+	))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("query analysis: %w", err)
+	}
+	return analysis, nil
+}
+
+func (s *Service) ListAnalyses(ctx context.Context, experimentID, userID, role string) ([]Analysis, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+analysisColumnsSQL+`
+		 FROM data_analyses da
+		 JOIN experiments e ON e.id = da.experiment_id
+		 WHERE da.experiment_id = $1 AND (e.owner_user_id = $2 OR ($3 = 'admin' AND e.status = 'completed'))
+		 ORDER BY da.created_at`,
+		experimentID, userID, role,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query analyses: %w", err)
+	}
+	defer rows.Close()
+
+	analyses := []Analysis{}
+	for rows.Next() {
+		analysis, err := scanAnalysis(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan analysis: %w", err)
+		}
+		analyses = append(analyses, *analysis)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate analyses: %w", err)
+	}
+	return analyses, nil
+}
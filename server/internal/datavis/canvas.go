@@ -0,0 +1,407 @@
+package datavis
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Chart drawing surfaces. The chart layout issues the same primitive calls
+// against an SVG writer and a raster image, so both formats come out
+// identical. Text metrics follow the built-in 5×7 bitmap font: a glyph is
+// 0.6 em wide and 0.7 em tall.
+
+type point struct{ x, y float64 }
+
+type textAnchor int
+
+const (
+	anchorStart textAnchor = iota
+	anchorMiddle
+	anchorEnd
+)
+
+type canvas interface {
+	line(x1, y1, x2, y2 float64, c color.RGBA, width float64)
+	polyline(pts []point, c color.RGBA, width float64)
+	polygon(pts []point, fill color.RGBA)
+	rect(x, y, w, h float64, fill color.RGBA)
+	circle(cx, cy, r float64, fill color.RGBA)
+	// text draws s with its baseline at y; vertical text reads bottom to
+	// top with the baseline at x.
+	text(x, y float64, s string, size float64, anchor textAnchor, vertical bool, c color.RGBA)
+}
+
+func textWidth(s string, size float64) float64 {
+	return float64(len([]rune(s))) * 0.6 * size
+}
+
+// ---------------------------------------------------------------------------
+// SVG
+// ---------------------------------------------------------------------------
+
+type svgCanvas struct {
+	b strings.Builder
+}
+
+func newSVGCanvas(width, height int) *svgCanvas {
+	c := &svgCanvas{}
+	fmt.Fprintf(&c.b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="DejaVu Sans Mono, Menlo, Consolas, monospace">`, width, height, width, height)
+	fmt.Fprintf(&c.b, `<rect width="%d" height="%d" fill="#ffffff"/>`, width, height)
+	return c
+}
+
+func (c *svgCanvas) bytes() []byte {
+	return []byte(c.b.String() + "</svg>")
+}
+
+func svgColor(c color.RGBA) string {
+	s := fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+	if c.A != 255 {
+		s += fmt.Sprintf(`" fill-opacity="%.3g" stroke-opacity="%.3g`, float64(c.A)/255, float64(c.A)/255)
+	}
+	return s
+}
+
+func svgNum(v float64) string {
+	return fmt.Sprintf("%.2f", v)
+}
+
+func (c *svgCanvas) line(x1, y1, x2, y2 float64, col color.RGBA, width float64) {
+	fmt.Fprintf(&c.b, `<line x1="%s" y1="%s" x2="%s" y2="%s" stroke="%s" stroke-width="%s"/>`,
+		svgNum(x1), svgNum(y1), svgNum(x2), svgNum(y2), svgColor(col), svgNum(width))
+}
+
+func svgPoints(pts []point) string {
+	parts := make([]string, len(pts))
+	for i, p := range pts {
+		parts[i] = svgNum(p.x) + "," + svgNum(p.y)
+	}
+	return strings.Join(parts, " ")
+}
+
+func (c *svgCanvas) polyline(pts []point, col color.RGBA, width float64) {
+	fmt.Fprintf(&c.b, `<polyline points="%s" fill="none" stroke="%s" stroke-width="%s" stroke-linejoin="round"/>`,
+		svgPoints(pts), svgColor(col), svgNum(width))
+}
+
+func (c *svgCanvas) polygon(pts []point, fill color.RGBA) {
+	fmt.Fprintf(&c.b, `<polygon points="%s" fill="%s"/>`, svgPoints(pts), svgColor(fill))
+}
+
+func (c *svgCanvas) rect(x, y, w, h float64, fill color.RGBA) {
+	fmt.Fprintf(&c.b, `<rect x="%s" y="%s" width="%s" height="%s" fill="%s"/>`,
+		svgNum(x), svgNum(y), svgNum(w), svgNum(h), svgColor(fill))
+}
+
+func (c *svgCanvas) circle(cx, cy, r float64, fill color.RGBA) {
+	fmt.Fprintf(&c.b, `<circle cx="%s" cy="%s" r="%s" fill="%s"/>`, svgNum(cx), svgNum(cy), svgNum(r), svgColor(fill))
+}
+
+func (c *svgCanvas) text(x, y float64, s string, size float64, anchor textAnchor, vertical bool, col color.RGBA) {
+	anchors := [...]string{"start", "middle", "end"}
+	transform := ""
+	if vertical {
+		transform = fmt.Sprintf(` transform="rotate(-90 %s %s)"`, svgNum(x), svgNum(y))
+	}
+	fmt.Fprintf(&c.b, `<text x="%s" y="%s" font-size="%s" text-anchor="%s" fill="%s"%s>%s</text>`,
+		svgNum(x), svgNum(y), svgNum(size), anchors[anchor], svgColor(col), transform, escapeXML(s))
+}
+
+func escapeXML(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;").Replace(s)
+}
+
+// ---------------------------------------------------------------------------
+// Raster
+// ---------------------------------------------------------------------------
+
+// rasterSupersample is the oversampling factor; shapes are drawn at this
+// scale and box-filtered down, which anti-aliases edges.
+const rasterSupersample = 3
+
+type rasterCanvas struct {
+	img *image.RGBA
+	s   float64
+}
+
+func newRasterCanvas(width, height int) *rasterCanvas {
+	img := image.NewRGBA(image.Rect(0, 0, width*rasterSupersample, height*rasterSupersample))
+	for i := range img.Pix {
+		img.Pix[i] = 255
+	}
+	return &rasterCanvas{img: img, s: rasterSupersample}
+}
+
+// image returns the downsampled result.
+func (c *rasterCanvas) image() *image.RGBA {
+	src := c.img
+	w, h := src.Rect.Dx()/rasterSupersample, src.Rect.Dy()/rasterSupersample
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	const n = rasterSupersample * rasterSupersample
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var sum [4]int
+			for dy := 0; dy < rasterSupersample; dy++ {
+				off := src.PixOffset(x*rasterSupersample, y*rasterSupersample+dy)
+				for dx := 0; dx < rasterSupersample; dx++ {
+					for k := 0; k < 4; k++ {
+						sum[k] += int(src.Pix[off+dx*4+k])
+					}
+				}
+			}
+			off := dst.PixOffset(x, y)
+			for k := 0; k < 4; k++ {
+				dst.Pix[off+k] = uint8((sum[k] + n/2) / n)
+			}
+		}
+	}
+	return dst
+}
+
+// blend paints one supersampled pixel with c over the existing colour.
+func (c *rasterCanvas) blend(x, y int, col color.RGBA) {
+	if !(image.Point{x, y}.In(c.img.Rect)) {
+		return
+	}
+	off := c.img.PixOffset(x, y)
+	a := int(col.A)
+	p := c.img.Pix[off : off+4 : off+4]
+	p[0] = uint8((int(col.R)*a + int(p[0])*(255-a)) / 255)
+	p[1] = uint8((int(col.G)*a + int(p[1])*(255-a)) / 255)
+	p[2] = uint8((int(col.B)*a + int(p[2])*(255-a)) / 255)
+	p[3] = 255
+}
+
+// fillPolygon scan-converts a polygon (even-odd rule) in supersampled
+// coordinates, sampling at pixel centres.
+func (c *rasterCanvas) fillPolygon(pts []point, col color.RGBA) {
+	if len(pts) < 3 {
+		return
+	}
+	minY, maxY := pts[0].y, pts[0].y
+	for _, p := range pts {
+		minY, maxY = math.Min(minY, p.y), math.Max(maxY, p.y)
+	}
+	bounds := c.img.Rect
+	y0 := int(math.Max(math.Floor(minY), float64(bounds.Min.Y)))
+	y1 := int(math.Min(math.Ceil(maxY), float64(bounds.Max.Y-1)))
+	var xs []float64
+	for y := y0; y <= y1; y++ {
+		sy := float64(y) + 0.5
+		xs = xs[:0]
+		for i := range pts {
+			a, b := pts[i], pts[(i+1)%len(pts)]
+			if (a.y <= sy) != (b.y <= sy) {
+				xs = append(xs, a.x+(sy-a.y)*(b.x-a.x)/(b.y-a.y))
+			}
+		}
+		sort.Float64s(xs)
+		for i := 0; i+1 < len(xs); i += 2 {
+			from := int(math.Ceil(xs[i] - 0.5))
+			to := int(math.Floor(xs[i+1] - 0.5))
+			for x := from; x <= to; x++ {
+				c.blend(x, y, col)
+			}
+		}
+	}
+}
+
+func (c *rasterCanvas) scale(pts []point) []point {
+	out := make([]point, len(pts))
+	for i, p := range pts {
+		out[i] = point{p.x * c.s, p.y * c.s}
+	}
+	return out
+}
+
+func (c *rasterCanvas) line(x1, y1, x2, y2 float64, col color.RGBA, width float64) {
+	dx, dy := x2-x1, y2-y1
+	length := math.Hypot(dx, dy)
+	if length == 0 {
+		return
+	}
+	// Offset perpendicular to the segment by half the stroke width.
+	nx, ny := -dy/length*width/2, dx/length*width/2
+	c.fillPolygon(c.scale([]point{{x1 + nx, y1 + ny}, {x2 + nx, y2 + ny}, {x2 - nx, y2 - ny}, {x1 - nx, y1 - ny}}), col)
+}
+
+func (c *rasterCanvas) polyline(pts []point, col color.RGBA, width float64) {
+	for i := 0; i+1 < len(pts); i++ {
+		c.line(pts[i].x, pts[i].y, pts[i+1].x, pts[i+1].y, col, width)
+		if i > 0 && col.A == 255 {
+			// Round joins.
+			c.circle(pts[i].x, pts[i].y, width/2, col)
+		}
+	}
+}
+
+func (c *rasterCanvas) polygon(pts []point, fill color.RGBA) {
+	c.fillPolygon(c.scale(pts), fill)
+}
+
+func (c *rasterCanvas) rect(x, y, w, h float64, fill color.RGBA) {
+	c.fillPolygon(c.scale([]point{{x, y}, {x + w, y}, {x + w, y + h}, {x, y + h}}), fill)
+}
+
+func (c *rasterCanvas) circle(cx, cy, r float64, fill color.RGBA) {
+	cx, cy, r = cx*c.s, cy*c.s, r*c.s
+	for y := int(math.Floor(cy - r)); y <= int(math.Ceil(cy+r)); y++ {
+		for x := int(math.Floor(cx - r)); x <= int(math.Ceil(cx+r)); x++ {
+			if math.Hypot(float64(x)+0.5-cx, float64(y)+0.5-cy) <= r {
+				c.blend(x, y, fill)
+			}
+		}
+	}
+}
+
+func (c *rasterCanvas) text(x, y float64, s string, size float64, anchor textAnchor, vertical bool, col color.RGBA) {
+	unit := size / 10 * c.s
+	width := textWidth(s, size) * c.s
+	x, y = x*c.s, y*c.s
+	// Offset along the reading direction for the anchor.
+	shift := 0.0
+	switch anchor {
+	case anchorMiddle:
+		shift = -width / 2
+	case anchorEnd:
+		shift = -width
+	}
+	for i, r := range []rune(s) {
+		glyph, ok := bitmapFont[r]
+		if !ok {
+			glyph = bitmapFont['?']
+		}
+		origin := shift + float64(i)*6*unit
+		for row := 0; row < 7; row++ {
+			for col5 := 0; col5 < 5; col5++ {
+				if glyph[row]&(0x10>>col5) == 0 {
+					continue
+				}
+				// Glyph cell in reading coordinates: u along the text, v up
+				// from the baseline.
+				u := origin + float64(col5)*unit
+				v := float64(7-row) * unit
+				var px, py float64
+				if vertical {
+					px, py = x-v, y-u-unit
+				} else {
+					px, py = x+u, y-v
+				}
+				for yy := int(py); yy < int(py+unit+0.5); yy++ {
+					for xx := int(px); xx < int(px+unit+0.5); xx++ {
+						c.blend(xx, yy, col)
+					}
+				}
+			}
+		}
+	}
+}
+
+// bitmapFont is a 5×7 font: seven rows per glyph, bit 4 is the leftmost
+// column.
+var bitmapFont = map[rune][7]uint8{
+	' ':  {0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+	'!':  {0x04, 0x04, 0x04, 0x04, 0x04, 0x00, 0x04},
+	'"':  {0x0A, 0x0A, 0x0A, 0x00, 0x00, 0x00, 0x00},
+	'#':  {0x0A, 0x0A, 0x1F, 0x0A, 0x1F, 0x0A, 0x0A},
+	'$':  {0x04, 0x0F, 0x14, 0x0E, 0x05, 0x1E, 0x04},
+	'%':  {0x18, 0x19, 0x02, 0x04, 0x08, 0x13, 0x03},
+	'&':  {0x0C, 0x12, 0x14, 0x08, 0x15, 0x12, 0x0D},
+	'\'': {0x0C, 0x04, 0x08, 0x00, 0x00, 0x00, 0x00},
+	'(':  {0x02, 0x04, 0x08, 0x08, 0x08, 0x04, 0x02},
+	')':  {0x08, 0x04, 0x02, 0x02, 0x02, 0x04, 0x08},
+	'*':  {0x00, 0x04, 0x15, 0x0E, 0x15, 0x04, 0x00},
+	'+':  {0x00, 0x04, 0x04, 0x1F, 0x04, 0x04, 0x00},
+	',':  {0x00, 0x00, 0x00, 0x00, 0x0C, 0x04, 0x08},
+	'-':  {0x00, 0x00, 0x00, 0x1F, 0x00, 0x00, 0x00},
+	'.':  {0x00, 0x00, 0x00, 0x00, 0x00, 0x0C, 0x0C},
+	'/':  {0x00, 0x01, 0x02, 0x04, 0x08, 0x10, 0x00},
+	'0':  {0x0E, 0x11, 0x13, 0x15, 0x19, 0x11, 0x0E},
+	'1':  {0x04, 0x0C, 0x04, 0x04, 0x04, 0x04, 0x0E},
+	'2':  {0x0E, 0x11, 0x01, 0x02, 0x04, 0x08, 0x1F},
+	'3':  {0x1F, 0x02, 0x04, 0x02, 0x01, 0x11, 0x0E},
+	'4':  {0x02, 0x06, 0x0A, 0x12, 0x1F, 0x02, 0x02},
+	'5':  {0x1F, 0x10, 0x1E, 0x01, 0x01, 0x11, 0x0E},
+	'6':  {0x06, 0x08, 0x10, 0x1E, 0x11, 0x11, 0x0E},
+	'7':  {0x1F, 0x01, 0x02, 0x04, 0x08, 0x08, 0x08},
+	'8':  {0x0E, 0x11, 0x11, 0x0E, 0x11, 0x11, 0x0E},
+	'9':  {0x0E, 0x11, 0x11, 0x0F, 0x01, 0x02, 0x0C},
+	':':  {0x00, 0x0C, 0x0C, 0x00, 0x0C, 0x0C, 0x00},
+	';':  {0x00, 0x0C, 0x0C, 0x00, 0x0C, 0x04, 0x08},
+	'<':  {0x02, 0x04, 0x08, 0x10, 0x08, 0x04, 0x02},
+	'=':  {0x00, 0x00, 0x1F, 0x00, 0x1F, 0x00, 0x00},
+	'>':  {0x08, 0x04, 0x02, 0x01, 0x02, 0x04, 0x08},
+	'?':  {0x0E, 0x11, 0x01, 0x02, 0x04, 0x00, 0x04},
+	'@':  {0x0E, 0x11, 0x01, 0x0D, 0x15, 0x15, 0x0E},
+	'A':  {0x0E, 0x11, 0x11, 0x11, 0x1F, 0x11, 0x11},
+	'B':  {0x1E, 0x11, 0x11, 0x1E, 0x11, 0x11, 0x1E},
+	'C':  {0x0E, 0x11, 0x10, 0x10, 0x10, 0x11, 0x0E},
+	'D':  {0x1C, 0x12, 0x11, 0x11, 0x11, 0x12, 0x1C},
+	'E':  {0x1F, 0x10, 0x10, 0x1E, 0x10, 0x10, 0x1F},
+	'F':  {0x1F, 0x10, 0x10, 0x1E, 0x10, 0x10, 0x10},
+	'G':  {0x0E, 0x11, 0x10, 0x17, 0x11, 0x11, 0x0F},
+	'H':  {0x11, 0x11, 0x11, 0x1F, 0x11, 0x11, 0x11},
+	'I':  {0x0E, 0x04, 0x04, 0x04, 0x04, 0x04, 0x0E},
+	'J':  {0x07, 0x02, 0x02, 0x02, 0x02, 0x12, 0x0C},
+	'K':  {0x11, 0x12, 0x14, 0x18, 0x14, 0x12, 0x11},
+	'L':  {0x10, 0x10, 0x10, 0x10, 0x10, 0x10, 0x1F},
+	'M':  {0x11, 0x1B, 0x15, 0x15, 0x11, 0x11, 0x11},
+	'N':  {0x11, 0x11, 0x19, 0x15, 0x13, 0x11, 0x11},
+	'O':  {0x0E, 0x11, 0x11, 0x11, 0x11, 0x11, 0x0E},
+	'P':  {0x1E, 0x11, 0x11, 0x1E, 0x10, 0x10, 0x10},
+	'Q':  {0x0E, 0x11, 0x11, 0x11, 0x15, 0x12, 0x0D},
+	'R':  {0x1E, 0x11, 0x11, 0x1E, 0x14, 0x12, 0x11},
+	'S':  {0x0F, 0x10, 0x10, 0x0E, 0x01, 0x01, 0x1E},
+	'T':  {0x1F, 0x04, 0x04, 0x04, 0x04, 0x04, 0x04},
+	'U':  {0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x0E},
+	'V':  {0x11, 0x11, 0x11, 0x11, 0x11, 0x0A, 0x04},
+	'W':  {0x11, 0x11, 0x11, 0x15, 0x15, 0x15, 0x0A},
+	'X':  {0x11, 0x11, 0x0A, 0x04, 0x0A, 0x11, 0x11},
+	'Y':  {0x11, 0x11, 0x11, 0x0A, 0x04, 0x04, 0x04},
+	'Z':  {0x1F, 0x01, 0x02, 0x04, 0x08, 0x10, 0x1F},
+	'[':  {0x0E, 0x08, 0x08, 0x08, 0x08, 0x08, 0x0E},
+	'\\': {0x00, 0x10, 0x08, 0x04, 0x02, 0x01, 0x00},
+	']':  {0x0E, 0x02, 0x02, 0x02, 0x02, 0x02, 0x0E},
+	'^':  {0x04, 0x0A, 0x11, 0x00, 0x00, 0x00, 0x00},
+	'_':  {0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x1F},
+	'`':  {0x08, 0x04, 0x02, 0x00, 0x00, 0x00, 0x00},
+	'a':  {0x00, 0x00, 0x0E, 0x01, 0x0F, 0x11, 0x0F},
+	'b':  {0x10, 0x10, 0x16, 0x19, 0x11, 0x11, 0x1E},
+	'c':  {0x00, 0x00, 0x0E, 0x10, 0x10, 0x11, 0x0E},
+	'd':  {0x01, 0x01, 0x0D, 0x13, 0x11, 0x11, 0x0F},
+	'e':  {0x00, 0x00, 0x0E, 0x11, 0x1F, 0x10, 0x0E},
+	'f':  {0x06, 0x09, 0x08, 0x1C, 0x08, 0x08, 0x08},
+	'g':  {0x00, 0x0F, 0x11, 0x11, 0x0F, 0x01, 0x0E},
+	'h':  {0x10, 0x10, 0x16, 0x19, 0x11, 0x11, 0x11},
+	'i':  {0x04, 0x00, 0x0C, 0x04, 0x04, 0x04, 0x0E},
+	'j':  {0x02, 0x00, 0x06, 0x02, 0x02, 0x12, 0x0C},
+	'k':  {0x10, 0x10, 0x12, 0x14, 0x18, 0x14, 0x12},
+	'l':  {0x0C, 0x04, 0x04, 0x04, 0x04, 0x04, 0x0E},
+	'm':  {0x00, 0x00, 0x1A, 0x15, 0x15, 0x11, 0x11},
+	'n':  {0x00, 0x00, 0x16, 0x19, 0x11, 0x11, 0x11},
+	'o':  {0x00, 0x00, 0x0E, 0x11, 0x11, 0x11, 0x0E},
+	'p':  {0x00, 0x00, 0x1E, 0x11, 0x1E, 0x10, 0x10},
+	'q':  {0x00, 0x00, 0x0D, 0x13, 0x0F, 0x01, 0x01},
+	'r':  {0x00, 0x00, 0x16, 0x19, 0x10, 0x10, 0x10},
+	's':  {0x00, 0x00, 0x0E, 0x10, 0x0E, 0x01, 0x1E},
+	't':  {0x08, 0x08, 0x1C, 0x08, 0x08, 0x09, 0x06},
+	'u':  {0x00, 0x00, 0x11, 0x11, 0x11, 0x13, 0x0D},
+	'v':  {0x00, 0x00, 0x11, 0x11, 0x11, 0x0A, 0x04},
+	'w':  {0x00, 0x00, 0x11, 0x11, 0x15, 0x15, 0x0A},
+	'x':  {0x00, 0x00, 0x11, 0x0A, 0x04, 0x0A, 0x11},
+	'y':  {0x00, 0x00, 0x11, 0x11, 0x0F, 0x01, 0x0E},
+	'z':  {0x00, 0x00, 0x1F, 0x02, 0x04, 0x08, 0x1F},
+	'{':  {0x02, 0x04, 0x04, 0x08, 0x04, 0x04, 0x02},
+	'|':  {0x04, 0x04, 0x04, 0x04, 0x04, 0x04, 0x04},
+	'}':  {0x08, 0x04, 0x04, 0x02, 0x04, 0x04, 0x08},
+	'~':  {0x00, 0x00, 0x08, 0x15, 0x02, 0x00, 0x00},
+	'°':  {0x0C, 0x12, 0x12, 0x0C, 0x00, 0x00, 0x00},
+	'µ':  {0x00, 0x00, 0x11, 0x11, 0x13, 0x1D, 0x10},
+	'Δ':  {0x04, 0x04, 0x0A, 0x0A, 0x11, 0x11, 0x1F},
+	'²':  {0x0C, 0x02, 0x04, 0x0E, 0x00, 0x00, 0x00},
+	'±':  {0x04, 0x04, 0x1F, 0x04, 0x04, 0x00, 0x1F},
+}
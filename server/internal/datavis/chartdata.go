@@ -0,0 +1,491 @@
+package datavis
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// minDownsamplePoints is the smallest maxPoints accepted; LTTB always keeps
+// the first and last point plus at least one bucket.
+const minDownsamplePoints = 3
+
+type ChartDataInput struct {
+	ChartConfigID string
+	UserID        string
+	Role          string
+	// MaxPoints caps the points per series for line, area and scatter
+	// charts; zero returns every point.
+	MaxPoints int
+}
+
+// ChartData is the series of a chart built from the extract's full table.
+// Complete is false when the extract predates full row storage and only its
+// sample rows were available. The axes carry the resolved labels, units and
+// scales.
+type ChartData struct {
+	ChartConfigID string        `json:"chartConfigId"`
+	DataExtractID string        `json:"dataExtractId"`
+	ChartType     string        `json:"chartType"`
+	XColumn       string        `json:"xColumn"`
+	XNumeric      bool          `json:"xNumeric"`
+	XAxis         ChartAxis     `json:"xAxis"`
+	YAxis         ChartAxis     `json:"yAxis"`
+	TotalRows     int           `json:"totalRows"`
+	Complete      bool          `json:"complete"`
+	Downsampled   bool          `json:"downsampled"`
+	Series        []ChartSeries `json:"series"`
+}
+
+// ChartSeries holds one y column, or one group of it when the chart is
+// grouped, within one facet. X values are numbers when every non-missing x
+// cell is numeric, otherwise the raw strings. Rows whose y cell is empty,
+// not numeric or not positive on a log axis, and on a numeric x axis rows
+// whose x cell is missing, are left out and counted in SkippedRows. Error
+// holds the half width of each point's error bar when the chart names an
+// error column for the series; missing error cells are zero.
+//
+// Box plots carry Boxes, one per x category, instead of points; heatmaps
+// carry Cells.
+type ChartSeries struct {
+	Column       string        `json:"column"`
+	Group        string        `json:"group,omitempty"`
+	Facet        string        `json:"facet,omitempty"`
+	X            []any         `json:"x"`
+	Y            []float64     `json:"y"`
+	Error        []float64     `json:"error,omitempty"`
+	Boxes        []BoxSummary  `json:"boxes,omitempty"`
+	Cells        *HeatmapCells `json:"cells,omitempty"`
+	SourcePoints int           `json:"sourcePoints"`
+	SkippedRows  int           `json:"skippedRows"`
+}
+
+// BoxSummary is a Tukey box: whiskers reach the most extreme values within
+// 1.5 IQR of the quartiles, values beyond them are outliers.
+type BoxSummary struct {
+	X            string    `json:"x"`
+	N            int       `json:"n"`
+	LowerWhisker float64   `json:"lowerWhisker"`
+	Q1           float64   `json:"q1"`
+	Median       float64   `json:"median"`
+	Q3           float64   `json:"q3"`
+	UpperWhisker float64   `json:"upperWhisker"`
+	Outliers     []float64 `json:"outliers"`
+}
+
+// HeatmapCells is a grid of mean values, Values[row][column]; nil marks a
+// cell without data. Rows and columns are shared by every facet.
+type HeatmapCells struct {
+	Columns []string     `json:"columns"`
+	Rows    []string     `json:"rows"`
+	Values  [][]*float64 `json:"values"`
+}
+
+// GetChartData resolves a chart configuration against its extract.
+func (s *Service) GetChartData(ctx context.Context, in ChartDataInput) (*ChartData, error) {
+	if in.MaxPoints != 0 && in.MaxPoints < minDownsamplePoints {
+		return nil, fmt.Errorf("%w: maxPoints must be 0 or at least %d", ErrInvalidInput, minDownsamplePoints)
+	}
+
+	cc, err := s.GetChartConfig(ctx, in.ChartConfigID, in.UserID, in.Role)
+	if err != nil {
+		return nil, err
+	}
+	info, err := s.loadExtractInfo(ctx, cc.DataExtractID, in.UserID, in.Role)
+	if err != nil {
+		return nil, err
+	}
+
+	// The extract is immutable and the spec was validated against it, but
+	// charts created before validation may name columns that are missing.
+	optional := func(name, field string) (int, error) {
+		if name == "" {
+			return -1, nil
+		}
+		idx := columnIndex(info.headers, name)
+		if idx < 0 {
+			return -1, fmt.Errorf("%w: %s %q is not in the extract", ErrInvalidInput, field, name)
+		}
+		return idx, nil
+	}
+	xIdx, err := optional(cc.XColumn, "x column")
+	if err != nil {
+		return nil, err
+	}
+	if xIdx < 0 && cc.ChartType != ChartHistogram {
+		return nil, fmt.Errorf("%w: x column is required", ErrInvalidInput)
+	}
+	yIdx := make([]int, len(cc.YColumns))
+	for i, col := range cc.YColumns {
+		if yIdx[i], err = optional(col, "y column"); err != nil {
+			return nil, err
+		}
+		if yIdx[i] < 0 {
+			return nil, fmt.Errorf("%w: y column is empty", ErrInvalidInput)
+		}
+	}
+	errIdx := make([]int, len(cc.YColumns))
+	for i := range errIdx {
+		errIdx[i] = -1
+		if i < len(cc.Spec.ErrorColumns) {
+			if errIdx[i], err = optional(cc.Spec.ErrorColumns[i], "error column"); err != nil {
+				return nil, err
+			}
+		}
+	}
+	groupIdx, err := optional(cc.Spec.GroupBy, "groupBy column")
+	if err != nil {
+		return nil, err
+	}
+	facetIdx, err := optional(cc.Spec.FacetBy, "facetBy column")
+	if err != nil {
+		return nil, err
+	}
+	rowIdx, err := optional(cc.Spec.RowColumn, "row column")
+	if err != nil {
+		return nil, err
+	}
+	if cc.ChartType == ChartHeatmap && rowIdx < 0 {
+		return nil, fmt.Errorf("%w: a heatmap needs a rowColumn", ErrInvalidInput)
+	}
+
+	var rows [][]string
+	collect := func(_ int, row []string) { rows = append(rows, row) }
+	if info.rowsStored {
+		if err := s.scanRowChunks(ctx, info.id, 0, -1, collect); err != nil {
+			return nil, err
+		}
+	} else {
+		for i, row := range info.sampleRows {
+			collect(i, row)
+		}
+	}
+	cell := func(row []string, i int) string {
+		if i >= 0 && i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+		return ""
+	}
+
+	xs := make([]string, len(rows))
+	for r, row := range rows {
+		xs[r] = cell(row, xIdx)
+	}
+	xValues, xNumeric := parseXValues(xs)
+	xAxis, yAxis := resolveAxes(cc)
+	if !xNumeric {
+		xAxis.Scale = AxisScaleLinear
+	}
+	out := &ChartData{
+		ChartConfigID: cc.ID,
+		DataExtractID: info.id,
+		ChartType:     cc.ChartType,
+		XColumn:       cc.XColumn,
+		XNumeric:      xNumeric,
+		XAxis:         xAxis,
+		YAxis:         yAxis,
+		TotalRows:     len(rows),
+		Complete:      info.rowsStored,
+		Series:        []ChartSeries{},
+	}
+	xLog, yLog := xAxis.Scale == AxisScaleLog, yAxis.Scale == AxisScaleLog
+	downsample := in.MaxPoints > 0 && (cc.ChartType == ChartLine || cc.ChartType == ChartArea || cc.ChartType == ChartScatter)
+
+	// Rows of each facet and group, in order of first appearance.
+	// Keys are sorted by facet so each facet's series are contiguous.
+	type seriesKey struct{ facet, group string }
+	var keys []seriesKey
+	members := map[seriesKey][]int{}
+	facetOrder := map[string]int{}
+	for r, row := range rows {
+		k := seriesKey{cell(row, facetIdx), cell(row, groupIdx)}
+		if _, ok := members[k]; !ok {
+			keys = append(keys, k)
+		}
+		if _, ok := facetOrder[k.facet]; !ok {
+			facetOrder[k.facet] = len(facetOrder)
+		}
+		members[k] = append(members[k], r)
+	}
+	sort.SliceStable(keys, func(i, j int) bool { return facetOrder[keys[i].facet] < facetOrder[keys[j].facet] })
+	if len(keys) == 0 {
+		keys = []seriesKey{{}}
+	}
+
+	var heatColumns, heatRows []string
+	if cc.ChartType == ChartHeatmap {
+		heatColumns, heatRows = distinctSorted(xs), distinctSorted(columnCells(rows, rowIdx, cell))
+	}
+
+	for _, k := range keys {
+		for i, col := range cc.YColumns {
+			series := ChartSeries{Column: col, Group: k.group, Facet: k.facet, X: []any{}, Y: []float64{}}
+			var pos []float64
+			var kept []int
+			for _, r := range members[k] {
+				v, ok := parseNumber(cell(rows[r], yIdx[i]))
+				if xNumeric && xValues[r] == nil {
+					ok = false
+				}
+				if !ok || (yLog && v <= 0) || (xLog && xValues[r].(float64) <= 0) {
+					series.SkippedRows++
+					continue
+				}
+				kept = append(kept, r)
+				series.Y = append(series.Y, v)
+				if errIdx[i] >= 0 {
+					e, ok := parseNumber(cell(rows[r], errIdx[i]))
+					if !ok {
+						e = 0
+					}
+					series.Error = append(series.Error, math.Abs(e))
+				}
+				if xNumeric {
+					pos = append(pos, xValues[r].(float64))
+				} else {
+					pos = append(pos, float64(r))
+				}
+			}
+			series.SourcePoints = len(kept)
+
+			switch cc.ChartType {
+			case ChartBox:
+				series.Boxes = boxSummaries(xs, kept, series.Y)
+				series.Y = []float64{}
+			case ChartHeatmap:
+				series.Cells = heatmapCells(heatColumns, heatRows, xs, columnCells(rows, rowIdx, cell), kept, series.Y)
+				series.Y = []float64{}
+			default:
+				if downsample && len(kept) > in.MaxPoints {
+					keep := lttb(pos, series.Y, in.MaxPoints)
+					y := make([]float64, len(keep))
+					idx := make([]int, len(keep))
+					var e []float64
+					for n, j := range keep {
+						y[n] = series.Y[j]
+						idx[n] = kept[j]
+						if series.Error != nil {
+							e = append(e, series.Error[j])
+						}
+					}
+					series.Y, series.Error, kept = y, e, idx
+					out.Downsampled = true
+				}
+				if xIdx >= 0 {
+					for _, r := range kept {
+						series.X = append(series.X, xValues[r])
+					}
+				}
+			}
+			if len(keys) > 1 && series.SourcePoints == 0 {
+				// A group with no values for this column.
+				continue
+			}
+			out.Series = append(out.Series, series)
+		}
+	}
+	return out, nil
+}
+
+func columnCells(rows [][]string, idx int, cell func([]string, int) string) []string {
+	out := make([]string, len(rows))
+	for r, row := range rows {
+		out[r] = cell(row, idx)
+	}
+	return out
+}
+
+// distinctSorted returns the distinct non-empty values, numerically when
+// all are numbers (plate columns 1..24) and lexically otherwise.
+func distinctSorted(values []string) []string {
+	seen := map[string]bool{}
+	var out []string
+	numeric := true
+	for _, v := range values {
+		if v == "" || seen[v] {
+			continue
+		}
+		seen[v] = true
+		out = append(out, v)
+		if _, ok := parseNumber(v); !ok {
+			numeric = false
+		}
+	}
+	if numeric {
+		sort.Slice(out, func(i, j int) bool {
+			a, _ := parseNumber(out[i])
+			b, _ := parseNumber(out[j])
+			return a < b
+		})
+	} else {
+		sort.Strings(out)
+	}
+	return out
+}
+
+// boxSummaries summarizes the y values of rows kept per x category, in
+// order of first appearance.
+func boxSummaries(xs []string, kept []int, y []float64) []BoxSummary {
+	var order []string
+	values := map[string][]float64{}
+	for n, r := range kept {
+		x := xs[r]
+		if _, ok := values[x]; !ok {
+			order = append(order, x)
+		}
+		values[x] = append(values[x], y[n])
+	}
+	out := make([]BoxSummary, 0, len(order))
+	for _, x := range order {
+		v := values[x]
+		sort.Float64s(v)
+		b := BoxSummary{X: x, N: len(v), Q1: quantile(v, 0.25), Median: quantile(v, 0.5), Q3: quantile(v, 0.75), Outliers: []float64{}}
+		iqr := b.Q3 - b.Q1
+		lo, hi := b.Q1-1.5*iqr, b.Q3+1.5*iqr
+		b.LowerWhisker, b.UpperWhisker = b.Q1, b.Q3
+		for _, val := range v {
+			switch {
+			case val < lo || val > hi:
+				b.Outliers = append(b.Outliers, val)
+			default:
+				b.LowerWhisker = math.Min(b.LowerWhisker, val)
+				b.UpperWhisker = math.Max(b.UpperWhisker, val)
+			}
+		}
+		out = append(out, b)
+	}
+	return out
+}
+
+// heatmapCells averages the y values of the kept rows into the grid.
+func heatmapCells(columns, rowLabels, xs, rowValues []string, kept []int, y []float64) *HeatmapCells {
+	colIndex := map[string]int{}
+	for i, c := range columns {
+		colIndex[c] = i
+	}
+	rowIndex := map[string]int{}
+	for i, r := range rowLabels {
+		rowIndex[r] = i
+	}
+	sums := make([][]float64, len(rowLabels))
+	counts := make([][]int, len(rowLabels))
+	for i := range sums {
+		sums[i] = make([]float64, len(columns))
+		counts[i] = make([]int, len(columns))
+	}
+	for n, r := range kept {
+		ci, okC := colIndex[xs[r]]
+		ri, okR := rowIndex[rowValues[r]]
+		if !okC || !okR {
+			continue
+		}
+		sums[ri][ci] += y[n]
+		counts[ri][ci]++
+	}
+	out := &HeatmapCells{Columns: columns, Rows: rowLabels, Values: make([][]*float64, len(rowLabels))}
+	for i := range sums {
+		out.Values[i] = make([]*float64, len(columns))
+		for j := range sums[i] {
+			if counts[i][j] > 0 {
+				v := sums[i][j] / float64(counts[i][j])
+				out.Values[i][j] = &v
+			}
+		}
+	}
+	return out
+}
+
+func columnIndex(headers []string, name string) int {
+	for i, h := range headers {
+		if h == name {
+			return i
+		}
+	}
+	trimmed := strings.TrimSpace(name)
+	for i, h := range headers {
+		if strings.TrimSpace(h) == trimmed {
+			return i
+		}
+	}
+	return -1
+}
+
+// parseXValues returns float64 x values when every non-missing cell parses
+// as a number, leaving missing cells nil, otherwise the strings unchanged.
+// An axis without any value is not numeric.
+func parseXValues(xs []string) ([]any, bool) {
+	out := make([]any, len(xs))
+	numeric, seen := true, false
+	for i, raw := range xs {
+		if isMissing(raw) {
+			continue
+		}
+		v, ok := parseNumber(raw)
+		if !ok {
+			numeric = false
+			break
+		}
+		out[i], seen = v, true
+	}
+	if numeric && seen {
+		return out, true
+	}
+	for i, raw := range xs {
+		out[i] = raw
+	}
+	return out, false
+}
+
+// lttb selects threshold point indices with the Largest-Triangle-Three-
+// Buckets algorithm, which keeps the visual shape of a series (peaks,
+// troughs) far better than taking every nth point. x must be in plotting
+// order.
+func lttb(x, y []float64, threshold int) []int {
+	n := len(x)
+	if threshold >= n || threshold < minDownsamplePoints {
+		out := make([]int, n)
+		for i := range out {
+			out[i] = i
+		}
+		return out
+	}
+
+	out := make([]int, 0, threshold)
+	out = append(out, 0)
+	bucket := float64(n-2) / float64(threshold-2)
+	a := 0
+	for i := 0; i < threshold-2; i++ {
+		// Average of the next bucket is the third triangle vertex.
+		nextStart := int(float64(i+1)*bucket) + 1
+		nextEnd := int(float64(i+2)*bucket) + 1
+		if nextEnd > n {
+			nextEnd = n
+		}
+		var avgX, avgY float64
+		for j := nextStart; j < nextEnd; j++ {
+			avgX += x[j]
+			avgY += y[j]
+		}
+		if cnt := nextEnd - nextStart; cnt > 0 {
+			avgX /= float64(cnt)
+			avgY /= float64(cnt)
+		} else {
+			avgX, avgY = x[n-1], y[n-1]
+		}
+
+		start := int(float64(i)*bucket) + 1
+		end := nextStart
+		best, bestArea := start, -1.0
+		for j := start; j < end; j++ {
+			area := math.Abs((x[a]-avgX)*(y[j]-y[a]) - (x[a]-x[j])*(avgY-y[a]))
+			if area > bestArea {
+				best, bestArea = j, area
+			}
+		}
+		out = append(out, best)
+		a = best
+	}
+	return append(out, n-1)
+}
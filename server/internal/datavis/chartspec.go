@@ -0,0 +1,295 @@
+package datavis
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Chart types.
+const (
+	ChartLine      = "line"
+	ChartScatter   = "scatter"
+	ChartBar       = "bar"
+	ChartHistogram = "histogram"
+	ChartArea      = "area"
+	ChartBox       = "box"
+	ChartHeatmap   = "heatmap"
+)
+
+// Axis scales.
+const (
+	AxisScaleLinear = "linear"
+	AxisScaleLog    = "log"
+)
+
+const (
+	// maxChartGroups bounds groupBy and facetBy; more series than this are
+	// not readable in one chart.
+	maxChartGroups = 24
+	// maxHeatmapCategories fits the 24 columns of a 384-well plate.
+	maxHeatmapCategories = 48
+)
+
+var chartTypes = []string{ChartLine, ChartScatter, ChartBar, ChartHistogram, ChartArea, ChartBox, ChartHeatmap}
+
+// AxisSpec overrides an axis. Label and Unit default to the column header
+// ("OD600 (AU)" gives label OD600, unit AU); Scale is linear or log.
+type AxisSpec struct {
+	Label string `json:"label,omitempty"`
+	Unit  string `json:"unit,omitempty"`
+	Scale string `json:"scale,omitempty"`
+}
+
+// ChartSpec is the typed part of a chart configuration beyond its type and
+// columns, stored in chart_configs.options.
+//
+//   - ErrorColumns: one column per y column (empty for none) holding the
+//     error bar half width of each point. line, scatter, bar and area.
+//   - GroupBy: splits every y column into one series per value of a
+//     categorical column.
+//   - FacetBy: draws one panel per value of a categorical column.
+//   - RowColumn: heatmap only; the heatmap has one cell per (xColumn,
+//     RowColumn) pair coloured by the single y column, e.g. plate column,
+//     plate row and reading.
+type ChartSpec struct {
+	XAxis        AxisSpec `json:"xAxis"`
+	YAxis        AxisSpec `json:"yAxis"`
+	ErrorColumns []string `json:"errorColumns,omitempty"`
+	GroupBy      string   `json:"groupBy,omitempty"`
+	FacetBy      string   `json:"facetBy,omitempty"`
+	RowColumn    string   `json:"rowColumn,omitempty"`
+}
+
+func isNumericColumn(p *ColumnProfile) bool {
+	return p.Type == ColumnTypeInteger || p.Type == ColumnTypeNumeric
+}
+
+// isGroupingColumn reports whether a column can split a chart: categorical,
+// boolean or integer (plate columns, replicate numbers) with few values.
+func isGroupingColumn(p *ColumnProfile, limit int) bool {
+	switch p.Type {
+	case ColumnTypeCategorical, ColumnTypeBoolean, ColumnTypeInteger:
+		return p.Distinct <= limit
+	}
+	return false
+}
+
+// validateChart checks a chart configuration against the column profiles
+// of its extract.
+func validateChart(chartType, xColumn string, yColumns []string, spec *ChartSpec, headers []string, profiles []ColumnProfile) error {
+	known := false
+	for _, t := range chartTypes {
+		known = known || t == chartType
+	}
+	if !known {
+		return fmt.Errorf("%w: chartType must be one of %s", ErrInvalidInput, strings.Join(chartTypes, ", "))
+	}
+	column := func(name, field string) (*ColumnProfile, error) {
+		idx := columnIndex(headers, name)
+		if idx < 0 || idx >= len(profiles) {
+			return nil, fmt.Errorf("%w: %s %q is not in the extract", ErrInvalidInput, field, name)
+		}
+		return &profiles[idx], nil
+	}
+	for _, axis := range []struct {
+		name string
+		spec *AxisSpec
+	}{{"xAxis", &spec.XAxis}, {"yAxis", &spec.YAxis}} {
+		switch axis.spec.Scale {
+		case "":
+			axis.spec.Scale = AxisScaleLinear
+		case AxisScaleLinear, AxisScaleLog:
+		default:
+			return fmt.Errorf("%w: %s.scale must be linear or log", ErrInvalidInput, axis.name)
+		}
+	}
+	xLog, yLog := spec.XAxis.Scale == AxisScaleLog, spec.YAxis.Scale == AxisScaleLog
+
+	if len(yColumns) == 0 {
+		return fmt.Errorf("%w: at least one yColumn is required", ErrInvalidInput)
+	}
+	for _, name := range yColumns {
+		p, err := column(name, "y column")
+		if err != nil {
+			return err
+		}
+		if !isNumericColumn(p) {
+			return fmt.Errorf("%w: y column %q is %s, not numeric", ErrInvalidInput, name, p.Type)
+		}
+		if yLog && (p.Min == nil || *p.Min <= 0) && chartType != ChartHistogram {
+			return fmt.Errorf("%w: y column %q has values <= 0 and cannot use a log axis", ErrInvalidInput, name)
+		}
+	}
+
+	// The x column: numeric for scatter plots, any column for category
+	// axes, and unused by histograms.
+	if strings.TrimSpace(xColumn) == "" {
+		if chartType != ChartHistogram {
+			return fmt.Errorf("%w: xColumn is required", ErrInvalidInput)
+		}
+	} else {
+		p, err := column(xColumn, "x column")
+		if err != nil {
+			return err
+		}
+		switch chartType {
+		case ChartScatter:
+			if !isNumericColumn(p) {
+				return fmt.Errorf("%w: scatter charts need a numeric x column; %q is %s", ErrInvalidInput, xColumn, p.Type)
+			}
+		case ChartHeatmap:
+			if p.Distinct > maxHeatmapCategories {
+				return fmt.Errorf("%w: heatmap x column %q has more than %d values", ErrInvalidInput, xColumn, maxHeatmapCategories)
+			}
+		}
+		if xLog {
+			if chartType != ChartLine && chartType != ChartScatter && chartType != ChartArea {
+				return fmt.Errorf("%w: a log x axis needs a line, scatter or area chart", ErrInvalidInput)
+			}
+			if !isNumericColumn(p) || p.Min == nil || *p.Min <= 0 {
+				return fmt.Errorf("%w: a log x axis needs a numeric x column with values > 0", ErrInvalidInput)
+			}
+		}
+	}
+
+	switch chartType {
+	case ChartBar, ChartArea, ChartHistogram:
+		if yLog {
+			return fmt.Errorf("%w: %s charts cannot use a log y axis", ErrInvalidInput, chartType)
+		}
+	case ChartHeatmap:
+		if xLog || yLog {
+			return fmt.Errorf("%w: heatmap axes are categorical and cannot be log scaled", ErrInvalidInput)
+		}
+		if len(yColumns) != 1 {
+			return fmt.Errorf("%w: a heatmap takes exactly one y column, the cell value", ErrInvalidInput)
+		}
+		if spec.RowColumn == "" {
+			return fmt.Errorf("%w: a heatmap needs a rowColumn", ErrInvalidInput)
+		}
+		p, err := column(spec.RowColumn, "row column")
+		if err != nil {
+			return err
+		}
+		if p.Distinct > maxHeatmapCategories {
+			return fmt.Errorf("%w: heatmap row column %q has more than %d values", ErrInvalidInput, spec.RowColumn, maxHeatmapCategories)
+		}
+		if spec.GroupBy != "" {
+			return fmt.Errorf("%w: heatmaps cannot be grouped; use facetBy", ErrInvalidInput)
+		}
+	}
+	if spec.RowColumn != "" && chartType != ChartHeatmap {
+		return fmt.Errorf("%w: rowColumn only applies to heatmaps", ErrInvalidInput)
+	}
+
+	if len(spec.ErrorColumns) > 0 {
+		switch chartType {
+		case ChartLine, ChartScatter, ChartBar, ChartArea:
+		default:
+			return fmt.Errorf("%w: %s charts do not draw error bars", ErrInvalidInput, chartType)
+		}
+		if len(spec.ErrorColumns) > len(yColumns) {
+			return fmt.Errorf("%w: errorColumns has more entries than yColumns", ErrInvalidInput)
+		}
+		for _, name := range spec.ErrorColumns {
+			if name == "" {
+				continue
+			}
+			p, err := column(name, "error column")
+			if err != nil {
+				return err
+			}
+			if !isNumericColumn(p) {
+				return fmt.Errorf("%w: error column %q is %s, not numeric", ErrInvalidInput, name, p.Type)
+			}
+		}
+	}
+
+	for _, g := range []struct{ field, name string }{{"groupBy", spec.GroupBy}, {"facetBy", spec.FacetBy}} {
+		if g.name == "" {
+			continue
+		}
+		p, err := column(g.name, g.field+" column")
+		if err != nil {
+			return err
+		}
+		if !isGroupingColumn(p, maxChartGroups) {
+			return fmt.Errorf("%w: %s column %q must be categorical with at most %d values", ErrInvalidInput, g.field, g.name, maxChartGroups)
+		}
+	}
+	if spec.GroupBy != "" && spec.GroupBy == spec.FacetBy {
+		return fmt.Errorf("%w: groupBy and facetBy must be different columns", ErrInvalidInput)
+	}
+	return nil
+}
+
+// ChartAxis is a resolved axis: the spec's label and unit, or those parsed
+// from the column header.
+type ChartAxis struct {
+	Label string `json:"label"`
+	Unit  string `json:"unit,omitempty"`
+	Scale string `json:"scale"`
+}
+
+// Title is the axis title as drawn, "Label (unit)".
+func (a ChartAxis) Title() string {
+	if a.Unit == "" {
+		return a.Label
+	}
+	if a.Label == "" {
+		return "(" + a.Unit + ")"
+	}
+	return a.Label + " (" + a.Unit + ")"
+}
+
+// resolveAxes fills axis labels and units from the column headers where
+// the spec leaves them empty. The y axis only takes a label from the data
+// when it shows a single column; its unit when all columns share one.
+func resolveAxes(cc *ChartConfig) (x, y ChartAxis) {
+	xColumn, yColumns := cc.XColumn, cc.YColumns
+	switch cc.ChartType {
+	case ChartHistogram:
+		// Values run along x; y counts them.
+		xColumn, yColumns = "", nil
+		if len(cc.YColumns) == 1 {
+			xColumn = cc.YColumns[0]
+		}
+		y.Label = "Count"
+	case ChartHeatmap:
+		yColumns = []string{cc.Spec.RowColumn}
+	}
+	if xColumn != "" {
+		x.Label, x.Unit = ParseHeaderUnit(xColumn)
+	}
+	if len(yColumns) == 1 {
+		y.Label, y.Unit = ParseHeaderUnit(yColumns[0])
+	} else if len(yColumns) > 1 {
+		_, y.Unit = ParseHeaderUnit(yColumns[0])
+		for _, col := range yColumns[1:] {
+			if _, unit := ParseHeaderUnit(col); unit != y.Unit {
+				y.Unit = ""
+				break
+			}
+		}
+	}
+	if cc.Spec.XAxis.Label != "" {
+		x.Label = cc.Spec.XAxis.Label
+	}
+	if cc.Spec.XAxis.Unit != "" {
+		x.Unit = cc.Spec.XAxis.Unit
+	}
+	if cc.Spec.YAxis.Label != "" {
+		y.Label = cc.Spec.YAxis.Label
+	}
+	if cc.Spec.YAxis.Unit != "" {
+		y.Unit = cc.Spec.YAxis.Unit
+	}
+	x.Scale, y.Scale = AxisScaleLinear, AxisScaleLinear
+	if cc.Spec.XAxis.Scale == AxisScaleLog {
+		x.Scale = AxisScaleLog
+	}
+	if cc.Spec.YAxis.Scale == AxisScaleLog {
+		y.Scale = AxisScaleLog
+	}
+	return x, y
+}
@@ -0,0 +1,284 @@
+package datavis
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Column types inferred at parse time.
+const (
+	ColumnTypeInteger     = "integer"
+	ColumnTypeNumeric     = "numeric"
+	ColumnTypeDateTime    = "datetime"
+	ColumnTypeBoolean     = "boolean"
+	ColumnTypeCategorical = "categorical"
+)
+
+// maxTopValues is how many of the most frequent values are listed for
+// categorical and boolean columns.
+const maxTopValues = 10
+
+// ColumnProfile describes one extract column: the inferred type, the unit
+// parsed from the header and summary statistics over the full table.
+// Count excludes missing cells (empty, NA, N/A, NaN, null).
+type ColumnProfile struct {
+	Index    int    `json:"index"`
+	Name     string `json:"name"`
+	Label    string `json:"label"`
+	Unit     string `json:"unit,omitempty"`
+	Type     string `json:"type"`
+	Count    int    `json:"count"`
+	Missing  int    `json:"missing"`
+	Distinct int    `json:"distinct"`
+
+	// Numeric and integer columns.
+	Min       *float64         `json:"min,omitempty"`
+	Max       *float64         `json:"max,omitempty"`
+	Mean      *float64         `json:"mean,omitempty"`
+	Std       *float64         `json:"std,omitempty"`
+	Quantiles *ColumnQuantiles `json:"quantiles,omitempty"`
+
+	// Datetime columns, RFC 3339.
+	MinTime string `json:"minTime,omitempty"`
+	MaxTime string `json:"maxTime,omitempty"`
+
+	// Categorical and boolean columns.
+	TopValues []ValueCount `json:"topValues,omitempty"`
+}
+
+type ColumnQuantiles struct {
+	P25    float64 `json:"p25"`
+	Median float64 `json:"median"`
+	P75    float64 `json:"p75"`
+}
+
+type ValueCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+var (
+	// "OD600 (AU)", "Temperature [°C]"
+	bracketUnitPattern = regexp.MustCompile(`^(.*?)\s*[(\[]\s*([^()\[\]]+?)\s*[)\]]\s*$`)
+	// "T / K", the quantity-calculus convention.
+	slashUnitPattern = regexp.MustCompile(`^(.*\S)\s+/\s+(\S.*)$`)
+)
+
+var dateTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"2006/01/02 15:04:05",
+	"2006/01/02",
+	"01/02/2006 15:04:05",
+	"01/02/2006",
+	"02.01.2006 15:04:05",
+	"02.01.2006",
+}
+
+// ParseHeaderUnit splits a header such as "OD600 (AU)" into its label and
+// unit. Headers without a recognizable unit are returned unchanged.
+func ParseHeaderUnit(header string) (label, unit string) {
+	header = strings.TrimSpace(header)
+	if m := bracketUnitPattern.FindStringSubmatch(header); m != nil && strings.TrimSpace(m[1]) != "" {
+		return strings.TrimSpace(m[1]), m[2]
+	}
+	if m := slashUnitPattern.FindStringSubmatch(header); m != nil {
+		return m[1], strings.TrimSpace(m[2])
+	}
+	return header, ""
+}
+
+func isMissing(v string) bool {
+	switch strings.ToLower(v) {
+	case "", "na", "n/a", "nan", "null", "none":
+		return true
+	}
+	return false
+}
+
+func parseBool(v string) (bool, bool) {
+	switch strings.ToLower(v) {
+	case "true", "yes", "y", "t":
+		return true, true
+	case "false", "no", "n", "f":
+		return false, true
+	}
+	return false, false
+}
+
+func parseNumber(v string) (float64, bool) {
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, false
+	}
+	return f, true
+}
+
+func parseDateTime(v string) (time.Time, bool) {
+	for _, layout := range dateTimeLayouts {
+		if t, err := time.Parse(layout, v); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// profileColumns infers types and computes statistics for every column.
+func profileColumns(headers []string, rows [][]string) []ColumnProfile {
+	profiles := make([]ColumnProfile, len(headers))
+	for i, h := range headers {
+		values := make([]string, 0, len(rows))
+		for _, row := range rows {
+			v := ""
+			if i < len(row) {
+				v = strings.TrimSpace(row[i])
+			}
+			values = append(values, v)
+		}
+		profiles[i] = profileColumn(i, h, values)
+	}
+	return profiles
+}
+
+func profileColumn(index int, header string, values []string) ColumnProfile {
+	p := ColumnProfile{Index: index, Name: header}
+	p.Label, p.Unit = ParseHeaderUnit(header)
+
+	present := make([]string, 0, len(values))
+	counts := map[string]int{}
+	for _, v := range values {
+		if isMissing(v) {
+			p.Missing++
+			continue
+		}
+		present = append(present, v)
+		counts[v]++
+	}
+	p.Count = len(present)
+	p.Distinct = len(counts)
+	if p.Count == 0 {
+		p.Type = ColumnTypeCategorical
+		return p
+	}
+
+	integer, numeric, boolean, datetime := true, true, true, true
+	for _, v := range present {
+		if integer {
+			if _, err := strconv.ParseInt(v, 10, 64); err != nil {
+				integer = false
+			}
+		}
+		if numeric {
+			if _, ok := parseNumber(v); !ok {
+				numeric = false
+			}
+		}
+		if boolean {
+			if _, ok := parseBool(v); !ok {
+				boolean = false
+			}
+		}
+		if datetime {
+			if _, ok := parseDateTime(v); !ok {
+				datetime = false
+			}
+		}
+		if !numeric && !boolean && !datetime {
+			break
+		}
+	}
+
+	switch {
+	case integer:
+		p.Type = ColumnTypeInteger
+	case numeric:
+		p.Type = ColumnTypeNumeric
+	case boolean:
+		p.Type = ColumnTypeBoolean
+	case datetime:
+		p.Type = ColumnTypeDateTime
+	default:
+		p.Type = ColumnTypeCategorical
+	}
+
+	switch p.Type {
+	case ColumnTypeInteger, ColumnTypeNumeric:
+		nums := make([]float64, len(present))
+		for i, v := range present {
+			nums[i], _ = parseNumber(v)
+		}
+		numericStats(&p, nums)
+	case ColumnTypeDateTime:
+		var lo, hi time.Time
+		for i, v := range present {
+			t, _ := parseDateTime(v)
+			if i == 0 || t.Before(lo) {
+				lo = t
+			}
+			if i == 0 || t.After(hi) {
+				hi = t
+			}
+		}
+		p.MinTime, p.MaxTime = lo.Format(time.RFC3339), hi.Format(time.RFC3339)
+	default:
+		p.TopValues = topValues(counts)
+	}
+	return p
+}
+
+func numericStats(p *ColumnProfile, nums []float64) {
+	sort.Float64s(nums)
+	n := float64(len(nums))
+	var sum float64
+	for _, v := range nums {
+		sum += v
+	}
+	mean := sum / n
+	var sq float64
+	for _, v := range nums {
+		sq += (v - mean) * (v - mean)
+	}
+	std := 0.0
+	if len(nums) > 1 {
+		std = math.Sqrt(sq / (n - 1))
+	}
+	lo, hi := nums[0], nums[len(nums)-1]
+	p.Min, p.Max, p.Mean, p.Std = &lo, &hi, &mean, &std
+	p.Quantiles = &ColumnQuantiles{
+		P25:    quantile(nums, 0.25),
+		Median: quantile(nums, 0.5),
+		P75:    quantile(nums, 0.75),
+	}
+}
+
+// quantile interpolates linearly between closest ranks of sorted values.
+func quantile(sorted []float64, q float64) float64 {
+	pos := q * float64(len(sorted)-1)
+	lo := int(math.Floor(pos))
+	hi := int(math.Ceil(pos))
+	return sorted[lo] + (sorted[hi]-sorted[lo])*(pos-float64(lo))
+}
+
+func topValues(counts map[string]int) []ValueCount {
+	out := make([]ValueCount, 0, len(counts))
+	for v, c := range counts {
+		out = append(out, ValueCount{Value: v, Count: c})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].Value < out[j].Value
+	})
+	if len(out) > maxTopValues {
+		out = out[:maxTopValues]
+	}
+	return out
+}
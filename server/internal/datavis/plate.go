@@ -0,0 +1,594 @@
+package datavis
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	internaldb "github.com/mjhen/elnote/server/internal/db"
+	"github.com/mjhen/elnote/server/internal/syncer"
+)
+
+// Plate formats.
+const (
+	PlateFormat96  = 96
+	PlateFormat384 = 384
+)
+
+// Well roles in a plate layout.
+const (
+	WellRoleSample   = "sample"
+	WellRoleStandard = "standard"
+	WellRoleBlank    = "blank"
+	WellRoleControl  = "control"
+)
+
+// plateLabelSearchRows is how many lines above a grid are searched for the
+// read label ("Absorbance 450nm", "Fluorescence 485/520").
+const plateLabelSearchRows = 3
+
+var (
+	// plateColumns are the headers of a tidy, one-row-per-well-and-read plate
+	// extract.
+	plateColumns = []string{"well", "row", "column", "read", "value"}
+	// plateLayoutColumns are appended when a layout is applied.
+	plateLayoutColumns = []string{"role", "sample", "group", "concentration"}
+	// wellColumnNames identify the well column of list-style exports.
+	wellColumnNames = map[string]bool{"well": true, "wells": true, "well id": true, "well position": true, "position": true}
+)
+
+// WellAssignment gives one well ("B3") or a rectangular range ("A1:A3",
+// "A1:H2") a role. Wells sharing a Group are replicates; Concentration is
+// the known amount of a standard.
+type WellAssignment struct {
+	Wells         string   `json:"wells"`
+	Role          string   `json:"role"`
+	Sample        string   `json:"sample,omitempty"`
+	Group         string   `json:"group,omitempty"`
+	Concentration *float64 `json:"concentration,omitempty"`
+}
+
+// PlateLayout maps the wells of a plate to their contents.
+type PlateLayout struct {
+	ID            string           `json:"plateLayoutId"`
+	ExperimentID  string           `json:"experimentId"`
+	CreatorUserID string           `json:"creatorUserId"`
+	Name          string           `json:"name"`
+	PlateFormat   int              `json:"plateFormat"`
+	Assignments   []WellAssignment `json:"assignments"`
+	CreatedAt     time.Time        `json:"createdAt"`
+}
+
+type CreatePlateLayoutInput struct {
+	ExperimentID  string
+	CreatorUserID string
+	DeviceID      string
+	Name          string
+	PlateFormat   int
+	Assignments   []WellAssignment
+}
+
+type ParsePlateInput struct {
+	AttachmentID string
+	ExperimentID string
+	ActorUserID  string
+	// Data is the raw export; when empty the attachment is read.
+	Data   []byte
+	Format string
+	// Sheet selects a workbook sheet; empty uses the first sheet holding
+	// a plate.
+	Sheet string
+	// PlateFormat is 96 or 384; zero accepts the format found.
+	PlateFormat   int
+	PlateLayoutID string
+}
+
+// plateBlock is one grid of a plate export: a line of column numbers
+// followed by one line per row letter.
+type plateBlock struct {
+	label     string
+	headerRow int
+	rows      int
+	cols      int
+	values    [][]string
+}
+
+func plateDimensions(format int) (rows, cols int, ok bool) {
+	switch format {
+	case PlateFormat96:
+		return 8, 12, true
+	case PlateFormat384:
+		return 16, 24, true
+	}
+	return 0, 0, false
+}
+
+// parseWellID parses "B3" or "B03" into zero-based row and column.
+func parseWellID(id string) (row, col int, ok bool) {
+	id = strings.ToUpper(strings.TrimSpace(id))
+	if len(id) < 2 || id[0] < 'A' || id[0] > 'Z' {
+		return 0, 0, false
+	}
+	n, err := strconv.Atoi(id[1:])
+	if err != nil || n < 1 {
+		return 0, 0, false
+	}
+	return int(id[0] - 'A'), n - 1, true
+}
+
+func wellName(row, col int) string {
+	return fmt.Sprintf("%c%d", 'A'+row, col+1)
+}
+
+// expandAssignments resolves every assignment to its wells. A well may only
+// be assigned once.
+func expandAssignments(format int, assignments []WellAssignment) (map[string]WellAssignment, error) {
+	rows, cols, ok := plateDimensions(format)
+	if !ok {
+		return nil, fmt.Errorf("%w: plateFormat must be 96 or 384", ErrInvalidInput)
+	}
+	wells := map[string]WellAssignment{}
+	for i, a := range assignments {
+		switch a.Role {
+		case WellRoleSample, WellRoleStandard, WellRoleBlank, WellRoleControl:
+		default:
+			return nil, fmt.Errorf("%w: assignment %d: role must be sample, standard, blank or control", ErrInvalidInput, i+1)
+		}
+		from, to, _ := strings.Cut(a.Wells, ":")
+		if to == "" {
+			to = from
+		}
+		r1, c1, ok1 := parseWellID(from)
+		r2, c2, ok2 := parseWellID(to)
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("%w: assignment %d: invalid wells %q", ErrInvalidInput, i+1, a.Wells)
+		}
+		if r1 > r2 {
+			r1, r2 = r2, r1
+		}
+		if c1 > c2 {
+			c1, c2 = c2, c1
+		}
+		if r2 >= rows || c2 >= cols {
+			return nil, fmt.Errorf("%w: assignment %d: wells %q are outside a %d-well plate", ErrInvalidInput, i+1, a.Wells, format)
+		}
+		for r := r1; r <= r2; r++ {
+			for c := c1; c <= c2; c++ {
+				well := wellName(r, c)
+				if _, dup := wells[well]; dup {
+					return nil, fmt.Errorf("%w: well %s is assigned more than once", ErrInvalidInput, well)
+				}
+				wells[well] = a
+			}
+		}
+	}
+	return wells, nil
+}
+
+// findPlateBlocks locates every 8×12 or 16×24 grid in the records.
+func findPlateBlocks(records [][]string) []plateBlock {
+	cell := func(row []string, i int) string {
+		if i >= 0 && i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+		return ""
+	}
+
+	var blocks []plateBlock
+	lastEnd := 0
+	for i := 0; i < len(records); i++ {
+		row := records[i]
+		c0 := -1
+		for c := 1; c < len(row); c++ {
+			if cell(row, c) == "1" {
+				c0 = c
+				break
+			}
+		}
+		if c0 < 0 {
+			continue
+		}
+		n := 0
+		for cell(row, c0+n) == strconv.Itoa(n+1) {
+			n++
+		}
+		var wantRows int
+		switch {
+		case n >= 24:
+			n, wantRows = 24, 16
+		case n >= 12:
+			n, wantRows = 12, 8
+		default:
+			continue
+		}
+
+		block := plateBlock{headerRow: i + 1, rows: wantRows, cols: n}
+		for r := 0; r < wantRows && i+1+r < len(records); r++ {
+			next := records[i+1+r]
+			if !strings.EqualFold(cell(next, c0-1), string(rune('A'+r))) {
+				break
+			}
+			values := make([]string, n)
+			for c := range values {
+				values[c] = cell(next, c0+c)
+			}
+			block.values = append(block.values, values)
+		}
+		if len(block.values) != wantRows {
+			continue
+		}
+
+		if corner := cell(row, c0-1); corner != "" && corner != "<>" {
+			block.label = corner
+		} else {
+			for j := i - 1; j >= lastEnd && j >= i-plateLabelSearchRows; j-- {
+				var parts []string
+				for _, c := range records[j] {
+					if c = strings.TrimSpace(c); c != "" {
+						parts = append(parts, c)
+					}
+				}
+				if len(parts) > 0 {
+					block.label = strings.Join(parts, " ")
+					break
+				}
+			}
+		}
+		blocks = append(blocks, block)
+		i += wantRows
+		lastEnd = i + 1
+	}
+	return blocks
+}
+
+// plateTable converts plate-reader records into a tidy table with one row
+// per measured well and read. Grid exports are tried first, then list
+// exports with a well column. ok is false when neither is present.
+func plateTable(records [][]string) (t table, ok bool, err error) {
+	if blocks := findPlateBlocks(records); len(blocks) > 0 {
+		t = table{headerRow: blocks[0].headerRow, headers: plateColumns, rows: [][]string{}}
+		t.plateFormat = PlateFormat96
+		seen := map[string]int{}
+		for k, b := range blocks {
+			if b.cols == 24 {
+				t.plateFormat = PlateFormat384
+			}
+			label := b.label
+			if label == "" {
+				label = fmt.Sprintf("read %d", k+1)
+			}
+			if seen[label]++; seen[label] > 1 {
+				label = fmt.Sprintf("%s (%d)", label, seen[label])
+			}
+			for r, values := range b.values {
+				for c, v := range values {
+					if v == "" {
+						continue
+					}
+					t.rows = append(t.rows, []string{wellName(r, c), string(rune('A' + r)), strconv.Itoa(c + 1), label, v})
+				}
+			}
+		}
+		return t, true, nil
+	}
+
+	if len(records) == 0 {
+		return table{}, false, nil
+	}
+	list, err := buildTable(records, 0)
+	if err != nil {
+		return table{}, false, nil
+	}
+	wellCol := -1
+	for i, h := range list.headers {
+		if wellColumnNames[strings.ToLower(h)] {
+			wellCol = i
+			break
+		}
+	}
+	if wellCol < 0 {
+		return table{}, false, nil
+	}
+
+	t = table{headerRow: list.headerRow, headers: plateColumns, rows: [][]string{}, plateFormat: PlateFormat96}
+	for i, row := range list.rows {
+		r, c, ok := parseWellID(row[wellCol])
+		if !ok {
+			return table{}, false, fmt.Errorf("%w: row %d: invalid well %q", ErrInvalidInput, i+1, row[wellCol])
+		}
+		if r >= 16 || c >= 24 {
+			return table{}, false, fmt.Errorf("%w: row %d: well %q is outside a 384-well plate", ErrInvalidInput, i+1, row[wellCol])
+		}
+		if r >= 8 || c >= 12 {
+			t.plateFormat = PlateFormat384
+		}
+		for j, v := range row {
+			if j == wellCol || strings.TrimSpace(v) == "" {
+				continue
+			}
+			t.rows = append(t.rows, []string{wellName(r, c), string(rune('A' + r)), strconv.Itoa(c + 1), list.headers[j], strings.TrimSpace(v)})
+		}
+	}
+	return t, true, nil
+}
+
+// parsePlate finds the plate in the export, honouring the requested sheet.
+func parsePlate(data []byte, in ParsePlateInput) (table, error) {
+	format := detectFormat(data, in.Format)
+	switch format {
+	case SourceFormatXLSX:
+		sheets, err := readXLSX(data)
+		if err != nil {
+			return table{}, fmt.Errorf("%w: cannot read workbook: %v", ErrInvalidInput, err)
+		}
+		for _, sheet := range sheets {
+			if in.Sheet != "" && sheet.name != strings.TrimSpace(in.Sheet) {
+				continue
+			}
+			t, ok, err := plateTable(sheet.rows)
+			if err != nil {
+				return table{}, fmt.Errorf("sheet %q: %w", sheet.name, err)
+			}
+			if ok {
+				t.format, t.sheetName = SourceFormatXLSX, sheet.name
+				return t, nil
+			}
+			if in.Sheet != "" {
+				return table{}, fmt.Errorf("%w: sheet %q holds no plate grid or well list", ErrInvalidInput, sheet.name)
+			}
+		}
+		if in.Sheet != "" {
+			return table{}, fmt.Errorf("%w: workbook has no sheet named %q", ErrInvalidInput, in.Sheet)
+		}
+	case SourceFormatCSV, SourceFormatTSV:
+		records, format, err := readDelimited(data, format)
+		if err != nil {
+			return table{}, err
+		}
+		t, ok, err := plateTable(records)
+		if err != nil {
+			return table{}, err
+		}
+		if ok {
+			t.format = format
+			return t, nil
+		}
+	default:
+		return table{}, fmt.Errorf("%w: format must be csv, tsv or xlsx", ErrInvalidInput)
+	}
+	return table{}, fmt.Errorf("%w: no 96- or 384-well plate grid or well list found", ErrInvalidInput)
+}
+
+// applyLayout appends the layout columns to every well row.
+func applyLayout(t *table, layout *PlateLayout) error {
+	if layout.PlateFormat != t.plateFormat {
+		return fmt.Errorf("%w: layout is for a %d-well plate but the export is a %d-well plate", ErrInvalidInput, layout.PlateFormat, t.plateFormat)
+	}
+	wells, err := expandAssignments(layout.PlateFormat, layout.Assignments)
+	if err != nil {
+		return err
+	}
+	t.headers = append(append([]string{}, plateColumns...), plateLayoutColumns...)
+	for i, row := range t.rows {
+		a := wells[row[0]]
+		concentration := ""
+		if a.Concentration != nil {
+			concentration = strconv.FormatFloat(*a.Concentration, 'g', -1, 64)
+		}
+		t.rows[i] = append(row, a.Role, a.Sample, a.Group, concentration)
+	}
+	t.plateLayoutID = layout.ID
+	return nil
+}
+
+// ParsePlate stores a plate-reader export as a tidy well-level extract with
+// columns well, row, column, read and value, plus role, sample, group and
+// concentration when a layout is applied.
+func (s *Service) ParsePlate(ctx context.Context, in ParsePlateInput) (*DataExtract, error) {
+	if strings.TrimSpace(in.ExperimentID) == "" {
+		return nil, fmt.Errorf("%w: experimentId is required", ErrInvalidInput)
+	}
+	if in.PlateFormat != 0 {
+		if _, _, ok := plateDimensions(in.PlateFormat); !ok {
+			return nil, fmt.Errorf("%w: plateFormat must be 96 or 384", ErrInvalidInput)
+		}
+	}
+	if err := s.checkExperimentOwner(ctx, in.ExperimentID, in.ActorUserID); err != nil {
+		return nil, err
+	}
+
+	var layout *PlateLayout
+	if in.PlateLayoutID != "" {
+		var err error
+		if layout, err = s.GetPlateLayout(ctx, in.PlateLayoutID, in.ActorUserID, ""); err != nil {
+			return nil, err
+		}
+		if layout.ExperimentID != in.ExperimentID {
+			return nil, fmt.Errorf("%w: plate layout belongs to another experiment", ErrInvalidInput)
+		}
+	}
+
+	data, err := s.sourceData(ctx, in.Data, in.AttachmentID, in.ExperimentID)
+	if err != nil {
+		return nil, err
+	}
+	t, err := parsePlate(data, in)
+	if err != nil {
+		return nil, err
+	}
+	if in.PlateFormat != 0 && in.PlateFormat != t.plateFormat {
+		return nil, fmt.Errorf("%w: expected a %d-well plate but found a %d-well plate", ErrInvalidInput, in.PlateFormat, t.plateFormat)
+	}
+	if layout != nil {
+		if err := applyLayout(&t, layout); err != nil {
+			return nil, err
+		}
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	extract, err := insertExtract(ctx, tx, ParseInput{
+		AttachmentID: in.AttachmentID,
+		ExperimentID: in.ExperimentID,
+		ActorUserID:  in.ActorUserID,
+	}, t)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return extract, nil
+}
+
+// CreatePlateLayout stores an immutable layout for the experiment.
+func (s *Service) CreatePlateLayout(ctx context.Context, in CreatePlateLayoutInput) (*PlateLayout, error) {
+	if strings.TrimSpace(in.Name) == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidInput)
+	}
+	if len(in.Assignments) == 0 {
+		return nil, fmt.Errorf("%w: at least one well assignment is required", ErrInvalidInput)
+	}
+	if _, err := expandAssignments(in.PlateFormat, in.Assignments); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	var expOwner string
+	err = tx.QueryRowContext(ctx,
+		`SELECT owner_user_id FROM experiments WHERE id = $1`, in.ExperimentID,
+	).Scan(&expOwner)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("query experiment: %w", err)
+	}
+	if expOwner != in.CreatorUserID {
+		return nil, ErrForbidden
+	}
+
+	assignmentsJSON, err := json.Marshal(in.Assignments)
+	if err != nil {
+		return nil, fmt.Errorf("encode assignments: %w", err)
+	}
+	layout := PlateLayout{
+		ExperimentID:  in.ExperimentID,
+		CreatorUserID: in.CreatorUserID,
+		Name:          strings.TrimSpace(in.Name),
+		PlateFormat:   in.PlateFormat,
+		Assignments:   in.Assignments,
+	}
+	err = tx.QueryRowContext(ctx,
+		`INSERT INTO plate_layouts (experiment_id, creator_user_id, name, plate_format, assignments)
+		 VALUES ($1, $2, $3, $4, $5)
+		 RETURNING id, created_at`,
+		in.ExperimentID, in.CreatorUserID, layout.Name, in.PlateFormat, assignmentsJSON,
+	).Scan(&layout.ID, &layout.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("insert plate layout: %w", err)
+	}
+
+	payload := map[string]any{
+		"plateLayoutId": layout.ID,
+		"plateFormat":   layout.PlateFormat,
+		"experimentId":  in.ExperimentID,
+	}
+	if err := internaldb.AppendAuditEvent(ctx, tx, in.CreatorUserID, "plate_layout.created", "experiment", in.ExperimentID, payload); err != nil {
+		return nil, fmt.Errorf("append plate_layout.created audit event: %w", err)
+	}
+
+	if _, err := s.sync.AppendEvent(ctx, tx, syncer.AppendEventInput{
+		OwnerUserID:   expOwner,
+		ActorUserID:   in.CreatorUserID,
+		DeviceID:      in.DeviceID,
+		EventType:     "plate_layout.created",
+		AggregateType: "experiment",
+		AggregateID:   in.ExperimentID,
+		Payload:       payload,
+	}); err != nil {
+		return nil, fmt.Errorf("append plate_layout.created sync event: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return &layout, nil
+}
+
+const plateLayoutColumnsSQL = `pl.id, pl.experiment_id, pl.creator_user_id, pl.name, pl.plate_format, pl.assignments, pl.created_at`
+
+func scanPlateLayout(row interface{ Scan(...any) error }) (*PlateLayout, error) {
+	var (
+		layout          PlateLayout
+		assignmentsJSON []byte
+	)
+	if err := row.Scan(&layout.ID, &layout.ExperimentID, &layout.CreatorUserID, &layout.Name,
+		&layout.PlateFormat, &assignmentsJSON, &layout.CreatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(assignmentsJSON, &layout.Assignments); err != nil {
+		return nil, fmt.Errorf("decode assignments: %w", err)
+	}
+	return &layout, nil
+}
+
+func (s *Service) GetPlateLayout(ctx context.Context, layoutID, userID, role string) (*PlateLayout, error) {
+	layout, err := scanPlateLayout(s.db.QueryRowContext(ctx,
+		`SELECT `+plateLayoutColumnsSQL+`
+		 FROM plate_layouts pl
+		 JOIN experiments e ON e.id = pl.experiment_id
+		 WHERE pl.id = $1 AND (e.owner_user_id = $2 OR ($3 = 'admin' AND e.status = 'completed'))`,
+		layoutID, userID, role,
+	))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("query plate layout: %w", err)
+	}
+	return layout, nil
+}
+
+func (s *Service) ListPlateLayouts(ctx context.Context, experimentID, userID, role string) ([]PlateLayout, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+plateLayoutColumnsSQL+`
+		 FROM plate_layouts pl
+		 JOIN experiments e ON e.id = pl.experiment_id
+		 WHERE pl.experiment_id = $1 AND (e.owner_user_id = $2 OR ($3 = 'admin' AND e.status = 'completed'))
+		 ORDER BY pl.created_at`,
+		experimentID, userID, role,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query plate layouts: %w", err)
+	}
+	defer rows.Close()
+
+	layouts := []PlateLayout{}
+	for rows.Next() {
+		layout, err := scanPlateLayout(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan plate layout: %w", err)
+		}
+		layouts = append(layouts, *layout)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate plate layouts: %w", err)
+	}
+	return layouts, nil
+}
@@ -0,0 +1,262 @@
+package datavis
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// AnalysisQPCRDeltaDeltaCt is relative quantification of qPCR Ct values by
+// the 2^-ΔΔCt method.
+const AnalysisQPCRDeltaDeltaCt = "qpcr_ddct"
+
+// defaultCtOutlierThreshold is how far (in cycles) a technical replicate
+// may sit from its group's median before it is flagged.
+const defaultCtOutlierThreshold = 0.5
+
+// QPCRResult is a ΔΔCt analysis. Replicates lists every sample/target
+// group with its Ct values; Results has one row per sample and non-reference
+// target. Warnings names the combinations that could not be computed.
+type QPCRResult struct {
+	ReferenceTargets []string             `json:"referenceTargets"`
+	ControlSample    string               `json:"controlSample"`
+	OutlierThreshold float64              `json:"outlierThreshold"`
+	Replicates       []QPCRReplicateGroup `json:"replicates"`
+	Results          []QPCRTargetResult   `json:"results"`
+	Warnings         []string             `json:"warnings,omitempty"`
+}
+
+// QPCRReplicateGroup holds the technical replicates of one sample and
+// target. Outliers marks each Ct value further than the threshold from the
+// group median (groups of three or more); HighVariance is set when a pair
+// of replicates differs by more than the threshold. Excluded outliers are
+// left out of MeanCt and SDCt. Undetermined counts wells without a Ct.
+type QPCRReplicateGroup struct {
+	Sample       string    `json:"sample"`
+	Target       string    `json:"target"`
+	CtValues     []float64 `json:"ctValues"`
+	Outliers     []bool    `json:"outliers"`
+	HighVariance bool      `json:"highVariance"`
+	Undetermined int       `json:"undetermined"`
+	N            int       `json:"n"`
+	MeanCt       float64   `json:"meanCt"`
+	SDCt         float64   `json:"sdCt"`
+}
+
+// QPCRTargetResult is the relative expression of a target in a sample.
+// ΔCt = Ct(target) − mean Ct(reference targets); ΔΔCt = ΔCt − ΔCt of the
+// control sample. Standard deviations are propagated in quadrature, and the
+// fold-change range is 2^-(ΔΔCt ± SD).
+type QPCRTargetResult struct {
+	Sample         string  `json:"sample"`
+	Target         string  `json:"target"`
+	DeltaCt        float64 `json:"deltaCt"`
+	DeltaCtSD      float64 `json:"deltaCtSd"`
+	DeltaDeltaCt   float64 `json:"deltaDeltaCt"`
+	DeltaDeltaCtSD float64 `json:"deltaDeltaCtSd"`
+	FoldChange     float64 `json:"foldChange"`
+	FoldChangeLow  float64 `json:"foldChangeLow"`
+	FoldChangeHigh float64 `json:"foldChangeHigh"`
+}
+
+type qpcrKey struct{ sample, target string }
+
+// deltaCt is a ΔCt with its propagated standard deviation.
+type deltaCt struct{ value, sd float64 }
+
+func qpcrDeltaDeltaCt(params *AnalysisParameters, t *analysisTable) (*QPCRResult, error) {
+	ctIdx, err := t.column(params.CtColumn, "ctColumn")
+	if err != nil {
+		return nil, err
+	}
+	sampleIdx, err := t.column(params.SampleColumn, "sampleColumn")
+	if err != nil {
+		return nil, err
+	}
+	targetIdx, err := t.column(params.TargetColumn, "targetColumn")
+	if err != nil {
+		return nil, err
+	}
+	if len(params.ReferenceTargets) == 0 {
+		return nil, fmt.Errorf("%w: at least one referenceTarget is required", ErrInvalidInput)
+	}
+	if strings.TrimSpace(params.ControlSample) == "" {
+		return nil, fmt.Errorf("%w: controlSample is required", ErrInvalidInput)
+	}
+	if params.OutlierThreshold < 0 {
+		return nil, fmt.Errorf("%w: outlierThreshold must not be negative", ErrInvalidInput)
+	}
+	if params.OutlierThreshold == 0 {
+		params.OutlierThreshold = defaultCtOutlierThreshold
+	}
+	isReference := map[string]bool{}
+	for _, ref := range params.ReferenceTargets {
+		isReference[strings.TrimSpace(ref)] = true
+	}
+
+	groups := map[qpcrKey]*QPCRReplicateGroup{}
+	var samples, targets []string
+	seenSample, seenTarget := map[string]bool{}, map[string]bool{}
+	for _, row := range t.rows {
+		key := qpcrKey{t.cell(row, sampleIdx), t.cell(row, targetIdx)}
+		if key.sample == "" || key.target == "" {
+			continue
+		}
+		g := groups[key]
+		if g == nil {
+			g = &QPCRReplicateGroup{Sample: key.sample, Target: key.target, CtValues: []float64{}, Outliers: []bool{}}
+			groups[key] = g
+		}
+		if !seenSample[key.sample] {
+			seenSample[key.sample] = true
+			samples = append(samples, key.sample)
+		}
+		if !seenTarget[key.target] {
+			seenTarget[key.target] = true
+			targets = append(targets, key.target)
+		}
+		// Instruments write "Undetermined" or leave the cell empty when
+		// there was no amplification.
+		ct, ok := t.number(row, ctIdx)
+		if !ok {
+			g.Undetermined++
+			continue
+		}
+		g.CtValues = append(g.CtValues, ct)
+	}
+	if !seenSample[params.ControlSample] {
+		return nil, fmt.Errorf("%w: control sample %q has no rows", ErrInvalidInput, params.ControlSample)
+	}
+	for ref := range isReference {
+		if !seenTarget[ref] {
+			return nil, fmt.Errorf("%w: reference target %q has no rows", ErrInvalidInput, ref)
+		}
+	}
+
+	out := &QPCRResult{
+		ReferenceTargets: params.ReferenceTargets,
+		ControlSample:    params.ControlSample,
+		OutlierThreshold: params.OutlierThreshold,
+		Replicates:       []QPCRReplicateGroup{},
+		Results:          []QPCRTargetResult{},
+	}
+	keys := make([]qpcrKey, 0, len(groups))
+	for k := range groups {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].sample != keys[j].sample {
+			return keys[i].sample < keys[j].sample
+		}
+		return keys[i].target < keys[j].target
+	})
+	for _, k := range keys {
+		g := groups[k]
+		summarizeReplicates(g, params.OutlierThreshold, params.ExcludeOutliers)
+		out.Replicates = append(out.Replicates, *g)
+	}
+
+	// ΔCt of every sample/target against the sample's reference targets.
+	reference := map[string]deltaCt{}
+	for _, sample := range samples {
+		var sum, varSum float64
+		complete := true
+		for _, ref := range params.ReferenceTargets {
+			g := groups[qpcrKey{sample, strings.TrimSpace(ref)}]
+			if g == nil || g.N == 0 {
+				complete = false
+				break
+			}
+			sum += g.MeanCt
+			varSum += g.SDCt * g.SDCt
+		}
+		if !complete {
+			out.Warnings = append(out.Warnings, fmt.Sprintf("sample %q is missing reference Ct values", sample))
+			continue
+		}
+		k := float64(len(params.ReferenceTargets))
+		reference[sample] = deltaCt{value: sum / k, sd: math.Sqrt(varSum) / k}
+	}
+	delta := func(sample, target string) (deltaCt, bool) {
+		ref, ok := reference[sample]
+		g := groups[qpcrKey{sample, target}]
+		if !ok || g == nil || g.N == 0 {
+			return deltaCt{}, false
+		}
+		return deltaCt{value: g.MeanCt - ref.value, sd: math.Sqrt(g.SDCt*g.SDCt + ref.sd*ref.sd)}, true
+	}
+
+	sort.Strings(samples)
+	sort.Strings(targets)
+	for _, target := range targets {
+		if isReference[target] {
+			continue
+		}
+		control, ok := delta(params.ControlSample, target)
+		if !ok {
+			out.Warnings = append(out.Warnings, fmt.Sprintf("control sample has no ΔCt for target %q", target))
+			continue
+		}
+		for _, sample := range samples {
+			if groups[qpcrKey{sample, target}] == nil {
+				continue
+			}
+			d, ok := delta(sample, target)
+			if !ok {
+				out.Warnings = append(out.Warnings, fmt.Sprintf("no ΔCt for sample %q, target %q", sample, target))
+				continue
+			}
+			r := QPCRTargetResult{
+				Sample:       sample,
+				Target:       target,
+				DeltaCt:      d.value,
+				DeltaCtSD:    d.sd,
+				DeltaDeltaCt: d.value - control.value,
+			}
+			if sample == params.ControlSample {
+				r.DeltaDeltaCtSD = d.sd
+			} else {
+				r.DeltaDeltaCtSD = math.Sqrt(d.sd*d.sd + control.sd*control.sd)
+			}
+			r.FoldChange = math.Pow(2, -r.DeltaDeltaCt)
+			r.FoldChangeLow = math.Pow(2, -(r.DeltaDeltaCt + r.DeltaDeltaCtSD))
+			r.FoldChangeHigh = math.Pow(2, -(r.DeltaDeltaCt - r.DeltaDeltaCtSD))
+			out.Results = append(out.Results, r)
+		}
+	}
+	if len(out.Results) == 0 {
+		return nil, fmt.Errorf("%w: no sample/target combination could be quantified", ErrInvalidInput)
+	}
+	return out, nil
+}
+
+// summarizeReplicates flags outlying replicates and computes the mean and
+// SD of the Ct values kept.
+func summarizeReplicates(g *QPCRReplicateGroup, threshold float64, exclude bool) {
+	g.Outliers = make([]bool, len(g.CtValues))
+	switch n := len(g.CtValues); {
+	case n >= 3:
+		sorted := append([]float64(nil), g.CtValues...)
+		sort.Float64s(sorted)
+		median := quantile(sorted, 0.5)
+		for i, ct := range g.CtValues {
+			g.Outliers[i] = math.Abs(ct-median) > threshold
+		}
+	case n == 2:
+		g.HighVariance = math.Abs(g.CtValues[0]-g.CtValues[1]) > threshold
+	}
+
+	kept := make([]float64, 0, len(g.CtValues))
+	for i, ct := range g.CtValues {
+		if exclude && g.Outliers[i] {
+			continue
+		}
+		kept = append(kept, ct)
+	}
+	g.N = len(kept)
+	if g.N > 0 {
+		g.MeanCt = mean(kept)
+		g.SDCt = sampleSD(kept)
+	}
+}
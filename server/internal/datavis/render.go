@@ -0,0 +1,872 @@
+package datavis
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image/color"
+	"image/png"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Chart image formats.
+const (
+	ChartImageSVG = "svg"
+	ChartImagePNG = "png"
+)
+
+const (
+	defaultChartWidth  = 800
+	defaultChartHeight = 500
+	minChartSize       = 200
+	maxChartSize       = 4000
+)
+
+const (
+	titleFontSize = 16
+	labelFontSize = 13
+	tickFontSize  = 11
+)
+
+var (
+	chartPalette = []color.RGBA{
+		{0x1f, 0x77, 0xb4, 0xff}, {0xff, 0x7f, 0x0e, 0xff}, {0x2c, 0xa0, 0x2c, 0xff},
+		{0xd6, 0x27, 0x28, 0xff}, {0x94, 0x67, 0xbd, 0xff}, {0x8c, 0x56, 0x4b, 0xff},
+		{0xe3, 0x77, 0xc2, 0xff}, {0x7f, 0x7f, 0x7f, 0xff}, {0xbc, 0xbd, 0x22, 0xff},
+		{0x17, 0xbe, 0xcf, 0xff},
+	}
+	inkColor  = color.RGBA{0x33, 0x33, 0x33, 0xff}
+	gridColor = color.RGBA{0xe3, 0xe3, 0xe3, 0xff}
+)
+
+// ChartImageInput selects a chart and the image to render. Zero Width and
+// Height use the defaults.
+type ChartImageInput struct {
+	ChartConfigID string
+	UserID        string
+	Role          string
+	Format        string
+	Width         int
+	Height        int
+}
+
+// ChartImage is a rendered chart.
+type ChartImage struct {
+	ContentType string
+	Data        []byte
+}
+
+// RenderedChart is a chart configuration with its SVG rendering, as
+// embedded in exports. RenderError is set instead of SVG when the chart no
+// longer resolves against its extract.
+type RenderedChart struct {
+	ChartConfig
+	SVG         string `json:"svg,omitempty"`
+	RenderError string `json:"renderError,omitempty"`
+}
+
+// RenderChart draws a chart configuration as an SVG or PNG image.
+func (s *Service) RenderChart(ctx context.Context, in ChartImageInput) (*ChartImage, error) {
+	if in.Format == "" {
+		in.Format = ChartImageSVG
+	}
+	if in.Format != ChartImageSVG && in.Format != ChartImagePNG {
+		return nil, fmt.Errorf("%w: format must be svg or png", ErrInvalidInput)
+	}
+	if in.Width == 0 {
+		in.Width = defaultChartWidth
+	}
+	if in.Height == 0 {
+		in.Height = defaultChartHeight
+	}
+	if in.Width < minChartSize || in.Width > maxChartSize || in.Height < minChartSize || in.Height > maxChartSize {
+		return nil, fmt.Errorf("%w: width and height must be between %d and %d", ErrInvalidInput, minChartSize, maxChartSize)
+	}
+
+	cc, err := s.GetChartConfig(ctx, in.ChartConfigID, in.UserID, in.Role)
+	if err != nil {
+		return nil, err
+	}
+	// About one point per horizontal pixel is all a line can show.
+	data, err := s.GetChartData(ctx, ChartDataInput{
+		ChartConfigID: in.ChartConfigID,
+		UserID:        in.UserID,
+		Role:          in.Role,
+		MaxPoints:     in.Width,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if in.Format == ChartImageSVG {
+		c := newSVGCanvas(in.Width, in.Height)
+		drawChart(c, cc.Title, data, float64(in.Width), float64(in.Height))
+		return &ChartImage{ContentType: "image/svg+xml", Data: c.bytes()}, nil
+	}
+	c := newRasterCanvas(in.Width, in.Height)
+	drawChart(c, cc.Title, data, float64(in.Width), float64(in.Height))
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, c.image()); err != nil {
+		return nil, fmt.Errorf("encode png: %w", err)
+	}
+	return &ChartImage{ContentType: "image/png", Data: buf.Bytes()}, nil
+}
+
+// RenderExperimentCharts renders every chart of an experiment as SVG.
+func (s *Service) RenderExperimentCharts(ctx context.Context, experimentID, userID, role string) ([]RenderedChart, error) {
+	charts, err := s.ListChartConfigs(ctx, experimentID, userID, role)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]RenderedChart, 0, len(charts))
+	for _, cc := range charts {
+		rc := RenderedChart{ChartConfig: cc}
+		img, err := s.RenderChart(ctx, ChartImageInput{
+			ChartConfigID: cc.ID,
+			UserID:        userID,
+			Role:          role,
+			Format:        ChartImageSVG,
+		})
+		switch {
+		case err == nil:
+			rc.SVG = string(img.Data)
+		case errors.Is(err, ErrInvalidInput):
+			rc.RenderError = err.Error()
+		default:
+			return nil, err
+		}
+		out = append(out, rc)
+	}
+	return out, nil
+}
+
+// ---------------------------------------------------------------------------
+// Layout
+// ---------------------------------------------------------------------------
+
+// valueScale maps a data interval onto a pixel interval, linearly or by
+// log10. Non-positive values on a log scale clamp to the lower bound.
+// Differences are taken of halves, so intervals near the float64 limits
+// do not overflow.
+type valueScale struct {
+	d0, d1, r0, r1 float64
+	log            bool
+}
+
+func (s valueScale) at(v float64) float64 {
+	d0, d1 := s.d0, s.d1
+	v = clampFinite(v)
+	if s.log {
+		if v <= 0 {
+			v = d0
+		}
+		d0, d1, v = math.Log10(d0), math.Log10(d1), math.Log10(v)
+	}
+	if d1 == d0 {
+		return (s.r0 + s.r1) / 2
+	}
+	return s.r0 + (v/2-d0/2)/(d1/2-d0/2)*(s.r1-s.r0)
+}
+
+// clampFinite clamps v into the finite float64 range; NaN becomes zero.
+func clampFinite(v float64) float64 {
+	if math.IsNaN(v) {
+		return 0
+	}
+	return math.Max(-math.MaxFloat64, math.Min(math.MaxFloat64, v))
+}
+
+// maxTicks bounds the ticks of an axis whatever its interval.
+const maxTicks = 64
+
+// niceTicks returns round tick values covering [lo, hi] with roughly n
+// intervals; the first and last tick bound the axis. An interval too wide
+// for float64 gets a step of the largest finite value, and at most
+// maxTicks ticks are returned.
+func niceTicks(lo, hi float64, n int) ([]float64, float64) {
+	lo, hi = clampFinite(lo), clampFinite(hi)
+	if lo == hi {
+		pad := math.Max(math.Abs(lo)*0.1, 1)
+		lo, hi = clampFinite(lo-pad), clampFinite(hi+pad)
+	}
+	n = max(1, min(n, maxTicks-1))
+	raw := (hi/2 - lo/2) / float64(n) * 2
+	step := math.MaxFloat64
+	if !math.IsInf(raw, 0) {
+		mag := math.Pow(10, math.Floor(math.Log10(raw)))
+		step = 10 * mag
+		for _, m := range []float64{1, 2, 5} {
+			if raw <= m*mag {
+				step = m * mag
+				break
+			}
+		}
+		step = clampFinite(step)
+	}
+	start := clampFinite(math.Floor(lo/step) * step)
+	end := clampFinite(math.Ceil(hi/step) * step)
+	var ticks []float64
+	for i := 0; i < maxTicks; i++ {
+		v := (start/2 + float64(i)*(step/2)) * 2
+		if math.IsInf(v, 0) || v/2 > end/2+step/4 {
+			break
+		}
+		ticks = append(ticks, v)
+	}
+	return ticks, step
+}
+
+// axisTicks returns the ticks, their labels and the scale for an axis over
+// [lo, hi] drawn from r0 to r1. Log axes span whole decades, with ticks at
+// 1, 2 and 5 times each power of ten when there are few decades.
+func axisTicks(lo, hi float64, n int, log bool, r0, r1 float64) ([]float64, []string, valueScale) {
+	if !log {
+		ticks, step := niceTicks(lo, hi, n)
+		labels := make([]string, len(ticks))
+		for i, v := range ticks {
+			labels[i] = formatTick(v, step)
+		}
+		return ticks, labels, valueScale{d0: ticks[0], d1: ticks[len(ticks)-1], r0: r0, r1: r1}
+	}
+	e0, e1 := math.Floor(math.Log10(lo)), math.Min(math.Ceil(math.Log10(hi)), 308)
+	if e1 <= e0 {
+		e1 = e0 + 1
+	}
+	multiples := []float64{1}
+	if e1-e0 <= 2 {
+		multiples = []float64{1, 2, 5}
+	}
+	var ticks []float64
+	var labels []string
+	for e := e0; e <= e1; e++ {
+		for _, m := range multiples {
+			v := m * math.Pow(10, e)
+			if e == e1 && m > 1 {
+				break
+			}
+			ticks = append(ticks, v)
+			labels = append(labels, formatLogTick(v))
+		}
+	}
+	return ticks, labels, valueScale{d0: math.Pow(10, e0), d1: math.Pow(10, e1), r0: r0, r1: r1, log: true}
+}
+
+func formatLogTick(v float64) string {
+	if v >= 1e-3 && v < 1e5 {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return strconv.FormatFloat(v, 'g', 3, 64)
+}
+
+func formatTick(v, step float64) string {
+	if v != 0 && (math.Abs(v) >= 1e6 || math.Abs(v) < 1e-4) {
+		return strconv.FormatFloat(v, 'g', 3, 64)
+	}
+	decimals := 0
+	if step > 0 {
+		decimals = int(math.Max(0, -math.Floor(math.Log10(step)+1e-9)))
+	}
+	s := strconv.FormatFloat(v, 'f', decimals, 64)
+	if strings.Trim(s, "-0.") == "" {
+		s = strings.TrimPrefix(s, "-")
+	}
+	return s
+}
+
+func truncateLabel(s string, max int) string {
+	r := []rune(s)
+	if max < 2 {
+		max = 2
+	}
+	if len(r) <= max {
+		return s
+	}
+	return string(r[:max-1]) + "~"
+}
+
+func seriesColor(i int) color.RGBA {
+	return chartPalette[i%len(chartPalette)]
+}
+
+func withAlpha(c color.RGBA, a uint8) color.RGBA {
+	c.A = a
+	return c
+}
+
+// viridis interpolates the viridis colour map at t in [0, 1].
+func viridis(t float64) color.RGBA {
+	stops := [...]color.RGBA{
+		{0x44, 0x01, 0x54, 0xff}, {0x3b, 0x52, 0x8b, 0xff}, {0x21, 0x91, 0x8c, 0xff},
+		{0x5e, 0xc9, 0x62, 0xff}, {0xfd, 0xe7, 0x25, 0xff},
+	}
+	t = math.Max(0, math.Min(1, t)) * float64(len(stops)-1)
+	i := int(t)
+	if i >= len(stops)-1 {
+		return stops[len(stops)-1]
+	}
+	f := t - float64(i)
+	mix := func(a, b uint8) uint8 { return uint8(float64(a) + (float64(b)-float64(a))*f + 0.5) }
+	a, b := stops[i], stops[i+1]
+	return color.RGBA{mix(a.R, b.R), mix(a.G, b.G), mix(a.B, b.B), 0xff}
+}
+
+// histogramBins counts the values of every series into shared bins, using
+// Sturges' rule on the largest series.
+func histogramBins(series []ChartSeries) (edges []float64, counts [][]int) {
+	lo, hi := math.Inf(1), math.Inf(-1)
+	largest := 0
+	for _, s := range series {
+		for _, v := range s.Y {
+			lo, hi = math.Min(lo, v), math.Max(hi, v)
+		}
+		largest = max(largest, len(s.Y))
+	}
+	if largest == 0 {
+		return nil, nil
+	}
+	if lo == hi {
+		lo, hi = lo-0.5, hi+0.5
+	}
+	bins := int(math.Ceil(math.Log2(float64(largest)))) + 1
+	// Halves keep the width finite when hi-lo would overflow.
+	half := (hi/2 - lo/2) / float64(bins)
+	if math.IsInf(half, 0) || math.IsNaN(half) || half <= 0 {
+		return nil, nil
+	}
+	edges = make([]float64, bins+1)
+	for i := range edges {
+		edges[i] = clampFinite(lo + float64(i)*half*2)
+	}
+	edges[bins] = hi
+	counts = make([][]int, len(series))
+	for i, s := range series {
+		counts[i] = make([]int, bins)
+		for _, v := range s.Y {
+			b := int((v/2 - lo/2) / half)
+			if math.IsNaN(v) || b < 0 {
+				b = 0
+			}
+			if b >= bins {
+				b = bins - 1
+			}
+			counts[i][b]++
+		}
+	}
+	return edges, counts
+}
+
+// seriesLabel names a series in the legend: its column, its group, or both
+// when a grouped chart shows several columns.
+func seriesLabel(s ChartSeries, multiColumn bool) string {
+	switch {
+	case s.Group == "":
+		return s.Column
+	case multiColumn:
+		return s.Column + " / " + s.Group
+	default:
+		return s.Group
+	}
+}
+
+// drawChart lays out and draws a chart: title, legend or colour scale, axis
+// titles, then one panel per facet with its ticks, grid and series. Panels
+// share their scales so facets compare directly.
+func drawChart(c canvas, title string, data *ChartData, width, height float64) {
+	series := data.Series
+	chartType := data.ChartType
+	histogram := chartType == ChartHistogram
+	heatmap := chartType == ChartHeatmap
+	box := chartType == ChartBox
+	xLog := data.XAxis.Scale == AxisScaleLog
+	yLog := data.YAxis.Scale == AxisScaleLog
+
+	multiColumn := false
+	for _, s := range series {
+		multiColumn = multiColumn || s.Column != series[0].Column
+	}
+	var labels []string
+	slot := map[string]int{}
+	var facets []string
+	facetSeen := map[string]bool{}
+	for _, s := range series {
+		if l := seriesLabel(s, multiColumn); !heatmap {
+			if _, ok := slot[l]; !ok {
+				slot[l] = len(labels)
+				labels = append(labels, l)
+			}
+		}
+		if !facetSeen[s.Facet] {
+			facetSeen[s.Facet] = true
+			facets = append(facets, s.Facet)
+		}
+	}
+	if len(facets) == 0 {
+		facets = []string{""}
+	}
+	faceted := len(facets) > 1 || facets[0] != ""
+	colorOf := func(s ChartSeries) color.RGBA { return seriesColor(slot[seriesLabel(s, multiColumn)]) }
+	slots := math.Max(1, float64(len(labels)))
+
+	// Category axis for bar and box charts and non-numeric x values, in
+	// order of first appearance.
+	var categories []string
+	catIndex := map[string]int{}
+	addCategory := func(x string) {
+		if _, ok := catIndex[x]; !ok {
+			catIndex[x] = len(categories)
+			categories = append(categories, x)
+		}
+	}
+	categorical := chartType == ChartBar || box || (!histogram && !heatmap && !data.XNumeric)
+
+	// Data ranges, shared by every panel.
+	xLo, xHi := math.Inf(1), math.Inf(-1)
+	yLo, yHi := math.Inf(1), math.Inf(-1)
+	extendY := func(v float64) {
+		if math.IsInf(v, 0) || math.IsNaN(v) {
+			return
+		}
+		if !yLog || v > 0 {
+			yLo, yHi = math.Min(yLo, v), math.Max(yHi, v)
+		}
+	}
+	var edges []float64
+	var counts [][]int
+	var cells *HeatmapCells
+	valueLo, valueHi := math.Inf(1), math.Inf(-1)
+	points := 0
+	switch {
+	case histogram:
+		edges, counts = histogramBins(series)
+		if len(edges) > 0 {
+			xLo, xHi = edges[0], edges[len(edges)-1]
+			yLo, yHi = 0, 1
+			for i, cs := range counts {
+				points += len(series[i].Y)
+				for _, n := range cs {
+					yHi = math.Max(yHi, float64(n))
+				}
+			}
+		}
+	case box:
+		for _, s := range series {
+			for _, b := range s.Boxes {
+				points += b.N
+				addCategory(b.X)
+				extendY(b.LowerWhisker)
+				extendY(b.UpperWhisker)
+				for _, v := range b.Outliers {
+					extendY(v)
+				}
+			}
+		}
+	case heatmap:
+		for _, s := range series {
+			if s.Cells == nil {
+				continue
+			}
+			if cells == nil {
+				cells = s.Cells
+			}
+			for _, row := range s.Cells.Values {
+				for _, v := range row {
+					if v != nil {
+						points++
+						valueLo, valueHi = math.Min(valueLo, *v), math.Max(valueHi, *v)
+					}
+				}
+			}
+		}
+	default:
+		for _, s := range series {
+			for j, y := range s.Y {
+				points++
+				e := 0.0
+				if j < len(s.Error) {
+					e = s.Error[j]
+				}
+				extendY(y - e)
+				extendY(y + e)
+				if j >= len(s.X) {
+					continue
+				}
+				if categorical {
+					addCategory(fmt.Sprint(s.X[j]))
+				} else {
+					x := s.X[j].(float64)
+					xLo, xHi = math.Min(xLo, x), math.Max(xHi, x)
+				}
+			}
+		}
+	}
+	if math.IsInf(xLo, 1) {
+		xLo, xHi = 0, 1
+		if xLog {
+			xLo, xHi = 1, 10
+		}
+	}
+	if math.IsInf(yLo, 1) {
+		yLo, yHi = 0, 1
+		if yLog {
+			yLo, yHi = 1, 10
+		}
+	}
+	if !yLog && (chartType == ChartBar || chartType == ChartArea) {
+		yLo, yHi = math.Min(yLo, 0), math.Max(yHi, 0)
+	}
+
+	// Outer margins: title, legend or colour scale, axis titles.
+	top := 10.0
+	if title != "" {
+		top += titleFontSize + 14
+	}
+	right := 12.0
+	legend := len(labels) > 1
+	if legend {
+		widest := 0.0
+		for _, l := range labels {
+			widest = math.Max(widest, textWidth(truncateLabel(l, 24), labelFontSize))
+		}
+		right += widest + 30
+	}
+	var valueTicks []float64
+	var valueLabels []string
+	var valueScaleBar valueScale
+	valueTitle := ""
+	if heatmap {
+		if math.IsInf(valueLo, 1) {
+			valueLo, valueHi = 0, 1
+		}
+		// Colours span the data exactly; only ticks inside it are labelled.
+		ticks, tickLabels, _ := axisTicks(valueLo, valueHi, 4, false, 0, 1)
+		for i, v := range ticks {
+			if v >= valueLo-1e-9*math.Abs(valueLo) && v <= valueHi+1e-9*math.Abs(valueHi) {
+				valueTicks = append(valueTicks, v)
+				valueLabels = append(valueLabels, tickLabels[i])
+			}
+		}
+		valueScaleBar = valueScale{d0: valueLo, d1: valueHi}
+		widest := 0.0
+		for _, l := range valueLabels {
+			widest = math.Max(widest, textWidth(l, tickFontSize))
+		}
+		if len(series) > 0 {
+			label, unit := ParseHeaderUnit(series[0].Column)
+			valueTitle = ChartAxis{Label: label, Unit: unit}.Title()
+		}
+		right += 14 + 16 + 6 + widest + 8 + labelFontSize + 6
+	}
+	xTitle, yTitle := data.XAxis.Title(), data.YAxis.Title()
+	left, bottom := 10.0, 8.0
+	if yTitle != "" {
+		left += labelFontSize + 8
+	}
+	if xTitle != "" {
+		bottom += labelFontSize + 10
+	}
+
+	// Panel grid.
+	gridCols := int(math.Ceil(math.Sqrt(float64(len(facets)))))
+	gridRows := (len(facets) + gridCols - 1) / gridCols
+	areaX0, areaY0 := left, top
+	areaW, areaH := width-left-right, height-top-bottom
+	cellW, cellH := areaW/float64(gridCols), areaH/float64(gridRows)
+	panelTop, panelRight, panelBottom := 4.0, 10.0, tickFontSize+14.0
+	if faceted {
+		panelTop = tickFontSize + 12
+	}
+	plotH := cellH - panelTop - panelBottom
+
+	yTicks, yLabels, ys := axisTicks(yLo, yHi, int(math.Max(2, plotH/50)), yLog, 0, 1)
+	panelLeft := 0.0
+	if heatmap && cells != nil {
+		for _, r := range cells.Rows {
+			panelLeft = math.Max(panelLeft, textWidth(truncateLabel(r, 10), tickFontSize))
+		}
+	} else {
+		for _, l := range yLabels {
+			panelLeft = math.Max(panelLeft, textWidth(l, tickFontSize))
+		}
+	}
+	panelLeft += 12
+
+	if title != "" {
+		c.text(width/2, 10+titleFontSize*0.7+4, truncateLabel(title, int(width/(0.6*titleFontSize))), titleFontSize, anchorMiddle, false, inkColor)
+	}
+	if yTitle != "" {
+		c.text(10+labelFontSize*0.7, areaY0+areaH/2, truncateLabel(yTitle, int(areaH/(0.6*labelFontSize))), labelFontSize, anchorMiddle, true, inkColor)
+	}
+	if xTitle != "" {
+		c.text(areaX0+areaW/2, height-10, truncateLabel(xTitle, int(areaW/(0.6*labelFontSize))), labelFontSize, anchorMiddle, false, inkColor)
+	}
+
+	for f, facet := range facets {
+		px0 := areaX0 + float64(f%gridCols)*cellW + panelLeft
+		px1 := areaX0 + float64(f%gridCols+1)*cellW - panelRight
+		py0 := areaY0 + float64(f/gridCols)*cellH + panelTop
+		py1 := areaY0 + float64(f/gridCols+1)*cellH - panelBottom
+		var members []int
+		for i, s := range series {
+			if s.Facet == facet {
+				members = append(members, i)
+			}
+		}
+		if faceted {
+			c.text((px0+px1)/2, py0-7, truncateLabel(facet, int((px1-px0)/(0.6*tickFontSize))), tickFontSize, anchorMiddle, false, inkColor)
+		}
+		if heatmap {
+			drawHeatmapPanel(c, series, members, cells, valueScaleBar, px0, py0, px1, py1)
+			continue
+		}
+
+		ys.r0, ys.r1 = py1, py0
+		tickY := py1 + 8 + tickFontSize*0.7
+		for i, v := range yTicks {
+			y := ys.at(v)
+			c.line(px0, y, px1, y, gridColor, 1)
+			c.line(px0-4, y, px0, y, inkColor, 1)
+			c.text(px0-7, y+tickFontSize*0.35, yLabels[i], tickFontSize, anchorEnd, false, inkColor)
+		}
+
+		// X axis: category bands or a numeric scale.
+		var xs valueScale
+		band := 0.0
+		if categorical {
+			band = (px1 - px0) / math.Max(1, float64(len(categories)))
+			const maxChars = 14
+			labelW := 0.0
+			for _, cat := range categories {
+				labelW = math.Max(labelW, textWidth(truncateLabel(cat, maxChars), tickFontSize))
+			}
+			every := max(1, int(math.Ceil((labelW+8)/band)))
+			for i, cat := range categories {
+				x := px0 + band*(float64(i)+0.5)
+				c.line(x, py1, x, py1+4, inkColor, 1)
+				if i%every == 0 {
+					c.text(x, tickY, truncateLabel(cat, maxChars), tickFontSize, anchorMiddle, false, inkColor)
+				}
+			}
+		} else {
+			var xTicks []float64
+			var xLabels []string
+			xTicks, xLabels, xs = axisTicks(xLo, xHi, int(math.Max(2, (px1-px0)/90)), xLog, px0, px1)
+			if histogram && len(edges) > 0 {
+				xs.d0, xs.d1 = edges[0], edges[len(edges)-1]
+			}
+			for i, v := range xTicks {
+				x := xs.at(v)
+				if x < px0-0.5 || x > px1+0.5 {
+					continue
+				}
+				c.line(x, py1, x, py1+4, inkColor, 1)
+				c.text(x, tickY, xLabels[i], tickFontSize, anchorMiddle, false, inkColor)
+			}
+		}
+		xPos := func(s ChartSeries, j int) float64 {
+			if categorical {
+				return px0 + band*(float64(catIndex[fmt.Sprint(s.X[j])])+0.5)
+			}
+			return xs.at(s.X[j].(float64))
+		}
+		errorBar := func(x, y, e, capW float64, col color.RGBA) {
+			if e <= 0 {
+				return
+			}
+			top, bot := ys.at(y+e), ys.at(y-e)
+			c.line(x, top, x, bot, col, 1.2)
+			c.line(x-capW, top, x+capW, top, col, 1.2)
+			c.line(x-capW, bot, x+capW, bot, col, 1.2)
+		}
+		errorAt := func(s ChartSeries, j int) float64 {
+			if j < len(s.Error) {
+				return s.Error[j]
+			}
+			return 0
+		}
+		baseY := ys.at(math.Max(ys.d0, math.Min(0, ys.d1)))
+		if yLog {
+			baseY = py1
+		}
+
+		panelPoints := 0
+		for _, i := range members {
+			s := series[i]
+			col := colorOf(s)
+			slotIdx := float64(slot[seriesLabel(s, multiColumn)])
+			panelPoints += len(s.Y) + len(s.Boxes)
+			switch chartType {
+			case ChartHistogram:
+				fill := col
+				if len(labels) > 1 {
+					fill = withAlpha(col, 0x8c)
+				}
+				for b, n := range counts[i] {
+					if n == 0 {
+						continue
+					}
+					bx0, bx1 := xs.at(edges[b]), xs.at(edges[b+1])
+					by := ys.at(float64(n))
+					c.rect(bx0+0.5, by, bx1-bx0-1, baseY-by, fill)
+				}
+			case ChartBar:
+				groupW := band * 0.8
+				barW := groupW / slots
+				for j, y := range s.Y {
+					x := xPos(s, j) - groupW/2 + barW*slotIdx
+					by := ys.at(y)
+					c.rect(x, math.Min(by, baseY), barW, math.Abs(baseY-by), col)
+					errorBar(x+barW/2, y, errorAt(s, j), math.Min(barW/4, 6), inkColor)
+				}
+			case ChartBox:
+				groupW := band * 0.8
+				slotW := groupW / slots
+				boxW := slotW * 0.7
+				for _, b := range s.Boxes {
+					cx := px0 + band*(float64(catIndex[b.X])+0.5) - groupW/2 + slotW*(slotIdx+0.5)
+					c.line(cx, ys.at(b.LowerWhisker), cx, ys.at(b.UpperWhisker), inkColor, 1)
+					c.line(cx-boxW/4, ys.at(b.LowerWhisker), cx+boxW/4, ys.at(b.LowerWhisker), inkColor, 1)
+					c.line(cx-boxW/4, ys.at(b.UpperWhisker), cx+boxW/4, ys.at(b.UpperWhisker), inkColor, 1)
+					q1, q3 := ys.at(b.Q1), ys.at(b.Q3)
+					c.rect(cx-boxW/2, q3, boxW, q1-q3, withAlpha(col, 0xb3))
+					c.polyline([]point{{cx - boxW/2, q3}, {cx + boxW/2, q3}, {cx + boxW/2, q1}, {cx - boxW/2, q1}, {cx - boxW/2, q3}}, col, 1)
+					c.line(cx-boxW/2, ys.at(b.Median), cx+boxW/2, ys.at(b.Median), inkColor, 2)
+					for _, v := range b.Outliers {
+						c.circle(cx, ys.at(v), 2.5, col)
+					}
+				}
+			default:
+				pts := make([]point, 0, len(s.Y))
+				for j, y := range s.Y {
+					if j < len(s.X) {
+						pts = append(pts, point{xPos(s, j), ys.at(y)})
+					}
+				}
+				switch chartType {
+				case ChartArea:
+					if len(pts) > 1 {
+						poly := append([]point{{pts[0].x, baseY}}, pts...)
+						poly = append(poly, point{pts[len(pts)-1].x, baseY})
+						c.polygon(poly, withAlpha(col, 0x4d))
+					}
+					c.polyline(pts, col, 2)
+				case ChartLine:
+					c.polyline(pts, col, 2)
+					if len(pts) <= 60 {
+						for _, p := range pts {
+							c.circle(p.x, p.y, 2.5, col)
+						}
+					}
+				default:
+					for _, p := range pts {
+						c.circle(p.x, p.y, 3.5, withAlpha(col, 0xcc))
+					}
+				}
+				for j, y := range s.Y {
+					if j < len(pts) {
+						errorBar(pts[j].x, y, errorAt(s, j), 4, col)
+					}
+				}
+			}
+		}
+
+		// Axes over the data.
+		c.line(px0, py1, px1, py1, inkColor, 1)
+		c.line(px0, py0, px0, py1, inkColor, 1)
+		if panelPoints == 0 {
+			c.text((px0+px1)/2, (py0+py1)/2, "No data", labelFontSize, anchorMiddle, false, inkColor)
+		}
+	}
+
+	if legend {
+		lx := areaX0 + areaW + 14
+		for i, l := range labels {
+			ly := areaY0 + 4 + float64(i)*(labelFontSize+8)
+			c.rect(lx, ly, 12, 12, seriesColor(i))
+			c.text(lx+18, ly+6+labelFontSize*0.35, truncateLabel(l, 24), labelFontSize, anchorStart, false, inkColor)
+		}
+	}
+	if heatmap {
+		// Colour scale beside the panels.
+		bx := areaX0 + areaW + 14
+		by0, by1 := areaY0+panelTop, areaY0+areaH-panelBottom
+		const steps = 64
+		for k := 0; k < steps; k++ {
+			y := by1 - (by1-by0)*float64(k+1)/steps
+			c.rect(bx, y, 16, (by1-by0)/steps+0.5, viridis((float64(k)+0.5)/steps))
+		}
+		widest := 0.0
+		for i, v := range valueTicks {
+			t := 0.5
+			if valueScaleBar.d1 != valueScaleBar.d0 {
+				t = (v - valueScaleBar.d0) / (valueScaleBar.d1 - valueScaleBar.d0)
+			}
+			y := by1 - (by1-by0)*t
+			c.line(bx+16, y, bx+20, y, inkColor, 1)
+			c.text(bx+23, y+tickFontSize*0.35, valueLabels[i], tickFontSize, anchorStart, false, inkColor)
+			widest = math.Max(widest, textWidth(valueLabels[i], tickFontSize))
+		}
+		if valueTitle != "" {
+			c.text(bx+23+widest+8+labelFontSize*0.7, (by0+by1)/2, truncateLabel(valueTitle, int((by1-by0)/(0.6*labelFontSize))), labelFontSize, anchorMiddle, true, inkColor)
+		}
+	}
+}
+
+// drawHeatmapPanel draws the cells of one facet: columns left to right,
+// rows top to bottom, each coloured on the shared scale and labelled with
+// its value when there is room.
+func drawHeatmapPanel(c canvas, series []ChartSeries, members []int, grid *HeatmapCells, scale valueScale, x0, y0, x1, y1 float64) {
+	if grid == nil || len(grid.Columns) == 0 || len(grid.Rows) == 0 {
+		c.text((x0+x1)/2, (y0+y1)/2, "No data", labelFontSize, anchorMiddle, false, inkColor)
+		return
+	}
+	var cells *HeatmapCells
+	for _, i := range members {
+		if series[i].Cells != nil {
+			cells = series[i].Cells
+		}
+	}
+	cw := (x1 - x0) / float64(len(grid.Columns))
+	ch := (y1 - y0) / float64(len(grid.Rows))
+	every := max(1, int(math.Ceil((textWidth("000", tickFontSize)+6)/cw)))
+	for j, col := range grid.Columns {
+		if j%every == 0 {
+			c.text(x0+cw*(float64(j)+0.5), y1+8+tickFontSize*0.7, truncateLabel(col, 6), tickFontSize, anchorMiddle, false, inkColor)
+		}
+	}
+	rowEvery := max(1, int(math.Ceil((tickFontSize+2)/ch)))
+	for i, row := range grid.Rows {
+		if i%rowEvery == 0 {
+			c.text(x0-6, y0+ch*(float64(i)+0.5)+tickFontSize*0.35, truncateLabel(row, 10), tickFontSize, anchorEnd, false, inkColor)
+		}
+	}
+	const valueFont = 10
+	for i := range grid.Rows {
+		for j := range grid.Columns {
+			x, y := x0+cw*float64(j), y0+ch*float64(i)
+			var v *float64
+			if cells != nil && i < len(cells.Values) && j < len(cells.Values[i]) {
+				v = cells.Values[i][j]
+			}
+			if v == nil {
+				c.rect(x+0.5, y+0.5, cw-1, ch-1, gridColor)
+				continue
+			}
+			t := 0.5
+			if scale.d1 != scale.d0 {
+				t = (*v - scale.d0) / (scale.d1 - scale.d0)
+			}
+			c.rect(x+0.5, y+0.5, cw-1, ch-1, viridis(t))
+			label := strconv.FormatFloat(*v, 'g', 3, 64)
+			if textWidth(label, valueFont)+4 <= cw && ch >= valueFont+4 {
+				ink := color.RGBA{0xff, 0xff, 0xff, 0xff}
+				if t > 0.6 {
+					ink = inkColor
+				}
+				c.text(x+cw/2, y+ch/2+valueFont*0.35, label, valueFont, anchorMiddle, false, ink)
+			}
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package datavis
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+const (
+	// rowChunkSize is how many parsed rows are stored per data_extract_chunks
+	// row.
+	rowChunkSize       = 1000
+	sampleRowCount     = 100
+	defaultRowPageSize = 100
+	maxRowPageSize     = 1000
+)
+
+type ExtractRowsInput struct {
+	DataExtractID string
+	UserID        string
+	Role          string
+	Offset        int
+	Limit         int
+}
+
+// ExtractRows is one page of an extract's parsed table. Complete is false
+// for extracts parsed before full rows were stored; only their sample rows
+// can be paged.
+type ExtractRows struct {
+	DataExtractID string     `json:"dataExtractId"`
+	ColumnHeaders []string   `json:"columnHeaders"`
+	Offset        int        `json:"offset"`
+	Limit         int        `json:"limit"`
+	TotalRows     int        `json:"totalRows"`
+	Complete      bool       `json:"complete"`
+	Rows          [][]string `json:"rows"`
+}
+
+// extractInfo is the access-checked header of an extract.
+type extractInfo struct {
+	id           string
+	experimentID string
+	headers      []string
+	rowCount     int
+	rowsStored   bool
+	sampleRows   [][]string
+}
+
+func (s *Service) loadExtractInfo(ctx context.Context, extractID, userID, role string) (*extractInfo, error) {
+	var (
+		info                    extractInfo
+		headersJSON, sampleJSON []byte
+	)
+	err := s.db.QueryRowContext(ctx,
+		`SELECT de.id, de.experiment_id, de.column_headers, de.row_count, de.rows_stored, de.sample_rows
+		 FROM data_extracts de
+		 JOIN experiments e ON e.id = de.experiment_id
+		 WHERE de.id = $1 AND (e.owner_user_id = $2 OR ($3 = 'admin' AND e.status = 'completed'))`,
+		extractID, userID, role,
+	).Scan(&info.id, &info.experimentID, &headersJSON, &info.rowCount, &info.rowsStored, &sampleJSON)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("query data extract: %w", err)
+	}
+	if err := json.Unmarshal(headersJSON, &info.headers); err != nil {
+		return nil, fmt.Errorf("decode column headers: %w", err)
+	}
+	if err := json.Unmarshal(sampleJSON, &info.sampleRows); err != nil {
+		return nil, fmt.Errorf("decode sample rows: %w", err)
+	}
+	return &info, nil
+}
+
+// storeRowChunks writes the full parsed table in rowChunkSize chunks.
+func storeRowChunks(ctx context.Context, tx *sql.Tx, extractID string, rows [][]string) error {
+	for chunk, start := 0, 0; start < len(rows); chunk, start = chunk+1, start+rowChunkSize {
+		end := start + rowChunkSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+		rowsJSON, err := json.Marshal(rows[start:end])
+		if err != nil {
+			return fmt.Errorf("encode row chunk %d: %w", chunk, err)
+		}
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO data_extract_chunks (data_extract_id, chunk_index, start_row, row_count, rows)
+			 VALUES ($1, $2, $3, $4, $5)`,
+			extractID, chunk, start, end-start, rowsJSON,
+		); err != nil {
+			return fmt.Errorf("insert row chunk %d: %w", chunk, err)
+		}
+	}
+	return nil
+}
+
+// GetExtractRows returns a page of the extract's rows.
+func (s *Service) GetExtractRows(ctx context.Context, in ExtractRowsInput) (*ExtractRows, error) {
+	if in.Offset < 0 {
+		return nil, fmt.Errorf("%w: offset must not be negative", ErrInvalidInput)
+	}
+	if in.Limit <= 0 {
+		in.Limit = defaultRowPageSize
+	}
+	if in.Limit > maxRowPageSize {
+		return nil, fmt.Errorf("%w: limit must be at most %d", ErrInvalidInput, maxRowPageSize)
+	}
+
+	info, err := s.loadExtractInfo(ctx, in.DataExtractID, in.UserID, in.Role)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &ExtractRows{
+		DataExtractID: info.id,
+		ColumnHeaders: info.headers,
+		Offset:        in.Offset,
+		Limit:         in.Limit,
+		TotalRows:     info.rowCount,
+		Complete:      info.rowsStored,
+		Rows:          [][]string{},
+	}
+	if !info.rowsStored {
+		out.TotalRows = len(info.sampleRows)
+		if in.Offset < len(info.sampleRows) {
+			end := in.Offset + in.Limit
+			if end > len(info.sampleRows) {
+				end = len(info.sampleRows)
+			}
+			out.Rows = info.sampleRows[in.Offset:end]
+		}
+		return out, nil
+	}
+
+	end := in.Offset + in.Limit
+	err = s.scanRowChunks(ctx, info.id, in.Offset, end, func(index int, row []string) {
+		if index >= in.Offset && index < end {
+			out.Rows = append(out.Rows, row)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// scanRowChunks calls fn for every stored row in the chunks overlapping
+// [from, to); a negative to reads every chunk.
+func (s *Service) scanRowChunks(ctx context.Context, extractID string, from, to int, fn func(index int, row []string)) error {
+	query := `SELECT start_row, rows FROM data_extract_chunks
+		 WHERE data_extract_id = $1 AND start_row + row_count > $2`
+	args := []any{extractID, from}
+	if to >= 0 {
+		query += ` AND start_row < $3`
+		args = append(args, to)
+	}
+	query += ` ORDER BY chunk_index`
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("query row chunks: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			start     int
+			chunkJSON []byte
+			chunk     [][]string
+		)
+		if err := rows.Scan(&start, &chunkJSON); err != nil {
+			return fmt.Errorf("scan row chunk: %w", err)
+		}
+		if err := json.Unmarshal(chunkJSON, &chunk); err != nil {
+			return fmt.Errorf("decode row chunk: %w", err)
+		}
+		for i, row := range chunk {
+			fn(start+i, row)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iterate row chunks: %w", err)
+	}
+	return nil
+}
+
+// loadAllRows returns every row of the extract. complete is false when only
+// the sample of a legacy extract is available.
+func (s *Service) loadAllRows(ctx context.Context, info *extractInfo) (rows [][]string, complete bool, err error) {
+	if !info.rowsStored {
+		return info.sampleRows, len(info.sampleRows) >= info.rowCount, nil
+	}
+	rows = make([][]string, 0, info.rowCount)
+	err = s.scanRowChunks(ctx, info.id, 0, -1, func(_ int, row []string) {
+		rows = append(rows, row)
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return rows, true, nil
+}
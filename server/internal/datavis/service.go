@@ -1,15 +1,12 @@
 package datavis
 
 import (
-	"bytes"
 	"context"
 	"database/sql"
-	"encoding/csv"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"strings"
 	"time"
 
 	internaldb "github.com/mjhen/elnote/server/internal/db"
@@ -26,27 +23,42 @@ var (
 // Types
 // ---------------------------------------------------------------------------
 
+// DataExtract is a parsed table. SampleRows holds the first rows; when
+// RowsStored is set every row is stored and can be paged with
+// GetExtractRows (older extracts only kept the sample). Columns carries the
+// inferred type, unit and statistics of each column and is only populated
+// for a single extract.
 type DataExtract struct {
-	ID            string     `json:"dataExtractId"`
-	AttachmentID  string     `json:"attachmentId"`
-	ExperimentID  string     `json:"experimentId"`
-	ColumnHeaders []string   `json:"columnHeaders"`
-	RowCount      int        `json:"rowCount"`
-	SampleRows    [][]string `json:"sampleRows"`
-	ParsedAt      time.Time  `json:"parsedAt"`
+	ID            string          `json:"dataExtractId"`
+	AttachmentID  string          `json:"attachmentId"`
+	ExperimentID  string          `json:"experimentId"`
+	ColumnHeaders []string        `json:"columnHeaders"`
+	Columns       []ColumnProfile `json:"columns,omitempty"`
+	RowCount      int             `json:"rowCount"`
+	SampleRows    [][]string      `json:"sampleRows"`
+	RowsStored    bool            `json:"rowsStored"`
+	SourceFormat  string          `json:"sourceFormat"`
+	SheetName     string          `json:"sheetName,omitempty"`
+	HeaderRow     int             `json:"headerRow"`
+	PlateFormat   int             `json:"plateFormat,omitempty"`
+	PlateLayoutID string          `json:"plateLayoutId,omitempty"`
+	ParsedAt      time.Time       `json:"parsedAt"`
 }
 
+// ChartConfig is a stored chart. Options repeats Spec under the name it
+// had before specs were typed, for clients that still read it.
 type ChartConfig struct {
-	ID            string         `json:"chartConfigId"`
-	ExperimentID  string         `json:"experimentId"`
-	DataExtractID string         `json:"dataExtractId"`
-	CreatorUserID string         `json:"creatorUserId"`
-	ChartType     string         `json:"chartType"`
-	Title         string         `json:"title"`
-	XColumn       string         `json:"xColumn"`
-	YColumns      []string       `json:"yColumns"`
-	Options       map[string]any `json:"options"`
-	CreatedAt     time.Time      `json:"createdAt"`
+	ID            string    `json:"chartConfigId"`
+	ExperimentID  string    `json:"experimentId"`
+	DataExtractID string    `json:"dataExtractId"`
+	CreatorUserID string    `json:"creatorUserId"`
+	ChartType     string    `json:"chartType"`
+	Title         string    `json:"title"`
+	XColumn       string    `json:"xColumn"`
+	YColumns      []string  `json:"yColumns"`
+	Spec          ChartSpec `json:"spec"`
+	Options       ChartSpec `json:"options"`
+	CreatedAt     time.Time `json:"createdAt"`
 }
 
 type ParseCSVInput struct {
@@ -65,7 +77,7 @@ type CreateChartInput struct {
 	Title         string
 	XColumn       string
 	YColumns      []string
-	Options       map[string]any
+	Spec          ChartSpec
 }
 
 type CreateChartOutput struct {
@@ -84,100 +96,55 @@ type DataPreviewInput struct {
 // Service
 // ---------------------------------------------------------------------------
 
+// ObjectReader streams stored attachment objects. The attachments object
+// store inspector satisfies it.
+type ObjectReader interface {
+	Open(ctx context.Context, objectKey string) (io.ReadCloser, error)
+}
+
 type Service struct {
-	db   *sql.DB
-	sync *syncer.Service
+	db             *sql.DB
+	sync           *syncer.Service
+	objects        ObjectReader
+	maxSourceBytes int64
 }
 
-func NewService(db *sql.DB, syncService *syncer.Service) *Service {
-	return &Service{db: db, sync: syncService}
+func NewService(db *sql.DB, syncService *syncer.Service, objects ObjectReader, maxSourceBytes int64) *Service {
+	return &Service{db: db, sync: syncService, objects: objects, maxSourceBytes: maxSourceBytes}
 }
 
-// ParseCSV parses CSV data from an attachment and stores the extract.
+// ParseCSV parses delimited text from an attachment and stores the
+// extract. Comma, tab and semicolon delimiters and preamble lines above the
+// header are detected; see ParseTable.
 func (s *Service) ParseCSV(ctx context.Context, in ParseCSVInput) (*DataExtract, error) {
-	reader := csv.NewReader(bytes.NewReader(in.CSVData))
-	reader.TrimLeadingSpace = true
-
-	// Read headers
-	headers, err := reader.Read()
+	extracts, err := s.ParseTable(ctx, ParseInput{
+		AttachmentID: in.AttachmentID,
+		ExperimentID: in.ExperimentID,
+		ActorUserID:  in.ActorUserID,
+		Data:         in.CSVData,
+		Format:       SourceFormatCSV,
+	})
 	if err != nil {
-		return nil, fmt.Errorf("%w: cannot read CSV headers: %v", ErrInvalidInput, err)
-	}
-
-	// Read all rows
-	var allRows [][]string
-	for {
-		record, err := reader.Read()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return nil, fmt.Errorf("%w: CSV parse error: %v", ErrInvalidInput, err)
-		}
-		allRows = append(allRows, record)
-	}
-
-	// Keep sample of first 100 rows
-	sampleRows := allRows
-	if len(sampleRows) > 100 {
-		sampleRows = sampleRows[:100]
-	}
-
-	headersJSON, _ := json.Marshal(headers)
-	sampleJSON, _ := json.Marshal(sampleRows)
-
-	tx, err := s.db.BeginTx(ctx, nil)
-	if err != nil {
-		return nil, fmt.Errorf("begin tx: %w", err)
-	}
-	defer tx.Rollback()
-
-	// attachment_id is nullable — pass nil when no attachment is associated
-	var attachParam any
-	if in.AttachmentID != "" {
-		attachParam = in.AttachmentID
-	}
-
-	var extract DataExtract
-	var nullableAttachID sql.NullString
-	err = tx.QueryRowContext(ctx,
-		`INSERT INTO data_extracts (attachment_id, experiment_id, column_headers, row_count, sample_rows)
-		 VALUES ($1, $2, $3, $4, $5)
-		 RETURNING id, COALESCE(attachment_id::text,''), experiment_id, row_count, parsed_at`,
-		attachParam, in.ExperimentID, headersJSON, len(allRows), sampleJSON,
-	).Scan(&extract.ID, &nullableAttachID, &extract.ExperimentID, &extract.RowCount, &extract.ParsedAt)
-	if err != nil {
-		return nil, fmt.Errorf("insert data extract: %w", err)
-	}
-	extract.AttachmentID = nullableAttachID.String
-	extract.ColumnHeaders = headers
-	extract.SampleRows = sampleRows
-
-	if err := internaldb.AppendAuditEvent(ctx, tx, in.ActorUserID, "data.extract_created", "attachment", in.AttachmentID, map[string]any{
-		"dataExtractId": extract.ID,
-		"attachmentId":  in.AttachmentID,
-	}); err != nil {
-		return nil, fmt.Errorf("append data.extract_created audit event: %w", err)
+		return nil, err
 	}
-
-	if err := tx.Commit(); err != nil {
-		return nil, fmt.Errorf("commit: %w", err)
-	}
-
-	return &extract, nil
+	return &extracts[0], nil
 }
 
 func (s *Service) GetDataExtract(ctx context.Context, extractID, userID, role string) (*DataExtract, error) {
 	var extract DataExtract
-	var headersJSON, sampleJSON []byte
+	var headersJSON, sampleJSON, profilesJSON []byte
 	var nullAttach sql.NullString
 	err := s.db.QueryRowContext(ctx,
-		`SELECT de.id, COALESCE(de.attachment_id::text,''), de.experiment_id, de.column_headers, de.row_count, de.sample_rows, de.parsed_at
+		`SELECT de.id, COALESCE(de.attachment_id::text,''), de.experiment_id, de.column_headers, de.row_count, de.sample_rows, de.rows_stored, de.column_profiles,
+			de.source_format, COALESCE(de.sheet_name, ''), de.header_row,
+			COALESCE(de.plate_format, 0), COALESCE(de.plate_layout_id::text, ''), de.parsed_at
 		 FROM data_extracts de
 		 JOIN experiments e ON e.id = de.experiment_id
 		 WHERE de.id = $1 AND (e.owner_user_id = $2 OR ($3 = 'admin' AND e.status = 'completed'))`,
 		extractID, userID, role,
-	).Scan(&extract.ID, &nullAttach, &extract.ExperimentID, &headersJSON, &extract.RowCount, &sampleJSON, &extract.ParsedAt)
+	).Scan(&extract.ID, &nullAttach, &extract.ExperimentID, &headersJSON, &extract.RowCount, &sampleJSON, &extract.RowsStored, &profilesJSON,
+		&extract.SourceFormat, &extract.SheetName, &extract.HeaderRow,
+		&extract.PlateFormat, &extract.PlateLayoutID, &extract.ParsedAt)
 	extract.AttachmentID = nullAttach.String
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -188,13 +155,52 @@ func (s *Service) GetDataExtract(ctx context.Context, extractID, userID, role st
 
 	json.Unmarshal(headersJSON, &extract.ColumnHeaders)
 	json.Unmarshal(sampleJSON, &extract.SampleRows)
+	if err := json.Unmarshal(profilesJSON, &extract.Columns); err != nil {
+		return nil, fmt.Errorf("decode column profiles: %w", err)
+	}
+	if len(extract.Columns) == 0 && len(extract.ColumnHeaders) > 0 {
+		// Parsed before profiling existed; profile whatever rows are stored,
+		// once, and keep the result for later reads.
+		rows := extract.SampleRows
+		if extract.RowsStored {
+			rows = nil
+			if err := s.scanRowChunks(ctx, extract.ID, 0, -1, func(_ int, row []string) {
+				rows = append(rows, row)
+			}); err != nil {
+				return nil, err
+			}
+		}
+		extract.Columns = profileColumns(extract.ColumnHeaders, rows)
+		if err := s.storeColumnProfiles(ctx, extract.ID, extract.Columns); err != nil {
+			return nil, err
+		}
+	}
 
 	return &extract, nil
 }
 
+// storeColumnProfiles saves profiles computed for an extract parsed before
+// profiling existed. A concurrent read may have stored them already; both
+// computed the same profiles from the same rows.
+func (s *Service) storeColumnProfiles(ctx context.Context, extractID string, columns []ColumnProfile) error {
+	profilesJSON, err := json.Marshal(columns)
+	if err != nil {
+		return fmt.Errorf("encode column profiles: %w", err)
+	}
+	if _, err := s.db.ExecContext(ctx,
+		`UPDATE data_extracts SET column_profiles = $2::jsonb WHERE id = $1 AND column_profiles = '[]'::jsonb`,
+		extractID, string(profilesJSON),
+	); err != nil {
+		return fmt.Errorf("store column profiles: %w", err)
+	}
+	return nil
+}
+
 func (s *Service) ListDataExtracts(ctx context.Context, experimentID, userID, role string) ([]DataExtract, error) {
 	rows, err := s.db.QueryContext(ctx,
-		`SELECT de.id, COALESCE(de.attachment_id::text,''), de.experiment_id, de.column_headers, de.row_count, de.parsed_at
+		`SELECT de.id, COALESCE(de.attachment_id::text,''), de.experiment_id, de.column_headers, de.row_count, de.rows_stored,
+			de.source_format, COALESCE(de.sheet_name, ''), de.header_row,
+			COALESCE(de.plate_format, 0), COALESCE(de.plate_layout_id::text, ''), de.parsed_at
 		 FROM data_extracts de
 		 JOIN experiments e ON e.id = de.experiment_id
 		 WHERE de.experiment_id = $1 AND (e.owner_user_id = $2 OR ($3 = 'admin' AND e.status = 'completed'))
@@ -211,7 +217,9 @@ func (s *Service) ListDataExtracts(ctx context.Context, experimentID, userID, ro
 		var de DataExtract
 		var headersJSON []byte
 		var nullAttach sql.NullString
-		if err := rows.Scan(&de.ID, &nullAttach, &de.ExperimentID, &headersJSON, &de.RowCount, &de.ParsedAt); err != nil {
+		if err := rows.Scan(&de.ID, &nullAttach, &de.ExperimentID, &headersJSON, &de.RowCount, &de.RowsStored,
+			&de.SourceFormat, &de.SheetName, &de.HeaderRow,
+			&de.PlateFormat, &de.PlateLayoutID, &de.ParsedAt); err != nil {
 			return nil, fmt.Errorf("scan extract: %w", err)
 		}
 		de.AttachmentID = nullAttach.String
@@ -225,17 +233,6 @@ func (s *Service) ListDataExtracts(ctx context.Context, experimentID, userID, ro
 }
 
 func (s *Service) CreateChartConfig(ctx context.Context, in CreateChartInput) (*CreateChartOutput, error) {
-	validTypes := map[string]bool{"line": true, "scatter": true, "bar": true, "histogram": true, "area": true}
-	if !validTypes[in.ChartType] {
-		return nil, fmt.Errorf("%w: chartType must be line, scatter, bar, histogram, or area", ErrInvalidInput)
-	}
-	if strings.TrimSpace(in.XColumn) == "" {
-		return nil, fmt.Errorf("%w: xColumn is required", ErrInvalidInput)
-	}
-	if len(in.YColumns) == 0 {
-		return nil, fmt.Errorf("%w: at least one yColumn is required", ErrInvalidInput)
-	}
-
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return nil, fmt.Errorf("begin tx: %w", err)
@@ -257,11 +254,23 @@ func (s *Service) CreateChartConfig(ctx context.Context, in CreateChartInput) (*
 		return nil, ErrForbidden
 	}
 
-	yColumnsJSON, _ := json.Marshal(in.YColumns)
-	optionsJSON, _ := json.Marshal(in.Options)
-	if in.Options == nil {
-		optionsJSON = []byte("{}")
+	// The spec is checked against the inferred column types of the extract.
+	extract, err := s.GetDataExtract(ctx, in.DataExtractID, in.CreatorUserID, "")
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, fmt.Errorf("%w: data extract not found", ErrInvalidInput)
+		}
+		return nil, err
+	}
+	if extract.ExperimentID != in.ExperimentID {
+		return nil, fmt.Errorf("%w: data extract belongs to another experiment", ErrInvalidInput)
 	}
+	if err := validateChart(in.ChartType, in.XColumn, in.YColumns, &in.Spec, extract.ColumnHeaders, extract.Columns); err != nil {
+		return nil, err
+	}
+
+	yColumnsJSON, _ := json.Marshal(in.YColumns)
+	optionsJSON, _ := json.Marshal(in.Spec)
 
 	var chartID string
 	var createdAt time.Time
@@ -330,7 +339,8 @@ func (s *Service) ListChartConfigs(ctx context.Context, experimentID, userID, ro
 			return nil, fmt.Errorf("scan chart config: %w", err)
 		}
 		json.Unmarshal(yColumnsJSON, &cc.YColumns)
-		json.Unmarshal(optionsJSON, &cc.Options)
+		json.Unmarshal(optionsJSON, &cc.Spec)
+		cc.Options = cc.Spec
 		configs = append(configs, cc)
 	}
 	if configs == nil {
@@ -358,6 +368,7 @@ func (s *Service) GetChartConfig(ctx context.Context, chartID, userID, role stri
 		return nil, fmt.Errorf("query chart: %w", err)
 	}
 	json.Unmarshal(yColumnsJSON, &cc.YColumns)
-	json.Unmarshal(optionsJSON, &cc.Options)
+	json.Unmarshal(optionsJSON, &cc.Spec)
+	cc.Options = cc.Spec
 	return &cc, nil
 }
@@ -0,0 +1,333 @@
+package datavis
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Numerical routines behind the analysis API: least-squares fits, the
+// four-parameter logistic model and Student's t distribution.
+
+const (
+	lmMaxIterations = 200
+	lmTolerance     = 1e-10
+)
+
+var errFitFailed = errors.New("fit did not converge")
+
+func mean(v []float64) float64 {
+	var sum float64
+	for _, x := range v {
+		sum += x
+	}
+	return sum / float64(len(v))
+}
+
+// sampleSD is the n-1 standard deviation; zero for fewer than two values.
+func sampleSD(v []float64) float64 {
+	if len(v) < 2 {
+		return 0
+	}
+	m := mean(v)
+	var sq float64
+	for _, x := range v {
+		sq += (x - m) * (x - m)
+	}
+	return math.Sqrt(sq / float64(len(v)-1))
+}
+
+// rSquared is the coefficient of determination of predictions yhat.
+func rSquared(y, yhat []float64) float64 {
+	m := mean(y)
+	var ssRes, ssTot float64
+	for i := range y {
+		ssRes += (y[i] - yhat[i]) * (y[i] - yhat[i])
+		ssTot += (y[i] - m) * (y[i] - m)
+	}
+	if ssTot == 0 {
+		if ssRes == 0 {
+			return 1
+		}
+		return 0
+	}
+	return 1 - ssRes/ssTot
+}
+
+// residualSD is sqrt(SSres / (n - params)).
+func residualSD(y, yhat []float64, params int) float64 {
+	dof := len(y) - params
+	if dof <= 0 {
+		return 0
+	}
+	var ss float64
+	for i := range y {
+		ss += (y[i] - yhat[i]) * (y[i] - yhat[i])
+	}
+	return math.Sqrt(ss / float64(dof))
+}
+
+// linearFit returns the ordinary least-squares slope and intercept.
+func linearFit(x, y []float64) (slope, intercept float64, err error) {
+	mx, my := mean(x), mean(y)
+	var sxx, sxy float64
+	for i := range x {
+		sxx += (x[i] - mx) * (x[i] - mx)
+		sxy += (x[i] - mx) * (y[i] - my)
+	}
+	if sxx == 0 {
+		return 0, 0, errors.New("x values are all equal")
+	}
+	slope = sxy / sxx
+	return slope, my - slope*mx, nil
+}
+
+// logistic4PL evaluates y = D + (A - D) / (1 + (x/C)^B) with p = [A, B, C, D]:
+// A is the response at zero dose, D the response at infinite dose, C the
+// inflection point (EC50) and B the Hill slope.
+func logistic4PL(p [4]float64, x float64) float64 {
+	a, b, c, d := p[0], p[1], p[2], p[3]
+	if x <= 0 {
+		if b > 0 {
+			return a
+		}
+		return d
+	}
+	return d + (a-d)/(1+math.Pow(x/c, b))
+}
+
+// inverse4PL returns the dose producing response y, or false when y is not
+// strictly between the asymptotes.
+func inverse4PL(p [4]float64, y float64) (float64, bool) {
+	a, b, c, d := p[0], p[1], p[2], p[3]
+	if y == d || b == 0 {
+		return 0, false
+	}
+	ratio := (a-d)/(y-d) - 1
+	if ratio <= 0 {
+		return 0, false
+	}
+	x := c * math.Pow(ratio, 1/b)
+	if math.IsNaN(x) || math.IsInf(x, 0) {
+		return 0, false
+	}
+	return x, true
+}
+
+// fit4PL fits the four-parameter logistic model by Levenberg–Marquardt. C
+// is optimized on a log scale so it stays positive. It returns the number of
+// iterations used, and errFitFailed when lmMaxIterations pass without the
+// improvement falling below lmTolerance.
+func fit4PL(x, y []float64) ([4]float64, int, error) {
+	// Starting values: asymptotes from the responses at the lowest and
+	// highest dose, EC50 at the dose closest to the midpoint response.
+	order := make([]int, len(x))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool { return x[order[i]] < x[order[j]] })
+	a0, d0 := y[order[0]], y[order[len(order)-1]]
+	mid := (a0 + d0) / 2
+	c0 := 0.0
+	best := math.Inf(1)
+	for _, i := range order {
+		if x[i] > 0 && math.Abs(y[i]-mid) < best {
+			best, c0 = math.Abs(y[i]-mid), x[i]
+		}
+	}
+	if c0 <= 0 {
+		return [4]float64{}, 0, errors.New("at least one positive dose is required")
+	}
+
+	// Parameters being optimized: A, B, log C, D.
+	q := [4]float64{a0, 1, math.Log(c0), d0}
+	model := func(q [4]float64, xv float64) float64 {
+		return logistic4PL([4]float64{q[0], q[1], math.Exp(q[2]), q[3]}, xv)
+	}
+	sse := func(q [4]float64) float64 {
+		var s float64
+		for i := range x {
+			r := y[i] - model(q, x[i])
+			s += r * r
+		}
+		return s
+	}
+
+	lambda := 1e-3
+	cur := sse(q)
+	iter := 0
+	for ; iter < lmMaxIterations; iter++ {
+		// Numerical Jacobian and the normal equations J^T J and J^T r.
+		var jtj [4][4]float64
+		var jtr [4]float64
+		for i := range x {
+			r := y[i] - model(q, x[i])
+			var grad [4]float64
+			for k := 0; k < 4; k++ {
+				h := 1e-6 * math.Max(1, math.Abs(q[k]))
+				qp, qm := q, q
+				qp[k] += h
+				qm[k] -= h
+				grad[k] = (model(qp, x[i]) - model(qm, x[i])) / (2 * h)
+			}
+			for k := 0; k < 4; k++ {
+				jtr[k] += grad[k] * r
+				for l := 0; l < 4; l++ {
+					jtj[k][l] += grad[k] * grad[l]
+				}
+			}
+		}
+
+		improved := false
+		for attempt := 0; attempt < 20; attempt++ {
+			m := jtj
+			for k := 0; k < 4; k++ {
+				m[k][k] += lambda * math.Max(jtj[k][k], 1e-12)
+			}
+			step, ok := solve4(m, jtr)
+			if !ok {
+				lambda *= 10
+				continue
+			}
+			next := q
+			for k := range next {
+				next[k] += step[k]
+			}
+			if s := sse(next); s < cur && !math.IsNaN(s) {
+				converged := (cur-s)/math.Max(cur, 1e-300) < lmTolerance
+				q, cur = next, s
+				lambda = math.Max(lambda/10, 1e-12)
+				improved = true
+				if converged {
+					return [4]float64{q[0], q[1], math.Exp(q[2]), q[3]}, iter + 1, nil
+				}
+				break
+			}
+			lambda *= 10
+		}
+		if !improved {
+			// No step reduces the error: q is at a minimum.
+			break
+		}
+	}
+	if iter == lmMaxIterations {
+		return [4]float64{}, iter, fmt.Errorf("%w after %d iterations", errFitFailed, iter)
+	}
+	p := [4]float64{q[0], q[1], math.Exp(q[2]), q[3]}
+	for _, v := range p {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return p, iter, errFitFailed
+		}
+	}
+	return p, iter, nil
+}
+
+// solve4 solves m·x = b by Gaussian elimination with partial pivoting.
+func solve4(m [4][4]float64, b [4]float64) ([4]float64, bool) {
+	for col := 0; col < 4; col++ {
+		pivot := col
+		for r := col + 1; r < 4; r++ {
+			if math.Abs(m[r][col]) > math.Abs(m[pivot][col]) {
+				pivot = r
+			}
+		}
+		if math.Abs(m[pivot][col]) < 1e-300 {
+			return b, false
+		}
+		m[col], m[pivot] = m[pivot], m[col]
+		b[col], b[pivot] = b[pivot], b[col]
+		for r := col + 1; r < 4; r++ {
+			f := m[r][col] / m[col][col]
+			for c := col; c < 4; c++ {
+				m[r][c] -= f * m[col][c]
+			}
+			b[r] -= f * b[col]
+		}
+	}
+	var x [4]float64
+	for r := 3; r >= 0; r-- {
+		s := b[r]
+		for c := r + 1; c < 4; c++ {
+			s -= m[r][c] * x[c]
+		}
+		x[r] = s / m[r][r]
+	}
+	return x, true
+}
+
+// studentTTwoSided returns the two-sided p-value of t with df degrees of
+// freedom.
+func studentTTwoSided(t, df float64) float64 {
+	if math.IsNaN(t) || df <= 0 {
+		return math.NaN()
+	}
+	if math.IsInf(t, 0) {
+		return 0
+	}
+	return regIncBeta(df/2, 0.5, df/(df+t*t))
+}
+
+// regIncBeta is the regularized incomplete beta function I_x(a, b),
+// evaluated with Lentz's continued fraction.
+func regIncBeta(a, b, x float64) float64 {
+	switch {
+	case x <= 0:
+		return 0
+	case x >= 1:
+		return 1
+	}
+	la, _ := math.Lgamma(a)
+	lb, _ := math.Lgamma(b)
+	lab, _ := math.Lgamma(a + b)
+	front := math.Exp(lab - la - lb + a*math.Log(x) + b*math.Log(1-x))
+	if x > (a+1)/(a+b+2) {
+		return 1 - front*betaContinuedFraction(b, a, 1-x)/b
+	}
+	return front * betaContinuedFraction(a, b, x) / a
+}
+
+func betaContinuedFraction(a, b, x float64) float64 {
+	const (
+		maxIter = 300
+		eps     = 1e-15
+		tiny    = 1e-300
+	)
+	c, d := 1.0, 1-(a+b)*x/(a+1)
+	if math.Abs(d) < tiny {
+		d = tiny
+	}
+	d = 1 / d
+	h := d
+	for m := 1; m <= maxIter; m++ {
+		fm := float64(m)
+		num := fm * (b - fm) * x / ((a + 2*fm - 1) * (a + 2*fm))
+		d = 1 + num*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + num/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		h *= d * c
+
+		num = -(a + fm) * (a + b + fm) * x / ((a + 2*fm) * (a + 2*fm + 1))
+		d = 1 + num*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + num/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		delta := d * c
+		h *= delta
+		if math.Abs(delta-1) < eps {
+			break
+		}
+	}
+	return h
+}
@@ -0,0 +1,518 @@
+package datavis
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	internaldb "github.com/mjhen/elnote/server/internal/db"
+	"github.com/mjhen/elnote/server/internal/delimited"
+)
+
+// Source formats of a data extract.
+const (
+	SourceFormatCSV  = "csv"
+	SourceFormatTSV  = "tsv"
+	SourceFormatXLSX = "xlsx"
+)
+
+var decimalCommaPattern = regexp.MustCompile(`^\s*[-+]?\d*,\d+\s*$`)
+
+// headerScanRows is how many leading rows are considered when looking for
+// the header row below a preamble.
+const headerScanRows = 50
+
+// maxTableCells bounds the cells of a table once its rows are padded to
+// the header width, and of a worksheet's rows, so a sparse sheet or a wide
+// header over many short lines cannot expand a small upload into an
+// unbounded allocation.
+const maxTableCells = 1 << 24
+
+type ParseInput struct {
+	AttachmentID string
+	ExperimentID string
+	ActorUserID  string
+	// Data is the raw file. When empty, the stored object of AttachmentID
+	// is read.
+	Data []byte
+	// Format is csv, tsv or xlsx; empty detects it from the content.
+	Format string
+	// HeaderRow is the 1-based row (line, for delimited text) holding the
+	// column headers; zero detects it, skipping preamble lines written by
+	// instrument software.
+	HeaderRow int
+	// Sheets restricts which workbook sheets are extracted; empty extracts
+	// every non-empty sheet.
+	Sheets []string
+}
+
+// table is one parsed sheet or delimited file ready to be stored.
+type table struct {
+	format        string
+	sheetName     string
+	headerRow     int
+	headers       []string
+	rows          [][]string
+	plateFormat   int
+	plateLayoutID string
+}
+
+// ParseTable parses a CSV, TSV, semicolon-delimited or XLSX file and stores
+// one extract per table (per sheet for workbooks). Only the experiment owner
+// may create extracts.
+func (s *Service) ParseTable(ctx context.Context, in ParseInput) ([]DataExtract, error) {
+	if strings.TrimSpace(in.ExperimentID) == "" {
+		return nil, fmt.Errorf("%w: experimentId is required", ErrInvalidInput)
+	}
+	if in.HeaderRow < 0 {
+		return nil, fmt.Errorf("%w: headerRow must be positive", ErrInvalidInput)
+	}
+	if err := s.checkExperimentOwner(ctx, in.ExperimentID, in.ActorUserID); err != nil {
+		return nil, err
+	}
+
+	data, err := s.sourceData(ctx, in.Data, in.AttachmentID, in.ExperimentID)
+	if err != nil {
+		return nil, err
+	}
+
+	tables, err := parseTables(data, in)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	extracts := make([]DataExtract, 0, len(tables))
+	for _, t := range tables {
+		extract, err := insertExtract(ctx, tx, in, t)
+		if err != nil {
+			return nil, err
+		}
+		extracts = append(extracts, *extract)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return extracts, nil
+}
+
+func (s *Service) checkExperimentOwner(ctx context.Context, experimentID, userID string) error {
+	var owner string
+	err := s.db.QueryRowContext(ctx,
+		`SELECT owner_user_id FROM experiments WHERE id = $1`, experimentID,
+	).Scan(&owner)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("query experiment: %w", err)
+	}
+	if owner != userID {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// sourceData returns the uploaded bytes, or the attachment's stored object
+// when none were sent.
+func (s *Service) sourceData(ctx context.Context, data []byte, attachmentID, experimentID string) ([]byte, error) {
+	if len(data) > 0 {
+		return data, nil
+	}
+	if attachmentID == "" {
+		return nil, fmt.Errorf("%w: data or attachmentId is required", ErrInvalidInput)
+	}
+	return s.readAttachment(ctx, attachmentID, experimentID)
+}
+
+// readAttachment loads a completed attachment of the experiment from the
+// object store. Attachments awaiting or failing a content scan are refused.
+func (s *Service) readAttachment(ctx context.Context, attachmentID, experimentID string) ([]byte, error) {
+	var (
+		objectKey, status, scanStatus, attachmentExperiment string
+		sizeBytes                                           int64
+	)
+	err := s.db.QueryRowContext(ctx,
+		`SELECT content_object_key, status, scan_status, experiment_id::text, size_bytes
+		 FROM attachments WHERE id = $1`, attachmentID,
+	).Scan(&objectKey, &status, &scanStatus, &attachmentExperiment, &sizeBytes)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("query attachment: %w", err)
+	}
+	if attachmentExperiment != experimentID {
+		return nil, fmt.Errorf("%w: attachment does not belong to the experiment", ErrInvalidInput)
+	}
+	if status != "completed" {
+		return nil, fmt.Errorf("%w: attachment upload is not completed", ErrInvalidInput)
+	}
+	if scanStatus == "pending_scan" || scanStatus == "scan_failed" || scanStatus == "quarantined" {
+		return nil, fmt.Errorf("%w: attachment content scan status is %s", ErrInvalidInput, scanStatus)
+	}
+	if s.objects == nil {
+		return nil, errors.New("object store reader is not configured")
+	}
+	if s.maxSourceBytes > 0 && sizeBytes > s.maxSourceBytes {
+		return nil, fmt.Errorf("%w: attachment is larger than the %d byte extract limit", ErrInvalidInput, s.maxSourceBytes)
+	}
+
+	rc, err := s.objects.Open(ctx, objectKey)
+	if err != nil {
+		return nil, fmt.Errorf("open attachment object: %w", err)
+	}
+	defer rc.Close()
+	limit := s.maxSourceBytes
+	if limit <= 0 {
+		limit = sizeBytes
+	}
+	data, err := io.ReadAll(io.LimitReader(rc, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("read attachment object: %w", err)
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%w: attachment is larger than the %d byte extract limit", ErrInvalidInput, limit)
+	}
+	return data, nil
+}
+
+// detectFormat normalizes a requested format, sniffing workbooks from
+// their zip signature when none was given.
+func detectFormat(data []byte, format string) string {
+	format = strings.ToLower(strings.TrimSpace(format))
+	if format == "" {
+		format = SourceFormatCSV
+		if isZip(data) {
+			format = SourceFormatXLSX
+		}
+	}
+	return format
+}
+
+func parseTables(data []byte, in ParseInput) ([]table, error) {
+	switch format := detectFormat(data, in.Format); format {
+	case SourceFormatXLSX:
+		sheets, err := readXLSX(data)
+		if err != nil {
+			return nil, fmt.Errorf("%w: cannot read workbook: %v", ErrInvalidInput, err)
+		}
+		wanted := map[string]bool{}
+		for _, name := range in.Sheets {
+			wanted[strings.TrimSpace(name)] = true
+		}
+		var tables []table
+		for _, sheet := range sheets {
+			if len(in.Sheets) > 0 && !wanted[sheet.name] {
+				continue
+			}
+			delete(wanted, sheet.name)
+			if isEmptyGrid(sheet.rows) {
+				continue
+			}
+			t, err := buildTable(sheet.rows, in.HeaderRow)
+			if err != nil {
+				return nil, fmt.Errorf("sheet %q: %w", sheet.name, err)
+			}
+			t.format, t.sheetName = SourceFormatXLSX, sheet.name
+			tables = append(tables, t)
+		}
+		for name := range wanted {
+			return nil, fmt.Errorf("%w: workbook has no sheet named %q", ErrInvalidInput, name)
+		}
+		if len(tables) == 0 {
+			return nil, fmt.Errorf("%w: workbook has no data", ErrInvalidInput)
+		}
+		return tables, nil
+
+	case SourceFormatCSV, SourceFormatTSV:
+		records, format, err := readDelimited(data, format)
+		if err != nil {
+			return nil, err
+		}
+		t, err := buildTable(records, in.HeaderRow)
+		if err != nil {
+			return nil, err
+		}
+		t.format = format
+		return []table{t}, nil
+
+	default:
+		return nil, fmt.Errorf("%w: format must be csv, tsv or xlsx", ErrInvalidInput)
+	}
+}
+
+// readDelimited splits CSV or TSV text into records placed at their
+// starting line, so blank lines skipped by csv.Reader still count towards
+// row numbers. A csv file whose detected delimiter is a tab is reported as
+// tsv.
+func readDelimited(data []byte, format string) ([][]string, string, error) {
+	if isZip(data) {
+		return nil, "", fmt.Errorf("%w: file is a workbook, not delimited text", ErrInvalidInput)
+	}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if !utf8.Valid(data) {
+		return nil, "", fmt.Errorf("%w: delimited text must be UTF-8", ErrInvalidInput)
+	}
+	delim := '\t'
+	if format == SourceFormatCSV {
+		delim = delimited.Detect(data)
+	}
+	if delim == '\t' {
+		format = SourceFormatTSV
+	}
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comma = delim
+	reader.TrimLeadingSpace = delim != '\t'
+	// Preamble lines have a different number of fields than the table.
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	var records [][]string
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("%w: CSV parse error: %v", ErrInvalidInput, err)
+		}
+		line, _ := reader.FieldPos(0)
+		for len(records) < line-1 {
+			records = append(records, nil)
+		}
+		records = append(records, record)
+	}
+	if delim == ';' {
+		normalizeDecimalCommas(records)
+	}
+	return records, format, nil
+}
+
+// normalizeDecimalCommas rewrites "0,25" as "0.25". Semicolon-delimited
+// files come from locales that use the comma as decimal separator.
+func normalizeDecimalCommas(records [][]string) {
+	for _, row := range records {
+		for i, c := range row {
+			if decimalCommaPattern.MatchString(c) {
+				row[i] = strings.Replace(c, ",", ".", 1)
+			}
+		}
+	}
+}
+
+func isEmptyGrid(rows [][]string) bool {
+	for _, row := range rows {
+		if !isBlankRow(row) {
+			return false
+		}
+	}
+	return true
+}
+
+func isBlankRow(row []string) bool {
+	for _, c := range row {
+		if strings.TrimSpace(c) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func trimTrailingEmpty(row []string) []string {
+	end := len(row)
+	for end > 0 && strings.TrimSpace(row[end-1]) == "" {
+		end--
+	}
+	return row[:end]
+}
+
+// buildTable picks the header row (given 1-based, or detected), then
+// normalizes every following non-blank row to the header width.
+func buildTable(records [][]string, headerRow int) (table, error) {
+	if headerRow == 0 {
+		headerRow = detectHeaderRow(records)
+	}
+	if headerRow < 1 || headerRow > len(records) {
+		return table{}, fmt.Errorf("%w: header row %d is outside the table", ErrInvalidInput, headerRow)
+	}
+	headers := trimTrailingEmpty(records[headerRow-1])
+	if len(headers) == 0 {
+		return table{}, fmt.Errorf("%w: header row %d is empty", ErrInvalidInput, headerRow)
+	}
+	for i := range headers {
+		headers[i] = strings.TrimSpace(headers[i])
+		if headers[i] == "" {
+			headers[i] = fmt.Sprintf("column_%d", i+1)
+		}
+	}
+
+	rows := [][]string{}
+	for i := headerRow; i < len(records); i++ {
+		if isBlankRow(records[i]) {
+			continue
+		}
+		row := trimTrailingEmpty(records[i])
+		if len(row) > len(headers) {
+			return table{}, fmt.Errorf("%w: row %d has %d values but the header has %d columns", ErrInvalidInput, i+1, len(row), len(headers))
+		}
+		if (len(rows)+1)*len(headers) > maxTableCells {
+			return table{}, fmt.Errorf("%w: table has more than %d cells", ErrInvalidInput, maxTableCells)
+		}
+		normalized := make([]string, len(headers))
+		copy(normalized, row)
+		rows = append(rows, normalized)
+	}
+	return table{headerRow: headerRow, headers: headers, rows: rows}, nil
+}
+
+// detectHeaderRow returns the 1-based header row. Preamble lines written
+// by instrument software are narrower than the table, so only rows reaching
+// the full table width within headerScanRows are candidates. The first
+// candidate with fewer numeric cells than the row below it is the header;
+// failing that, the first candidate without numeric cells, then the first
+// candidate, then the first non-blank row.
+func detectHeaderRow(records [][]string) int {
+	width := 0
+	for _, r := range records {
+		if n := len(trimTrailingEmpty(r)); n > width {
+			width = n
+		}
+	}
+	numericCells := func(row []string) int {
+		n := 0
+		for _, c := range row {
+			if _, ok := parseNumber(strings.TrimSpace(c)); ok {
+				n++
+			}
+		}
+		return n
+	}
+
+	first, firstWide, firstText := 0, 0, 0
+	for i := 0; i < len(records) && i < headerScanRows; i++ {
+		row := trimTrailingEmpty(records[i])
+		if len(row) == 0 {
+			continue
+		}
+		if first == 0 {
+			first = i + 1
+		}
+		if len(row) != width {
+			continue
+		}
+		if firstWide == 0 {
+			firstWide = i + 1
+		}
+		numeric := numericCells(row)
+		if numeric == 0 && firstText == 0 {
+			firstText = i + 1
+		}
+		for j := i + 1; j < len(records); j++ {
+			if next := trimTrailingEmpty(records[j]); len(next) > 0 {
+				if numeric < numericCells(next) {
+					return i + 1
+				}
+				break
+			}
+		}
+	}
+	for _, row := range []int{firstText, firstWide, first} {
+		if row > 0 {
+			return row
+		}
+	}
+	return 1
+}
+
+// insertExtract stores one table with its profiles and row chunks.
+func insertExtract(ctx context.Context, tx *sql.Tx, in ParseInput, t table) (*DataExtract, error) {
+	sampleRows := t.rows
+	if len(sampleRows) > sampleRowCount {
+		sampleRows = sampleRows[:sampleRowCount]
+	}
+	profiles := profileColumns(t.headers, t.rows)
+
+	headersJSON, _ := json.Marshal(t.headers)
+	sampleJSON, _ := json.Marshal(sampleRows)
+	profilesJSON, err := json.Marshal(profiles)
+	if err != nil {
+		return nil, fmt.Errorf("encode column profiles: %w", err)
+	}
+
+	// attachment_id is nullable — pass nil when no attachment is associated
+	var attachParam any
+	if in.AttachmentID != "" {
+		attachParam = in.AttachmentID
+	}
+	var sheetParam, plateFormatParam, layoutParam any
+	if t.sheetName != "" {
+		sheetParam = t.sheetName
+	}
+	if t.plateFormat != 0 {
+		plateFormatParam = t.plateFormat
+	}
+	if t.plateLayoutID != "" {
+		layoutParam = t.plateLayoutID
+	}
+
+	var extract DataExtract
+	var nullableAttachID sql.NullString
+	err = tx.QueryRowContext(ctx,
+		`INSERT INTO data_extracts (attachment_id, experiment_id, column_headers, row_count, sample_rows, rows_stored, column_profiles,
+			source_format, sheet_name, header_row, plate_format, plate_layout_id)
+		 VALUES ($1, $2, $3, $4, $5, TRUE, $6, $7, $8, $9, $10, $11)
+		 RETURNING id, COALESCE(attachment_id::text,''), experiment_id, row_count, rows_stored, parsed_at`,
+		attachParam, in.ExperimentID, headersJSON, len(t.rows), sampleJSON, profilesJSON,
+		t.format, sheetParam, t.headerRow, plateFormatParam, layoutParam,
+	).Scan(&extract.ID, &nullableAttachID, &extract.ExperimentID, &extract.RowCount, &extract.RowsStored, &extract.ParsedAt)
+	if err != nil {
+		return nil, fmt.Errorf("insert data extract: %w", err)
+	}
+	if err := storeRowChunks(ctx, tx, extract.ID, t.rows); err != nil {
+		return nil, err
+	}
+	extract.AttachmentID = nullableAttachID.String
+	extract.ColumnHeaders = t.headers
+	extract.Columns = profiles
+	extract.SampleRows = sampleRows
+	extract.SourceFormat = t.format
+	extract.SheetName = t.sheetName
+	extract.HeaderRow = t.headerRow
+	extract.PlateFormat = t.plateFormat
+	extract.PlateLayoutID = t.plateLayoutID
+
+	payload := map[string]any{
+		"dataExtractId": extract.ID,
+		"attachmentId":  in.AttachmentID,
+		"rowCount":      extract.RowCount,
+		"sourceFormat":  t.format,
+		"headerRow":     t.headerRow,
+	}
+	if t.sheetName != "" {
+		payload["sheetName"] = t.sheetName
+	}
+	if t.plateFormat != 0 {
+		payload["plateFormat"] = t.plateFormat
+	}
+	if t.plateLayoutID != "" {
+		payload["plateLayoutId"] = t.plateLayoutID
+	}
+	if err := internaldb.AppendAuditEvent(ctx, tx, in.ActorUserID, "data.extract_created", "attachment", in.AttachmentID, payload); err != nil {
+		return nil, fmt.Errorf("append data.extract_created audit event: %w", err)
+	}
+	return &extract, nil
+}
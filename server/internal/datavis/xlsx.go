@@ -0,0 +1,431 @@
+package datavis
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Minimal Office Open XML spreadsheet reader: enough of SpreadsheetML to
+// read cell values from every worksheet, resolving shared strings, inline
+// strings, booleans and date-formatted numbers. Formulas are read through
+// their cached values; charts, styles other than number formats and
+// merged-cell semantics are ignored.
+
+const (
+	// xlsxMaxPartBytes bounds the decompressed size of any one package part
+	// so a small crafted workbook cannot exhaust memory.
+	xlsxMaxPartBytes = 256 << 20
+	xlsxMaxColumns   = 16384
+	xlsxMaxRows      = 1 << 20
+)
+
+var errNotXLSX = errors.New("not an xlsx workbook")
+
+type xlsxSheet struct {
+	name string
+	rows [][]string
+}
+
+func isZip(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("PK\x03\x04"))
+}
+
+// readXLSX returns the worksheets of a workbook in workbook order.
+func readXLSX(data []byte) ([]xlsxSheet, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errNotXLSX, err)
+	}
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		files[strings.TrimPrefix(f.Name, "/")] = f
+	}
+	if files["xl/workbook.xml"] == nil {
+		return nil, errNotXLSX
+	}
+
+	var workbook struct {
+		Pr struct {
+			Date1904 string `xml:"date1904,attr"`
+		} `xml:"workbookPr"`
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+			RID  string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := decodeXLSXPart(files["xl/workbook.xml"], &workbook); err != nil {
+		return nil, err
+	}
+	date1904 := workbook.Pr.Date1904 == "1" || workbook.Pr.Date1904 == "true"
+
+	targets := map[string]string{}
+	if f := files["xl/_rels/workbook.xml.rels"]; f != nil {
+		var rels struct {
+			Rels []struct {
+				ID     string `xml:"Id,attr"`
+				Target string `xml:"Target,attr"`
+			} `xml:"Relationship"`
+		}
+		if err := decodeXLSXPart(f, &rels); err != nil {
+			return nil, err
+		}
+		for _, r := range rels.Rels {
+			target := r.Target
+			if strings.HasPrefix(target, "/") {
+				target = strings.TrimPrefix(target, "/")
+			} else {
+				target = path.Join("xl", target)
+			}
+			targets[r.ID] = target
+		}
+	}
+
+	var shared []string
+	if f := files["xl/sharedStrings.xml"]; f != nil {
+		if shared, err = readSharedStrings(f); err != nil {
+			return nil, err
+		}
+	}
+
+	var dateStyles map[int]bool
+	if f := files["xl/styles.xml"]; f != nil {
+		if dateStyles, err = readDateStyles(f); err != nil {
+			return nil, err
+		}
+	}
+
+	var sheets []xlsxSheet
+	cells := 0
+	for i, s := range workbook.Sheets {
+		target := targets[s.RID]
+		if target == "" {
+			target = fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1)
+		}
+		f := files[target]
+		if f == nil {
+			return nil, fmt.Errorf("worksheet %q is missing from the workbook", s.Name)
+		}
+		rows, err := readWorksheet(f, shared, dateStyles, date1904, &cells)
+		if err != nil {
+			return nil, fmt.Errorf("worksheet %q: %w", s.Name, err)
+		}
+		sheets = append(sheets, xlsxSheet{name: s.Name, rows: rows})
+	}
+	return sheets, nil
+}
+
+func openXLSXPart(f *zip.File) (io.ReadCloser, io.Reader, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, nil, fmt.Errorf("open %s: %w", f.Name, err)
+	}
+	return rc, io.LimitReader(rc, xlsxMaxPartBytes), nil
+}
+
+func decodeXLSXPart(f *zip.File, v any) error {
+	rc, r, err := openXLSXPart(f)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	if err := xml.NewDecoder(r).Decode(v); err != nil {
+		return fmt.Errorf("parse %s: %w", f.Name, err)
+	}
+	return nil
+}
+
+// readSharedStrings concatenates the text runs of every <si> entry.
+func readSharedStrings(f *zip.File) ([]string, error) {
+	rc, r, err := openXLSXPart(f)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	var (
+		out    []string
+		cur    strings.Builder
+		inSI   bool
+		inText bool
+		inRPh  bool
+	)
+	dec := xml.NewDecoder(r)
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse shared strings: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "si":
+				inSI = true
+				cur.Reset()
+			case "rPh":
+				// Phonetic runs are annotations, not cell text.
+				inRPh = true
+			case "t":
+				inText = inSI && !inRPh
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "si":
+				out = append(out, cur.String())
+				inSI = false
+			case "rPh":
+				inRPh = false
+			case "t":
+				inText = false
+			}
+		case xml.CharData:
+			if inText {
+				cur.Write(t)
+			}
+		}
+	}
+	return out, nil
+}
+
+// readDateStyles returns the cellXfs indexes whose number format is a date
+// or time format.
+func readDateStyles(f *zip.File) (map[int]bool, error) {
+	var styles struct {
+		NumFmts []struct {
+			ID   int    `xml:"numFmtId,attr"`
+			Code string `xml:"formatCode,attr"`
+		} `xml:"numFmts>numFmt"`
+		Xfs []struct {
+			NumFmtID int `xml:"numFmtId,attr"`
+		} `xml:"cellXfs>xf"`
+	}
+	if err := decodeXLSXPart(f, &styles); err != nil {
+		return nil, err
+	}
+	custom := map[int]bool{}
+	for _, nf := range styles.NumFmts {
+		custom[nf.ID] = isDateFormatCode(nf.Code)
+	}
+	out := map[int]bool{}
+	for i, xf := range styles.Xfs {
+		id := xf.NumFmtID
+		isDate, ok := custom[id]
+		if !ok {
+			// Built-in date and time formats.
+			isDate = (id >= 14 && id <= 22) || (id >= 45 && id <= 47)
+		}
+		if isDate {
+			out[i] = true
+		}
+	}
+	return out, nil
+}
+
+// isDateFormatCode reports whether a custom number format renders a date or
+// time, ignoring quoted literals, escapes and colour/condition sections.
+func isDateFormatCode(code string) bool {
+	var (
+		inQuote   bool
+		inBracket bool
+		escaped   bool
+	)
+	for _, c := range strings.ToLower(code) {
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == '"':
+			inQuote = !inQuote
+		case inQuote:
+		case c == '[':
+			inBracket = true
+		case c == ']':
+			inBracket = false
+		case inBracket:
+		case c == 'y', c == 'd', c == 'h', c == 's', c == 'm':
+			return true
+		}
+	}
+	return false
+}
+
+// readWorksheet returns the rows of a worksheet, each holding its cells up
+// to its last non-empty column. cells counts the stored cells across the
+// workbook against maxTableCells.
+func readWorksheet(f *zip.File, shared []string, dateStyles map[int]bool, date1904 bool, cells *int) ([][]string, error) {
+	rc, r, err := openXLSXPart(f)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	type cell struct {
+		Ref    string `xml:"r,attr"`
+		Type   string `xml:"t,attr"`
+		Style  int    `xml:"s,attr"`
+		Value  string `xml:"v"`
+		Inline struct {
+			Text string   `xml:"t"`
+			Runs []string `xml:"r>t"`
+		} `xml:"is"`
+	}
+
+	var (
+		rows    [][]string
+		nextRow = 1
+	)
+	dec := xml.NewDecoder(r)
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse worksheet: %w", err)
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "row" {
+			continue
+		}
+
+		var row struct {
+			Ref   int    `xml:"r,attr"`
+			Cells []cell `xml:"c"`
+		}
+		if err := dec.DecodeElement(&row, &start); err != nil {
+			return nil, fmt.Errorf("parse worksheet row: %w", err)
+		}
+		rowNum := row.Ref
+		if rowNum <= 0 {
+			rowNum = nextRow
+		}
+		if rowNum > xlsxMaxRows {
+			return nil, fmt.Errorf("more than %d rows", xlsxMaxRows)
+		}
+		nextRow = rowNum + 1
+		for len(rows) < rowNum {
+			rows = append(rows, nil)
+		}
+
+		// Values are placed once the row's last non-empty column is known,
+		// so empty trailing cells are dropped and only stored cells count
+		// towards maxTableCells.
+		type placed struct {
+			col   int
+			value string
+		}
+		var found []placed
+		width := 0
+		nextCol := 0
+		for _, c := range row.Cells {
+			col := nextCol
+			if c.Ref != "" {
+				if parsed, ok := columnFromRef(c.Ref); ok {
+					col = parsed
+				}
+			}
+			if col >= xlsxMaxColumns {
+				return nil, fmt.Errorf("more than %d columns", xlsxMaxColumns)
+			}
+			nextCol = col + 1
+
+			var v string
+			switch c.Type {
+			case "s":
+				idx, err := strconv.Atoi(strings.TrimSpace(c.Value))
+				if err != nil || idx < 0 || idx >= len(shared) {
+					return nil, fmt.Errorf("cell %s: invalid shared string index", c.Ref)
+				}
+				v = shared[idx]
+			case "inlineStr":
+				v = c.Inline.Text + strings.Join(c.Inline.Runs, "")
+			case "b":
+				v = "false"
+				if strings.TrimSpace(c.Value) == "1" {
+					v = "true"
+				}
+			case "e":
+				// Error values (#DIV/0!, #N/A) are treated as missing.
+				v = ""
+			case "str", "d":
+				v = c.Value
+			default:
+				v = c.Value
+				if dateStyles[c.Style] && v != "" {
+					if f, err := strconv.ParseFloat(v, 64); err == nil {
+						v = formatExcelDate(f, date1904)
+					}
+				}
+			}
+			if v != "" {
+				found = append(found, placed{col, v})
+				width = max(width, col+1)
+			}
+		}
+		if *cells += width; *cells > maxTableCells {
+			return nil, fmt.Errorf("more than %d cells", maxTableCells)
+		}
+		var values []string
+		if width > 0 {
+			values = make([]string, width)
+			for _, p := range found {
+				values[p.col] = p.value
+			}
+		}
+		rows[rowNum-1] = values
+	}
+	return rows, nil
+}
+
+// columnFromRef returns the zero-based column of a cell reference like
+// "AB12".
+func columnFromRef(ref string) (int, bool) {
+	col := 0
+	n := 0
+	for _, c := range ref {
+		if c >= 'a' && c <= 'z' {
+			c -= 'a' - 'A'
+		}
+		if c < 'A' || c > 'Z' {
+			break
+		}
+		col = col*26 + int(c-'A'+1)
+		n++
+	}
+	if n == 0 || n > 3 {
+		return 0, false
+	}
+	return col - 1, true
+}
+
+// formatExcelDate converts a serial date to ISO 8601, dropping the time of
+// day when it is midnight and the date when the serial is below one day.
+func formatExcelDate(serial float64, date1904 bool) string {
+	epoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	if date1904 {
+		epoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	days := math.Floor(serial)
+	secs := math.Round((serial - days) * 86400)
+	t := epoch.AddDate(0, 0, int(days)).Add(time.Duration(secs) * time.Second)
+	switch {
+	case !date1904 && days == 0:
+		return t.Format("15:04:05")
+	case secs == 0:
+		return t.Format("2006-01-02")
+	default:
+		return t.Format("2006-01-02T15:04:05")
+	}
+}
@@ -0,0 +1,41 @@
+package delimited
+
+import "strings"
+
+// detectLines is how many leading lines Detect looks at.
+const detectLines = 200
+
+// Candidates are the delimiters Detect chooses between, in order of
+// preference on a tie.
+var Candidates = []rune{',', '\t', ';', '|'}
+
+// Detect chooses the field delimiter of delimited text: for each candidate,
+// the most common per-line separator count is found, and the candidate
+// whose count is shared by the most lines wins (ties go to more columns,
+// then to the earlier candidate). Preamble lines and decimal commas in
+// semicolon files lose this vote to the table body. Text without any
+// candidate is taken as comma-separated.
+//
+// Data extracts and table previews both use it, so a file is split the
+// same way in its preview and in its extract.
+func Detect(data []byte) rune {
+	lines := strings.SplitN(string(data), "\n", detectLines+1)
+	if len(lines) > detectLines {
+		lines = lines[:detectLines]
+	}
+	best, bestLines, bestFields := ',', 0, 0
+	for _, d := range Candidates {
+		counts := map[int]int{}
+		for _, line := range lines {
+			if n := strings.Count(line, string(d)); n > 0 {
+				counts[n]++
+			}
+		}
+		for n, c := range counts {
+			if c > bestLines || (c == bestLines && n > bestFields) {
+				best, bestLines, bestFields = d, c, n
+			}
+		}
+	}
+	return best
+}
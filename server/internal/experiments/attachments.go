@@ -0,0 +1,156 @@
+package experiments
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// attachmentRefPattern matches inline attachment references in entry bodies,
+// written as [[attachment:<uuid>]].
+var attachmentRefPattern = regexp.MustCompile(`\[\[attachment:([0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12})\]\]`)
+
+// EntryAttachment is an attachment shown alongside an entry, either because it
+// was uploaded against the entry or because the entry body references it.
+type EntryAttachment struct {
+	AttachmentID          string  `json:"attachmentId"`
+	EntryID               *string `json:"entryId,omitempty"`
+	ObjectKey             string  `json:"objectKey"`
+	MimeType              string  `json:"mimeType"`
+	SizeBytes             int64   `json:"sizeBytes"`
+	Status                string  `json:"status"`
+	Version               int     `json:"version"`
+	EffectiveAttachmentID string  `json:"effectiveAttachmentId"`
+	BoundToEntry          bool    `json:"boundToEntry"`
+	ReferencedInline      bool    `json:"referencedInline"`
+}
+
+// AttachmentRefs returns the distinct attachment IDs referenced inline in an
+// entry body, in order of first appearance.
+func AttachmentRefs(body string) []string {
+	matches := attachmentRefPattern.FindAllStringSubmatch(body, -1)
+	if len(matches) == 0 {
+		return nil
+	}
+	seen := make(map[string]bool, len(matches))
+	refs := make([]string, 0, len(matches))
+	for _, m := range matches {
+		id := strings.ToLower(m[1])
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		refs = append(refs, id)
+	}
+	return refs
+}
+
+// ensureAttachmentRefs rejects bodies that reference attachments outside the
+// experiment.
+func ensureAttachmentRefs(ctx context.Context, tx *sql.Tx, experimentID, body string) error {
+	refs := AttachmentRefs(body)
+	if len(refs) == 0 {
+		return nil
+	}
+	for _, ref := range refs {
+		var found bool
+		if err := tx.QueryRowContext(ctx, `
+			SELECT EXISTS (
+				SELECT 1 FROM attachments WHERE id = $1::uuid AND experiment_id = $2::uuid
+			)
+		`, ref, experimentID).Scan(&found); err != nil {
+			return fmt.Errorf("check attachment reference: %w", err)
+		}
+		if !found {
+			return fmt.Errorf("%w: entry references unknown attachment %s", ErrInvalidInput, ref)
+		}
+	}
+	return nil
+}
+
+// loadExperimentAttachments returns every attachment of the experiment keyed
+// by ID, plus the IDs in upload order.
+func (s *Service) loadExperimentAttachments(ctx context.Context, experimentID string) (map[string]EntryAttachment, []string, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT
+			a.id::text,
+			a.entry_id::text,
+			a.object_key,
+			a.mime_type,
+			a.size_bytes,
+			a.status,
+			a.version_number,
+			COALESCE((
+				SELECT head.id::text
+				FROM attachments head
+				WHERE head.lineage_id = a.lineage_id
+				  AND head.status = 'completed'
+				ORDER BY head.version_number DESC
+				LIMIT 1
+			), a.id::text)
+		FROM attachments a
+		WHERE a.experiment_id = $1
+		ORDER BY a.created_at ASC, a.id ASC
+	`, experimentID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("query experiment attachments: %w", err)
+	}
+	defer rows.Close()
+
+	byID := make(map[string]EntryAttachment)
+	var order []string
+	for rows.Next() {
+		var (
+			a       EntryAttachment
+			entryID sql.NullString
+		)
+		if err := rows.Scan(&a.AttachmentID, &entryID, &a.ObjectKey, &a.MimeType, &a.SizeBytes, &a.Status, &a.Version, &a.EffectiveAttachmentID); err != nil {
+			return nil, nil, fmt.Errorf("scan experiment attachment: %w", err)
+		}
+		if entryID.Valid {
+			a.EntryID = &entryID.String
+		}
+		byID[a.AttachmentID] = a
+		order = append(order, a.AttachmentID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("iterate experiment attachments: %w", err)
+	}
+	return byID, order, nil
+}
+
+// entryAttachments collects the attachments bound to an entry followed by
+// those referenced inline from its body. When effectiveOnly is set, versions
+// superseded by a newer completed upload are left out of the bound set.
+func entryAttachments(entryID, body string, byID map[string]EntryAttachment, order []string, effectiveOnly bool) []EntryAttachment {
+	out := []EntryAttachment{}
+	index := make(map[string]int)
+	for _, id := range order {
+		a := byID[id]
+		if a.EntryID == nil || *a.EntryID != entryID {
+			continue
+		}
+		if effectiveOnly && a.EffectiveAttachmentID != a.AttachmentID {
+			continue
+		}
+		a.BoundToEntry = true
+		index[id] = len(out)
+		out = append(out, a)
+	}
+	for _, ref := range AttachmentRefs(body) {
+		if i, ok := index[ref]; ok {
+			out[i].ReferencedInline = true
+			continue
+		}
+		a, ok := byID[ref]
+		if !ok {
+			continue
+		}
+		a.ReferencedInline = true
+		index[ref] = len(out)
+		out = append(out, a)
+	}
+	return out
+}
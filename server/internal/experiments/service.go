@@ -83,6 +83,9 @@ type EffectiveView struct {
 	EffectiveBody    string     `json:"effectiveBody"`
 	CreatedAt        time.Time  `json:"createdAt"`
 	CompletedAt      *time.Time `json:"completedAt,omitempty"`
+	// Attachments bound to the effective entry (current versions only) and
+	// those referenced inline from the effective body.
+	Attachments []EntryAttachment `json:"attachments"`
 }
 
 type HistoryEntry struct {
@@ -91,6 +94,9 @@ type HistoryEntry struct {
 	SupersedesEntryID *string   `json:"supersedesEntryId,omitempty"`
 	Body              string    `json:"body"`
 	CreatedAt         time.Time `json:"createdAt"`
+	// Attachments bound to this entry, including superseded versions, and
+	// those referenced inline from its body.
+	Attachments []EntryAttachment `json:"attachments"`
 }
 
 type HistoryView struct {
@@ -122,6 +128,12 @@ func (s *Service) CreateExperiment(ctx context.Context, in CreateExperimentInput
 		return CreateExperimentOutput{}, fmt.Errorf("insert experiment: %w", err)
 	}
 
+	// A new experiment has no attachments yet, so this rejects any inline
+	// reference; it keeps the original entry to the same rule as addenda.
+	if err := ensureAttachmentRefs(ctx, tx, experimentID, in.OriginalBody); err != nil {
+		return CreateExperimentOutput{}, err
+	}
+
 	var originalEntryID string
 	err = tx.QueryRowContext(ctx, `
 		INSERT INTO experiment_entries (
@@ -192,6 +204,9 @@ func (s *Service) AddAddendum(ctx context.Context, in AddAddendumInput) (AddAdde
 	if err := ensureOwner(ctx, tx, in.ExperimentID, in.OwnerUserID); err != nil {
 		return AddAddendumOutput{}, err
 	}
+	if err := ensureAttachmentRefs(ctx, tx, in.ExperimentID, in.Body); err != nil {
+		return AddAddendumOutput{}, err
+	}
 
 	var supersedesEntryID string
 	err = tx.QueryRowContext(ctx, `
@@ -432,6 +447,12 @@ func (s *Service) GetEffectiveView(ctx context.Context, experimentID, viewerUser
 		out.CompletedAt = &completedAt.Time
 	}
 
+	byID, order, err := s.loadExperimentAttachments(ctx, experimentID)
+	if err != nil {
+		return EffectiveView{}, err
+	}
+	out.Attachments = entryAttachments(out.EffectiveEntryID, out.EffectiveBody, byID, order, true)
+
 	return out, nil
 }
 
@@ -473,6 +494,15 @@ func (s *Service) GetHistory(ctx context.Context, experimentID, viewerUserID, vi
 		return HistoryView{}, ErrNotFound
 	}
 
+	byID, order, err := s.loadExperimentAttachments(ctx, experimentID)
+	if err != nil {
+		return HistoryView{}, err
+	}
+	for i := range history.Entries {
+		entry := &history.Entries[i]
+		entry.Attachments = entryAttachments(entry.EntryID, entry.Body, byID, order, false)
+	}
+
 	return history, nil
 }
 
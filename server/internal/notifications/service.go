@@ -54,9 +54,20 @@ func NewService(db *sql.DB) *Service {
 	return &Service{db: db}
 }
 
+// Execer is a database or transaction a notification can be written with.
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
 // Create emits a notification for a user.
 func (s *Service) Create(ctx context.Context, userID, eventType, title, body, refType string, refID *string) error {
-	_, err := s.db.ExecContext(ctx,
+	return s.CreateWith(ctx, s.db, userID, eventType, title, body, refType, refID)
+}
+
+// CreateWith emits a notification through store, so a caller can commit it
+// together with the change it reports.
+func (s *Service) CreateWith(ctx context.Context, store Execer, userID, eventType, title, body, refType string, refID *string) error {
+	_, err := store.ExecContext(ctx,
 		`INSERT INTO notifications (user_id, event_type, title, body, reference_type, reference_id)
 		 VALUES ($1, $2, $3, $4, $5, $6)`,
 		userID, eventType, title, body, refType, refID,
@@ -13,6 +13,7 @@ import (
 	"time"
 
 	internaldb "github.com/mjhen/elnote/server/internal/db"
+	"github.com/mjhen/elnote/server/internal/experiments"
 )
 
 type Service struct {
@@ -39,6 +40,9 @@ type Dashboard struct {
 	ReconcileMissingObjectUnresolved     int64     `json:"reconcileMissingObjectUnresolved"`
 	ReconcileOrphanObjectUnresolved      int64     `json:"reconcileOrphanObjectUnresolved"`
 	ReconcileIntegrityMismatchUnresolved int64     `json:"reconcileIntegrityMismatchUnresolved"`
+	AttachmentVerificationFlagged        int64     `json:"attachmentVerificationFlagged"`
+	AttachmentsPendingScan               int64     `json:"attachmentsPendingScan"`
+	AttachmentsQuarantined               int64     `json:"attachmentsQuarantined"`
 	AuditEvents24h                       int64     `json:"auditEvents24h"`
 }
 
@@ -113,6 +117,20 @@ func (s *Service) Dashboard(ctx context.Context) (Dashboard, error) {
 	`); err != nil {
 		return Dashboard{}, err
 	}
+	if out.AttachmentVerificationFlagged, err = countQuery(ctx, s.db, `
+		SELECT COUNT(*)
+		FROM attachments
+		WHERE status = 'completed'
+		  AND verification_status IN ('mismatch', 'missing')
+	`); err != nil {
+		return Dashboard{}, err
+	}
+	if out.AttachmentsPendingScan, err = countQuery(ctx, s.db, `SELECT COUNT(*) FROM attachments WHERE scan_status IN ('pending_scan', 'scan_failed')`); err != nil {
+		return Dashboard{}, err
+	}
+	if out.AttachmentsQuarantined, err = countQuery(ctx, s.db, `SELECT COUNT(*) FROM attachments WHERE scan_status = 'quarantined'`); err != nil {
+		return Dashboard{}, err
+	}
 	if out.AuditEvents24h, err = countQuery(ctx, s.db, `SELECT COUNT(*) FROM audit_log WHERE created_at >= $1`, since); err != nil {
 		return Dashboard{}, err
 	}
@@ -352,7 +370,7 @@ func (s *Service) ForensicExport(ctx context.Context, experimentID string) (map[
 	}
 
 	attachments, err := rowsToMaps(ctx, s.db, `
-		SELECT id::text AS attachment_id, uploader_user_id::text, object_key, checksum, size_bytes, mime_type, status, created_at, completed_at
+		SELECT id::text AS attachment_id, entry_id::text, uploader_user_id::text, object_key, content_object_key, deduplicated_from_attachment_id::text, lineage_id::text, version_number, supersedes_attachment_id::text, checksum, verified_sha256, verification_status, verified_at, scan_status, scanned_at, size_bytes, mime_type, status, created_at, completed_at
 		FROM attachments
 		WHERE experiment_id = $1::uuid
 		ORDER BY created_at ASC
@@ -361,6 +379,31 @@ func (s *Service) ForensicExport(ctx context.Context, experimentID string) (map[
 		return nil, err
 	}
 
+	// Preserve which attachments each entry carries: those uploaded against
+	// the entry and those referenced inline from its body.
+	boundByEntry := make(map[string][]string)
+	for _, a := range attachments {
+		entryID, _ := a["entry_id"].(string)
+		attachmentID, _ := a["attachment_id"].(string)
+		if entryID != "" {
+			boundByEntry[entryID] = append(boundByEntry[entryID], attachmentID)
+		}
+	}
+	for _, entry := range entries {
+		entryID, _ := entry["entry_id"].(string)
+		body, _ := entry["body"].(string)
+		bound := boundByEntry[entryID]
+		if bound == nil {
+			bound = []string{}
+		}
+		refs := experiments.AttachmentRefs(body)
+		if refs == nil {
+			refs = []string{}
+		}
+		entry["attachment_ids"] = bound
+		entry["attachment_refs"] = refs
+	}
+
 	auditRows, err := s.db.QueryContext(ctx, `
 		SELECT
 			id,
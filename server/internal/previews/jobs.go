@@ -0,0 +1,474 @@
+package previews
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	internaldb "github.com/mjhen/elnote/server/internal/db"
+)
+
+const (
+	JobStatusQueued    = "queued"
+	JobStatusRunning   = "running"
+	JobStatusSucceeded = "succeeded"
+	JobStatusFailed    = "failed"
+	JobStatusSkipped   = "skipped"
+)
+
+const maxRetryBackoff = time.Hour
+
+// JobPolicy controls retries of preview jobs. A failed attempt is retried
+// after RetryBackoff, doubling per attempt, until MaxAttempts is reached.
+type JobPolicy struct {
+	MaxAttempts  int
+	RetryBackoff time.Duration
+	// LeaseTimeout is how long a running job may go without finishing before
+	// another worker reclaims it.
+	LeaseTimeout time.Duration
+}
+
+func normalizeJobPolicy(p JobPolicy) JobPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = 5
+	}
+	if p.RetryBackoff <= 0 {
+		p.RetryBackoff = 30 * time.Second
+	}
+	if p.LeaseTimeout <= 0 {
+		p.LeaseTimeout = 10 * time.Minute
+	}
+	return p
+}
+
+type PreviewJob struct {
+	ID            string     `json:"jobId"`
+	AttachmentID  string     `json:"attachmentId"`
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"`
+	MaxAttempts   int        `json:"maxAttempts"`
+	LastError     *string    `json:"lastError,omitempty"`
+	NextAttemptAt *time.Time `json:"nextAttemptAt,omitempty"`
+	StartedAt     *time.Time `json:"startedAt,omitempty"`
+	FinishedAt    *time.Time `json:"finishedAt,omitempty"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	UpdatedAt     time.Time  `json:"updatedAt"`
+}
+
+type ProcessInput struct {
+	Limit int
+}
+
+type ProcessOutput struct {
+	Claimed   int `json:"claimed"`
+	Succeeded int `json:"succeeded"`
+	Retrying  int `json:"retrying"`
+	Failed    int `json:"failed"`
+	Skipped   int `json:"skipped"`
+}
+
+type claimedJob struct {
+	id          string
+	attachment  string
+	attempts    int
+	maxAttempts int
+	objectKey   string
+	name        string
+	mimeType    string
+	sizeBytes   int64
+	scanStatus  string
+}
+
+// jobOutcome is the result of one attempt. Permanent failures are not
+// retried; transient ones are until attempts run out.
+type jobOutcome struct {
+	status    string
+	err       error
+	permanent bool
+}
+
+const previewJobColumns = `
+	id::text, attachment_id::text, status, attempts, max_attempts, last_error,
+	CASE WHEN status = 'queued' THEN next_attempt_at END, started_at, finished_at, created_at, updated_at`
+
+func scanPreviewJob(row interface{ Scan(...any) error }) (*PreviewJob, error) {
+	var (
+		job           PreviewJob
+		lastError     sql.NullString
+		nextAttemptAt sql.NullTime
+		startedAt     sql.NullTime
+		finishedAt    sql.NullTime
+	)
+	if err := row.Scan(&job.ID, &job.AttachmentID, &job.Status, &job.Attempts, &job.MaxAttempts, &lastError,
+		&nextAttemptAt, &startedAt, &finishedAt, &job.CreatedAt, &job.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if lastError.Valid {
+		job.LastError = &lastError.String
+	}
+	if nextAttemptAt.Valid {
+		job.NextAttemptAt = &nextAttemptAt.Time
+	}
+	if startedAt.Valid {
+		job.StartedAt = &startedAt.Time
+	}
+	if finishedAt.Valid {
+		job.FinishedAt = &finishedAt.Time
+	}
+	return &job, nil
+}
+
+// Enqueue creates the preview job for a completed attachment. It is
+// idempotent: an existing job is returned unchanged.
+func (s *Service) Enqueue(ctx context.Context, attachmentID, actorUserID string) (*PreviewJob, error) {
+	var status string
+	err := s.db.QueryRowContext(ctx, `SELECT status FROM attachments WHERE id = $1::uuid`, attachmentID).Scan(&status)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("query attachment: %w", err)
+	}
+	if status != "completed" {
+		return nil, fmt.Errorf("%w: attachment upload is not completed", ErrInvalidInput)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	job, err := scanPreviewJob(tx.QueryRowContext(ctx, `
+		INSERT INTO preview_jobs (attachment_id, max_attempts)
+		VALUES ($1::uuid, $2)
+		ON CONFLICT (attachment_id) DO NOTHING
+		RETURNING `+previewJobColumns,
+		attachmentID, s.jobs.MaxAttempts,
+	))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return s.getJob(ctx, attachmentID)
+		}
+		return nil, fmt.Errorf("insert preview job: %w", err)
+	}
+
+	if err := internaldb.AppendAuditEvent(ctx, tx, actorUserID, "attachment.preview_job.enqueue", "attachment", attachmentID, map[string]any{
+		"jobId":       job.ID,
+		"maxAttempts": job.MaxAttempts,
+	}); err != nil {
+		return nil, fmt.Errorf("append attachment.preview_job.enqueue audit event: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return job, nil
+}
+
+// EnqueueCompleted creates jobs for completed attachments that have neither
+// a job nor a thumbnail, so uploads whose enqueue was missed still get
+// previews.
+func (s *Service) EnqueueCompleted(ctx context.Context, limit int) (int, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+	res, err := s.db.ExecContext(ctx, `
+		INSERT INTO preview_jobs (attachment_id, max_attempts)
+		SELECT a.id, $2
+		FROM attachments a
+		WHERE a.status = 'completed'
+		  AND NOT EXISTS (SELECT 1 FROM preview_jobs j WHERE j.attachment_id = a.id)
+		  AND NOT EXISTS (SELECT 1 FROM attachment_previews p WHERE p.attachment_id = a.id)
+		ORDER BY a.completed_at DESC NULLS LAST
+		LIMIT $1
+		ON CONFLICT (attachment_id) DO NOTHING
+	`, limit, s.jobs.MaxAttempts)
+	if err != nil {
+		return 0, fmt.Errorf("enqueue completed attachments: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("count enqueued preview jobs: %w", err)
+	}
+	return int(n), nil
+}
+
+// RequestPreview enqueues a preview job on behalf of a user, or requeues a
+// job that has exhausted its attempts.
+func (s *Service) RequestPreview(ctx context.Context, attachmentID, userID, role string) (*PreviewJob, error) {
+	if err := s.checkAttachmentAccess(ctx, attachmentID, userID, role); err != nil {
+		return nil, err
+	}
+
+	job, err := s.getJob(ctx, attachmentID)
+	if errors.Is(err, ErrNotFound) {
+		return s.Enqueue(ctx, attachmentID, userID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if job.Status != JobStatusFailed {
+		return job, nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	job, err = scanPreviewJob(tx.QueryRowContext(ctx, `
+		UPDATE preview_jobs
+		SET status = 'queued',
+			max_attempts = attempts + $2,
+			next_attempt_at = NOW(),
+			finished_at = NULL,
+			updated_at = NOW()
+		WHERE attachment_id = $1::uuid AND status = 'failed'
+		RETURNING `+previewJobColumns,
+		attachmentID, s.jobs.MaxAttempts,
+	))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return s.getJob(ctx, attachmentID)
+		}
+		return nil, fmt.Errorf("requeue preview job: %w", err)
+	}
+
+	if err := internaldb.AppendAuditEvent(ctx, tx, userID, "attachment.preview_job.requeue", "attachment", attachmentID, map[string]any{
+		"jobId":       job.ID,
+		"attempts":    job.Attempts,
+		"maxAttempts": job.MaxAttempts,
+	}); err != nil {
+		return nil, fmt.Errorf("append attachment.preview_job.requeue audit event: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return job, nil
+}
+
+// GetJobForAttachment returns the preview job status for an attachment,
+// checking experiment access first.
+func (s *Service) GetJobForAttachment(ctx context.Context, attachmentID, userID, role string) (*PreviewJob, error) {
+	if err := s.checkAttachmentAccess(ctx, attachmentID, userID, role); err != nil {
+		return nil, err
+	}
+	return s.getJob(ctx, attachmentID)
+}
+
+func (s *Service) getJob(ctx context.Context, attachmentID string) (*PreviewJob, error) {
+	job, err := scanPreviewJob(s.db.QueryRowContext(ctx,
+		`SELECT `+previewJobColumns+` FROM preview_jobs WHERE attachment_id = $1::uuid`, attachmentID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("query preview job: %w", err)
+	}
+	return job, nil
+}
+
+// ProcessJobs claims due jobs and generates their previews from the stored
+// objects. Jobs for attachments still awaiting a content scan stay queued;
+// quarantined attachments are skipped.
+func (s *Service) ProcessJobs(ctx context.Context, in ProcessInput) (ProcessOutput, error) {
+	out := ProcessOutput{}
+	if in.Limit <= 0 {
+		in.Limit = 10
+	}
+
+	claimed, err := s.claimJobs(ctx, in.Limit)
+	if err != nil {
+		return out, err
+	}
+	out.Claimed = len(claimed)
+
+	for _, job := range claimed {
+		outcome := s.runJob(ctx, job)
+		status, err := s.finishJob(ctx, job, outcome)
+		if err != nil {
+			return out, err
+		}
+		switch status {
+		case JobStatusSucceeded:
+			out.Succeeded++
+		case JobStatusSkipped:
+			out.Skipped++
+		case JobStatusFailed:
+			out.Failed++
+		case JobStatusQueued:
+			out.Retrying++
+		}
+	}
+	return out, nil
+}
+
+func (s *Service) claimJobs(ctx context.Context, limit int) ([]claimedJob, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		WITH due AS (
+			SELECT j.id
+			FROM preview_jobs j
+			JOIN attachments a ON a.id = j.attachment_id
+			WHERE ((j.status = 'queued' AND j.next_attempt_at <= NOW())
+			    OR (j.status = 'running' AND j.started_at < NOW() - make_interval(secs => $2)))
+			  AND a.scan_status NOT IN ('pending_scan', 'scan_failed')
+			ORDER BY j.next_attempt_at ASC
+			LIMIT $1
+			FOR UPDATE OF j SKIP LOCKED
+		)
+		UPDATE preview_jobs j
+		SET status = 'running',
+			attempts = j.attempts + 1,
+			started_at = NOW(),
+			updated_at = NOW()
+		FROM due, attachments a
+		WHERE j.id = due.id
+		  AND a.id = j.attachment_id
+		RETURNING j.id::text, j.attachment_id::text, j.attempts, j.max_attempts,
+			a.content_object_key, a.object_key, a.mime_type, a.size_bytes, a.scan_status
+	`, limit, s.jobs.LeaseTimeout.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("claim preview jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var claimed []claimedJob
+	for rows.Next() {
+		var job claimedJob
+		if err := rows.Scan(&job.id, &job.attachment, &job.attempts, &job.maxAttempts,
+			&job.objectKey, &job.name, &job.mimeType, &job.sizeBytes, &job.scanStatus); err != nil {
+			return nil, fmt.Errorf("scan claimed preview job: %w", err)
+		}
+		claimed = append(claimed, job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate claimed preview jobs: %w", err)
+	}
+	return claimed, nil
+}
+
+func (s *Service) runJob(ctx context.Context, job claimedJob) jobOutcome {
+	if job.scanStatus == "quarantined" {
+		return jobOutcome{status: JobStatusSkipped, err: errors.New("attachment is quarantined")}
+	}
+	textType := ""
+	if !IsSupportedImageMime(job.mimeType) {
+		textType = TextPreviewType(job.mimeType, job.name)
+		if textType == "" {
+			return jobOutcome{status: JobStatusSkipped, err: fmt.Errorf("no preview renderer for %s", job.mimeType)}
+		}
+	}
+	// Logs and tables only read the head of the object, so the size limit
+	// applies to images and to sequence files, which are read in full.
+	limited := textType == "" || textType == PreviewTypeSequence
+	if limited && s.maxSourceBytes > 0 && job.sizeBytes > s.maxSourceBytes {
+		return jobOutcome{status: JobStatusSkipped, err: fmt.Errorf("object is larger than the %d byte preview limit", s.maxSourceBytes)}
+	}
+	if s.objects == nil {
+		return jobOutcome{err: errors.New("object store is not configured")}
+	}
+
+	rc, err := s.objects.Open(ctx, job.objectKey)
+	if err != nil {
+		return jobOutcome{err: fmt.Errorf("open stored object: %w", err)}
+	}
+	defer rc.Close()
+
+	if textType != "" {
+		var r io.Reader = rc
+		if limited && s.maxSourceBytes > 0 {
+			r = io.LimitReader(rc, s.maxSourceBytes)
+		}
+		if _, err := s.GenerateTextPreview(ctx, job.attachment, textType, "", r); err != nil {
+			return jobOutcome{err: err, permanent: errors.Is(err, ErrInvalidInput)}
+		}
+		return jobOutcome{status: JobStatusSucceeded}
+	}
+
+	limit := s.maxSourceBytes
+	if limit <= 0 {
+		limit = job.sizeBytes
+	}
+	data, err := io.ReadAll(io.LimitReader(rc, limit+1))
+	if err != nil {
+		return jobOutcome{err: fmt.Errorf("read stored object: %w", err)}
+	}
+	if int64(len(data)) > limit {
+		return jobOutcome{status: JobStatusSkipped, err: fmt.Errorf("object is larger than the %d byte preview limit", limit)}
+	}
+
+	if _, err := s.GeneratePreviews(ctx, GenerateInput{
+		AttachmentID: job.attachment,
+		ImageData:    data,
+		SourceMime:   job.mimeType,
+	}); err != nil {
+		return jobOutcome{err: err, permanent: errors.Is(err, ErrInvalidInput)}
+	}
+	return jobOutcome{status: JobStatusSucceeded}
+}
+
+// finishJob records an attempt's outcome and returns the job's new status.
+func (s *Service) finishJob(ctx context.Context, job claimedJob, outcome jobOutcome) (string, error) {
+	status := outcome.status
+	var lastError any
+	if outcome.err != nil {
+		lastError = outcome.err.Error()
+	}
+	if status == "" {
+		status = JobStatusQueued
+		if outcome.permanent || job.attempts >= job.maxAttempts {
+			status = JobStatusFailed
+		}
+	}
+
+	backoff := s.jobs.RetryBackoff << (job.attempts - 1)
+	if backoff <= 0 || backoff > maxRetryBackoff {
+		backoff = maxRetryBackoff
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `
+		UPDATE preview_jobs
+		SET status = $2,
+			last_error = $3,
+			next_attempt_at = CASE WHEN $2::text = 'queued' THEN NOW() + make_interval(secs => $4) ELSE next_attempt_at END,
+			finished_at = CASE WHEN $2::text = 'queued' THEN NULL ELSE NOW() END,
+			updated_at = NOW()
+		WHERE id = $1::uuid AND status = 'running' AND attempts = $5
+	`, job.id, status, lastError, backoff.Seconds(), job.attempts)
+	if err != nil {
+		return "", fmt.Errorf("update preview job: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return "", fmt.Errorf("check preview job update: %w", err)
+	} else if n == 0 {
+		// Another worker reclaimed the job after the lease expired.
+		return "", nil
+	}
+
+	if status != JobStatusQueued {
+		if err := internaldb.AppendAuditEvent(ctx, tx, "", "attachment.preview_job."+status, "attachment", job.attachment, map[string]any{
+			"jobId":    job.id,
+			"attempts": job.attempts,
+			"error":    lastError,
+		}); err != nil {
+			return "", fmt.Errorf("append attachment.preview_job.%s audit event: %w", status, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("commit: %w", err)
+	}
+	return status, nil
+}
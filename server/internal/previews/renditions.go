@@ -0,0 +1,242 @@
+package previews
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rendition names, smallest first. Larger renditions are only produced when
+// the source is bigger than the next smaller one, so a 300px image gets a
+// thumbnail and a medium rendition at its native size but no large.
+const (
+	RenditionThumbnail = "thumbnail"
+	RenditionMedium    = "medium"
+	RenditionLarge     = "large"
+)
+
+type rendition struct {
+	name   string
+	maxDim int
+}
+
+var renditions = []rendition{
+	{name: RenditionThumbnail, maxDim: thumbnailMaxDim},
+	{name: RenditionMedium, maxDim: 1024},
+	{name: RenditionLarge, maxDim: 2048},
+}
+
+const (
+	jpegQuality = 85
+	// photoColorThreshold is the number of distinct colours above which an
+	// image is treated as photographic and encoded as JPEG.
+	photoColorThreshold = 1024
+	photoSampleLimit    = 1 << 16
+)
+
+// ObjectStore reads source objects and, when configured, stores larger
+// renditions. The attachments object store inspector satisfies it.
+type ObjectStore interface {
+	Open(ctx context.Context, objectKey string) (io.ReadCloser, error)
+	Put(ctx context.Context, objectKey, contentType string, data []byte) error
+}
+
+// DownloadSigner issues short-lived URLs for renditions kept in the object
+// store.
+type DownloadSigner interface {
+	SignDownload(objectKey string, expiresAt time.Time) (string, error)
+}
+
+// StoragePolicy decides where rendition bytes live. Renditions other than
+// the thumbnail whose encoded size reaches ObjectStoreMinBytes are written to
+// the object store instead of attachment_previews.data; zero keeps every
+// rendition in Postgres.
+type StoragePolicy struct {
+	ObjectStoreMinBytes int64
+	URLTTL              time.Duration
+}
+
+// RenditionRequest selects a rendition by name or by the largest dimension
+// the caller intends to display. An empty request selects the thumbnail.
+type RenditionRequest struct {
+	Name   string
+	MaxDim int
+}
+
+// ValidateRenditionName reports whether name is a known rendition or the
+// page-N preview of a stack.
+func ValidateRenditionName(name string) error {
+	for _, r := range renditions {
+		if r.name == name {
+			return nil
+		}
+	}
+	if isPageRendition(name) {
+		return nil
+	}
+	return fmt.Errorf("%w: unknown rendition %q", ErrInvalidInput, name)
+}
+
+// isPageRendition reports whether name is a "page-N" preview, N from 1.
+func isPageRendition(name string) bool {
+	n, err := strconv.Atoi(strings.TrimPrefix(name, "page-"))
+	return strings.HasPrefix(name, "page-") && err == nil && n >= 1 && strconv.Itoa(n) == name[len("page-"):]
+}
+
+type encodedRendition struct {
+	name     string
+	mimeType string
+	width    int
+	height   int
+	data     []byte
+	// objectKey is set when the bytes are stored in the object store.
+	objectKey string
+}
+
+// renderRenditions produces every applicable rendition of the source.
+// Stacks are rendered as a montage at each size.
+func renderRenditions(src decodedSource) ([]encodedRendition, error) {
+	b := src.pages[0].Bounds()
+	sourceDim := b.Dx()
+	if b.Dy() > sourceDim {
+		sourceDim = b.Dy()
+	}
+
+	var out []encodedRendition
+	for i, r := range renditions {
+		if i > 0 && sourceDim <= renditions[i-1].maxDim {
+			break
+		}
+		var img image.Image
+		if len(src.pages) > 1 {
+			img = montage(src.pages, r.maxDim)
+		} else {
+			img = resample(src.pages[0], r.maxDim, r.maxDim)
+		}
+		data, mimeType, err := encodeRendition(img)
+		if err != nil {
+			return nil, fmt.Errorf("encode %s rendition: %w", r.name, err)
+		}
+		rb := img.Bounds()
+		out = append(out, encodedRendition{
+			name:     r.name,
+			mimeType: mimeType,
+			width:    rb.Dx(),
+			height:   rb.Dy(),
+			data:     data,
+		})
+	}
+	return out, nil
+}
+
+// encodeRendition uses JPEG for photographic content and lossless PNG for
+// everything else, which keeps gels, plots and 8-bit grayscale exact.
+func encodeRendition(img image.Image) ([]byte, string, error) {
+	if isPhotographic(img) {
+		data, err := EncodeJPEG(img, jpegQuality)
+		return data, "image/jpeg", err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), "image/png", nil
+}
+
+// isPhotographic samples the image and reports whether it has many distinct
+// opaque colours.
+func isPhotographic(img image.Image) bool {
+	b := img.Bounds()
+	pixels := b.Dx() * b.Dy()
+	stride := 1
+	if pixels > photoSampleLimit {
+		stride = pixels / photoSampleLimit
+	}
+	colors := make(map[uint32]struct{}, photoColorThreshold+1)
+	for i := 0; i < pixels; i += stride {
+		r, g, bl, a := img.At(b.Min.X+i%b.Dx(), b.Min.Y+i/b.Dx()).RGBA()
+		if a != 0xffff {
+			return false
+		}
+		colors[(r>>8)<<16|(g>>8)<<8|bl>>8] = struct{}{}
+		if len(colors) > photoColorThreshold {
+			return true
+		}
+	}
+	return false
+}
+
+func renditionObjectKey(attachmentID string, r encodedRendition) string {
+	ext := ".png"
+	if r.mimeType == "image/jpeg" {
+		ext = ".jpg"
+	}
+	return "previews/" + attachmentID + "/" + r.name + ext
+}
+
+// offloadRenditions writes large renditions to the object store before the
+// metadata transaction, so no object-store round trip runs inside it.
+func (s *Service) offloadRenditions(ctx context.Context, attachmentID string, rs []encodedRendition) error {
+	if s.storage.ObjectStoreMinBytes <= 0 || s.objects == nil {
+		return nil
+	}
+	for i := range rs {
+		r := &rs[i]
+		if r.name == RenditionThumbnail || int64(len(r.data)) < s.storage.ObjectStoreMinBytes {
+			continue
+		}
+		key := renditionObjectKey(attachmentID, *r)
+		if err := s.objects.Put(ctx, key, r.mimeType, r.data); err != nil {
+			return fmt.Errorf("store %s rendition: %w", r.name, err)
+		}
+		r.objectKey = key
+	}
+	return nil
+}
+
+// selectRendition picks from the available renditions (smallest first).
+// A named request falls back to the largest smaller rendition when the
+// source was too small to produce it; a dimension request picks the smallest
+// rendition at least that large, or the largest available.
+func selectRendition(available []Preview, want RenditionRequest) (Preview, bool) {
+	if len(available) == 0 {
+		return Preview{}, false
+	}
+	name := strings.TrimSpace(want.Name)
+	if name == "" && want.MaxDim <= 0 {
+		name = RenditionThumbnail
+	}
+	if name != "" {
+		var best *Preview
+		for _, r := range renditions {
+			for i := range available {
+				if available[i].PreviewType == r.name {
+					best = &available[i]
+				}
+			}
+			if r.name == name {
+				break
+			}
+		}
+		if best == nil {
+			return available[0], true
+		}
+		return *best, true
+	}
+	for _, p := range available {
+		dim := p.Width
+		if p.Height > dim {
+			dim = p.Height
+		}
+		if dim >= want.MaxDim {
+			return p, true
+		}
+	}
+	return available[len(available)-1], true
+}
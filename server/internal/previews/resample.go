@@ -0,0 +1,189 @@
+package previews
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+// Downscaling for preview renditions. Large reductions use area averaging,
+// which weighs every source pixel by how much of it falls inside the output
+// pixel; moderate reductions use a Lanczos-3 filter widened by the scale
+// factor so fine detail (gel bands, cell edges) stays sharp without aliasing.
+
+const (
+	lanczosLobes = 3
+	// areaScaleThreshold is the reduction factor from which area averaging
+	// is used instead of Lanczos.
+	areaScaleThreshold = 3.0
+)
+
+// fitSize returns the dimensions of src scaled to fit within maxW x maxH,
+// never enlarging.
+func fitSize(srcW, srcH, maxW, maxH int) (int, int) {
+	if srcW <= maxW && srcH <= maxH {
+		return srcW, srcH
+	}
+	scale := math.Min(float64(maxW)/float64(srcW), float64(maxH)/float64(srcH))
+	w := int(math.Round(float64(srcW) * scale))
+	h := int(math.Round(float64(srcH) * scale))
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+	return w, h
+}
+
+// resample scales src to fit within maxW x maxH, preserving aspect ratio.
+// The result is an *image.RGBA composited over the dark preview background.
+func resample(src image.Image, maxW, maxH int) image.Image {
+	b := src.Bounds()
+	dstW, dstH := fitSize(b.Dx(), b.Dy(), maxW, maxH)
+
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), &image.Uniform{color.RGBA{0x1f, 0x1f, 0x1f, 0xff}}, image.Point{}, draw.Src)
+	draw.Draw(rgba, rgba.Bounds(), src, b.Min, draw.Over)
+	if dstW == b.Dx() && dstH == b.Dy() {
+		return rgba
+	}
+
+	factor := math.Max(float64(b.Dx())/float64(dstW), float64(b.Dy())/float64(dstH))
+	var kernel func(srcLen, dstLen int) [][]weight
+	if factor >= areaScaleThreshold {
+		kernel = areaWeights
+	} else {
+		kernel = lanczosWeights
+	}
+
+	// Separable two-pass filter: horizontal into a float buffer, then
+	// vertical into the output.
+	horiz := kernel(b.Dx(), dstW)
+	tmp := make([]float64, dstW*b.Dy()*4)
+	for y := 0; y < b.Dy(); y++ {
+		row := rgba.Pix[y*rgba.Stride:]
+		for x, ws := range horiz {
+			var r, g, bl, a float64
+			for _, w := range ws {
+				p := row[w.index*4:]
+				r += float64(p[0]) * w.value
+				g += float64(p[1]) * w.value
+				bl += float64(p[2]) * w.value
+				a += float64(p[3]) * w.value
+			}
+			o := (y*dstW + x) * 4
+			tmp[o], tmp[o+1], tmp[o+2], tmp[o+3] = r, g, bl, a
+		}
+	}
+
+	vert := kernel(b.Dy(), dstH)
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+	for y, ws := range vert {
+		for x := 0; x < dstW; x++ {
+			var r, g, bl, a float64
+			for _, w := range ws {
+				o := (w.index*dstW + x) * 4
+				r += tmp[o] * w.value
+				g += tmp[o+1] * w.value
+				bl += tmp[o+2] * w.value
+				a += tmp[o+3] * w.value
+			}
+			p := dst.Pix[y*dst.Stride+x*4:]
+			p[0], p[1], p[2], p[3] = clampByte(r), clampByte(g), clampByte(bl), clampByte(a)
+		}
+	}
+	return dst
+}
+
+type weight struct {
+	index int
+	value float64
+}
+
+// areaWeights gives each output sample the coverage-weighted mean of the
+// source samples it spans.
+func areaWeights(srcLen, dstLen int) [][]weight {
+	scale := float64(srcLen) / float64(dstLen)
+	out := make([][]weight, dstLen)
+	for i := range out {
+		start := float64(i) * scale
+		end := start + scale
+		var ws []weight
+		for j := int(start); j < srcLen && float64(j) < end; j++ {
+			cover := math.Min(end, float64(j+1)) - math.Max(start, float64(j))
+			if cover > 0 {
+				ws = append(ws, weight{index: j, value: cover / scale})
+			}
+		}
+		out[i] = ws
+	}
+	return out
+}
+
+// lanczosWeights computes normalized Lanczos-3 taps, widening the kernel by
+// the reduction factor.
+func lanczosWeights(srcLen, dstLen int) [][]weight {
+	scale := float64(srcLen) / float64(dstLen)
+	support := float64(lanczosLobes)
+	if scale > 1 {
+		support *= scale
+	}
+	out := make([][]weight, dstLen)
+	for i := range out {
+		center := (float64(i)+0.5)*scale - 0.5
+		lo := int(math.Floor(center - support))
+		hi := int(math.Ceil(center + support))
+		var (
+			ws  []weight
+			sum float64
+		)
+		for j := lo; j <= hi; j++ {
+			x := float64(j) - center
+			if scale > 1 {
+				x /= scale
+			}
+			v := lanczos(x)
+			if v == 0 {
+				continue
+			}
+			idx := j
+			if idx < 0 {
+				idx = 0
+			} else if idx >= srcLen {
+				idx = srcLen - 1
+			}
+			ws = append(ws, weight{index: idx, value: v})
+			sum += v
+		}
+		if sum != 0 {
+			for k := range ws {
+				ws[k].value /= sum
+			}
+		}
+		out[i] = ws
+	}
+	return out
+}
+
+func lanczos(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	if x <= -lanczosLobes || x >= lanczosLobes {
+		return 0
+	}
+	px := math.Pi * x
+	return lanczosLobes * math.Sin(px) * math.Sin(px/lanczosLobes) / (px * px)
+}
+
+func clampByte(v float64) uint8 {
+	if v <= 0 {
+		return 0
+	}
+	if v >= 255 {
+		return 255
+	}
+	return uint8(v + 0.5)
+}
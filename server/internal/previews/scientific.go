@@ -0,0 +1,287 @@
+package previews
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	// Percentiles used for the auto-contrast stretch of high bit-depth
+	// images; the darkest and brightest 0.5% of samples are saturated.
+	stretchLowPercentile  = 0.005
+	stretchHighPercentile = 0.995
+	// stretchSampleLimit caps how many samples are sorted to estimate the
+	// percentiles.
+	stretchSampleLimit = 1 << 18
+	// maxStackPages is how many pages of a stack are rendered into the
+	// montage and per-page thumbnails.
+	maxStackPages = 16
+)
+
+// ImageMetadata describes the source image a preview was rendered from.
+type ImageMetadata struct {
+	AttachmentID string    `json:"attachmentId"`
+	Format       string    `json:"format"`
+	Width        int       `json:"width"`
+	Height       int       `json:"height"`
+	BitDepth     int       `json:"bitDepth"`
+	Channels     int       `json:"channels"`
+	PageCount    int       `json:"pageCount"`
+	SampleFormat string    `json:"sampleFormat"`
+	DisplayMin   *float64  `json:"displayMin,omitempty"`
+	DisplayMax   *float64  `json:"displayMax,omitempty"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// decodedSource is a source image converted to 8-bit pages ready for
+// thumbnailing.
+type decodedSource struct {
+	pages    []image.Image
+	metadata ImageMetadata
+}
+
+// decodeSource decodes the supported formats. TIFF files go through the
+// in-package reader so that 16-bit and multi-page stacks are handled; other
+// formats use the standard library decoders.
+func decodeSource(data []byte) (decodedSource, error) {
+	if isTIFF(data) {
+		return decodeTIFFSource(data)
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return decodedSource{}, fmt.Errorf("%w: cannot decode image: %v", ErrInvalidInput, err)
+	}
+	bounds := img.Bounds()
+	meta := ImageMetadata{
+		Format:       format,
+		Width:        bounds.Dx(),
+		Height:       bounds.Dy(),
+		BitDepth:     8,
+		Channels:     channelCount(img.ColorModel()),
+		PageCount:    1,
+		SampleFormat: "uint",
+	}
+	switch img.ColorModel() {
+	case color.Gray16Model, color.RGBA64Model, color.NRGBA64Model:
+		meta.BitDepth = 16
+		stretched, low, high := stretchWide(img)
+		img = stretched
+		meta.DisplayMin, meta.DisplayMax = &low, &high
+	}
+	return decodedSource{pages: []image.Image{img}, metadata: meta}, nil
+}
+
+func decodeTIFFSource(data []byte) (decodedSource, error) {
+	f, err := openTIFF(data)
+	if err != nil {
+		return decodedSource{}, fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+
+	n := f.pageCount()
+	if n > maxStackPages {
+		n = maxStackPages
+	}
+	var (
+		pages []image.Image
+		meta  ImageMetadata
+	)
+	for i := 0; i < n; i++ {
+		decoded, err := f.decodePage(i)
+		if err != nil {
+			if i > 0 && errors.Is(err, errUnsupportedTIFF) {
+				// Thumbnails, masks or other oddities after the first page
+				// do not prevent a preview of the stack itself.
+				break
+			}
+			return decodedSource{}, fmt.Errorf("%w: %v", ErrInvalidInput, err)
+		}
+		if i == 0 {
+			meta = ImageMetadata{
+				Format:       "tiff",
+				Width:        decoded.page.width,
+				Height:       decoded.page.height,
+				BitDepth:     decoded.page.bitsPerSample,
+				Channels:     decoded.page.samplesPerPixel,
+				PageCount:    f.pageCount(),
+				SampleFormat: sampleFormatName(decoded.page.sampleFormat),
+			}
+		}
+		img, low, high := renderSamples(decoded)
+		if i == 0 && (decoded.page.bitsPerSample > 8 || decoded.page.sampleFormat != tiffSampleUint) {
+			meta.DisplayMin, meta.DisplayMax = &low, &high
+		}
+		pages = append(pages, img)
+	}
+	return decodedSource{pages: pages, metadata: meta}, nil
+}
+
+func sampleFormatName(format int) string {
+	switch format {
+	case tiffSampleInt:
+		return "int"
+	case tiffSampleFloat:
+		return "float"
+	default:
+		return "uint"
+	}
+}
+
+func channelCount(model color.Model) int {
+	switch model {
+	case color.GrayModel, color.Gray16Model:
+		return 1
+	case color.RGBAModel, color.NRGBAModel, color.RGBA64Model, color.NRGBA64Model:
+		return 4
+	case color.CMYKModel:
+		return 4
+	default:
+		return 3
+	}
+}
+
+// renderSamples converts a decoded TIFF page to an 8-bit image. 8-bit
+// unsigned data is shown as stored; anything wider is percentile stretched.
+func renderSamples(s tiffSamples) (image.Image, float64, float64) {
+	p := s.page
+	low, high := 0.0, 255.0
+	if p.bitsPerSample > 8 || p.sampleFormat != tiffSampleUint {
+		low, high = percentileRange(s.samples, p.samplesPerPixel, p.photometric == 2)
+	}
+	scale := 0.0
+	if high > low {
+		scale = 255 / (high - low)
+	}
+	toByte := func(v float32) uint8 {
+		x := (float64(v) - low) * scale
+		if p.photometric == 0 {
+			x = 255 - x
+		}
+		if x <= 0 || math.IsNaN(x) {
+			return 0
+		}
+		if x >= 255 {
+			return 255
+		}
+		return uint8(x + 0.5)
+	}
+
+	rect := image.Rect(0, 0, p.width, p.height)
+	spp := p.samplesPerPixel
+	if p.photometric == 2 {
+		dst := image.NewRGBA(rect)
+		for i := 0; i < p.width*p.height; i++ {
+			dst.Pix[i*4] = toByte(s.samples[i*spp])
+			dst.Pix[i*4+1] = toByte(s.samples[i*spp+1])
+			dst.Pix[i*4+2] = toByte(s.samples[i*spp+2])
+			dst.Pix[i*4+3] = 0xff
+		}
+		return dst, low, high
+	}
+	// Grayscale: extra samples (alpha or additional channels) are ignored.
+	dst := image.NewGray(rect)
+	for i := 0; i < p.width*p.height; i++ {
+		dst.Pix[i] = toByte(s.samples[i*spp])
+	}
+	return dst, low, high
+}
+
+// percentileRange estimates the display range from a strided subset of the
+// samples. For grayscale only the first sample of each pixel is considered;
+// for RGB all three colour samples share one range so hues are preserved.
+func percentileRange(samples []float32, spp int, rgb bool) (float64, float64) {
+	perPixel := 1
+	if rgb {
+		perPixel = 3
+	}
+	pixels := len(samples) / spp
+	stride := 1
+	if pixels*perPixel > stretchSampleLimit {
+		stride = pixels * perPixel / stretchSampleLimit
+	}
+	subset := make([]float64, 0, pixels*perPixel/stride+perPixel)
+	for i := 0; i < pixels; i += stride {
+		for c := 0; c < perPixel; c++ {
+			v := float64(samples[i*spp+c])
+			if !math.IsNaN(v) && !math.IsInf(v, 0) {
+				subset = append(subset, v)
+			}
+		}
+	}
+	if len(subset) == 0 {
+		return 0, 0
+	}
+	sort.Float64s(subset)
+	low := subset[int(float64(len(subset)-1)*stretchLowPercentile)]
+	high := subset[int(float64(len(subset)-1)*stretchHighPercentile)]
+	if high <= low {
+		low, high = subset[0], subset[len(subset)-1]
+	}
+	return low, high
+}
+
+// stretchWide applies the percentile stretch to 16-bit images decoded by the
+// standard library (for example 16-bit PNG).
+func stretchWide(img image.Image) (image.Image, float64, float64) {
+	b := img.Bounds()
+	gray := img.ColorModel() == color.Gray16Model
+	spp := 3
+	if gray {
+		spp = 1
+	}
+	samples := make([]float32, 0, b.Dx()*b.Dy()*spp)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if gray {
+				samples = append(samples, float32(color.Gray16Model.Convert(img.At(x, y)).(color.Gray16).Y))
+				continue
+			}
+			c := color.NRGBA64Model.Convert(img.At(x, y)).(color.NRGBA64)
+			samples = append(samples, float32(c.R), float32(c.G), float32(c.B))
+		}
+	}
+	photometric := 2
+	if gray {
+		photometric = 1
+	}
+	return renderSamples(tiffSamples{
+		page: tiffPage{
+			width:           b.Dx(),
+			height:          b.Dy(),
+			bitsPerSample:   16,
+			samplesPerPixel: spp,
+			sampleFormat:    tiffSampleUint,
+			photometric:     photometric,
+		},
+		samples: samples,
+	})
+}
+
+// montage tiles up to maxStackPages page thumbnails into a square grid no
+// larger than the thumbnail size.
+func montage(pages []image.Image, maxDim int) image.Image {
+	cols := int(math.Ceil(math.Sqrt(float64(len(pages)))))
+	rows := (len(pages) + cols - 1) / cols
+	cell := maxDim / cols
+	if cell < 1 {
+		cell = 1
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, cols*cell, rows*cell))
+	draw.Draw(dst, dst.Bounds(), &image.Uniform{color.RGBA{0x1f, 0x1f, 0x1f, 0xff}}, image.Point{}, draw.Src)
+	for i, page := range pages {
+		tile := resample(page, cell, cell)
+		tb := tile.Bounds()
+		// Centre each tile in its cell.
+		x := (i%cols)*cell + (cell-tb.Dx())/2
+		y := (i/cols)*cell + (cell-tb.Dy())/2
+		draw.Draw(dst, image.Rect(x, y, x+tb.Dx(), y+tb.Dy()), tile, tb.Min, draw.Src)
+	}
+	return dst
+}
@@ -5,13 +5,11 @@ import (
 	"context"
 	"database/sql"
 	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"image"
-	"image/color"
-	"image/draw"
 	"image/jpeg"
-	"image/png"
 	"strings"
 	"time"
 
@@ -34,6 +32,10 @@ const (
 // Types
 // ---------------------------------------------------------------------------
 
+// Preview is one stored rendition. Image renditions kept in Postgres are
+// returned inline as DataBase64, those in the object store as a short-lived
+// URL, and textual previews as Content. A rendition listed without its
+// bytes carries Href, the API path that returns it.
 type Preview struct {
 	ID           string    `json:"previewId"`
 	AttachmentID string    `json:"attachmentId"`
@@ -41,8 +43,17 @@ type Preview struct {
 	MimeType     string    `json:"mimeType"`
 	Width        int       `json:"width"`
 	Height       int       `json:"height"`
-	DataBase64   string    `json:"dataBase64"`
+	SizeBytes    int64     `json:"sizeBytes"`
+	DataBase64   string    `json:"dataBase64,omitempty"`
+	URL          string    `json:"url,omitempty"`
+	Href         string    `json:"href,omitempty"`
 	CreatedAt    time.Time `json:"createdAt"`
+	// Content is the JSON document of a textual preview (text, table or
+	// sequence); image bytes are never returned here.
+	Content json.RawMessage `json:"content,omitempty"`
+	// ImageMetadata describes the source image; it is only populated when
+	// fetching a single attachment's preview.
+	ImageMetadata *ImageMetadata `json:"imageMetadata,omitempty"`
 }
 
 type GenerateInput struct {
@@ -57,39 +68,67 @@ type GenerateInput struct {
 // ---------------------------------------------------------------------------
 
 type Service struct {
-	db *sql.DB
+	db             *sql.DB
+	objects        ObjectStore
+	signer         DownloadSigner
+	maxSourceBytes int64
+	jobs           JobPolicy
+	storage        StoragePolicy
 }
 
-func NewService(db *sql.DB) *Service {
-	return &Service{db: db}
+func NewService(db *sql.DB, objects ObjectStore, signer DownloadSigner, maxSourceBytes int64, jobs JobPolicy, storage StoragePolicy) *Service {
+	if storage.URLTTL <= 0 {
+		storage.URLTTL = 15 * time.Minute
+	}
+	return &Service{
+		db:             db,
+		objects:        objects,
+		signer:         signer,
+		maxSourceBytes: maxSourceBytes,
+		jobs:           normalizeJobPolicy(jobs),
+		storage:        storage,
+	}
 }
 
-// GenerateThumbnail creates a thumbnail preview from raw image data
-// and stores it in the attachment_previews table.
-func (s *Service) GenerateThumbnail(ctx context.Context, in GenerateInput) (*Preview, error) {
+// GeneratePreviews renders the thumbnail, medium and large renditions from
+// raw image data and stores them in attachment_previews. Multi-page stacks
+// get montage renditions plus one "page-N" thumbnail per rendered page, and
+// the source image properties are recorded in attachment_image_metadata.
+// The thumbnail is returned.
+func (s *Service) GeneratePreviews(ctx context.Context, in GenerateInput) (*Preview, error) {
 	if len(in.ImageData) == 0 {
 		return nil, fmt.Errorf("%w: image data is empty", ErrInvalidInput)
 	}
 
-	// Decode source image
-	img, format, err := image.Decode(bytes.NewReader(in.ImageData))
+	src, err := decodeSource(in.ImageData)
 	if err != nil {
-		return nil, fmt.Errorf("%w: cannot decode image: %v", ErrInvalidInput, err)
+		return nil, err
 	}
-	_ = format
-
-	// Generate thumbnail (simple nearest-neighbor downscale)
-	thumb := resizeToFit(img, thumbnailMaxDim, thumbnailMaxDim)
 
-	// Encode as PNG
-	var buf bytes.Buffer
-	if err := png.Encode(&buf, thumb); err != nil {
-		return nil, fmt.Errorf("encode thumbnail: %w", err)
+	rs, err := renderRenditions(src)
+	if err != nil {
+		return nil, err
+	}
+	if len(src.pages) > 1 {
+		for i, page := range src.pages {
+			img := resample(page, thumbnailMaxDim, thumbnailMaxDim)
+			data, mimeType, err := encodeRendition(img)
+			if err != nil {
+				return nil, fmt.Errorf("encode page %d preview: %w", i+1, err)
+			}
+			b := img.Bounds()
+			rs = append(rs, encodedRendition{
+				name:     fmt.Sprintf("page-%d", i+1),
+				mimeType: mimeType,
+				width:    b.Dx(),
+				height:   b.Dy(),
+				data:     data,
+			})
+		}
+	}
+	if err := s.offloadRenditions(ctx, in.AttachmentID, rs); err != nil {
+		return nil, err
 	}
-
-	bounds := thumb.Bounds()
-	width := bounds.Dx()
-	height := bounds.Dy()
 
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
@@ -97,58 +136,242 @@ func (s *Service) GenerateThumbnail(ctx context.Context, in GenerateInput) (*Pre
 	}
 	defer tx.Rollback()
 
-	var preview Preview
-	err = tx.QueryRowContext(ctx,
-		`INSERT INTO attachment_previews (attachment_id, preview_type, mime_type, width, height, data)
-		 VALUES ($1, 'thumbnail', 'image/png', $2, $3, $4)
-		 ON CONFLICT (attachment_id, preview_type) DO NOTHING
-		 RETURNING id, attachment_id, preview_type, mime_type, width, height, created_at`,
-		in.AttachmentID, width, height, buf.Bytes(),
-	).Scan(&preview.ID, &preview.AttachmentID, &preview.PreviewType, &preview.MimeType, &preview.Width, &preview.Height, &preview.CreatedAt)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			// Already exists (DO NOTHING triggered), fetch existing
-			return s.GetPreview(ctx, in.AttachmentID, "thumbnail")
+	var thumbnail *Preview
+	stored := make([]string, 0, len(rs))
+	for _, r := range rs {
+		preview, err := insertPreview(ctx, tx, in.AttachmentID, r)
+		if err != nil {
+			return nil, err
+		}
+		if preview == nil {
+			continue
+		}
+		stored = append(stored, r.name)
+		if r.name == RenditionThumbnail {
+			thumbnail = preview
+			thumbnail.DataBase64 = base64.StdEncoding.EncodeToString(r.data)
 		}
-		return nil, fmt.Errorf("insert preview: %w", err)
 	}
-	preview.DataBase64 = base64.StdEncoding.EncodeToString(buf.Bytes())
 
-	if err := internaldb.AppendAuditEvent(ctx, tx, in.ActorUserID, "attachment.preview_generated", "attachment", in.AttachmentID, nil); err != nil {
-		return nil, fmt.Errorf("append attachment.preview_generated audit event: %w", err)
+	meta := src.metadata
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO attachment_image_metadata (attachment_id, format, width, height, bit_depth, channels, page_count, sample_format, display_min, display_max)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		 ON CONFLICT (attachment_id) DO NOTHING`,
+		in.AttachmentID, meta.Format, meta.Width, meta.Height, meta.BitDepth, meta.Channels, meta.PageCount, meta.SampleFormat, meta.DisplayMin, meta.DisplayMax,
+	); err != nil {
+		return nil, fmt.Errorf("insert image metadata: %w", err)
+	}
+
+	if len(stored) > 0 {
+		if err := internaldb.AppendAuditEvent(ctx, tx, in.ActorUserID, "attachment.preview_generated", "attachment", in.AttachmentID, map[string]any{
+			"format":     meta.Format,
+			"bitDepth":   meta.BitDepth,
+			"pageCount":  meta.PageCount,
+			"renditions": stored,
+		}); err != nil {
+			return nil, fmt.Errorf("append attachment.preview_generated audit event: %w", err)
+		}
 	}
 
 	if err := tx.Commit(); err != nil {
 		return nil, fmt.Errorf("commit: %w", err)
 	}
 
+	if thumbnail == nil {
+		// Already exists (DO NOTHING triggered), fetch existing
+		return s.GetPreview(ctx, in.AttachmentID, RenditionThumbnail)
+	}
+	return thumbnail, nil
+}
+
+// insertPreview stores one encoded rendition. It returns a nil preview when
+// one of that type already exists for the attachment.
+func insertPreview(ctx context.Context, tx *sql.Tx, attachmentID string, r encodedRendition) (*Preview, error) {
+	var data, objectKey any
+	if r.objectKey != "" {
+		objectKey = r.objectKey
+	} else {
+		data = r.data
+	}
+
+	var preview Preview
+	err := tx.QueryRowContext(ctx,
+		`INSERT INTO attachment_previews (attachment_id, preview_type, mime_type, width, height, data, object_key, size_bytes)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		 ON CONFLICT (attachment_id, preview_type) DO NOTHING
+		 RETURNING id, attachment_id, preview_type, mime_type, width, height, size_bytes, created_at`,
+		attachmentID, r.name, r.mimeType, r.width, r.height, data, objectKey, len(r.data),
+	).Scan(&preview.ID, &preview.AttachmentID, &preview.PreviewType, &preview.MimeType, &preview.Width, &preview.Height, &preview.SizeBytes, &preview.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("insert %s preview: %w", r.name, err)
+	}
 	return &preview, nil
 }
 
+// GetImageMetadata returns the recorded source image properties, if any.
+func (s *Service) GetImageMetadata(ctx context.Context, attachmentID string) (*ImageMetadata, error) {
+	var (
+		meta     ImageMetadata
+		min, max sql.NullFloat64
+	)
+	err := s.db.QueryRowContext(ctx,
+		`SELECT attachment_id, format, width, height, bit_depth, channels, page_count, sample_format, display_min, display_max, created_at
+		 FROM attachment_image_metadata
+		 WHERE attachment_id = $1`,
+		attachmentID,
+	).Scan(&meta.AttachmentID, &meta.Format, &meta.Width, &meta.Height, &meta.BitDepth, &meta.Channels, &meta.PageCount, &meta.SampleFormat, &min, &max, &meta.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("query image metadata: %w", err)
+	}
+	if min.Valid {
+		meta.DisplayMin = &min.Float64
+	}
+	if max.Valid {
+		meta.DisplayMax = &max.Float64
+	}
+	return &meta, nil
+}
+
+const previewColumns = `ap.id, ap.attachment_id, ap.preview_type, ap.mime_type, ap.width, ap.height,
+	COALESCE(ap.size_bytes, octet_length(ap.data), 0), ap.created_at`
+
+// scanPreview scans previewColumns followed by any extra columns.
+func scanPreview(row interface{ Scan(...any) error }, extra ...any) (Preview, error) {
+	var p Preview
+	dest := append([]any{&p.ID, &p.AttachmentID, &p.PreviewType, &p.MimeType, &p.Width, &p.Height, &p.SizeBytes, &p.CreatedAt}, extra...)
+	err := row.Scan(dest...)
+	return p, err
+}
+
 // GetPreview retrieves a stored preview by attachment ID and type.
 func (s *Service) GetPreview(ctx context.Context, attachmentID, previewType string) (*Preview, error) {
-	var preview Preview
-	var data []byte
-	err := s.db.QueryRowContext(ctx,
-		`SELECT id, attachment_id, preview_type, mime_type, width, height, data, created_at
-		 FROM attachment_previews
-		 WHERE attachment_id = $1 AND preview_type = $2`,
+	var (
+		data      []byte
+		objectKey sql.NullString
+	)
+	preview, err := scanPreview(s.db.QueryRowContext(ctx,
+		`SELECT `+previewColumns+`, ap.data, ap.object_key
+		 FROM attachment_previews ap
+		 WHERE ap.attachment_id = $1 AND ap.preview_type = $2`,
 		attachmentID, previewType,
-	).Scan(&preview.ID, &preview.AttachmentID, &preview.PreviewType, &preview.MimeType, &preview.Width, &preview.Height, &data, &preview.CreatedAt)
+	), &data, &objectKey)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrNotFound
 		}
 		return nil, fmt.Errorf("query preview: %w", err)
 	}
-	preview.DataBase64 = base64.StdEncoding.EncodeToString(data)
+	if err := s.attachContent(&preview, data, objectKey.String); err != nil {
+		return nil, err
+	}
 	return &preview, nil
 }
 
-// GetPreviewForAttachment retrieves the thumbnail for an attachment,
-// checking experiment access first.
-func (s *Service) GetPreviewForAttachment(ctx context.Context, attachmentID, userID, role string) (*Preview, error) {
-	// Verify access
+// attachContent fills in either the inline bytes or a signed URL.
+func (s *Service) attachContent(p *Preview, data []byte, objectKey string) error {
+	if objectKey == "" {
+		if isTextualPreview(p.PreviewType) {
+			p.Content = data
+			return nil
+		}
+		p.DataBase64 = base64.StdEncoding.EncodeToString(data)
+		return nil
+	}
+	if s.signer == nil {
+		return errors.New("preview object signer is not configured")
+	}
+	url, err := s.signer.SignDownload(objectKey, time.Now().UTC().Add(s.storage.URLTTL))
+	if err != nil {
+		return fmt.Errorf("sign preview URL: %w", err)
+	}
+	p.URL = url
+	return nil
+}
+
+// GetPreviewForAttachment retrieves a rendition for an attachment, checking
+// experiment access first. See selectRendition for how the request maps to
+// a stored rendition.
+func (s *Service) GetPreviewForAttachment(ctx context.Context, attachmentID, userID, role string, want RenditionRequest) (*Preview, error) {
+	if err := s.checkAttachmentAccess(ctx, attachmentID, userID, role); err != nil {
+		return nil, err
+	}
+	if want.Name != "" {
+		if err := ValidateRenditionName(want.Name); err != nil {
+			return nil, err
+		}
+		if isPageRendition(want.Name) {
+			return s.GetPreview(ctx, attachmentID, want.Name)
+		}
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+previewColumns+`
+		 FROM attachment_previews ap
+		 WHERE ap.attachment_id = $1 AND ap.preview_type IN ('thumbnail', 'medium', 'large')
+		 ORDER BY GREATEST(ap.width, ap.height), ap.created_at`,
+		attachmentID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query renditions: %w", err)
+	}
+	var available []Preview
+	for rows.Next() {
+		p, err := scanPreview(rows)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scan rendition: %w", err)
+		}
+		available = append(available, p)
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return nil, fmt.Errorf("iterate renditions: %w", err)
+	}
+	rows.Close()
+
+	chosen, ok := selectRendition(available, want)
+	if !ok {
+		// Text-like attachments have a single textual preview instead.
+		if want.Name != "" || want.MaxDim > 0 {
+			return nil, ErrNotFound
+		}
+		var previewType string
+		err := s.db.QueryRowContext(ctx,
+			`SELECT preview_type FROM attachment_previews
+			 WHERE attachment_id = $1 AND preview_type IN ('text', 'table', 'sequence')
+			 ORDER BY created_at LIMIT 1`,
+			attachmentID,
+		).Scan(&previewType)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, ErrNotFound
+			}
+			return nil, fmt.Errorf("query textual preview: %w", err)
+		}
+		return s.GetPreview(ctx, attachmentID, previewType)
+	}
+	preview, err := s.GetPreview(ctx, attachmentID, chosen.PreviewType)
+	if err != nil {
+		return nil, err
+	}
+	meta, err := s.GetImageMetadata(ctx, attachmentID)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+	preview.ImageMetadata = meta
+	return preview, nil
+}
+
+// checkAttachmentAccess allows the experiment owner, and admins once the
+// experiment is completed.
+func (s *Service) checkAttachmentAccess(ctx context.Context, attachmentID, userID, role string) error {
 	var expOwner, expStatus string
 	err := s.db.QueryRowContext(ctx,
 		`SELECT e.owner_user_id, e.status
@@ -159,20 +382,22 @@ func (s *Service) GetPreviewForAttachment(ctx context.Context, attachmentID, use
 	).Scan(&expOwner, &expStatus)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return nil, ErrNotFound
+			return ErrNotFound
 		}
-		return nil, fmt.Errorf("query attachment: %w", err)
+		return fmt.Errorf("query attachment: %w", err)
 	}
 	if expOwner != userID {
 		if role != "admin" || expStatus != "completed" {
-			return nil, ErrForbidden
+			return ErrForbidden
 		}
 	}
-
-	return s.GetPreview(ctx, attachmentID, "thumbnail")
+	return nil
 }
 
-// ListPreviewsForExperiment returns all previews for attachments of an experiment.
+// ListPreviewsForExperiment returns all previews for attachments of an
+// experiment. Thumbnails and textual previews carry their content; other
+// renditions, which for a stack include every page, carry only their size
+// and the Href to fetch them from.
 func (s *Service) ListPreviewsForExperiment(ctx context.Context, experimentID, userID, role string) ([]Preview, error) {
 	// Access check
 	var expOwner, expStatus string
@@ -192,12 +417,14 @@ func (s *Service) ListPreviewsForExperiment(ctx context.Context, experimentID, u
 	}
 
 	rows, err := s.db.QueryContext(ctx,
-		`SELECT ap.id, ap.attachment_id, ap.preview_type, ap.mime_type, ap.width, ap.height, ap.data, ap.created_at
+		`SELECT `+previewColumns+`,
+			CASE WHEN ap.preview_type IN ($2, $3, $4, $5) THEN ap.data END,
+			CASE WHEN ap.preview_type IN ($2, $3, $4, $5) THEN ap.object_key END
 		 FROM attachment_previews ap
 		 JOIN attachments a ON a.id = ap.attachment_id
 		 WHERE a.experiment_id = $1
 		 ORDER BY ap.created_at`,
-		experimentID,
+		experimentID, RenditionThumbnail, PreviewTypeText, PreviewTypeTable, PreviewTypeSequence,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("query previews: %w", err)
@@ -206,12 +433,22 @@ func (s *Service) ListPreviewsForExperiment(ctx context.Context, experimentID, u
 
 	var previews []Preview
 	for rows.Next() {
-		var p Preview
-		var data []byte
-		if err := rows.Scan(&p.ID, &p.AttachmentID, &p.PreviewType, &p.MimeType, &p.Width, &p.Height, &data, &p.CreatedAt); err != nil {
+		var (
+			data      []byte
+			objectKey sql.NullString
+		)
+		p, err := scanPreview(rows, &data, &objectKey)
+		if err != nil {
 			return nil, fmt.Errorf("scan preview: %w", err)
 		}
-		p.DataBase64 = base64.StdEncoding.EncodeToString(data)
+		if p.PreviewType != RenditionThumbnail && !isTextualPreview(p.PreviewType) {
+			p.Href = "/v1/attachments/" + p.AttachmentID + "/preview?size=" + p.PreviewType
+			previews = append(previews, p)
+			continue
+		}
+		if err := s.attachContent(&p, data, objectKey.String); err != nil {
+			return nil, err
+		}
 		previews = append(previews, p)
 	}
 	if previews == nil {
@@ -223,7 +460,11 @@ func (s *Service) ListPreviewsForExperiment(ctx context.Context, experimentID, u
 // IsSupportedImageMime returns true if the MIME type is an image we can thumbnail.
 func IsSupportedImageMime(mime string) bool {
 	lower := strings.ToLower(mime)
-	return lower == "image/png" || lower == "image/jpeg" || lower == "image/gif" || lower == "image/jpg"
+	switch lower {
+	case "image/png", "image/jpeg", "image/gif", "image/jpg", "image/tiff", "image/tif", "image/x-tiff":
+		return true
+	}
+	return false
 }
 
 // EncodeJPEG is a utility for callers that need JPEG output.
@@ -234,48 +475,3 @@ func EncodeJPEG(img image.Image, quality int) ([]byte, error) {
 	}
 	return buf.Bytes(), nil
 }
-
-// resizeToFit downscales an image to fit within maxW x maxH, preserving aspect ratio.
-// Uses simple nearest-neighbor sampling for performance.
-func resizeToFit(src image.Image, maxW, maxH int) image.Image {
-	bounds := src.Bounds()
-	srcW := bounds.Dx()
-	srcH := bounds.Dy()
-
-	if srcW <= maxW && srcH <= maxH {
-		return src
-	}
-
-	// Calculate scale
-	scaleX := float64(maxW) / float64(srcW)
-	scaleY := float64(maxH) / float64(srcH)
-	scale := scaleX
-	if scaleY < scaleX {
-		scale = scaleY
-	}
-
-	dstW := int(float64(srcW) * scale)
-	dstH := int(float64(srcH) * scale)
-	if dstW < 1 {
-		dstW = 1
-	}
-	if dstH < 1 {
-		dstH = 1
-	}
-
-	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
-
-	// Fill with dark background (like BioArena's thumbnail canvas)
-	draw.Draw(dst, dst.Bounds(), &image.Uniform{color.RGBA{0x1f, 0x1f, 0x1f, 0xff}}, image.Point{}, draw.Src)
-
-	// Nearest-neighbor resize
-	for y := 0; y < dstH; y++ {
-		srcY := y * srcH / dstH
-		for x := 0; x < dstW; x++ {
-			srcX := x * srcW / dstW
-			dst.Set(x, y, src.At(bounds.Min.X+srcX, bounds.Min.Y+srcY))
-		}
-	}
-
-	return dst
-}
@@ -0,0 +1,474 @@
+package previews
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	internaldb "github.com/mjhen/elnote/server/internal/db"
+	"github.com/mjhen/elnote/server/internal/delimited"
+)
+
+// Textual preview types. Their data is a JSON document (mime type
+// application/json) returned to clients as Preview.Content.
+const (
+	PreviewTypeText     = "text"
+	PreviewTypeTable    = "table"
+	PreviewTypeSequence = "sequence"
+)
+
+const (
+	textPreviewMime = "application/json"
+	// textHeadBytes is how much of a log or table is read to build its
+	// preview; the rest of the object is never downloaded.
+	textHeadBytes     = 256 * 1024
+	textMaxLines      = 50
+	textMaxLineRunes  = 500
+	tableMaxRows      = 20
+	tableMaxColumns   = 50
+	tableMaxCellRunes = 200
+	sequenceMaxListed = 10
+)
+
+// TextPreview holds the first lines of a text file.
+type TextPreview struct {
+	Lines     []string `json:"lines"`
+	Truncated bool     `json:"truncated"`
+}
+
+// TablePreview is a snippet of a delimited file. Header is the first row.
+type TablePreview struct {
+	Delimiter   string     `json:"delimiter"`
+	Header      []string   `json:"header"`
+	Rows        [][]string `json:"rows"`
+	ColumnCount int        `json:"columnCount"`
+	Truncated   bool       `json:"truncated"`
+}
+
+// SequencePreview summarizes a FASTA or FASTQ file. Lengths exclude gaps;
+// GCPercent counts G, C and S over all strong/weak bases and is omitted for
+// protein sequences.
+type SequencePreview struct {
+	Format      string           `json:"format"`
+	Alphabet    string           `json:"alphabet"`
+	RecordCount int              `json:"recordCount"`
+	TotalLength int64            `json:"totalLength"`
+	MinLength   int64            `json:"minLength"`
+	MaxLength   int64            `json:"maxLength"`
+	MeanLength  float64          `json:"meanLength"`
+	N50         int64            `json:"n50"`
+	GCPercent   *float64         `json:"gcPercent,omitempty"`
+	MeanQuality *float64         `json:"meanQuality,omitempty"`
+	Records     []SequenceRecord `json:"records"`
+}
+
+type SequenceRecord struct {
+	ID          string `json:"id"`
+	Description string `json:"description,omitempty"`
+	Length      int64  `json:"length"`
+}
+
+// TextPreviewType returns the textual preview type for an attachment, or ""
+// when it is not text-like. The MIME type is checked first; generic types
+// such as text/plain or application/octet-stream fall back to the file
+// extension of the object key.
+func TextPreviewType(mimeType, objectKey string) string {
+	mimeType = strings.ToLower(strings.TrimSpace(mimeType))
+	if i := strings.IndexByte(mimeType, ';'); i >= 0 {
+		mimeType = strings.TrimSpace(mimeType[:i])
+	}
+	switch mimeType {
+	case "text/csv", "application/csv", "text/tab-separated-values", "text/tsv":
+		return PreviewTypeTable
+	case "chemical/seq-na-fasta", "chemical/seq-aa-fasta", "text/x-fasta", "application/x-fasta",
+		"text/x-fastq", "application/x-fastq":
+		return PreviewTypeSequence
+	}
+
+	switch strings.ToLower(path.Ext(strings.TrimSuffix(objectKey, "/"))) {
+	case ".csv", ".tsv", ".tab":
+		return PreviewTypeTable
+	case ".fasta", ".fa", ".fna", ".faa", ".ffn", ".fastq", ".fq":
+		return PreviewTypeSequence
+	}
+
+	if strings.HasPrefix(mimeType, "text/") {
+		return PreviewTypeText
+	}
+	switch mimeType {
+	case "application/json", "application/xml", "application/x-ndjson", "application/x-yaml", "application/yaml":
+		return PreviewTypeText
+	}
+	switch strings.ToLower(path.Ext(objectKey)) {
+	case ".txt", ".log", ".md", ".json", ".xml", ".yaml", ".yml":
+		return PreviewTypeText
+	}
+	return ""
+}
+
+// isTextualPreview reports whether a stored preview holds JSON content
+// rather than image bytes.
+func isTextualPreview(previewType string) bool {
+	switch previewType {
+	case PreviewTypeText, PreviewTypeTable, PreviewTypeSequence:
+		return true
+	}
+	return false
+}
+
+// GenerateTextPreview builds and stores the textual preview of the given
+// type from the object body. Logs and tables only consume the head of r;
+// sequence summaries read it to the end.
+func (s *Service) GenerateTextPreview(ctx context.Context, attachmentID, previewType, actorUserID string, r io.Reader) (*Preview, error) {
+	var (
+		content any
+		err     error
+	)
+	switch previewType {
+	case PreviewTypeText:
+		content, err = buildTextPreview(r)
+	case PreviewTypeTable:
+		content, err = buildTablePreview(r)
+	case PreviewTypeSequence:
+		content, err = buildSequencePreview(r)
+	default:
+		return nil, fmt.Errorf("%w: unknown textual preview type %q", ErrInvalidInput, previewType)
+	}
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(content)
+	if err != nil {
+		return nil, fmt.Errorf("encode %s preview: %w", previewType, err)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	preview, err := insertPreview(ctx, tx, attachmentID, encodedRendition{
+		name:     previewType,
+		mimeType: textPreviewMime,
+		data:     data,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if preview == nil {
+		return s.GetPreview(ctx, attachmentID, previewType)
+	}
+
+	if err := internaldb.AppendAuditEvent(ctx, tx, actorUserID, "attachment.preview_generated", "attachment", attachmentID, map[string]any{
+		"previewType": previewType,
+	}); err != nil {
+		return nil, fmt.Errorf("append attachment.preview_generated audit event: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	preview.Content = data
+	return preview, nil
+}
+
+// readHead reads up to textHeadBytes and reports whether more followed. It
+// rejects binary content.
+func readHead(r io.Reader) ([]byte, bool, error) {
+	data, err := io.ReadAll(io.LimitReader(r, textHeadBytes+1))
+	if err != nil {
+		return nil, false, fmt.Errorf("read object: %w", err)
+	}
+	more := len(data) > textHeadBytes
+	if more {
+		data = data[:textHeadBytes]
+		// Drop a partial trailing line and any split UTF-8 sequence.
+		if i := bytes.LastIndexByte(data, '\n'); i >= 0 {
+			data = data[:i+1]
+		}
+		for i := 0; i < utf8.UTFMax && len(data) > 0 && !utf8.Valid(data); i++ {
+			data = data[:len(data)-1]
+		}
+	}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if bytes.IndexByte(data, 0) >= 0 || !utf8.Valid(data) {
+		return nil, false, fmt.Errorf("%w: content is not UTF-8 text", ErrInvalidInput)
+	}
+	return data, more, nil
+}
+
+func truncateRunes(s string, max int) string {
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:max]) + "…"
+}
+
+func buildTextPreview(r io.Reader) (*TextPreview, error) {
+	data, more, err := readHead(r)
+	if err != nil {
+		return nil, err
+	}
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	out := &TextPreview{Truncated: more}
+	if len(lines) > textMaxLines {
+		lines = lines[:textMaxLines]
+		out.Truncated = true
+	}
+	out.Lines = make([]string, len(lines))
+	for i, line := range lines {
+		out.Lines[i] = truncateRunes(line, textMaxLineRunes)
+	}
+	return out, nil
+}
+
+func buildTablePreview(r io.Reader) (*TablePreview, error) {
+	data, more, err := readHead(r)
+	if err != nil {
+		return nil, err
+	}
+	delim := delimited.Detect(data)
+	cr := csv.NewReader(bytes.NewReader(data))
+	cr.Comma = delim
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+
+	out := &TablePreview{Delimiter: string(delim), Truncated: more}
+	for {
+		rec, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			// The head may end mid-record; keep what parsed cleanly.
+			if out.Header != nil {
+				out.Truncated = true
+				break
+			}
+			return nil, fmt.Errorf("%w: cannot parse delimited text: %v", ErrInvalidInput, err)
+		}
+		if len(rec) > out.ColumnCount {
+			out.ColumnCount = len(rec)
+		}
+		if len(rec) > tableMaxColumns {
+			rec = rec[:tableMaxColumns]
+			out.Truncated = true
+		}
+		for i := range rec {
+			rec[i] = truncateRunes(rec[i], tableMaxCellRunes)
+		}
+		if out.Header == nil {
+			out.Header = rec
+			continue
+		}
+		if len(out.Rows) == tableMaxRows {
+			out.Truncated = true
+			break
+		}
+		out.Rows = append(out.Rows, rec)
+	}
+	if out.Header == nil {
+		return nil, fmt.Errorf("%w: delimited file is empty", ErrInvalidInput)
+	}
+	if out.Rows == nil {
+		out.Rows = [][]string{}
+	}
+	return out, nil
+}
+
+// buildSequencePreview streams a FASTA or FASTQ file. The format is taken
+// from the first non-blank line ('>' for FASTA, '@' for FASTQ).
+func buildSequencePreview(r io.Reader) (*SequencePreview, error) {
+	br := bufio.NewReaderSize(r, 64*1024)
+	var (
+		out          = &SequencePreview{Records: []SequenceRecord{}}
+		lengths      []int64
+		gc, atgc     int64
+		residues     int64
+		nonNucleic   int64
+		qualSum      int64
+		qualCount    int64
+		cur          *SequenceRecord
+		fastqState   int // 0 header, 1 sequence, 2 plus, 3 quality
+		qualExpected int64
+		qualSeen     int64
+	)
+	finish := func() {
+		if cur == nil {
+			return
+		}
+		lengths = append(lengths, cur.Length)
+		if len(out.Records) < sequenceMaxListed {
+			out.Records = append(out.Records, *cur)
+		}
+		cur = nil
+	}
+	countBases := func(line []byte) int64 {
+		var n int64
+		for _, c := range line {
+			switch c {
+			case '-', '.', '*', ' ', '\t':
+				continue
+			case 'G', 'C', 'S', 'g', 'c', 's':
+				gc++
+				atgc++
+			case 'A', 'T', 'U', 'W', 'a', 't', 'u', 'w':
+				atgc++
+			case 'N', 'R', 'Y', 'K', 'M', 'B', 'D', 'H', 'V', 'n', 'r', 'y', 'k', 'm', 'b', 'd', 'h', 'v':
+			default:
+				nonNucleic++
+			}
+			n++
+		}
+		residues += n
+		return n
+	}
+	startRecord := func(header []byte) {
+		fields := strings.SplitN(strings.TrimSpace(string(header[1:])), " ", 2)
+		cur = &SequenceRecord{ID: truncateRunes(fields[0], tableMaxCellRunes)}
+		if len(fields) == 2 {
+			cur.Description = truncateRunes(strings.TrimSpace(fields[1]), tableMaxCellRunes)
+		}
+	}
+
+	lineNo := 0
+	for {
+		line, err := br.ReadSlice('\n')
+		if errors.Is(err, bufio.ErrBufferFull) {
+			// Long sequence lines are consumed in chunks.
+			if cur == nil || (out.Format == "fastq" && fastqState != 1 && fastqState != 3) {
+				return nil, fmt.Errorf("%w: header line too long", ErrInvalidInput)
+			}
+			if out.Format == "fastq" && fastqState == 3 {
+				qualSeen += int64(len(line))
+				for _, c := range line {
+					qualSum += int64(c) - 33
+					qualCount++
+				}
+			} else {
+				cur.Length += countBases(line)
+			}
+			continue
+		}
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("read object: %w", err)
+		}
+		trimmed := bytes.TrimRight(line, "\r\n")
+		lineNo++
+		if lineNo == 1 {
+			trimmed = bytes.TrimPrefix(trimmed, []byte("\xef\xbb\xbf"))
+		}
+
+		if len(bytes.TrimSpace(trimmed)) > 0 || fastqState == 3 {
+			if out.Format == "" {
+				switch trimmed[0] {
+				case '>':
+					out.Format = "fasta"
+				case '@':
+					out.Format = "fastq"
+				default:
+					return nil, fmt.Errorf("%w: not a FASTA or FASTQ file", ErrInvalidInput)
+				}
+			}
+
+			if out.Format == "fasta" {
+				switch {
+				case trimmed[0] == '>':
+					finish()
+					startRecord(trimmed)
+				case trimmed[0] == ';':
+					// Comment line.
+				default:
+					cur.Length += countBases(trimmed)
+				}
+			} else {
+				switch fastqState {
+				case 0:
+					if trimmed[0] != '@' {
+						return nil, fmt.Errorf("%w: malformed FASTQ record at line %d", ErrInvalidInput, lineNo)
+					}
+					finish()
+					startRecord(trimmed)
+					fastqState = 1
+				case 1:
+					if trimmed[0] == '+' {
+						fastqState = 3
+						qualExpected, qualSeen = cur.Length, 0
+					} else {
+						cur.Length += countBases(trimmed)
+					}
+				case 3:
+					qualSeen += int64(len(trimmed))
+					for _, c := range trimmed {
+						qualSum += int64(c) - 33
+						qualCount++
+					}
+					if qualSeen >= qualExpected {
+						fastqState = 0
+					}
+				}
+			}
+		}
+
+		if errors.Is(err, io.EOF) {
+			break
+		}
+	}
+	finish()
+
+	if out.Format == "" {
+		return nil, fmt.Errorf("%w: sequence file is empty", ErrInvalidInput)
+	}
+	out.RecordCount = len(lengths)
+	if out.RecordCount == 0 {
+		out.Alphabet = "nucleotide"
+		return out, nil
+	}
+
+	out.MinLength = lengths[0]
+	for _, l := range lengths {
+		out.TotalLength += l
+		if l < out.MinLength {
+			out.MinLength = l
+		}
+		if l > out.MaxLength {
+			out.MaxLength = l
+		}
+	}
+	out.MeanLength = float64(out.TotalLength) / float64(out.RecordCount)
+
+	sort.Slice(lengths, func(i, j int) bool { return lengths[i] > lengths[j] })
+	var running int64
+	for _, l := range lengths {
+		running += l
+		if running*2 >= out.TotalLength {
+			out.N50 = l
+			break
+		}
+	}
+
+	out.Alphabet = "nucleotide"
+	if nonNucleic*10 > residues {
+		out.Alphabet = "protein"
+	} else if atgc > 0 {
+		v := float64(gc) * 100 / float64(atgc)
+		out.GCPercent = &v
+	}
+	if qualCount > 0 {
+		v := float64(qualSum) / float64(qualCount)
+		out.MeanQuality = &v
+	}
+	return out, nil
+}
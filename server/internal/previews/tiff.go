@@ -0,0 +1,425 @@
+package previews
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// A small baseline TIFF reader covering what lab instruments write:
+// uncompressed, PackBits or Deflate strips, 8/16/32-bit samples, grayscale or
+// RGB, and any number of pages (IFDs). Tiled, LZW, JPEG-in-TIFF and BigTIFF
+// files are reported as unsupported rather than guessed at.
+
+const (
+	tiffTagImageWidth      = 256
+	tiffTagImageLength     = 257
+	tiffTagBitsPerSample   = 258
+	tiffTagCompression     = 259
+	tiffTagPhotometric     = 262
+	tiffTagStripOffsets    = 273
+	tiffTagSamplesPerPixel = 277
+	tiffTagRowsPerStrip    = 278
+	tiffTagStripByteCounts = 279
+	tiffTagPlanarConfig    = 284
+	tiffTagPredictor       = 317
+	tiffTagTileWidth       = 322
+	tiffTagSampleFormat    = 339
+
+	tiffCompressionNone     = 1
+	tiffCompressionDeflate  = 8
+	tiffCompressionPackBits = 32773
+	tiffCompressionZlibOld  = 32946
+
+	tiffSampleUint  = 1
+	tiffSampleInt   = 2
+	tiffSampleFloat = 3
+
+	// tiffMaxPixels bounds a single page so a forged header cannot make the
+	// worker allocate unbounded memory.
+	tiffMaxPixels = 100 * 1024 * 1024
+	// tiffMaxSampleBytes bounds the decoded samples of a page, held as
+	// float32 and so at least as large as the raw sample data.
+	tiffMaxSampleBytes = 512 * 1024 * 1024
+	// tiffMaxPages bounds the IFD walk when counting pages.
+	tiffMaxPages = 100000
+)
+
+var errUnsupportedTIFF = errors.New("unsupported tiff")
+
+type tiffFile struct {
+	data  []byte
+	order binary.ByteOrder
+	// ifdOffsets holds the offset of every page's IFD in file order.
+	ifdOffsets []uint32
+}
+
+type tiffPage struct {
+	width           int
+	height          int
+	bitsPerSample   int
+	samplesPerPixel int
+	sampleFormat    int
+	photometric     int
+	compression     int
+	predictor       int
+	rowsPerStrip    int
+	stripOffsets    []uint64
+	stripByteCounts []uint64
+}
+
+// tiffSamples is one decoded page with every sample widened to float32, in
+// chunky (interleaved) order.
+type tiffSamples struct {
+	page    tiffPage
+	samples []float32
+}
+
+func isTIFF(data []byte) bool {
+	return len(data) >= 4 && (bytes.Equal(data[:4], []byte("II*\x00")) || bytes.Equal(data[:4], []byte("MM\x00*")))
+}
+
+func openTIFF(data []byte) (*tiffFile, error) {
+	if len(data) < 8 {
+		return nil, fmt.Errorf("%w: file too short", errUnsupportedTIFF)
+	}
+	f := &tiffFile{data: data}
+	switch string(data[:2]) {
+	case "II":
+		f.order = binary.LittleEndian
+	case "MM":
+		f.order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("%w: bad byte-order mark", errUnsupportedTIFF)
+	}
+	switch f.order.Uint16(data[2:4]) {
+	case 42:
+	case 43:
+		return nil, fmt.Errorf("%w: BigTIFF", errUnsupportedTIFF)
+	default:
+		return nil, fmt.Errorf("%w: bad magic number", errUnsupportedTIFF)
+	}
+
+	seen := map[uint32]bool{}
+	offset := f.order.Uint32(data[4:8])
+	for offset != 0 && len(f.ifdOffsets) < tiffMaxPages {
+		if seen[offset] {
+			break
+		}
+		seen[offset] = true
+		if int64(offset)+2 > int64(len(data)) {
+			return nil, fmt.Errorf("%w: IFD offset out of range", errUnsupportedTIFF)
+		}
+		count := int64(f.order.Uint16(data[offset : offset+2]))
+		next := int64(offset) + 2 + count*12
+		if next+4 > int64(len(data)) {
+			return nil, fmt.Errorf("%w: truncated IFD", errUnsupportedTIFF)
+		}
+		f.ifdOffsets = append(f.ifdOffsets, offset)
+		offset = f.order.Uint32(data[next : next+4])
+	}
+	if len(f.ifdOffsets) == 0 {
+		return nil, fmt.Errorf("%w: no image directories", errUnsupportedTIFF)
+	}
+	return f, nil
+}
+
+func (f *tiffFile) pageCount() int {
+	return len(f.ifdOffsets)
+}
+
+// tiffTypeSize returns the byte size of one value of a TIFF field type.
+func tiffTypeSize(fieldType uint16) int {
+	switch fieldType {
+	case 1, 2, 6, 7:
+		return 1
+	case 3, 8:
+		return 2
+	case 4, 9, 11:
+		return 4
+	case 5, 10, 12:
+		return 8
+	default:
+		return 0
+	}
+}
+
+// fieldValues reads an integer-valued field (BYTE, SHORT or LONG).
+func (f *tiffFile) fieldValues(entry []byte) ([]uint64, error) {
+	fieldType := f.order.Uint16(entry[2:4])
+	count := int64(f.order.Uint32(entry[4:8]))
+	size := tiffTypeSize(fieldType)
+	if size == 0 || count <= 0 {
+		return nil, nil
+	}
+	total := int64(size) * count
+	raw := entry[8:12]
+	if total > 4 {
+		offset := int64(f.order.Uint32(entry[8:12]))
+		if offset+total > int64(len(f.data)) {
+			return nil, fmt.Errorf("%w: field value out of range", errUnsupportedTIFF)
+		}
+		raw = f.data[offset : offset+total]
+	}
+	values := make([]uint64, 0, count)
+	for i := int64(0); i < count; i++ {
+		switch fieldType {
+		case 1, 7:
+			values = append(values, uint64(raw[i]))
+		case 3:
+			values = append(values, uint64(f.order.Uint16(raw[i*2:])))
+		case 4:
+			values = append(values, uint64(f.order.Uint32(raw[i*4:])))
+		default:
+			return nil, nil
+		}
+	}
+	return values, nil
+}
+
+func (f *tiffFile) page(index int) (tiffPage, error) {
+	offset := f.ifdOffsets[index]
+	count := int(f.order.Uint16(f.data[offset : offset+2]))
+	p := tiffPage{
+		bitsPerSample:   1,
+		samplesPerPixel: 1,
+		sampleFormat:    tiffSampleUint,
+		compression:     tiffCompressionNone,
+		predictor:       1,
+		photometric:     1,
+	}
+	planar := 1
+	for i := 0; i < count; i++ {
+		start := int(offset) + 2 + i*12
+		entry := f.data[start : start+12]
+		tag := f.order.Uint16(entry[0:2])
+		values, err := f.fieldValues(entry)
+		if err != nil {
+			return tiffPage{}, err
+		}
+		first := 0
+		if len(values) > 0 {
+			first = int(values[0])
+		}
+		switch tag {
+		case tiffTagImageWidth:
+			p.width = first
+		case tiffTagImageLength:
+			p.height = first
+		case tiffTagBitsPerSample:
+			p.bitsPerSample = first
+			for _, v := range values {
+				if int(v) != first {
+					return tiffPage{}, fmt.Errorf("%w: mixed bits per sample", errUnsupportedTIFF)
+				}
+			}
+		case tiffTagCompression:
+			p.compression = first
+		case tiffTagPhotometric:
+			p.photometric = first
+		case tiffTagStripOffsets:
+			p.stripOffsets = values
+		case tiffTagSamplesPerPixel:
+			p.samplesPerPixel = first
+		case tiffTagRowsPerStrip:
+			p.rowsPerStrip = first
+		case tiffTagStripByteCounts:
+			p.stripByteCounts = values
+		case tiffTagPlanarConfig:
+			planar = first
+		case tiffTagPredictor:
+			p.predictor = first
+		case tiffTagTileWidth:
+			return tiffPage{}, fmt.Errorf("%w: tiled layout", errUnsupportedTIFF)
+		case tiffTagSampleFormat:
+			p.sampleFormat = first
+		}
+	}
+
+	switch {
+	case p.width <= 0 || p.height <= 0:
+		return tiffPage{}, fmt.Errorf("%w: missing dimensions", errUnsupportedTIFF)
+	case int64(p.width)*int64(p.height) > tiffMaxPixels:
+		return tiffPage{}, fmt.Errorf("%w: %dx%d exceeds the pixel limit", errUnsupportedTIFF, p.width, p.height)
+	case p.bitsPerSample != 8 && p.bitsPerSample != 16 && p.bitsPerSample != 32:
+		return tiffPage{}, fmt.Errorf("%w: %d bits per sample", errUnsupportedTIFF, p.bitsPerSample)
+	case p.sampleFormat == tiffSampleFloat && p.bitsPerSample != 32:
+		return tiffPage{}, fmt.Errorf("%w: %d-bit floating point samples", errUnsupportedTIFF, p.bitsPerSample)
+	case p.samplesPerPixel < 1 || p.samplesPerPixel > 8:
+		return tiffPage{}, fmt.Errorf("%w: %d samples per pixel", errUnsupportedTIFF, p.samplesPerPixel)
+	case int64(p.width)*int64(p.height)*int64(p.samplesPerPixel)*4 > tiffMaxSampleBytes:
+		return tiffPage{}, fmt.Errorf("%w: %dx%d with %d samples per pixel exceeds the size limit", errUnsupportedTIFF, p.width, p.height, p.samplesPerPixel)
+	case planar != 1 && p.samplesPerPixel > 1:
+		return tiffPage{}, fmt.Errorf("%w: planar sample layout", errUnsupportedTIFF)
+	case p.photometric > 2:
+		return tiffPage{}, fmt.Errorf("%w: photometric interpretation %d", errUnsupportedTIFF, p.photometric)
+	case p.photometric == 2 && p.samplesPerPixel < 3:
+		return tiffPage{}, fmt.Errorf("%w: RGB with %d samples", errUnsupportedTIFF, p.samplesPerPixel)
+	case len(p.stripOffsets) == 0 || len(p.stripOffsets) != len(p.stripByteCounts):
+		return tiffPage{}, fmt.Errorf("%w: missing strip table", errUnsupportedTIFF)
+	}
+	switch p.compression {
+	case tiffCompressionNone, tiffCompressionPackBits, tiffCompressionDeflate, tiffCompressionZlibOld:
+	default:
+		return tiffPage{}, fmt.Errorf("%w: compression scheme %d", errUnsupportedTIFF, p.compression)
+	}
+	if p.rowsPerStrip <= 0 || p.rowsPerStrip > p.height {
+		p.rowsPerStrip = p.height
+	}
+	return p, nil
+}
+
+// decodePage reads and decompresses every strip of a page. The strips are
+// checked against the file before anything is allocated, and the raw
+// buffer grows only as strips are read, so a forged header cannot claim
+// more memory than the file's own data supports.
+func (f *tiffFile) decodePage(index int) (tiffSamples, error) {
+	p, err := f.page(index)
+	if err != nil {
+		return tiffSamples{}, err
+	}
+	bytesPerSample := p.bitsPerSample / 8
+	rowBytes := p.width * p.samplesPerPixel * bytesPerSample
+	expected := rowBytes * p.height
+
+	stored := 0
+	for i, off := range p.stripOffsets {
+		n := p.stripByteCounts[i]
+		if off > uint64(len(f.data)) || n > uint64(len(f.data))-off {
+			return tiffSamples{}, fmt.Errorf("%w: strip out of range", errUnsupportedTIFF)
+		}
+		stored += int(n)
+	}
+	if p.compression == tiffCompressionNone && stored < expected {
+		return tiffSamples{}, fmt.Errorf("%w: image data truncated", errUnsupportedTIFF)
+	}
+
+	var raw []byte
+	for i, off := range p.stripOffsets {
+		strip := f.data[off : off+p.stripByteCounts[i]]
+		remaining := expected - len(raw)
+		if remaining <= 0 {
+			break
+		}
+		switch p.compression {
+		case tiffCompressionNone:
+			if len(strip) > remaining {
+				strip = strip[:remaining]
+			}
+			raw = append(raw, strip...)
+		case tiffCompressionPackBits:
+			raw, err = unpackBits(raw, strip, remaining)
+			if err != nil {
+				return tiffSamples{}, err
+			}
+		case tiffCompressionDeflate, tiffCompressionZlibOld:
+			zr, err := zlib.NewReader(bytes.NewReader(strip))
+			if err != nil {
+				return tiffSamples{}, fmt.Errorf("%w: deflate strip: %v", errUnsupportedTIFF, err)
+			}
+			chunk, err := io.ReadAll(io.LimitReader(zr, int64(remaining)))
+			zr.Close()
+			if err != nil {
+				return tiffSamples{}, fmt.Errorf("%w: deflate strip: %v", errUnsupportedTIFF, err)
+			}
+			raw = append(raw, chunk...)
+		}
+	}
+	if len(raw) < expected {
+		return tiffSamples{}, fmt.Errorf("%w: image data truncated", errUnsupportedTIFF)
+	}
+
+	samples := make([]float32, p.width*p.height*p.samplesPerPixel)
+	rowSamples := p.width * p.samplesPerPixel
+	for y := 0; y < p.height; y++ {
+		row := raw[y*rowBytes : (y+1)*rowBytes]
+		out := samples[y*rowSamples : (y+1)*rowSamples]
+		switch p.bitsPerSample {
+		case 8:
+			if p.predictor == 2 {
+				for i := p.samplesPerPixel; i < len(row); i++ {
+					row[i] += row[i-p.samplesPerPixel]
+				}
+			}
+			for i, b := range row {
+				if p.sampleFormat == tiffSampleInt {
+					out[i] = float32(int8(b))
+				} else {
+					out[i] = float32(b)
+				}
+			}
+		case 16:
+			var prev []uint16
+			if p.predictor == 2 {
+				prev = make([]uint16, p.samplesPerPixel)
+			}
+			for i := range out {
+				v := f.order.Uint16(row[i*2:])
+				if prev != nil {
+					c := i % p.samplesPerPixel
+					v += prev[c]
+					prev[c] = v
+				}
+				if p.sampleFormat == tiffSampleInt {
+					out[i] = float32(int16(v))
+				} else {
+					out[i] = float32(v)
+				}
+			}
+		case 32:
+			for i := range out {
+				v := f.order.Uint32(row[i*4:])
+				switch p.sampleFormat {
+				case tiffSampleFloat:
+					out[i] = math.Float32frombits(v)
+				case tiffSampleInt:
+					out[i] = float32(int32(v))
+				default:
+					out[i] = float32(v)
+				}
+			}
+		}
+	}
+	return tiffSamples{page: p, samples: samples}, nil
+}
+
+// unpackBits appends the PackBits-decoded strip to dst, stopping after limit
+// bytes.
+func unpackBits(dst, src []byte, limit int) ([]byte, error) {
+	produced := 0
+	for i := 0; i < len(src) && produced < limit; {
+		n := int(int8(src[i]))
+		i++
+		switch {
+		case n >= 0:
+			count := n + 1
+			if i+count > len(src) {
+				return nil, fmt.Errorf("%w: packbits literal overruns strip", errUnsupportedTIFF)
+			}
+			if count > limit-produced {
+				count = limit - produced
+			}
+			dst = append(dst, src[i:i+count]...)
+			produced += count
+			i += n + 1
+		case n != -128:
+			if i >= len(src) {
+				return nil, fmt.Errorf("%w: packbits run overruns strip", errUnsupportedTIFF)
+			}
+			count := -n + 1
+			if count > limit-produced {
+				count = limit - produced
+			}
+			for j := 0; j < count; j++ {
+				dst = append(dst, src[i])
+			}
+			produced += count
+			i++
+		}
+	}
+	return dst, nil
+}
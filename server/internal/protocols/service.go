@@ -3,6 +3,7 @@ package protocols
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"strings"
@@ -37,6 +38,7 @@ type ProtocolVersion struct {
 	ProtocolID    string    `json:"protocolId"`
 	VersionNumber int       `json:"versionNumber"`
 	Body          string    `json:"body"`
+	Steps         []Step    `json:"steps,omitempty"`
 	ChangeSummary string    `json:"changeSummary"`
 	AuthorUserID  string    `json:"authorUserId"`
 	CreatedAt     time.Time `json:"createdAt"`
@@ -63,11 +65,15 @@ type ExperimentProtocolLink struct {
 // Inputs / Outputs
 // ---------------------------------------------------------------------------
 
+// CreateProtocolInput creates a protocol with its first version. With
+// InitialSteps, the version is structured and InitialBody, if any,
+// introduces the rendered steps.
 type CreateProtocolInput struct {
-	OwnerUserID string
-	Title       string
-	Description string
-	InitialBody string
+	OwnerUserID  string
+	Title        string
+	Description  string
+	InitialBody  string
+	InitialSteps []Step
 }
 
 type CreateProtocolOutput struct {
@@ -77,10 +83,13 @@ type CreateProtocolOutput struct {
 	CreatedAt  time.Time `json:"createdAt"`
 }
 
+// PublishVersionInput publishes a new version. With Steps, the version is
+// structured and Body, if any, introduces the rendered steps.
 type PublishVersionInput struct {
 	ProtocolID    string
 	AuthorUserID  string
 	Body          string
+	Steps         []Step
 	ChangeSummary string
 }
 
@@ -130,9 +139,13 @@ func (s *Service) CreateProtocol(ctx context.Context, in CreateProtocolInput) (*
 	if strings.TrimSpace(in.Title) == "" {
 		return nil, fmt.Errorf("%w: title is required", ErrInvalidInput)
 	}
-	if strings.TrimSpace(in.InitialBody) == "" {
+	if in.InitialSteps == nil && strings.TrimSpace(in.InitialBody) == "" {
 		return nil, fmt.Errorf("%w: initial body is required", ErrInvalidInput)
 	}
+	body, steps, err := versionContent(in.InitialBody, in.InitialSteps)
+	if err != nil {
+		return nil, err
+	}
 
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
@@ -154,10 +167,10 @@ func (s *Service) CreateProtocol(ctx context.Context, in CreateProtocolInput) (*
 
 	var versionID string
 	err = tx.QueryRowContext(ctx,
-		`INSERT INTO protocol_versions (protocol_id, version_number, body, change_summary, author_user_id)
-		 VALUES ($1, 1, $2, 'Initial version', $3)
+		`INSERT INTO protocol_versions (protocol_id, version_number, body, steps, change_summary, author_user_id)
+		 VALUES ($1, 1, $2, $3::jsonb, 'Initial version', $4)
 		 RETURNING id`,
-		protocolID, in.InitialBody, in.OwnerUserID,
+		protocolID, body, steps, in.OwnerUserID,
 	).Scan(&versionID)
 	if err != nil {
 		return nil, fmt.Errorf("insert version: %w", err)
@@ -183,8 +196,9 @@ func (s *Service) CreateProtocol(ctx context.Context, in CreateProtocolInput) (*
 }
 
 func (s *Service) PublishVersion(ctx context.Context, in PublishVersionInput) (*PublishVersionOutput, error) {
-	if strings.TrimSpace(in.Body) == "" {
-		return nil, fmt.Errorf("%w: body is required", ErrInvalidInput)
+	body, steps, err := versionContent(in.Body, in.Steps)
+	if err != nil {
+		return nil, err
 	}
 
 	tx, err := s.db.BeginTx(ctx, nil)
@@ -226,10 +240,10 @@ func (s *Service) PublishVersion(ctx context.Context, in PublishVersionInput) (*
 	var versionID string
 	var createdAt time.Time
 	err = tx.QueryRowContext(ctx,
-		`INSERT INTO protocol_versions (protocol_id, version_number, body, change_summary, author_user_id)
-		 VALUES ($1, $2, $3, $4, $5)
+		`INSERT INTO protocol_versions (protocol_id, version_number, body, steps, change_summary, author_user_id)
+		 VALUES ($1, $2, $3, $4::jsonb, $5, $6)
 		 RETURNING id, created_at`,
-		in.ProtocolID, nextVersion, in.Body, in.ChangeSummary, in.AuthorUserID,
+		in.ProtocolID, nextVersion, body, steps, in.ChangeSummary, in.AuthorUserID,
 	).Scan(&versionID, &createdAt)
 	if err != nil {
 		return nil, fmt.Errorf("insert version: %w", err)
@@ -327,7 +341,7 @@ func (s *Service) ListVersions(ctx context.Context, protocolID, userID, role str
 	}
 
 	rows, err := s.db.QueryContext(ctx,
-		`SELECT id, protocol_id, version_number, body, change_summary, author_user_id, created_at
+		`SELECT id, protocol_id, version_number, body, steps, change_summary, author_user_id, created_at
 		 FROM protocol_versions WHERE protocol_id = $1
 		 ORDER BY version_number DESC`,
 		protocolID,
@@ -340,9 +354,15 @@ func (s *Service) ListVersions(ctx context.Context, protocolID, userID, role str
 	var versions []ProtocolVersion
 	for rows.Next() {
 		var v ProtocolVersion
-		if err := rows.Scan(&v.ID, &v.ProtocolID, &v.VersionNumber, &v.Body, &v.ChangeSummary, &v.AuthorUserID, &v.CreatedAt); err != nil {
+		var steps []byte
+		if err := rows.Scan(&v.ID, &v.ProtocolID, &v.VersionNumber, &v.Body, &steps, &v.ChangeSummary, &v.AuthorUserID, &v.CreatedAt); err != nil {
 			return nil, fmt.Errorf("scan version: %w", err)
 		}
+		if steps != nil {
+			if err := json.Unmarshal(steps, &v.Steps); err != nil {
+				return nil, fmt.Errorf("decode version steps: %w", err)
+			}
+		}
 		versions = append(versions, v)
 	}
 	if versions == nil {
@@ -0,0 +1,285 @@
+package protocols
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Parameter kinds a protocol step can set.
+const (
+	ParamTemperature   = "temperature"
+	ParamDuration      = "duration"
+	ParamVolume        = "volume"
+	ParamConcentration = "concentration"
+)
+
+// Limits on structured steps, so a version stays readable and its
+// rendered body stays a reasonable size.
+const (
+	maxStepDepth = 4
+	maxStepCount = 500
+)
+
+// stepUnits maps each parameter kind to its accepted units, keyed by the
+// spellings clients send and valued by the canonical unit stored.
+var stepUnits = map[string]map[string]string{
+	ParamTemperature: {
+		"°C":   "°C",
+		"C":    "°C",
+		"degC": "°C",
+		"°F":   "°F",
+		"F":    "°F",
+		"degF": "°F",
+		"K":    "K",
+	},
+	ParamDuration: {
+		"s":   "s",
+		"sec": "s",
+		"min": "min",
+		"h":   "h",
+		"hr":  "h",
+		"d":   "d",
+		"day": "d",
+	},
+	ParamVolume: {
+		"nL": "nL",
+		"µL": "µL",
+		"uL": "µL",
+		"μL": "µL",
+		"mL": "mL",
+		"L":  "L",
+	},
+	ParamConcentration: {
+		"nM":    "nM",
+		"µM":    "µM",
+		"uM":    "µM",
+		"μM":    "µM",
+		"mM":    "mM",
+		"M":     "M",
+		"ng/mL": "ng/mL",
+		"µg/mL": "µg/mL",
+		"ug/mL": "µg/mL",
+		"μg/mL": "µg/mL",
+		"mg/mL": "mg/mL",
+		"g/L":   "g/L",
+		"%":     "%",
+		"X":     "X",
+		"x":     "X",
+	},
+}
+
+// absoluteZero is the lowest temperature in each temperature unit.
+var absoluteZero = map[string]float64{"°C": -273.15, "°F": -459.67, "K": 0}
+
+// Step is one step of a structured protocol version. Steps are ordered by
+// their position and may nest sub-steps.
+type Step struct {
+	Title        string          `json:"title"`
+	Instructions string          `json:"instructions,omitempty"`
+	Parameters   []StepParameter `json:"parameters,omitempty"`
+	Reagents     []StepReagent   `json:"reagents,omitempty"`
+	SafetyNotes  []string        `json:"safetyNotes,omitempty"`
+	Steps        []Step          `json:"steps,omitempty"`
+}
+
+// StepParameter is a typed value of a step. A duration marked Timer is
+// one the bench client counts down while the step runs.
+type StepParameter struct {
+	Kind  string  `json:"kind"`
+	Label string  `json:"label,omitempty"`
+	Value float64 `json:"value"`
+	Unit  string  `json:"unit"`
+	Timer bool    `json:"timer,omitempty"`
+}
+
+// StepReagent is a reagent a step requires, with the amount if known.
+type StepReagent struct {
+	Name     string         `json:"name"`
+	Quantity *StepParameter `json:"quantity,omitempty"`
+}
+
+// normalizeSteps validates steps in place, trimming text and replacing
+// unit spellings with canonical units.
+func normalizeSteps(steps []Step) error {
+	if len(steps) == 0 {
+		return fmt.Errorf("%w: steps must not be empty", ErrInvalidInput)
+	}
+	count := 0
+	return normalizeStepList(steps, "", 1, &count)
+}
+
+func normalizeStepList(steps []Step, prefix string, depth int, count *int) error {
+	if depth > maxStepDepth {
+		return fmt.Errorf("%w: step %s nests deeper than %d levels", ErrInvalidInput, strings.TrimSuffix(prefix, "."), maxStepDepth)
+	}
+	for i := range steps {
+		*count++
+		if *count > maxStepCount {
+			return fmt.Errorf("%w: a protocol version has at most %d steps", ErrInvalidInput, maxStepCount)
+		}
+		step := &steps[i]
+		path := prefix + strconv.Itoa(i+1)
+
+		step.Title = strings.TrimSpace(step.Title)
+		step.Instructions = strings.TrimSpace(step.Instructions)
+		if step.Title == "" {
+			return fmt.Errorf("%w: step %s: title is required", ErrInvalidInput, path)
+		}
+		for j := range step.Parameters {
+			if err := normalizeParameter(&step.Parameters[j]); err != nil {
+				return fmt.Errorf("%w: step %s: parameter %d: %s", ErrInvalidInput, path, j+1, err)
+			}
+		}
+		for j := range step.Reagents {
+			reagent := &step.Reagents[j]
+			reagent.Name = strings.TrimSpace(reagent.Name)
+			if reagent.Name == "" {
+				return fmt.Errorf("%w: step %s: reagent %d: name is required", ErrInvalidInput, path, j+1)
+			}
+			if q := reagent.Quantity; q != nil {
+				if err := normalizeParameter(q); err != nil {
+					return fmt.Errorf("%w: step %s: reagent %d: %s", ErrInvalidInput, path, j+1, err)
+				}
+				if q.Kind != ParamVolume && q.Kind != ParamConcentration {
+					return fmt.Errorf("%w: step %s: reagent %d: quantity must be a volume or concentration", ErrInvalidInput, path, j+1)
+				}
+			}
+		}
+		notes := step.SafetyNotes[:0]
+		for _, note := range step.SafetyNotes {
+			if note = strings.TrimSpace(note); note != "" {
+				notes = append(notes, note)
+			}
+		}
+		step.SafetyNotes = notes
+
+		if err := normalizeStepList(step.Steps, path+".", depth+1, count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// normalizeParameter checks a parameter's kind, unit and value. Its errors
+// are messages only; callers add the step and ErrInvalidInput.
+func normalizeParameter(p *StepParameter) error {
+	p.Kind = strings.ToLower(strings.TrimSpace(p.Kind))
+	p.Label = strings.TrimSpace(p.Label)
+	units, ok := stepUnits[p.Kind]
+	if !ok {
+		return fmt.Errorf("unknown kind %q", p.Kind)
+	}
+	unit, ok := units[strings.TrimSpace(p.Unit)]
+	if !ok {
+		return fmt.Errorf("unit %q is not a %s unit", p.Unit, p.Kind)
+	}
+	p.Unit = unit
+	if math.IsNaN(p.Value) || math.IsInf(p.Value, 0) {
+		return fmt.Errorf("value must be a number")
+	}
+	switch p.Kind {
+	case ParamTemperature:
+		if p.Value < absoluteZero[unit] {
+			return fmt.Errorf("%s %s is below absolute zero", formatValue(p.Value), unit)
+		}
+	case ParamConcentration:
+		if p.Value < 0 {
+			return fmt.Errorf("concentration must not be negative")
+		}
+	default:
+		if p.Value <= 0 {
+			return fmt.Errorf("%s must be positive", p.Kind)
+		}
+	}
+	if p.Timer && p.Kind != ParamDuration {
+		return fmt.Errorf("only a duration can be a timer")
+	}
+	return nil
+}
+
+// renderSteps renders steps as the numbered text stored in a version's
+// body: each step's number and title, then its instructions, parameters,
+// reagents and safety notes indented below it, then its sub-steps.
+func renderSteps(steps []Step) string {
+	var b strings.Builder
+	renderStepList(&b, steps, "", "")
+	return strings.TrimRight(b.String(), "\n")
+}
+
+func renderStepList(b *strings.Builder, steps []Step, prefix, indent string) {
+	for i, step := range steps {
+		number := prefix + strconv.Itoa(i+1)
+		fmt.Fprintf(b, "%s%s. %s\n", indent, number, step.Title)
+
+		detail := indent + strings.Repeat(" ", len(number)+2)
+		for _, line := range strings.Split(step.Instructions, "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				fmt.Fprintf(b, "%s%s\n", detail, line)
+			}
+		}
+		for _, p := range step.Parameters {
+			name := p.Label
+			if name == "" {
+				name = strings.ToUpper(p.Kind[:1]) + p.Kind[1:]
+			}
+			fmt.Fprintf(b, "%s- %s: %s", detail, name, formatParameter(p))
+			if p.Timer {
+				b.WriteString(" (timer)")
+			}
+			b.WriteString("\n")
+		}
+		if len(step.Reagents) > 0 {
+			names := make([]string, len(step.Reagents))
+			for j, r := range step.Reagents {
+				names[j] = r.Name
+				if r.Quantity != nil {
+					names[j] += " (" + formatParameter(*r.Quantity) + ")"
+				}
+			}
+			fmt.Fprintf(b, "%s- Reagents: %s\n", detail, strings.Join(names, ", "))
+		}
+		for _, note := range step.SafetyNotes {
+			fmt.Fprintf(b, "%s- Safety: %s\n", detail, note)
+		}
+		renderStepList(b, step.Steps, number+".", detail)
+	}
+}
+
+func formatParameter(p StepParameter) string {
+	if p.Unit == "%" || p.Unit == "X" {
+		return formatValue(p.Value) + p.Unit
+	}
+	return formatValue(p.Value) + " " + p.Unit
+}
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// versionContent returns the body and steps column of a new version. With
+// steps, the body is the free-text introduction, if any, followed by the
+// rendered steps; without, it is the body as given and steps is NULL.
+func versionContent(body string, steps []Step) (string, sql.NullString, error) {
+	if steps == nil {
+		if strings.TrimSpace(body) == "" {
+			return "", sql.NullString{}, fmt.Errorf("%w: body is required", ErrInvalidInput)
+		}
+		return body, sql.NullString{}, nil
+	}
+	if err := normalizeSteps(steps); err != nil {
+		return "", sql.NullString{}, err
+	}
+	encoded, err := json.Marshal(steps)
+	if err != nil {
+		return "", sql.NullString{}, fmt.Errorf("encode steps: %w", err)
+	}
+	rendered := renderSteps(steps)
+	if intro := strings.TrimSpace(body); intro != "" {
+		rendered = intro + "\n\n" + rendered
+	}
+	return rendered, sql.NullString{String: string(encoded), Valid: true}, nil
+}
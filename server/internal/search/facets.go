@@ -0,0 +1,183 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Facets of the experiment results.
+const (
+	FacetStatus   = "status"
+	FacetTag      = "tag"
+	FacetOwner    = "owner"
+	FacetProject  = "project"
+	FacetProtocol = "protocol"
+	FacetMonth    = "month"
+)
+
+// FacetNames lists the facets in display order.
+var FacetNames = []string{FacetStatus, FacetTag, FacetOwner, FacetProject, FacetProtocol, FacetMonth}
+
+// maxFacetValues bounds each facet to its most frequent values.
+const maxFacetValues = 20
+
+var facetMonthPattern = regexp.MustCompile(`^\d{4}-(0[1-9]|1[0-2])$`)
+
+// Facet counts the experiment results by one attribute.
+type Facet struct {
+	Name   string       `json:"name"`
+	Values []FacetValue `json:"values"`
+}
+
+// FacetValue is one value of a facet. Value is what a selection passes
+// back: a status, tag name, user, project or protocol ID, or a YYYY-MM
+// month (UTC); Label is its display name.
+type FacetValue struct {
+	Value    string `json:"value"`
+	Label    string `json:"label"`
+	Count    int    `json:"count"`
+	Selected bool   `json:"selected"`
+}
+
+// facetSQL describes how a facet groups experiments as e and how a
+// selection filters them.
+type facetSQL struct {
+	join   string
+	value  string
+	label  string
+	filter string // condition on e with %s for the selected values
+}
+
+var facetColumns = map[string]facetSQL{
+	FacetStatus: {
+		value: "e.status", label: "e.status",
+		filter: "e.status = ANY(%s)",
+	},
+	FacetTag: {
+		join:  "JOIN experiment_tags fet ON fet.experiment_id = e.id JOIN tags ftg ON ftg.id = fet.tag_id",
+		value: "ftg.name", label: "ftg.name",
+		filter: "e.id IN (SELECT et.experiment_id FROM experiment_tags et JOIN tags tg ON tg.id = et.tag_id WHERE tg.name = ANY(%s))",
+	},
+	FacetOwner: {
+		join:  "JOIN users fu ON fu.id = e.owner_user_id",
+		value: "e.owner_user_id::text", label: "fu.email",
+		filter: "e.owner_user_id::text = ANY(%s)",
+	},
+	FacetProject: {
+		join:  "JOIN projects fpj ON fpj.id = e.project_id",
+		value: "e.project_id::text", label: "fpj.title",
+		filter: "e.project_id::text = ANY(%s)",
+	},
+	FacetProtocol: {
+		join:  "JOIN experiment_protocols fep ON fep.experiment_id = e.id JOIN protocols fp ON fp.id = fep.protocol_id",
+		value: "fp.id::text", label: "fp.title",
+		filter: "e.id IN (SELECT ep.experiment_id FROM experiment_protocols ep WHERE ep.protocol_id::text = ANY(%s))",
+	},
+	FacetMonth: {
+		value: "to_char(e.created_at AT TIME ZONE 'UTC', 'YYYY-MM')", label: "to_char(e.created_at AT TIME ZONE 'UTC', 'YYYY-MM')",
+		filter: "to_char(e.created_at AT TIME ZONE 'UTC', 'YYYY-MM') = ANY(%s)",
+	},
+}
+
+// validateFacets checks facet selections: known facets, and months as
+// YYYY-MM.
+func validateFacets(selections map[string][]string) error {
+	for name, values := range selections {
+		if _, ok := facetColumns[name]; !ok {
+			return fmt.Errorf("%w: unknown facet %q; expected one of %s", ErrInvalidInput, name, strings.Join(FacetNames, ", "))
+		}
+		if name == FacetMonth {
+			for _, v := range values {
+				if !facetMonthPattern.MatchString(v) {
+					return fmt.Errorf("%w: month %q must be YYYY-MM", ErrInvalidInput, v)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// experimentFilterConditions are the input's filters on experiments as e:
+// status, creation dates, tags and the facet selections other than
+// except. Values selected within a facet are alternatives; facets combine.
+func experimentFilterConditions(in SearchInput, b *binder, except string) []string {
+	var conditions []string
+	if in.Status != "" {
+		conditions = append(conditions, "e.status = "+b.bind("status", in.Status))
+	}
+	if in.DateFrom != nil {
+		conditions = append(conditions, "e.created_at >= "+b.bind("dateFrom", *in.DateFrom))
+	}
+	if in.DateTo != nil {
+		conditions = append(conditions, "e.created_at <= "+b.bind("dateTo", *in.DateTo))
+	}
+	if len(in.Tags) > 0 {
+		conditions = append(conditions, fmt.Sprintf(
+			`e.id IN (SELECT et.experiment_id FROM experiment_tags et JOIN tags t ON t.id = et.tag_id WHERE t.name = ANY(%s))`,
+			b.bind("tags", in.Tags),
+		))
+	}
+	for _, name := range FacetNames {
+		values := in.Facets[name]
+		if name == except || len(values) == 0 {
+			continue
+		}
+		conditions = append(conditions, fmt.Sprintf(facetColumns[name].filter, b.bind("facet:"+name, values)))
+	}
+	return conditions
+}
+
+// facets counts the experiment results by each facet. Each facet is
+// counted under every selection but its own, so its other values stay
+// visible for widening the selection.
+func (s *Service) facets(ctx context.Context, query *Query, in SearchInput) ([]Facet, error) {
+	facets := make([]Facet, 0, len(FacetNames))
+	for _, name := range FacetNames {
+		col := facetColumns[name]
+		b := &binder{}
+		conditions := experimentSearchConditions(query, in, b, name)
+		// Selected values sort first so they show even when rarer than
+		// the most frequent ones.
+		order := "3 DESC, 2"
+		if values := in.Facets[name]; len(values) > 0 {
+			order = fmt.Sprintf("(%s = ANY(%s)) DESC, %s", col.value, b.bind("facet:"+name, values), order)
+		}
+		sqlStr := fmt.Sprintf(`
+			SELECT %s AS value, %s AS label, COUNT(DISTINCT e.id)
+			FROM experiments e %s
+			WHERE %s
+			GROUP BY 1, 2
+			ORDER BY %s
+			LIMIT %d`,
+			col.value, col.label, col.join,
+			strings.Join(conditions, " AND "),
+			order, maxFacetValues,
+		)
+		rows, err := s.db.QueryContext(ctx, sqlStr, b.args...)
+		if err != nil {
+			return nil, fmt.Errorf("count %s facet: %w", name, err)
+		}
+		selected := map[string]bool{}
+		for _, v := range in.Facets[name] {
+			selected[v] = true
+		}
+		facet := Facet{Name: name, Values: []FacetValue{}}
+		for rows.Next() {
+			var v FacetValue
+			if err := rows.Scan(&v.Value, &v.Label, &v.Count); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("scan %s facet: %w", name, err)
+			}
+			v.Selected = selected[v.Value]
+			facet.Values = append(facet.Values, v)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("count %s facet: %w", name, err)
+		}
+		facets = append(facets, facet)
+	}
+	return facets, nil
+}
@@ -0,0 +1,662 @@
+package search
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Query fields.
+const (
+	FieldStatus   = "status"
+	FieldTag      = "tag"
+	FieldOwner    = "owner"
+	FieldProtocol = "protocol"
+	FieldCreated  = "created"
+)
+
+var queryFields = []string{FieldStatus, FieldTag, FieldOwner, FieldProtocol, FieldCreated}
+
+var queryStatuses = []string{"draft", "completed", "published", "archived"}
+
+const maxQueryDepth = 16
+
+// ParseError reports where a search query is malformed. Column is the
+// 1-based rune offset of the offending token.
+type ParseError struct {
+	Column int
+	Msg    string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("invalid query at column %d: %s", e.Column, e.Msg)
+}
+
+func (e *ParseError) Unwrap() error { return ErrInvalidInput }
+
+// Query is a parsed search query:
+//
+//	status:completed tag:crispr owner:alice protocol:"Western Blot"
+//	created:>2026-01-01 -contaminated "exact phrase" OR mycoplasma
+//
+// Terms are ANDed. OR binds tighter than the implicit AND, so "a b OR c"
+// is a AND (b OR c); parentheses group. A leading - negates a term,
+// phrase, filter or group. Bare terms match as prefixes, quoted phrases
+// as exact word sequences. Field filters are status, tag, owner (email or
+// the part before @), protocol (linked protocol title contains) and
+// created (a date, optionally prefixed by >, >=, < or <=).
+type Query struct {
+	root node
+	// rank is a tsquery of every non-negated term, used for ranking and
+	// headlines; empty when the query only filters.
+	rank string
+	// fuzzy is the raw text of the non-negated terms and phrases, matched
+	// by trigram similarity against titles and identifiers.
+	fuzzy string
+	// words are the non-negated single-word terms, as typed, that may
+	// take a "did you mean" correction.
+	words []string
+}
+
+type node interface{}
+
+type andNode struct{ children []node }
+
+type orNode struct{ children []node }
+
+type notNode struct{ child node }
+
+// textNode is a term or phrase compiled to tsquery syntax. fuzzy is its
+// raw text for trigram matching; empty where that would be wrong, under
+// negation and in OR groups.
+type textNode struct {
+	key     string
+	tsquery string
+	fuzzy   string
+	word    bool
+	negated bool
+}
+
+type filterNode struct {
+	key   string
+	field string
+	op    string
+	value string
+	date  time.Time
+}
+
+// ParseQuery parses a search query. Errors are *ParseError and match
+// ErrInvalidInput.
+func ParseQuery(input string) (*Query, error) {
+	tokens, err := lexQuery(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{tokens: tokens}
+	root, err := p.parseAnd(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, &ParseError{Column: p.tokens[p.pos].column, Msg: "unmatched )"}
+	}
+	if root == nil {
+		return nil, &ParseError{Column: 1, Msg: "query has no search terms or filters"}
+	}
+	q := &Query{}
+	var positive, fuzzy []string
+	collectRankTerms(root, false, func(t *textNode) {
+		positive = append(positive, "("+t.tsquery+")")
+		fuzzy = append(fuzzy, t.fuzzy)
+		if t.word {
+			q.words = append(q.words, t.fuzzy)
+		}
+	})
+	q.root = mergeText(root)
+	q.rank = strings.Join(positive, " | ")
+	q.fuzzy = strings.Join(fuzzy, " ")
+	return q, nil
+}
+
+// mergeText folds the terms of each AND and OR group into a single
+// tsquery, so Postgres drops stop words inside it rather than matching an
+// empty query, and each group costs one index probe.
+func mergeText(n node) node {
+	switch n := n.(type) {
+	case *notNode:
+		child := mergeText(n.child)
+		if t, ok := child.(*textNode); ok {
+			return &textNode{key: t.key, tsquery: "!(" + t.tsquery + ")", negated: true}
+		}
+		return &notNode{child: child}
+	case *andNode:
+		return mergeChildren(n.children, " & ", func(c []node) node { return &andNode{children: c} })
+	case *orNode:
+		return mergeChildren(n.children, " | ", func(c []node) node { return &orNode{children: c} })
+	}
+	return n
+}
+
+func mergeChildren(children []node, op string, group func([]node) node) node {
+	var text, negated *textNode
+	var rest []node
+	for _, c := range children {
+		c = mergeText(c)
+		t, ok := c.(*textNode)
+		if !ok {
+			rest = append(rest, c)
+			continue
+		}
+		// Negated terms of an AND group fold separately, keeping the
+		// positive terms' fuzzy match free of them.
+		if op == " & " && t.negated {
+			if negated == nil {
+				negated = &textNode{key: t.key, tsquery: t.tsquery, negated: true}
+			} else {
+				negated.tsquery += op + t.tsquery
+			}
+			continue
+		}
+		if text == nil {
+			text = &textNode{key: t.key, tsquery: "(" + t.tsquery + ")", fuzzy: t.fuzzy}
+			continue
+		}
+		text.tsquery += op + "(" + t.tsquery + ")"
+		// An AND group matches fuzzily as the text of all its terms.
+		if op == " & " && text.fuzzy != "" && t.fuzzy != "" {
+			text.fuzzy += " " + t.fuzzy
+		} else {
+			text.fuzzy = ""
+		}
+	}
+	if negated != nil {
+		rest = append([]node{negated}, rest...)
+	}
+	if text != nil {
+		rest = append([]node{text}, rest...)
+	}
+	if len(rest) == 1 {
+		return rest[0]
+	}
+	return group(rest)
+}
+
+// collectRankTerms visits the non-negated terms and phrases of the parsed
+// tree, before mergeText folds them together.
+func collectRankTerms(n node, negated bool, visit func(*textNode)) {
+	switch n := n.(type) {
+	case *andNode:
+		for _, c := range n.children {
+			collectRankTerms(c, negated, visit)
+		}
+	case *orNode:
+		for _, c := range n.children {
+			collectRankTerms(c, negated, visit)
+		}
+	case *notNode:
+		collectRankTerms(n.child, !negated, visit)
+	case *textNode:
+		if !negated {
+			visit(n)
+		}
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Lexer
+// ---------------------------------------------------------------------------
+
+type tokenKind int
+
+const (
+	tokTerm tokenKind = iota
+	tokPhrase
+	tokField
+	tokOr
+	tokNot
+	tokOpen
+	tokClose
+)
+
+type queryToken struct {
+	kind   tokenKind
+	column int
+	text   string // term or phrase text; field value
+	field  string
+}
+
+func lexQuery(input string) ([]queryToken, error) {
+	runes := []rune(input)
+	var tokens []queryToken
+	readPhrase := func(start int) (string, int, error) {
+		end := start + 1
+		for end < len(runes) && runes[end] != '"' {
+			end++
+		}
+		if end == len(runes) {
+			return "", 0, &ParseError{Column: start + 1, Msg: "unterminated quote"}
+		}
+		return string(runes[start+1 : end]), end + 1, nil
+	}
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, queryToken{kind: tokOpen, column: i + 1})
+			i++
+		case r == ')':
+			tokens = append(tokens, queryToken{kind: tokClose, column: i + 1})
+			i++
+		case r == '-' && i+1 < len(runes) && !unicode.IsSpace(runes[i+1]):
+			tokens = append(tokens, queryToken{kind: tokNot, column: i + 1})
+			i++
+		case r == '"':
+			text, next, err := readPhrase(i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, queryToken{kind: tokPhrase, column: i + 1, text: text})
+			i = next
+		default:
+			// Parentheses inside a word belong to it, as in
+			// Anti-pSTAT3(Y705); an unopened ) ends the word.
+			start, depth := i, 0
+			for ; i < len(runes) && !unicode.IsSpace(runes[i]) && runes[i] != '"'; i++ {
+				if runes[i] == '(' {
+					depth++
+				} else if runes[i] == ')' {
+					if depth == 0 {
+						break
+					}
+					depth--
+				}
+			}
+			word := string(runes[start:i])
+			if word == "OR" {
+				tokens = append(tokens, queryToken{kind: tokOr, column: start + 1})
+				continue
+			}
+			if word == "AND" {
+				continue
+			}
+			field, value, isField := strings.Cut(word, ":")
+			if !isField || field == "" || strings.IndexFunc(field, func(r rune) bool { return !unicode.IsLetter(r) }) >= 0 {
+				tokens = append(tokens, queryToken{kind: tokTerm, column: start + 1, text: word})
+				continue
+			}
+			if value == "" && i < len(runes) && runes[i] == '"' {
+				text, next, err := readPhrase(i)
+				if err != nil {
+					return nil, err
+				}
+				value, i = text, next
+			}
+			tokens = append(tokens, queryToken{kind: tokField, column: start + 1, field: strings.ToLower(field), text: value})
+		}
+	}
+	return tokens, nil
+}
+
+// ---------------------------------------------------------------------------
+// Parser
+// ---------------------------------------------------------------------------
+
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+	keys   int
+}
+
+func (p *queryParser) peek() *queryToken {
+	if p.pos < len(p.tokens) {
+		return &p.tokens[p.pos]
+	}
+	return nil
+}
+
+func (p *queryParser) nextKey() string {
+	p.keys++
+	return fmt.Sprintf("q%d", p.keys)
+}
+
+// parseAnd reads clauses up to a closing parenthesis or the end. Clauses
+// that compile to nothing (terms of punctuation only) are dropped; a nil
+// result means the group is empty.
+func (p *queryParser) parseAnd(depth int) (node, error) {
+	var children []node
+	for t := p.peek(); t != nil && t.kind != tokClose; t = p.peek() {
+		n, err := p.parseOr(depth)
+		if err != nil {
+			return nil, err
+		}
+		if n != nil {
+			children = append(children, n)
+		}
+	}
+	switch len(children) {
+	case 0:
+		return nil, nil
+	case 1:
+		return children[0], nil
+	}
+	return &andNode{children: children}, nil
+}
+
+func (p *queryParser) parseOr(depth int) (node, error) {
+	first, err := p.parseUnary(depth)
+	if err != nil {
+		return nil, err
+	}
+	children := []node{first}
+	for t := p.peek(); t != nil && t.kind == tokOr; t = p.peek() {
+		p.pos++
+		if next := p.peek(); next == nil || next.kind == tokOr || next.kind == tokClose {
+			return nil, &ParseError{Column: t.column, Msg: "OR must sit between two terms"}
+		}
+		n, err := p.parseUnary(depth)
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, n)
+	}
+	var kept []node
+	for _, c := range children {
+		if c != nil {
+			kept = append(kept, c)
+		}
+	}
+	switch len(kept) {
+	case 0:
+		return nil, nil
+	case 1:
+		return kept[0], nil
+	}
+	return &orNode{children: kept}, nil
+}
+
+func (p *queryParser) parseUnary(depth int) (node, error) {
+	t := p.peek()
+	if t == nil {
+		return nil, &ParseError{Column: p.endColumn(), Msg: "unexpected end of query"}
+	}
+	p.pos++
+	switch t.kind {
+	case tokNot:
+		if next := p.peek(); next == nil || next.kind == tokOr || next.kind == tokClose {
+			return nil, &ParseError{Column: t.column, Msg: "- must precede a term, phrase, filter or group"}
+		}
+		child, err := p.parseUnary(depth)
+		if err != nil || child == nil {
+			return nil, err
+		}
+		return &notNode{child: child}, nil
+	case tokOpen:
+		if depth >= maxQueryDepth {
+			return nil, &ParseError{Column: t.column, Msg: "parentheses are nested too deeply"}
+		}
+		inner, err := p.parseAnd(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if close := p.peek(); close == nil || close.kind != tokClose {
+			return nil, &ParseError{Column: t.column, Msg: "unmatched ("}
+		}
+		p.pos++
+		return inner, nil
+	case tokOr:
+		return nil, &ParseError{Column: t.column, Msg: "OR must sit between two terms"}
+	case tokClose:
+		return nil, &ParseError{Column: t.column, Msg: "unmatched )"}
+	case tokPhrase:
+		words := lexemes(t.text)
+		if len(words) == 0 {
+			return nil, &ParseError{Column: t.column, Msg: "empty phrase"}
+		}
+		return &textNode{key: p.nextKey(), tsquery: strings.Join(words, " <-> "), fuzzy: strings.TrimSpace(t.text)}, nil
+	case tokTerm:
+		words := lexemes(t.text)
+		if len(words) == 0 {
+			return nil, nil
+		}
+		// Hyphenated and dotted terms such as sc-7392 become phrases of
+		// their parts, the last matched as a prefix.
+		single := len(words) == 1
+		words[len(words)-1] += ":*"
+		return &textNode{key: p.nextKey(), tsquery: strings.Join(words, " <-> "), fuzzy: t.text, word: single}, nil
+	}
+	return p.parseFilter(t)
+}
+
+func (p *queryParser) endColumn() int {
+	if len(p.tokens) == 0 {
+		return 1
+	}
+	return p.tokens[len(p.tokens)-1].column + 1
+}
+
+func (p *queryParser) parseFilter(t *queryToken) (node, error) {
+	f := &filterNode{key: p.nextKey(), field: t.field, value: strings.TrimSpace(t.text)}
+	known := false
+	for _, name := range queryFields {
+		known = known || name == f.field
+	}
+	if !known {
+		return nil, &ParseError{Column: t.column, Msg: fmt.Sprintf("unknown field %q; expected one of %s", f.field, strings.Join(queryFields, ", "))}
+	}
+	if f.value == "" {
+		return nil, &ParseError{Column: t.column, Msg: fmt.Sprintf("%s: needs a value", f.field)}
+	}
+	switch f.field {
+	case FieldStatus:
+		f.value = strings.ToLower(f.value)
+		valid := false
+		for _, s := range queryStatuses {
+			valid = valid || s == f.value
+		}
+		if !valid {
+			return nil, &ParseError{Column: t.column, Msg: fmt.Sprintf("status must be one of %s", strings.Join(queryStatuses, ", "))}
+		}
+	case FieldCreated:
+		value := f.value
+		for _, op := range []string{">=", "<=", ">", "<", "="} {
+			if strings.HasPrefix(value, op) {
+				f.op, value = op, value[len(op):]
+				break
+			}
+		}
+		if f.op == "" {
+			f.op = "="
+		}
+		date, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			return nil, &ParseError{Column: t.column, Msg: "created needs a date like 2026-01-01, optionally prefixed by >, >=, < or <="}
+		}
+		f.date = date
+	}
+	return f, nil
+}
+
+// lexemes splits text into the letter and digit runs that to_tsvector
+// indexes, which keeps tsquery operators out of user input.
+func lexemes(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// ---------------------------------------------------------------------------
+// SQL compilation
+// ---------------------------------------------------------------------------
+
+// binder collects positional query arguments, binding each name once.
+type binder struct {
+	args  []any
+	names map[string]string
+}
+
+func (b *binder) bind(name string, v any) string {
+	if b.names == nil {
+		b.names = map[string]string{}
+	}
+	if p, ok := b.names[name]; ok {
+		return p
+	}
+	b.args = append(b.args, v)
+	b.names[name] = fmt.Sprintf("$%d", len(b.args))
+	return b.names[name]
+}
+
+// filterSQL compiles a field filter against one table.
+type filterSQL func(f *filterNode, b *binder) string
+
+// queryTarget is what a query is compiled against: the text search vector
+// and configuration of a table, the filters it supports and the
+// trigram-indexed columns (titles, names, catalog numbers, sequences) its
+// terms also match by similarity and prefix. Filters on fields the target
+// lacks are false.
+type queryTarget struct {
+	vector  string
+	config  string
+	filters map[string]filterSQL
+	fuzzy   []string
+}
+
+const (
+	// minFuzzyLength keeps short terms, whose trigrams match almost
+	// anything, to full-text matching.
+	minFuzzyLength = 3
+	// fuzzyRankWeight scales trigram similarity (0 to 1) into the range
+	// of ts_rank, so exact term matches still rank first.
+	fuzzyRankWeight = "0.1"
+)
+
+// likePrefix escapes text for a prefix ILIKE pattern.
+func likePrefix(text string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(text) + "%"
+}
+
+// condition compiles the query to a parameterized WHERE condition.
+func (q *Query) condition(t queryTarget, b *binder) string {
+	return compileNode(q.root, t, b)
+}
+
+// rankExpr returns the tsquery expression for headlines and the rank: the
+// full-text rank plus the weighted trigram similarity of the target's
+// fuzzy columns. rankQuery is "" and rank 0 when the query only filters.
+func (q *Query) rankExpr(t queryTarget, b *binder) (rankQuery, rank string) {
+	if q.rank == "" {
+		return "", "0::real"
+	}
+	rankQuery = fmt.Sprintf("to_tsquery('%s', %s)", t.config, b.bind("rank", q.rank))
+	rank = fmt.Sprintf("ts_rank(%s, %s)", t.vector, rankQuery)
+	if len(t.fuzzy) > 0 && utf8.RuneCountInString(q.fuzzy) >= minFuzzyLength {
+		sims := make([]string, len(t.fuzzy))
+		for i, col := range t.fuzzy {
+			sims[i] = fmt.Sprintf("word_similarity(%s, coalesce(%s, ''))", b.bind("rankFuzzy", q.fuzzy), col)
+		}
+		rank = fmt.Sprintf("(%s + %s * GREATEST(%s))", rank, fuzzyRankWeight, strings.Join(sims, ", "))
+	}
+	return rankQuery, rank
+}
+
+func compileNode(n node, t queryTarget, b *binder) string {
+	switch n := n.(type) {
+	case *andNode:
+		parts := make([]string, len(n.children))
+		for i, c := range n.children {
+			parts[i] = compileNode(c, t, b)
+		}
+		return "(" + strings.Join(parts, " AND ") + ")"
+	case *orNode:
+		parts := make([]string, len(n.children))
+		for i, c := range n.children {
+			parts[i] = compileNode(c, t, b)
+		}
+		return "(" + strings.Join(parts, " OR ") + ")"
+	case *notNode:
+		return "NOT " + compileNode(n.child, t, b)
+	case *textNode:
+		cond := fmt.Sprintf("%s @@ to_tsquery('%s', %s)", t.vector, t.config, b.bind(n.key, n.tsquery))
+		if len(t.fuzzy) > 0 && utf8.RuneCountInString(n.fuzzy) >= minFuzzyLength {
+			text, prefix := b.bind(n.key+":fuzzy", n.fuzzy), b.bind(n.key+":prefix", likePrefix(n.fuzzy))
+			for _, col := range t.fuzzy {
+				cond += fmt.Sprintf(" OR %s <%% %s OR %s ILIKE %s", text, col, col, prefix)
+			}
+		}
+		return "(" + cond + ")"
+	case *filterNode:
+		if compile, ok := t.filters[n.field]; ok {
+			return "(" + compile(n, b) + ")"
+		}
+	}
+	return "FALSE"
+}
+
+func statusFilter(column string) filterSQL {
+	return func(f *filterNode, b *binder) string {
+		return column + " = " + b.bind(f.key, f.value)
+	}
+}
+
+func ownerFilter(column string) filterSQL {
+	return func(f *filterNode, b *binder) string {
+		v := b.bind(f.key, f.value)
+		return fmt.Sprintf("%s IN (SELECT u.id FROM users u WHERE lower(u.email) = lower(%s) OR lower(split_part(u.email, '@', 1)) = lower(%s))", column, v, v)
+	}
+}
+
+// createdFilter compares against whole UTC days: created:>2026-01-01
+// starts the day after, created:2026-01-01 is that day.
+func createdFilter(column string) filterSQL {
+	return func(f *filterNode, b *binder) string {
+		day, next := f.date, f.date.AddDate(0, 0, 1)
+		switch f.op {
+		case ">":
+			return column + " >= " + b.bind(f.key, next)
+		case ">=":
+			return column + " >= " + b.bind(f.key, day)
+		case "<":
+			return column + " < " + b.bind(f.key, day)
+		case "<=":
+			return column + " < " + b.bind(f.key, next)
+		}
+		return fmt.Sprintf("%s >= %s AND %s < %s", column, b.bind(f.key, day), column, b.bind(f.key+"next", next))
+	}
+}
+
+func titleContainsFilter(column string) filterSQL {
+	return func(f *filterNode, b *binder) string {
+		return fmt.Sprintf("strpos(lower(%s), lower(%s)) > 0", column, b.bind(f.key, f.value))
+	}
+}
+
+// experimentFilters apply to experiments as e.
+var experimentFilters = map[string]filterSQL{
+	FieldStatus: statusFilter("e.status"),
+	FieldTag: func(f *filterNode, b *binder) string {
+		return fmt.Sprintf("e.id IN (SELECT et.experiment_id FROM experiment_tags et JOIN tags tg ON tg.id = et.tag_id WHERE lower(tg.name) = lower(%s))", b.bind(f.key, f.value))
+	},
+	FieldOwner: ownerFilter("e.owner_user_id"),
+	FieldProtocol: func(f *filterNode, b *binder) string {
+		return fmt.Sprintf("e.id IN (SELECT ep.experiment_id FROM experiment_protocols ep JOIN protocols lp ON lp.id = ep.protocol_id WHERE strpos(lower(lp.title), lower(%s)) > 0)", b.bind(f.key, f.value))
+	},
+	FieldCreated: createdFilter("e.created_at"),
+}
+
+var experimentTarget = queryTarget{vector: "e.search_vector", config: "english", filters: experimentFilters, fuzzy: []string{"e.title"}}
+
+// protocolFilters apply to protocols as p; protocol: matches the
+// protocol's own title.
+var protocolFilters = map[string]filterSQL{
+	FieldStatus:   statusFilter("p.status"),
+	FieldOwner:    ownerFilter("p.owner_user_id"),
+	FieldProtocol: titleContainsFilter("p.title"),
+	FieldCreated:  createdFilter("p.created_at"),
+}
+
+var protocolTarget = queryTarget{vector: "p.search_vector", config: "english", filters: protocolFilters, fuzzy: []string{"p.title"}}
@@ -0,0 +1,525 @@
+package search
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Reasons an experiment is related to another.
+const (
+	RelatedTags     = "tags"
+	RelatedProtocol = "protocol"
+	RelatedReagents = "reagents"
+	RelatedText     = "text"
+	RelatedProject  = "project"
+)
+
+// Scores of the reasons. A related experiment scores the sum of its
+// reasons; per-item reasons count at most maxRelatedItems items.
+const (
+	tagScore             = 1.0
+	sameVersionScore     = 3.0
+	sameProtocolScore    = 2.0
+	reagentScore         = 1.5
+	textScore            = 4.0
+	projectScore         = 1.0
+	maxRelatedItems      = 3
+	maxRelatedCandidates = 200
+	// keyTermCount is how many of the source's most frequent lexemes
+	// describe its text; minTextOverlap is the share of them another
+	// effective body must contain to count as similar.
+	keyTermCount   = 30
+	minTextOverlap = 0.2
+	// maxMentionedReagents bounds the reagents read from the source body.
+	maxMentionedReagents = 20
+)
+
+// RelatedReason is one reason an experiment is related, with the shared
+// values it rests on.
+type RelatedReason struct {
+	Kind   string   `json:"kind"`
+	Detail string   `json:"detail"`
+	Values []string `json:"values,omitempty"`
+	Score  float64  `json:"score"`
+}
+
+type RelatedExperiment struct {
+	ExperimentID string          `json:"experimentId"`
+	OwnerUserID  string          `json:"ownerUserId"`
+	Title        string          `json:"title"`
+	Status       string          `json:"status"`
+	Score        float64         `json:"score"`
+	Reasons      []RelatedReason `json:"reasons"`
+	CreatedAt    time.Time       `json:"createdAt"`
+}
+
+type RelatedInput struct {
+	ExperimentID string
+	UserID       string
+	Role         string
+	Limit        int
+}
+
+// relatedSource is what the source experiment shares with others.
+type relatedSource struct {
+	projectID        sql.NullString
+	projectTitle     sql.NullString
+	protocolID       sql.NullString
+	protocolVersion  sql.NullString
+	protocolTitle    sql.NullString
+	effectiveEntryID sql.NullString
+}
+
+// jsonStrings scans a JSON array of strings, as array columns are read
+// through to_json.
+type jsonStrings []string
+
+func (j *jsonStrings) Scan(src any) error {
+	switch v := src.(type) {
+	case []byte:
+		return json.Unmarshal(v, j)
+	case string:
+		return json.Unmarshal([]byte(v), j)
+	case nil:
+		*j = nil
+		return nil
+	}
+	return fmt.Errorf("scan %T into string list", src)
+}
+
+// relatedCandidate collects the reasons of one candidate experiment.
+type relatedCandidate struct {
+	id      string
+	score   float64
+	reasons []RelatedReason
+}
+
+// accessibleExperimentSQL restricts experiments as e to those the user
+// can read: their own, and any completed one for admins.
+const accessibleExperimentSQL = "(e.owner_user_id = %s::uuid OR (%s = 'admin' AND e.status = 'completed'))"
+
+// effectiveEntrySQL restricts entries as ee to effective ones.
+const effectiveEntrySQL = "NOT " + supersededSQL
+
+// Related ranks the other experiments the user can read by what they share
+// with the given one: tags, protocol and version, reagents mentioned in
+// both effective bodies, key terms of the effective bodies and project.
+func (s *Service) Related(ctx context.Context, in RelatedInput) ([]RelatedExperiment, error) {
+	if in.Limit <= 0 || in.Limit > 50 {
+		in.Limit = 10
+	}
+	src, err := s.relatedSource(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := map[string]*relatedCandidate{}
+	add := func(id string, reason RelatedReason) {
+		c := candidates[id]
+		if c == nil {
+			c = &relatedCandidate{id: id}
+			candidates[id] = c
+		}
+		c.score += reason.Score
+		c.reasons = append(c.reasons, reason)
+	}
+	for _, collect := range []func(context.Context, RelatedInput, relatedSource, func(string, RelatedReason)) error{
+		s.relatedByTags, s.relatedByProtocol, s.relatedByReagents, s.relatedByText, s.relatedByProject,
+	} {
+		if err := collect(ctx, in, src, add); err != nil {
+			return nil, err
+		}
+	}
+
+	ranked := make([]*relatedCandidate, 0, len(candidates))
+	for _, c := range candidates {
+		ranked = append(ranked, c)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].score != ranked[j].score {
+			return ranked[i].score > ranked[j].score
+		}
+		return ranked[i].id < ranked[j].id
+	})
+	if len(ranked) > in.Limit {
+		ranked = ranked[:in.Limit]
+	}
+	return s.relatedExperiments(ctx, ranked)
+}
+
+func (s *Service) relatedSource(ctx context.Context, in RelatedInput) (relatedSource, error) {
+	var src relatedSource
+	err := s.db.QueryRowContext(ctx, fmt.Sprintf(`
+		SELECT e.project_id::text, pj.title, ep.protocol_id::text, ep.protocol_version_id::text, p.title,
+			(SELECT ee.id::text FROM experiment_entries ee WHERE ee.experiment_id = e.id AND %s LIMIT 1)
+		FROM experiments e
+		LEFT JOIN projects pj ON pj.id = e.project_id
+		LEFT JOIN experiment_protocols ep ON ep.experiment_id = e.id
+		LEFT JOIN protocols p ON p.id = ep.protocol_id
+		WHERE e.id = $1 AND %s`,
+		fmt.Sprintf(effectiveEntrySQL, "ee.id"),
+		fmt.Sprintf(accessibleExperimentSQL, "$2", "$3"),
+	), in.ExperimentID, in.UserID, in.Role).Scan(
+		&src.projectID, &src.projectTitle, &src.protocolID, &src.protocolVersion, &src.protocolTitle, &src.effectiveEntryID,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return src, ErrNotFound
+	}
+	if err != nil {
+		return src, fmt.Errorf("load experiment: %w", err)
+	}
+	return src, nil
+}
+
+// candidateConditions restricts experiments as e to readable ones other
+// than the source, binding $1 to $3.
+func candidateConditions() string {
+	return "e.id <> $1::uuid AND " + fmt.Sprintf(accessibleExperimentSQL, "$2", "$3")
+}
+
+func (s *Service) relatedByTags(ctx context.Context, in RelatedInput, _ relatedSource, add func(string, RelatedReason)) error {
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT e.id::text, to_json(array_agg(DISTINCT t.name ORDER BY t.name))
+		FROM experiments e
+		JOIN experiment_tags et ON et.experiment_id = e.id
+		JOIN tags t ON t.id = et.tag_id
+		WHERE t.name IN (
+			SELECT st.name FROM experiment_tags sxt JOIN tags st ON st.id = sxt.tag_id WHERE sxt.experiment_id = $1::uuid
+		) AND %s
+		GROUP BY e.id
+		ORDER BY COUNT(DISTINCT t.name) DESC, e.id
+		LIMIT %d`,
+		candidateConditions(), maxRelatedCandidates,
+	), in.ExperimentID, in.UserID, in.Role)
+	if err != nil {
+		return fmt.Errorf("related by tags: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		var tags jsonStrings
+		if err := rows.Scan(&id, &tags); err != nil {
+			return fmt.Errorf("scan related by tags: %w", err)
+		}
+		add(id, RelatedReason{
+			Kind:   RelatedTags,
+			Detail: "Shares tags " + strings.Join(tags, ", "),
+			Values: tags,
+			Score:  tagScore * float64(min(len(tags), maxRelatedItems)),
+		})
+	}
+	return rows.Err()
+}
+
+func (s *Service) relatedByProtocol(ctx context.Context, in RelatedInput, src relatedSource, add func(string, RelatedReason)) error {
+	if !src.protocolID.Valid {
+		return nil
+	}
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT e.id::text, ep.protocol_version_id = $5::uuid
+		FROM experiments e
+		JOIN experiment_protocols ep ON ep.experiment_id = e.id
+		WHERE ep.protocol_id = $4::uuid AND %s
+		ORDER BY (ep.protocol_version_id = $5::uuid) DESC, e.created_at DESC
+		LIMIT %d`,
+		candidateConditions(), maxRelatedCandidates,
+	), in.ExperimentID, in.UserID, in.Role, src.protocolID.String, src.protocolVersion.String)
+	if err != nil {
+		return fmt.Errorf("related by protocol: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		var sameVersion bool
+		if err := rows.Scan(&id, &sameVersion); err != nil {
+			return fmt.Errorf("scan related by protocol: %w", err)
+		}
+		reason := RelatedReason{
+			Kind:   RelatedProtocol,
+			Detail: "Same protocol, another version: " + src.protocolTitle.String,
+			Values: []string{src.protocolID.String},
+			Score:  sameProtocolScore,
+		}
+		if sameVersion {
+			reason.Detail = "Same protocol version: " + src.protocolTitle.String
+			reason.Values = append(reason.Values, src.protocolVersion.String)
+			reason.Score = sameVersionScore
+		}
+		add(id, reason)
+	}
+	return rows.Err()
+}
+
+// relatedByReagents relates experiments whose effective bodies mention the
+// same reagents, by name or identifier, as the source's effective body.
+// The source's words narrow the reagents through their mention indexes
+// before each name and identifier is checked as a phrase, and the
+// mentioned phrases are combined into one tsquery matched against the
+// entry index.
+func (s *Service) relatedByReagents(ctx context.Context, in RelatedInput, src relatedSource, add func(string, RelatedReason)) error {
+	if !src.effectiveEntryID.Valid {
+		return nil
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT DISTINCT w.lexeme
+		FROM experiment_entries ee, unnest(to_tsvector('simple', coalesce(ee.body, ''))) w
+		WHERE ee.id = $1::uuid AND numnode(plainto_tsquery('english', w.lexeme)) > 0`,
+		src.effectiveEntryID.String,
+	)
+	if err != nil {
+		return fmt.Errorf("read source words: %w", err)
+	}
+	var words []string
+	for rows.Next() {
+		var word string
+		if err := rows.Scan(&word); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan source word: %w", err)
+		}
+		words = append(words, quoteLexeme(word))
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("read source words: %w", err)
+	}
+	if len(words) == 0 {
+		return nil
+	}
+
+	candidates := make([]string, 0, len(reagentTables))
+	for _, rt := range reagentTables {
+		terms := make([]string, 0, 1+len(rt.identifiers))
+		for _, col := range append([]string{rt.name}, rt.identifiers...) {
+			terms = append(terms, "(r."+col+")")
+		}
+		candidates = append(candidates, fmt.Sprintf(
+			"SELECT t.term, r.%s AS name FROM %s r CROSS JOIN LATERAL (VALUES %s) t(term) WHERE to_tsvector('simple', %s) @@ $2::tsquery",
+			rt.name, rt.table, strings.Join(terms, ", "), rt.mention,
+		))
+	}
+	rows, err = s.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT DISTINCT ON (lower(m.term)) m.name, phraseto_tsquery('english', m.term)::text
+		FROM (%s) m, experiment_entries source
+		WHERE source.id = $1::uuid AND length(m.term) >= %d
+		  AND source.search_vector @@ phraseto_tsquery('english', m.term)
+		ORDER BY lower(m.term), m.name
+		LIMIT %d`,
+		strings.Join(candidates, " UNION ALL "), minFuzzyLength, maxMentionedReagents,
+	), src.effectiveEntryID.String, strings.Join(words, " | "))
+	if err != nil {
+		return fmt.Errorf("read mentioned reagents: %w", err)
+	}
+	var names, queries, combined []string
+	for rows.Next() {
+		var name, query string
+		if err := rows.Scan(&name, &query); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan mentioned reagent: %w", err)
+		}
+		names = append(names, name)
+		queries = append(queries, query)
+		combined = append(combined, "("+query+")")
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("read mentioned reagents: %w", err)
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	rows, err = s.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT e.id::text, to_json(array_agg(DISTINCT m.name ORDER BY m.name))
+		FROM experiment_entries ee
+		JOIN experiments e ON e.id = ee.experiment_id
+		JOIN unnest($5::text[], $6::text[]) AS m(name, query) ON ee.search_vector @@ m.query::tsquery
+		WHERE ee.search_vector @@ $4::tsquery AND %s AND %s
+		GROUP BY e.id
+		ORDER BY COUNT(DISTINCT m.name) DESC, e.id
+		LIMIT %d`,
+		fmt.Sprintf(effectiveEntrySQL, "ee.id"), candidateConditions(), maxRelatedCandidates,
+	), in.ExperimentID, in.UserID, in.Role, strings.Join(combined, " | "), names, queries)
+	if err != nil {
+		return fmt.Errorf("related by reagents: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		var matched jsonStrings
+		if err := rows.Scan(&id, &matched); err != nil {
+			return fmt.Errorf("scan related by reagents: %w", err)
+		}
+		add(id, RelatedReason{
+			Kind:   RelatedReagents,
+			Detail: "Mentions the same reagents: " + strings.Join(matched, ", "),
+			Values: matched,
+			Score:  reagentScore * float64(min(len(matched), maxRelatedItems)),
+		})
+	}
+	return rows.Err()
+}
+
+// relatedByText relates experiments whose effective bodies contain enough
+// of the key terms, the most frequent lexemes, of the source's.
+func (s *Service) relatedByText(ctx context.Context, in RelatedInput, src relatedSource, add func(string, RelatedReason)) error {
+	if !src.effectiveEntryID.Valid {
+		return nil
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT lexeme
+		FROM experiment_entries ee, unnest(ee.search_vector)
+		WHERE ee.id = $1::uuid
+		ORDER BY coalesce(array_length(positions, 1), 1) DESC, lexeme
+		LIMIT $2`,
+		src.effectiveEntryID.String, keyTermCount,
+	)
+	if err != nil {
+		return fmt.Errorf("read key terms: %w", err)
+	}
+	var terms, quoted []string
+	for rows.Next() {
+		var term string
+		if err := rows.Scan(&term); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan key term: %w", err)
+		}
+		terms = append(terms, term)
+		quoted = append(quoted, quoteLexeme(term))
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("read key terms: %w", err)
+	}
+	// Too few terms make any overlap look significant.
+	if len(terms) < 3 {
+		return nil
+	}
+
+	rows, err = s.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT e.id::text, to_json(shared.terms)
+		FROM experiment_entries ee
+		JOIN experiments e ON e.id = ee.experiment_id
+		CROSS JOIN LATERAL (
+			SELECT array_agg(u.lexeme ORDER BY u.lexeme) AS terms
+			FROM unnest(ee.search_vector) u
+			WHERE u.lexeme = ANY($5)
+		) shared
+		WHERE ee.search_vector @@ $4::tsquery AND %s AND %s
+		  AND cardinality(shared.terms) >= $6
+		ORDER BY cardinality(shared.terms) DESC, e.id
+		LIMIT %d`,
+		fmt.Sprintf(effectiveEntrySQL, "ee.id"), candidateConditions(), maxRelatedCandidates,
+	), in.ExperimentID, in.UserID, in.Role, strings.Join(quoted, " | "), terms, int(math.Ceil(minTextOverlap*float64(len(terms)))))
+	if err != nil {
+		return fmt.Errorf("related by text: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		var shared jsonStrings
+		if err := rows.Scan(&id, &shared); err != nil {
+			return fmt.Errorf("scan related by text: %w", err)
+		}
+		overlap := float64(len(shared)) / float64(len(terms))
+		add(id, RelatedReason{
+			Kind:   RelatedText,
+			Detail: fmt.Sprintf("Similar text: shares %d of %d key terms", len(shared), len(terms)),
+			Values: shared,
+			Score:  math.Round(textScore*overlap*100) / 100,
+		})
+	}
+	return rows.Err()
+}
+
+func (s *Service) relatedByProject(ctx context.Context, in RelatedInput, src relatedSource, add func(string, RelatedReason)) error {
+	if !src.projectID.Valid {
+		return nil
+	}
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT e.id::text
+		FROM experiments e
+		WHERE e.project_id = $4::uuid AND %s
+		ORDER BY e.created_at DESC
+		LIMIT %d`,
+		candidateConditions(), maxRelatedCandidates,
+	), in.ExperimentID, in.UserID, in.Role, src.projectID.String)
+	if err != nil {
+		return fmt.Errorf("related by project: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return fmt.Errorf("scan related by project: %w", err)
+		}
+		add(id, RelatedReason{
+			Kind:   RelatedProject,
+			Detail: "Same project: " + src.projectTitle.String,
+			Values: []string{src.projectID.String},
+			Score:  projectScore,
+		})
+	}
+	return rows.Err()
+}
+
+// relatedExperiments loads the ranked candidates in rank order.
+func (s *Service) relatedExperiments(ctx context.Context, ranked []*relatedCandidate) ([]RelatedExperiment, error) {
+	out := make([]RelatedExperiment, 0, len(ranked))
+	if len(ranked) == 0 {
+		return out, nil
+	}
+	ids := make([]string, len(ranked))
+	for i, c := range ranked {
+		ids[i] = c.id
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id::text, owner_user_id::text, title, status, created_at
+		FROM experiments
+		WHERE id::text = ANY($1)`,
+		ids,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("load related experiments: %w", err)
+	}
+	defer rows.Close()
+
+	byID := map[string]RelatedExperiment{}
+	for rows.Next() {
+		var r RelatedExperiment
+		if err := rows.Scan(&r.ExperimentID, &r.OwnerUserID, &r.Title, &r.Status, &r.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan related experiment: %w", err)
+		}
+		byID[r.ExperimentID] = r
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("load related experiments: %w", err)
+	}
+	for _, c := range ranked {
+		r, ok := byID[c.id]
+		if !ok {
+			continue
+		}
+		r.Score = math.Round(c.score*100) / 100
+		sort.SliceStable(c.reasons, func(i, j int) bool { return c.reasons[i].Score > c.reasons[j].Score })
+		r.Reasons = c.reasons
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+// quoteLexeme quotes a lexeme for tsquery input, so it is matched as is.
+func quoteLexeme(lexeme string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `''`).Replace(lexeme) + "'"
+}
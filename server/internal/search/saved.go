@@ -0,0 +1,492 @@
+package search
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var (
+	ErrNotFound = errors.New("not found")
+	ErrConflict = errors.New("conflict")
+)
+
+// maxSavedSearchNameLength bounds saved search names.
+const maxSavedSearchNameLength = 200
+
+// SearchCriteria is the saved part of a SearchInput: what to search for,
+// independent of who runs it and which page they read.
+type SearchCriteria struct {
+	Query         string              `json:"query"`
+	Types         []string            `json:"types,omitempty"`
+	Facets        map[string][]string `json:"facets,omitempty"`
+	EffectiveOnly bool                `json:"effectiveOnly,omitempty"`
+}
+
+// SavedSearch is a named search its owner can re-run. A subscribed search
+// alerts its owner to experiments and protocols that start matching it.
+type SavedSearch struct {
+	ID          string         `json:"savedSearchId"`
+	OwnerUserID string         `json:"ownerUserId"`
+	Name        string         `json:"name"`
+	Criteria    SearchCriteria `json:"criteria"`
+	Subscribed  bool           `json:"subscribed"`
+	CreatedAt   time.Time      `json:"createdAt"`
+	UpdatedAt   time.Time      `json:"updatedAt"`
+}
+
+type SaveSearchInput struct {
+	SavedSearchID string // empty when creating
+	OwnerUserID   string
+	Name          string
+	Criteria      SearchCriteria
+	Subscribed    bool
+}
+
+// Alert is a record that newly matches a subscribed saved search.
+type Alert struct {
+	SavedSearchID string `json:"savedSearchId"`
+	OwnerUserID   string `json:"ownerUserId"`
+	SearchName    string `json:"searchName"`
+	RecordType    string `json:"recordType"` // HitExperiment or HitProtocol
+	RecordID      string `json:"recordId"`
+	Title         string `json:"title"`
+}
+
+type AlertOutput struct {
+	EventsScanned int     `json:"eventsScanned"`
+	Alerts        []Alert `json:"alerts"`
+}
+
+// validateCriteria checks criteria the way Search would check them, so a
+// saved search can always be re-run.
+func validateCriteria(c SearchCriteria) error {
+	if strings.TrimSpace(c.Query) == "" {
+		return fmt.Errorf("%w: query is required", ErrInvalidInput)
+	}
+	if _, err := ParseQuery(c.Query); err != nil {
+		return err
+	}
+	if _, err := parseHitTypes(c.Types); err != nil {
+		return err
+	}
+	return validateFacets(c.Facets)
+}
+
+func validateSaveSearchInput(in SaveSearchInput) (string, []byte, error) {
+	name := strings.TrimSpace(in.Name)
+	if name == "" {
+		return "", nil, fmt.Errorf("%w: name is required", ErrInvalidInput)
+	}
+	if len(name) > maxSavedSearchNameLength {
+		return "", nil, fmt.Errorf("%w: name must be at most %d characters", ErrInvalidInput, maxSavedSearchNameLength)
+	}
+	if err := validateCriteria(in.Criteria); err != nil {
+		return "", nil, err
+	}
+	criteria, err := json.Marshal(in.Criteria)
+	if err != nil {
+		return "", nil, fmt.Errorf("marshal criteria: %w", err)
+	}
+	return name, criteria, nil
+}
+
+const savedSearchColumns = `id, owner_user_id, name, criteria, subscribed, created_at, updated_at`
+
+func scanSavedSearch(row interface{ Scan(...any) error }) (*SavedSearch, error) {
+	var ss SavedSearch
+	var criteria []byte
+	if err := row.Scan(&ss.ID, &ss.OwnerUserID, &ss.Name, &criteria, &ss.Subscribed, &ss.CreatedAt, &ss.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(criteria, &ss.Criteria); err != nil {
+		return nil, fmt.Errorf("decode criteria: %w", err)
+	}
+	return &ss, nil
+}
+
+// savedSearchNameConstraint is the unique constraint on an owner's saved
+// search names, see migration 000033.
+const savedSearchNameConstraint = "saved_searches_owner_name_unique"
+
+// isSavedSearchNameConflict reports whether err is a unique violation of
+// savedSearchNameConstraint.
+func isSavedSearchNameConflict(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == savedSearchNameConstraint
+}
+
+// CreateSavedSearch saves a search under a name unique to its owner. A
+// subscription starts at the current head of the audit log.
+func (s *Service) CreateSavedSearch(ctx context.Context, in SaveSearchInput) (*SavedSearch, error) {
+	name, criteria, err := validateSaveSearchInput(in)
+	if err != nil {
+		return nil, err
+	}
+	ss, err := scanSavedSearch(s.db.QueryRowContext(ctx, `
+		INSERT INTO saved_searches (owner_user_id, name, criteria, subscribed, alert_cursor)
+		VALUES ($1, $2, $3, $4, CASE WHEN $4 THEN (SELECT COALESCE(MAX(id), 0) FROM audit_log) ELSE 0 END)
+		RETURNING `+savedSearchColumns,
+		in.OwnerUserID, name, criteria, in.Subscribed,
+	))
+	if err != nil {
+		if isSavedSearchNameConflict(err) {
+			return nil, fmt.Errorf("%w: a saved search named %q already exists", ErrConflict, name)
+		}
+		return nil, fmt.Errorf("insert saved search: %w", err)
+	}
+	return ss, nil
+}
+
+// UpdateSavedSearch replaces a saved search's name, criteria and
+// subscription. Subscribing again starts from the current head of the
+// audit log; changes made while unsubscribed do not alert.
+func (s *Service) UpdateSavedSearch(ctx context.Context, in SaveSearchInput) (*SavedSearch, error) {
+	name, criteria, err := validateSaveSearchInput(in)
+	if err != nil {
+		return nil, err
+	}
+	ss, err := scanSavedSearch(s.db.QueryRowContext(ctx, `
+		UPDATE saved_searches
+		SET name = $1, criteria = $2, subscribed = $3,
+			alert_cursor = CASE WHEN $3 AND NOT subscribed THEN (SELECT COALESCE(MAX(id), 0) FROM audit_log) ELSE alert_cursor END,
+			updated_at = NOW()
+		WHERE id = $4 AND owner_user_id = $5
+		RETURNING `+savedSearchColumns,
+		name, criteria, in.Subscribed, in.SavedSearchID, in.OwnerUserID,
+	))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		if isSavedSearchNameConflict(err) {
+			return nil, fmt.Errorf("%w: a saved search named %q already exists", ErrConflict, name)
+		}
+		return nil, fmt.Errorf("update saved search: %w", err)
+	}
+	return ss, nil
+}
+
+func (s *Service) ListSavedSearches(ctx context.Context, ownerUserID string) ([]SavedSearch, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+savedSearchColumns+` FROM saved_searches WHERE owner_user_id = $1 ORDER BY name`,
+		ownerUserID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query saved searches: %w", err)
+	}
+	defer rows.Close()
+
+	searches := []SavedSearch{}
+	for rows.Next() {
+		ss, err := scanSavedSearch(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan saved search: %w", err)
+		}
+		searches = append(searches, *ss)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query saved searches: %w", err)
+	}
+	return searches, nil
+}
+
+func (s *Service) GetSavedSearch(ctx context.Context, savedSearchID, ownerUserID string) (*SavedSearch, error) {
+	ss, err := scanSavedSearch(s.db.QueryRowContext(ctx,
+		`SELECT `+savedSearchColumns+` FROM saved_searches WHERE id = $1 AND owner_user_id = $2`,
+		savedSearchID, ownerUserID,
+	))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("query saved search: %w", err)
+	}
+	return ss, nil
+}
+
+func (s *Service) DeleteSavedSearch(ctx context.Context, savedSearchID, ownerUserID string) error {
+	result, err := s.db.ExecContext(ctx,
+		`DELETE FROM saved_searches WHERE id = $1 AND owner_user_id = $2`,
+		savedSearchID, ownerUserID,
+	)
+	if err != nil {
+		return fmt.Errorf("delete saved search: %w", err)
+	}
+	n, _ := result.RowsAffected()
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// RunSavedSearch re-runs a saved search with its owner's current access.
+func (s *Service) RunSavedSearch(ctx context.Context, savedSearchID, userID, role string, limit, offset int) (*SearchOutput, error) {
+	ss, err := s.GetSavedSearch(ctx, savedSearchID, userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.Search(ctx, SearchInput{
+		Query:  ss.Criteria.Query,
+		UserID: userID,
+		Role:   role,
+		Types:  ss.Criteria.Types,
+		Facets: ss.Criteria.Facets,
+		Limit:  limit,
+		Offset: offset,
+
+		EffectiveOnly: ss.Criteria.EffectiveOnly,
+	})
+}
+
+// subscription is a subscribed saved search with its owner's role and the
+// last audit event checked for it.
+type subscription struct {
+	SavedSearch
+	role   string
+	cursor int64
+}
+
+// changedRecord is an experiment or protocol touched by an audit event.
+type changedRecord struct {
+	auditID    int64
+	recordType string
+	recordID   string
+}
+
+// AlertDeliverer delivers an alert inside the transaction that records it,
+// so an alert is either recorded and delivered or retried on the next run.
+type AlertDeliverer func(ctx context.Context, tx *sql.Tx, alert Alert) error
+
+// ProcessAlerts checks the records changed since each subscribed search
+// was last checked, up to limit audit events, and returns those that now
+// match a search and have not alerted for it before. Audit events on an
+// experiment, its entries or a protocol count as changes. Each alert is
+// passed to deliver once; if delivery fails, neither the alert nor the
+// search's cursor is recorded.
+func (s *Service) ProcessAlerts(ctx context.Context, limit int, deliver AlertDeliverer) (*AlertOutput, error) {
+	if limit <= 0 {
+		limit = 500
+	}
+	out := &AlertOutput{Alerts: []Alert{}}
+
+	subs, err := s.subscriptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(subs) == 0 {
+		return out, nil
+	}
+	from := subs[0].cursor
+	for _, sub := range subs[1:] {
+		from = min(from, sub.cursor)
+	}
+
+	// The audit chain is appended under a lock, so ids commit in order and
+	// nothing can later appear at or below head.
+	var head int64
+	if err := s.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(id), 0) FROM audit_log`).Scan(&head); err != nil {
+		return nil, fmt.Errorf("read audit head: %w", err)
+	}
+	changes, err := s.changedRecords(ctx, from, head, limit)
+	if err != nil {
+		return nil, err
+	}
+	out.EventsScanned = len(changes)
+	upTo := head
+	if len(changes) == limit {
+		upTo = changes[len(changes)-1].auditID
+	}
+
+	for _, sub := range subs {
+		if sub.cursor >= upTo {
+			continue
+		}
+		alerts, err := s.alertSubscription(ctx, sub, changes, upTo, deliver)
+		if err != nil {
+			return nil, err
+		}
+		out.Alerts = append(out.Alerts, alerts...)
+	}
+	return out, nil
+}
+
+func (s *Service) subscriptions(ctx context.Context) ([]subscription, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT ss.id, ss.owner_user_id, ss.name, ss.criteria, u.role, ss.alert_cursor
+		FROM saved_searches ss
+		JOIN users u ON u.id = ss.owner_user_id
+		WHERE ss.subscribed
+		ORDER BY ss.alert_cursor, ss.id`)
+	if err != nil {
+		return nil, fmt.Errorf("query subscriptions: %w", err)
+	}
+	defer rows.Close()
+
+	var subs []subscription
+	for rows.Next() {
+		var sub subscription
+		var criteria []byte
+		if err := rows.Scan(&sub.ID, &sub.OwnerUserID, &sub.Name, &criteria, &sub.role, &sub.cursor); err != nil {
+			return nil, fmt.Errorf("scan subscription: %w", err)
+		}
+		if err := json.Unmarshal(criteria, &sub.Criteria); err != nil {
+			return nil, fmt.Errorf("decode criteria of saved search %s: %w", sub.ID, err)
+		}
+		subs = append(subs, sub)
+	}
+	return subs, rows.Err()
+}
+
+// changedRecords lists the experiments and protocols touched by audit
+// events in (from, head], oldest first. Entry events count for their
+// experiment.
+func (s *Service) changedRecords(ctx context.Context, from, head int64, limit int) ([]changedRecord, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT a.id,
+			CASE a.entity_type WHEN 'protocol' THEN 'protocol' ELSE 'experiment' END,
+			COALESCE(ee.experiment_id, a.entity_id)::text
+		FROM audit_log a
+		LEFT JOIN experiment_entries ee ON a.entity_type = 'experiment_entry' AND ee.id = a.entity_id
+		WHERE a.id > $1 AND a.id <= $2
+		  AND a.entity_type IN ('experiment', 'experiment_entry', 'protocol')
+		  AND a.entity_id IS NOT NULL
+		ORDER BY a.id
+		LIMIT $3`,
+		from, head, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query changed records: %w", err)
+	}
+	defer rows.Close()
+
+	var changes []changedRecord
+	for rows.Next() {
+		var c changedRecord
+		if err := rows.Scan(&c.auditID, &c.recordType, &c.recordID); err != nil {
+			return nil, fmt.Errorf("scan changed record: %w", err)
+		}
+		changes = append(changes, c)
+	}
+	return changes, rows.Err()
+}
+
+// alertSubscription matches the records changed after the subscription's
+// cursor against its search, records and delivers the new alerts and
+// advances the cursor to upTo, all in one transaction. A search whose
+// criteria no longer parse is passed over.
+func (s *Service) alertSubscription(ctx context.Context, sub subscription, changes []changedRecord, upTo int64, deliver AlertDeliverer) ([]Alert, error) {
+	auditIDs := map[string]map[string]int64{HitExperiment: {}, HitProtocol: {}}
+	for _, c := range changes {
+		if c.auditID > sub.cursor && c.auditID <= upTo {
+			auditIDs[c.recordType][c.recordID] = c.auditID
+		}
+	}
+
+	var matches []Alert
+	if query, err := ParseQuery(sub.Criteria.Query); err == nil {
+		in := SearchInput{Query: sub.Criteria.Query, UserID: sub.OwnerUserID, Role: sub.role, Facets: sub.Criteria.Facets}
+		types, err := parseHitTypes(sub.Criteria.Types)
+		if err != nil {
+			types = map[string]bool{}
+		}
+		for _, recordType := range []string{HitExperiment, HitProtocol} {
+			if !types[recordType] || len(auditIDs[recordType]) == 0 {
+				continue
+			}
+			ids := make([]string, 0, len(auditIDs[recordType]))
+			for id := range auditIDs[recordType] {
+				ids = append(ids, id)
+			}
+			found, err := s.matchChanged(ctx, sub, query, in, recordType, ids)
+			if err != nil {
+				return nil, err
+			}
+			matches = append(matches, found...)
+		}
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin alert tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Only the first run to record an alert returns it, so concurrent runs
+	// do not alert twice.
+	alerts := []Alert{}
+	for _, m := range matches {
+		res, err := tx.ExecContext(ctx, `
+			INSERT INTO saved_search_alerts (saved_search_id, record_type, record_id, audit_log_id)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT DO NOTHING`,
+			sub.ID, m.RecordType, m.RecordID, auditIDs[m.RecordType][m.RecordID],
+		)
+		if err != nil {
+			return nil, fmt.Errorf("record alert: %w", err)
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			if err := deliver(ctx, tx, m); err != nil {
+				return nil, fmt.Errorf("deliver alert for %s %s: %w", m.RecordType, m.RecordID, err)
+			}
+			alerts = append(alerts, m)
+		}
+	}
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE saved_searches SET alert_cursor = $1 WHERE id = $2 AND subscribed AND alert_cursor < $1`,
+		upTo, sub.ID,
+	); err != nil {
+		return nil, fmt.Errorf("advance alert cursor: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit alerts: %w", err)
+	}
+	return alerts, nil
+}
+
+// matchChanged returns the records among ids that match the search for its
+// owner and have not alerted for it yet.
+func (s *Service) matchChanged(ctx context.Context, sub subscription, query *Query, in SearchInput, recordType string, ids []string) ([]Alert, error) {
+	b := &binder{}
+	var table, alias string
+	var conditions []string
+	if recordType == HitExperiment {
+		table, alias = "experiments", "e"
+		conditions = experimentSearchConditions(query, in, b, "")
+	} else {
+		table, alias = "protocols", "p"
+		conditions = protocolSearchConditions(query, in, b)
+	}
+	conditions = append(conditions,
+		fmt.Sprintf("%s.id::text = ANY(%s)", alias, b.bind("ids", ids)),
+		fmt.Sprintf(`NOT EXISTS (
+			SELECT 1 FROM saved_search_alerts sa
+			WHERE sa.saved_search_id = %s AND sa.record_type = '%s' AND sa.record_id = %s.id)`,
+			b.bind("savedSearch", sub.ID), recordType, alias),
+	)
+
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(
+		`SELECT %[1]s.id::text, %[1]s.title FROM %[2]s %[1]s WHERE %[3]s ORDER BY %[1]s.created_at`,
+		alias, table, strings.Join(conditions, " AND "),
+	), b.args...)
+	if err != nil {
+		return nil, fmt.Errorf("match saved search %s: %w", sub.ID, err)
+	}
+	defer rows.Close()
+
+	var alerts []Alert
+	for rows.Next() {
+		a := Alert{SavedSearchID: sub.ID, OwnerUserID: sub.OwnerUserID, SearchName: sub.Name, RecordType: recordType}
+		if err := rows.Scan(&a.RecordID, &a.Title); err != nil {
+			return nil, fmt.Errorf("scan match: %w", err)
+		}
+		alerts = append(alerts, a)
+	}
+	return alerts, rows.Err()
+}
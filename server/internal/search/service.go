@@ -38,20 +38,26 @@ type ProtocolResult struct {
 }
 
 type SearchInput struct {
-	Query      string
-	UserID     string
-	Role       string
-	Status     string // optional filter: draft, completed, or empty for all
-	DateFrom   *time.Time
-	DateTo     *time.Time
-	Tags       []string
-	Limit      int
-	Offset     int
+	Query         string // query language, see ParseQuery
+	UserID        string
+	Role          string
+	Status        string // optional filter: draft, completed, or empty for all
+	DateFrom      *time.Time
+	DateTo        *time.Time
+	Tags          []string
+	Types         []string            // optional hit types for Hits; empty for all
+	Facets        map[string][]string // facet selections, see FacetNames
+	EffectiveOnly bool                // leave out hits bound to superseded entries
+	Limit         int
+	Offset        int
 }
 
 type SearchOutput struct {
 	Experiments []ExperimentResult `json:"experiments"`
 	Protocols   []ProtocolResult   `json:"protocols,omitempty"`
+	Hits        []Hit              `json:"hits"`
+	Facets      []Facet            `json:"facets"`
+	DidYouMean  string             `json:"didYouMean,omitempty"`
 	TotalCount  int                `json:"totalCount"`
 }
 
@@ -79,7 +85,13 @@ func (s *Service) Search(ctx context.Context, in SearchInput) (*SearchOutput, er
 		in.Offset = 0
 	}
 
-	tsQuery := toTSQuery(q)
+	query, err := ParseQuery(q)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateFacets(in.Facets); err != nil {
+		return nil, err
+	}
 
 	out := &SearchOutput{
 		Experiments: []ExperimentResult{},
@@ -87,7 +99,7 @@ func (s *Service) Search(ctx context.Context, in SearchInput) (*SearchOutput, er
 	}
 
 	// --- Search experiments ---
-	expQuery, expArgs := s.buildExperimentSearchQuery(tsQuery, in)
+	expQuery, expArgs := s.buildExperimentSearchQuery(query, in)
 	rows, err := s.db.QueryContext(ctx, expQuery, expArgs...)
 	if err != nil {
 		return nil, fmt.Errorf("search experiments: %w", err)
@@ -103,7 +115,7 @@ func (s *Service) Search(ctx context.Context, in SearchInput) (*SearchOutput, er
 	}
 
 	// --- Search protocols ---
-	protQuery, protArgs := s.buildProtocolSearchQuery(tsQuery, in)
+	protQuery, protArgs := s.buildProtocolSearchQuery(query, in)
 	pRows, err := s.db.QueryContext(ctx, protQuery, protArgs...)
 	if err != nil {
 		return nil, fmt.Errorf("search protocols: %w", err)
@@ -118,6 +130,26 @@ func (s *Service) Search(ctx context.Context, in SearchInput) (*SearchOutput, er
 		out.Protocols = append(out.Protocols, r)
 	}
 
+	// --- Unified typed hits across every searchable record ---
+	out.Hits, err = s.searchHits(ctx, query, in)
+	if err != nil {
+		return nil, err
+	}
+
+	// --- Facet counts over the experiment results ---
+	out.Facets, err = s.facets(ctx, query, in)
+	if err != nil {
+		return nil, err
+	}
+
+	// --- "Did you mean" when nothing matched ---
+	if len(out.Experiments) == 0 && len(out.Protocols) == 0 && len(out.Hits) == 0 {
+		out.DidYouMean, err = s.suggest(ctx, q, query, in)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	out.TotalCount = len(out.Experiments) + len(out.Protocols)
 	return out, nil
 }
@@ -184,100 +216,83 @@ func (s *Service) SearchExperimentContent(ctx context.Context, query, userID, ro
 	return results, nil
 }
 
-func (s *Service) buildExperimentSearchQuery(tsQuery string, in SearchInput) (string, []any) {
-	var conditions []string
-	var args []any
-	argIdx := 1
-
-	conditions = append(conditions, fmt.Sprintf("e.search_vector @@ to_tsquery('english', $%d)", argIdx))
-	args = append(args, tsQuery)
-	argIdx++
+func (s *Service) buildExperimentSearchQuery(query *Query, in SearchInput) (string, []any) {
+	b := &binder{}
+	conditions := experimentSearchConditions(query, in, b, "")
 
-	// Role-based visibility
-	if in.Role == "admin" {
-		conditions = append(conditions, "e.status = 'completed'")
-	} else {
-		conditions = append(conditions, fmt.Sprintf("e.owner_user_id = $%d", argIdx))
-		args = append(args, in.UserID)
-		argIdx++
+	snippet := "e.title"
+	rankQuery, rank := query.rankExpr(experimentTarget, b)
+	if rankQuery != "" {
+		snippet = fmt.Sprintf("ts_headline('english', e.title, %s, 'MaxWords=40,MinWords=10')", rankQuery)
 	}
 
-	if in.Status != "" {
-		conditions = append(conditions, fmt.Sprintf("e.status = $%d", argIdx))
-		args = append(args, in.Status)
-		argIdx++
-	}
-
-	if in.DateFrom != nil {
-		conditions = append(conditions, fmt.Sprintf("e.created_at >= $%d", argIdx))
-		args = append(args, *in.DateFrom)
-		argIdx++
-	}
-	if in.DateTo != nil {
-		conditions = append(conditions, fmt.Sprintf("e.created_at <= $%d", argIdx))
-		args = append(args, *in.DateTo)
-		argIdx++
-	}
-
-	if len(in.Tags) > 0 {
-		conditions = append(conditions, fmt.Sprintf(
-			`e.id IN (SELECT et.experiment_id FROM experiment_tags et JOIN tags t ON t.id = et.tag_id WHERE t.name = ANY($%d))`,
-			argIdx,
-		))
-		args = append(args, in.Tags)
-		argIdx++
-	}
-
-	query := fmt.Sprintf(`
+	sqlStr := fmt.Sprintf(`
 		SELECT e.id, e.owner_user_id, e.title, e.status,
-			ts_headline('english', e.title, to_tsquery('english', $1), 'MaxWords=40,MinWords=10') AS snippet,
-			ts_rank(e.search_vector, to_tsquery('english', $1)) AS rank,
+			%s AS snippet,
+			%s AS rank,
 			e.created_at
 		FROM experiments e
 		WHERE %s
-		ORDER BY rank DESC
-		LIMIT $%d OFFSET $%d`,
+		ORDER BY rank DESC, e.created_at DESC
+		LIMIT %s OFFSET %s`,
+		snippet, rank,
 		strings.Join(conditions, " AND "),
-		argIdx, argIdx+1,
+		b.bind("limit", in.Limit), b.bind("offset", in.Offset),
 	)
 
-	args = append(args, in.Limit, in.Offset)
-
-	return query, args
+	return sqlStr, b.args
 }
 
-func (s *Service) buildProtocolSearchQuery(tsQuery string, in SearchInput) (string, []any) {
-	var conditions []string
-	var args []any
-	argIdx := 1
-
-	conditions = append(conditions, fmt.Sprintf("p.search_vector @@ to_tsquery('english', $%d)", argIdx))
-	args = append(args, tsQuery)
-	argIdx++
+// experimentSearchConditions are the conditions of the experiment results:
+// the query, role-based visibility and the input's filters and facet
+// selections, leaving out the selection of facet except.
+func experimentSearchConditions(query *Query, in SearchInput, b *binder, except string) []string {
+	conditions := []string{query.condition(experimentTarget, b)}
 
+	// Role-based visibility
 	if in.Role == "admin" {
-		conditions = append(conditions, "p.status IN ('published','archived')")
+		conditions = append(conditions, "e.status = 'completed'")
 	} else {
-		conditions = append(conditions, fmt.Sprintf("p.owner_user_id = $%d", argIdx))
-		args = append(args, in.UserID)
-		argIdx++
+		conditions = append(conditions, "e.owner_user_id = "+b.bind("user", in.UserID))
 	}
 
-	query := fmt.Sprintf(`
+	return append(conditions, experimentFilterConditions(in, b, except)...)
+}
+
+func (s *Service) buildProtocolSearchQuery(query *Query, in SearchInput) (string, []any) {
+	b := &binder{}
+	conditions := protocolSearchConditions(query, in, b)
+
+	_, rank := query.rankExpr(protocolTarget, b)
+
+	sqlStr := fmt.Sprintf(`
 		SELECT p.id, p.owner_user_id, p.title, p.description, p.status,
-			ts_rank(p.search_vector, to_tsquery('english', $1)) AS rank,
+			%s AS rank,
 			p.created_at
 		FROM protocols p
 		WHERE %s
-		ORDER BY rank DESC
-		LIMIT $%d OFFSET $%d`,
+		ORDER BY rank DESC, p.created_at DESC
+		LIMIT %s OFFSET %s`,
+		rank,
 		strings.Join(conditions, " AND "),
-		argIdx, argIdx+1,
+		b.bind("limit", in.Limit), b.bind("offset", in.Offset),
 	)
 
-	args = append(args, in.Limit, in.Offset)
+	return sqlStr, b.args
+}
+
+// protocolSearchConditions are the conditions of the protocol results: the
+// query and role-based visibility.
+func protocolSearchConditions(query *Query, in SearchInput, b *binder) []string {
+	conditions := []string{query.condition(protocolTarget, b)}
+
+	if in.Role == "admin" {
+		conditions = append(conditions, "p.status IN ('published','archived')")
+	} else {
+		conditions = append(conditions, "p.owner_user_id = "+b.bind("user", in.UserID))
+	}
 
-	return query, args
+	return conditions
 }
 
 // toTSQuery converts user input to a safe tsquery string using & (AND) between words.
@@ -0,0 +1,90 @@
+package search
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// minSuggestionSimilarity is the trigram similarity a word needs to be
+	// offered as a correction.
+	minSuggestionSimilarity = 0.3
+	// suggestionCandidates bounds the titles and names read per source.
+	suggestionCandidates = 100
+)
+
+// suggest returns the query with each single-word term replaced by the
+// most similar word of the titles and reagent names the user can see, or
+// "" when every term is spelled as it appears there or nothing is close.
+func (s *Service) suggest(ctx context.Context, input string, query *Query, in SearchInput) (string, error) {
+	corrected, changed := input, false
+	for _, word := range query.words {
+		if utf8.RuneCountInString(word) < minFuzzyLength {
+			continue
+		}
+		best, err := s.closestWord(ctx, strings.ToLower(word), in)
+		if err != nil {
+			return "", err
+		}
+		if best == "" || best == strings.ToLower(word) {
+			continue
+		}
+		pattern := regexp.MustCompile(`(^|[\s(])` + regexp.QuoteMeta(word) + `($|[\s)])`)
+		corrected = pattern.ReplaceAllString(corrected, "${1}"+best+"${2}")
+		changed = true
+	}
+	if !changed {
+		return "", nil
+	}
+	return corrected, nil
+}
+
+// closestWord finds the vocabulary word most similar to term, drawing on
+// titles and names that contain a word similar to it (<%, served by the
+// trigram indexes).
+func (s *Service) closestWord(ctx context.Context, term string, in SearchInput) (string, error) {
+	b := &binder{}
+	t := b.bind("term", term)
+	sources := []string{
+		fmt.Sprintf("SELECT e.title AS doc FROM experiments e WHERE %s <%% e.title AND (e.owner_user_id = %s::uuid OR (%s = 'admin' AND e.status = 'completed'))",
+			t, b.bind("user", in.UserID), b.bind("role", in.Role)),
+		fmt.Sprintf("SELECT p.title FROM protocols p WHERE %s <%% p.title AND (p.owner_user_id = %s::uuid OR (%s = 'admin' AND p.status IN ('published','archived')))",
+			t, b.bind("user", in.UserID), b.bind("role", in.Role)),
+		fmt.Sprintf("SELECT tp.title FROM experiment_templates tp WHERE %s <%% tp.title AND tp.owner_user_id = %s::uuid",
+			t, b.bind("user", in.UserID)),
+	}
+	for _, rt := range reagentTables {
+		sources = append(sources, fmt.Sprintf("SELECT r.%s FROM %s r WHERE %s <%% r.%s", rt.name, rt.table, t, rt.name))
+	}
+	branches := make([]string, len(sources))
+	for i, src := range sources {
+		branches[i] = fmt.Sprintf("(%s LIMIT %d)", src, suggestionCandidates)
+	}
+
+	var best string
+	err := s.db.QueryRowContext(ctx, fmt.Sprintf(`
+		SELECT w
+		FROM (
+			SELECT regexp_split_to_table(lower(doc), '[^[:alnum:]]+') AS w
+			FROM (%s) candidates
+		) words
+		WHERE length(w) >= %d AND similarity(w, %s) >= %g
+		GROUP BY w
+		ORDER BY similarity(w, %s) DESC, COUNT(*) DESC, w
+		LIMIT 1`,
+		strings.Join(branches, " UNION ALL "),
+		minFuzzyLength, t, minSuggestionSimilarity, t,
+	), b.args...).Scan(&best)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("suggest correction: %w", err)
+	}
+	return best, nil
+}
@@ -0,0 +1,330 @@
+package search
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Hit types returned by the unified search.
+const (
+	HitExperiment  = "experiment"
+	HitEntry       = "entry"
+	HitProtocol    = "protocol"
+	HitComment     = "comment"
+	HitProposal    = "proposal"
+	HitAttachment  = "attachment"
+	HitDataExtract = "dataExtract"
+	HitTemplate    = "template"
+	HitReagent     = "reagent"
+)
+
+// HitTypes lists every hit type in display order.
+var HitTypes = []string{
+	HitExperiment, HitEntry, HitProtocol, HitComment, HitProposal,
+	HitAttachment, HitDataExtract, HitTemplate, HitReagent,
+}
+
+const headlineOptions = "MaxWords=35,MinWords=15"
+
+// Entry states of hits bound to an experiment entry.
+const (
+	EntryEffective  = "effective"
+	EntryHistorical = "historical"
+)
+
+// supersededSQL is true when an addendum has superseded the entry %s.
+const supersededSQL = "EXISTS (SELECT 1 FROM experiment_entries sup WHERE sup.supersedes_entry_id = %s)"
+
+// Hit is one typed result of the unified search. ExperimentID is set for
+// hits that belong to an experiment; Subtype names the reagent table
+// (antibody, cellLine, ...) for reagent hits, whose IDs are the reagent's
+// integer ID as a string. EntryID is set for entry hits and attachments
+// bound to an entry; EntryState says whether that entry is the effective
+// one or historical, superseded by a later addendum.
+type Hit struct {
+	Type         string    `json:"type"`
+	ID           string    `json:"id"`
+	Subtype      string    `json:"subtype,omitempty"`
+	ExperimentID string    `json:"experimentId,omitempty"`
+	EntryID      string    `json:"entryId,omitempty"`
+	EntryState   string    `json:"entryState,omitempty"`
+	Title        string    `json:"title"`
+	Snippet      string    `json:"snippet"`
+	Rank         float64   `json:"rank"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// hitSource is one branch of the unified search. Vector must repeat the
+// expression of the table's full-text index exactly. Experiment-scoped
+// sources join their experiment as e and take its access rule and the
+// status, date and tag filters. Entry is the entry a hit is bound to, if
+// any, as a UUID column.
+type hitSource struct {
+	typ          string
+	subtype      string
+	config       string
+	from         string
+	vector       string
+	id           string
+	experimentID string
+	entry        string
+	title        string
+	snippet      string
+	createdAt    string
+	where        string
+	experiment   bool
+	filters      map[string]filterSQL
+	fuzzy        []string
+}
+
+var hitSources = append([]hitSource{
+	{
+		typ: HitExperiment, config: "english", experiment: true,
+		from:   "experiments e",
+		vector: "e.search_vector", id: "e.id::text", experimentID: "e.id::text",
+		title: "e.title", snippet: "e.title", createdAt: "e.created_at",
+		fuzzy: []string{"e.title"},
+	},
+	{
+		typ: HitEntry, config: "english", experiment: true,
+		from:   "experiment_entries ee JOIN experiments e ON e.id = ee.experiment_id",
+		vector: "ee.search_vector", id: "ee.id::text", experimentID: "e.id::text", entry: "ee.id",
+		title: "e.title", snippet: "ee.body", createdAt: "ee.created_at",
+	},
+	{
+		typ: HitProtocol, config: "english",
+		from:   "protocols p",
+		vector: "p.search_vector", id: "p.id::text", experimentID: "NULL::text",
+		title: "p.title", snippet: "p.title || ' ' || p.description", createdAt: "p.created_at",
+		where:   "(p.owner_user_id = {user}::uuid OR ({role} = 'admin' AND p.status IN ('published','archived')))",
+		filters: protocolFilters,
+		fuzzy:   []string{"p.title"},
+	},
+	{
+		typ: HitComment, config: "english", experiment: true,
+		from:   "record_comments c JOIN experiments e ON e.id = c.experiment_id",
+		vector: "to_tsvector('english', c.body)", id: "c.id::text", experimentID: "e.id::text",
+		title: "e.title", snippet: "c.body", createdAt: "c.created_at",
+	},
+	{
+		typ: HitProposal, config: "english", experiment: true,
+		from:   "experiment_proposals pr JOIN experiments e ON e.id = pr.source_experiment_id",
+		vector: "to_tsvector('english', pr.title || ' ' || pr.body)", id: "pr.id::text", experimentID: "e.id::text",
+		title: "pr.title", snippet: "pr.body", createdAt: "pr.created_at",
+	},
+	{
+		// The snippet is the attachment's metadata rather than a headline.
+		typ: HitAttachment, config: "simple", experiment: true,
+		from: `attachments a JOIN experiments e ON e.id = a.experiment_id
+			LEFT JOIN attachment_image_metadata m ON m.attachment_id = a.id`,
+		vector: "to_tsvector('simple', translate(a.object_key || ' ' || a.mime_type, '/_.-', '    '))",
+		id:     "a.id::text", experimentID: "e.id::text", entry: "a.entry_id",
+		title:     "regexp_replace(a.object_key, '^.*/', '')",
+		snippet:   "a.mime_type || coalesce(', ' || m.format || ' ' || m.width || 'x' || m.height, '')",
+		createdAt: "a.created_at",
+		where:     "a.status = 'completed'",
+	},
+	{
+		typ: HitDataExtract, config: "english", experiment: true,
+		from: `data_extracts d JOIN experiments e ON e.id = d.experiment_id
+			LEFT JOIN attachments a ON a.id = d.attachment_id`,
+		vector: "to_tsvector('english', d.column_headers)", id: "d.id::text", experimentID: "e.id::text",
+		title:     "coalesce(regexp_replace(a.object_key, '^.*/', ''), e.title)",
+		snippet:   "array_to_string(ARRAY(SELECT jsonb_array_elements_text(d.column_headers)), ', ')",
+		createdAt: "d.parsed_at",
+	},
+	{
+		typ: HitTemplate, config: "english",
+		from:   "experiment_templates t",
+		vector: "to_tsvector('english', t.title || ' ' || t.description)", id: "t.id::text", experimentID: "NULL::text",
+		title: "t.title", snippet: "t.title || ' ' || t.description", createdAt: "t.created_at",
+		where:   "t.owner_user_id = {user}::uuid",
+		filters: templateFilters,
+		fuzzy:   []string{"t.title"},
+	},
+}, reagentSources()...)
+
+// reagentTables are the reagent tables the search covers: the name column,
+// the identifier columns matched by trigram similarity and prefix besides
+// the name, the document of the table's full-text index, and the mention
+// document of its name and identifiers, indexed for related experiments.
+var reagentTables = []struct {
+	subtype, table, name string
+	identifiers          []string
+	document, mention    string
+}{
+	{"antibody", "reagent_antibody", "antibody_name", []string{"catalog_no"}, "antibody_name || ' ' || coalesce(catalog_no, '') || ' ' || coalesce(notes, '')", "antibody_name || ' ' || coalesce(catalog_no, '')"},
+	{"cellLine", "reagent_cell_line", "cell_line_name", nil, "cell_line_name || ' ' || coalesce(notes, '')", "cell_line_name"},
+	{"virus", "reagent_virus", "virus_name", nil, "virus_name || ' ' || coalesce(notes, '')", "virus_name"},
+	{"dna", "reagent_dna", "dna_name", nil, "dna_name || ' ' || coalesce(notes, '')", "dna_name"},
+	{"oligo", "reagent_oligo", "oligo_name", []string{"sequence"}, "oligo_name || ' ' || coalesce(sequence, '') || ' ' || coalesce(notes, '')", "oligo_name || ' ' || coalesce(sequence, '')"},
+	{"chemical", "reagent_chemical", "chemical_name", []string{"catalog_no"}, "chemical_name || ' ' || coalesce(catalog_no, '') || ' ' || coalesce(notes, '')", "chemical_name || ' ' || coalesce(catalog_no, '')"},
+	{"molecular", "reagent_molecular", "mr_name", nil, "mr_name || ' ' || coalesce(notes, '')", "mr_name"},
+}
+
+// reagentSources searches the reagent tables. Reagents are shared across
+// the lab, so every authenticated user sees them.
+func reagentSources() []hitSource {
+	sources := make([]hitSource, len(reagentTables))
+	for i, rt := range reagentTables {
+		fuzzy := []string{"r." + rt.name}
+		for _, col := range rt.identifiers {
+			fuzzy = append(fuzzy, "r."+col)
+		}
+		sources[i] = hitSource{
+			typ: HitReagent, subtype: rt.subtype, config: "simple",
+			from:   rt.table + " r",
+			vector: "to_tsvector('simple', " + rt.document + ")", id: "r.id::text", experimentID: "NULL::text",
+			title: "r." + rt.name, snippet: rt.document, createdAt: "r.created_at",
+			filters: map[string]filterSQL{FieldCreated: createdFilter("r.created_at")},
+			fuzzy:   fuzzy,
+		}
+	}
+	return sources
+}
+
+// templateFilters apply to experiment templates as t; tag: matches the
+// template's tags and protocol: its linked protocol's title.
+var templateFilters = map[string]filterSQL{
+	FieldTag: func(f *filterNode, b *binder) string {
+		return fmt.Sprintf("EXISTS (SELECT 1 FROM jsonb_array_elements_text(t.tags) tt WHERE lower(tt) = lower(%s))", b.bind(f.key, f.value))
+	},
+	FieldOwner: ownerFilter("t.owner_user_id"),
+	FieldProtocol: func(f *filterNode, b *binder) string {
+		return fmt.Sprintf("t.protocol_id IN (SELECT lp.id FROM protocols lp WHERE strpos(lower(lp.title), lower(%s)) > 0)", b.bind(f.key, f.value))
+	},
+	FieldCreated: createdFilter("t.created_at"),
+}
+
+// parseHitTypes validates a hit type filter; empty means every type.
+func parseHitTypes(types []string) (map[string]bool, error) {
+	selected := map[string]bool{}
+	for _, t := range types {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			continue
+		}
+		known := false
+		for _, ht := range HitTypes {
+			known = known || ht == t
+		}
+		if !known {
+			return nil, fmt.Errorf("%w: unknown type %q; expected one of %s", ErrInvalidInput, t, strings.Join(HitTypes, ", "))
+		}
+		selected[t] = true
+	}
+	if len(selected) == 0 {
+		for _, ht := range HitTypes {
+			selected[ht] = true
+		}
+	}
+	return selected, nil
+}
+
+// searchHits runs the unified search as one UNION ALL over the selected
+// sources, ranked across types. Field filters and facet selections on
+// experiment-scoped hits describe the experiment; in effective-only mode,
+// hits bound to a superseded entry are left out. Arguments are bound only
+// when a selected source uses them, as Postgres rejects parameters it
+// cannot type.
+func (s *Service) searchHits(ctx context.Context, query *Query, in SearchInput) ([]Hit, error) {
+	selected, err := parseHitTypes(in.Types)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &binder{}
+	expand := func(cond string) string {
+		if strings.Contains(cond, "{user}") {
+			cond = strings.ReplaceAll(cond, "{user}", b.bind("user", in.UserID))
+		}
+		if strings.Contains(cond, "{role}") {
+			cond = strings.ReplaceAll(cond, "{role}", b.bind("role", in.Role))
+		}
+		return cond
+	}
+	experimentConditions := func() []string {
+		conditions := []string{expand("(e.owner_user_id = {user}::uuid OR ({role} = 'admin' AND e.status = 'completed'))")}
+		return append(conditions, experimentFilterConditions(in, b, "")...)
+	}
+
+	var branches []string
+	for _, src := range hitSources {
+		if !selected[src.typ] {
+			continue
+		}
+		filters := src.filters
+		if src.experiment {
+			filters = experimentFilters
+		}
+		target := queryTarget{vector: src.vector, config: src.config, filters: filters, fuzzy: src.fuzzy}
+		conditions := []string{query.condition(target, b)}
+		if src.where != "" {
+			conditions = append(conditions, expand(src.where))
+		}
+		if src.experiment {
+			conditions = append(conditions, experimentConditions()...)
+		}
+		entryID, entryState := "NULL::text", "NULL::text"
+		if src.entry != "" {
+			superseded := fmt.Sprintf(supersededSQL, src.entry)
+			entryID = src.entry + "::text"
+			entryState = fmt.Sprintf("CASE WHEN %s IS NULL THEN NULL WHEN %s THEN '%s' ELSE '%s' END",
+				src.entry, superseded, EntryHistorical, EntryEffective)
+			if in.EffectiveOnly {
+				conditions = append(conditions, "NOT "+superseded)
+			}
+		}
+		snippet := fmt.Sprintf("left(%s, 200)", src.snippet)
+		rankQuery, rank := query.rankExpr(target, b)
+		if rankQuery != "" {
+			snippet = fmt.Sprintf("ts_headline('%s', %s, %s, '%s')", src.config, src.snippet, rankQuery, headlineOptions)
+		}
+		if src.typ == HitAttachment {
+			snippet = src.snippet
+		}
+		branches = append(branches, fmt.Sprintf(`
+			SELECT '%s' AS type, %s AS id, '%s' AS subtype, %s AS experiment_id,
+				%s AS entry_id, %s AS entry_state, %s AS title,
+				%s AS snippet, %s AS rank, %s AS created_at
+			FROM %s
+			WHERE %s`,
+			src.typ, src.id, src.subtype, src.experimentID,
+			entryID, entryState, src.title,
+			snippet, rank, src.createdAt,
+			src.from,
+			strings.Join(conditions, " AND "),
+		))
+	}
+
+	sqlStr := fmt.Sprintf(`
+		SELECT type, id, subtype, experiment_id, entry_id, entry_state, title, snippet, rank, created_at
+		FROM (%s) hits
+		ORDER BY rank DESC, created_at DESC
+		LIMIT %s OFFSET %s`,
+		strings.Join(branches, "\n\t\t\tUNION ALL"),
+		b.bind("limit", in.Limit), b.bind("offset", in.Offset),
+	)
+	args := b.args
+
+	rows, err := s.db.QueryContext(ctx, sqlStr, args...)
+	if err != nil {
+		return nil, fmt.Errorf("search hits: %w", err)
+	}
+	defer rows.Close()
+
+	hits := []Hit{}
+	for rows.Next() {
+		var h Hit
+		var experimentID, entryID, entryState sql.NullString
+		if err := rows.Scan(&h.Type, &h.ID, &h.Subtype, &experimentID, &entryID, &entryState, &h.Title, &h.Snippet, &h.Rank, &h.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan hit: %w", err)
+		}
+		h.ExperimentID, h.EntryID, h.EntryState = experimentID.String, entryID.String, entryState.String
+		hits = append(hits, h)
+	}
+	return hits, rows.Err()
+}
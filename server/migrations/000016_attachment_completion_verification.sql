@@ -0,0 +1,95 @@
+-- 000016_attachment_completion_verification.sql
+-- Records the server-side verification performed when an attachment upload
+-- is completed: the SHA-256 observed in (or computed from) the object store
+-- and whether it matched the client-reported checksum and size.
+
+ALTER TABLE attachments
+    ADD COLUMN IF NOT EXISTS verification_status TEXT NOT NULL DEFAULT 'unverified'
+        CHECK (verification_status IN ('unverified', 'verified', 'mismatch', 'missing', 'probe_failed')),
+    ADD COLUMN IF NOT EXISTS verified_sha256 TEXT,
+    ADD COLUMN IF NOT EXISTS verification_details JSONB NOT NULL DEFAULT '{}'::jsonb,
+    ADD COLUMN IF NOT EXISTS verified_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_attachments_verification_status
+    ON attachments (verification_status)
+    WHERE verification_status IN ('mismatch', 'missing');
+
+CREATE OR REPLACE FUNCTION enforce_attachment_update_rules()
+RETURNS TRIGGER
+LANGUAGE plpgsql
+AS $$
+BEGIN
+    IF NEW.experiment_id <> OLD.experiment_id THEN
+        RAISE EXCEPTION 'experiment_id is immutable for attachments' USING ERRCODE = '55000';
+    END IF;
+
+    IF NEW.uploader_user_id <> OLD.uploader_user_id THEN
+        RAISE EXCEPTION 'uploader_user_id is immutable for attachments' USING ERRCODE = '55000';
+    END IF;
+
+    IF NEW.object_key <> OLD.object_key THEN
+        RAISE EXCEPTION 'object_key is immutable for attachments' USING ERRCODE = '55000';
+    END IF;
+
+    IF NEW.size_bytes <> OLD.size_bytes THEN
+        RAISE EXCEPTION 'size_bytes is immutable for attachments' USING ERRCODE = '55000';
+    END IF;
+
+    IF NEW.mime_type <> OLD.mime_type THEN
+        RAISE EXCEPTION 'mime_type is immutable for attachments' USING ERRCODE = '55000';
+    END IF;
+
+    IF OLD.status = 'completed' THEN
+        IF NEW.status <> 'completed' THEN
+            RAISE EXCEPTION 'completed attachments are immutable' USING ERRCODE = '55000';
+        END IF;
+
+        IF COALESCE(NEW.checksum, '') <> COALESCE(OLD.checksum, '') THEN
+            RAISE EXCEPTION 'checksum cannot be changed after completion' USING ERRCODE = '55000';
+        END IF;
+
+        IF NEW.completed_at IS DISTINCT FROM OLD.completed_at THEN
+            RAISE EXCEPTION 'completed_at cannot be changed after completion' USING ERRCODE = '55000';
+        END IF;
+
+        IF NEW.verification_status <> OLD.verification_status
+           OR NEW.verified_sha256 IS DISTINCT FROM OLD.verified_sha256
+           OR NEW.verification_details <> OLD.verification_details
+           OR NEW.verified_at IS DISTINCT FROM OLD.verified_at THEN
+            RAISE EXCEPTION 'verification result cannot be changed after completion' USING ERRCODE = '55000';
+        END IF;
+
+        RETURN NEW;
+    END IF;
+
+    IF NEW.status NOT IN ('initiated', 'completed') THEN
+        RAISE EXCEPTION 'invalid attachment status transition' USING ERRCODE = '55000';
+    END IF;
+
+    IF NEW.status = 'initiated' THEN
+        IF COALESCE(BTRIM(NEW.checksum), '') <> '' THEN
+            RAISE EXCEPTION 'initiated attachments must not include checksum' USING ERRCODE = '55000';
+        END IF;
+        IF NEW.completed_at IS NOT NULL THEN
+            RAISE EXCEPTION 'initiated attachments must not include completed_at' USING ERRCODE = '55000';
+        END IF;
+        IF NEW.verified_sha256 IS NOT NULL THEN
+            RAISE EXCEPTION 'initiated attachments must not include verified_sha256' USING ERRCODE = '55000';
+        END IF;
+    END IF;
+
+    IF NEW.status = 'completed' THEN
+        IF NEW.completed_at IS NULL THEN
+            RAISE EXCEPTION 'completed attachments must set completed_at' USING ERRCODE = '55000';
+        END IF;
+        IF COALESCE(BTRIM(NEW.checksum), '') = '' THEN
+            RAISE EXCEPTION 'completed attachments must include checksum' USING ERRCODE = '55000';
+        END IF;
+        IF NEW.verification_status = 'verified' AND COALESCE(BTRIM(NEW.verified_sha256), '') = '' THEN
+            RAISE EXCEPTION 'verified attachments must include verified_sha256' USING ERRCODE = '55000';
+        END IF;
+    END IF;
+
+    RETURN NEW;
+END;
+$$;
@@ -0,0 +1,155 @@
+-- 000017_attachment_versions.sql
+-- Attachment versioning: a corrected upload supersedes an earlier attachment
+-- in the same experiment, forming an append-only chain per logical attachment
+-- (lineage). Mirrors how addendum entries supersede experiment entries.
+
+ALTER TABLE attachments
+    ADD COLUMN IF NOT EXISTS supersedes_attachment_id UUID REFERENCES attachments(id) ON DELETE RESTRICT,
+    ADD COLUMN IF NOT EXISTS lineage_id UUID,
+    ADD COLUMN IF NOT EXISTS version_number INTEGER NOT NULL DEFAULT 1 CHECK (version_number >= 1);
+
+-- Existing attachments each start their own lineage. Runs before the update
+-- rules below so backfilling lineage_id is still permitted.
+UPDATE attachments SET lineage_id = id WHERE lineage_id IS NULL;
+
+ALTER TABLE attachments
+    ALTER COLUMN lineage_id SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_attachments_lineage_id
+    ON attachments (lineage_id, version_number);
+
+-- A completed version can only be superseded once by another completed
+-- version; competing pending uploads lose when they try to complete.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_attachments_completed_successor
+    ON attachments (supersedes_attachment_id)
+    WHERE supersedes_attachment_id IS NOT NULL AND status = 'completed';
+
+CREATE OR REPLACE FUNCTION enforce_attachment_version_rules()
+RETURNS TRIGGER
+LANGUAGE plpgsql
+AS $$
+DECLARE
+    prev_experiment_id UUID;
+    prev_status TEXT;
+    prev_lineage_id UUID;
+    prev_version_number INTEGER;
+BEGIN
+    IF NEW.supersedes_attachment_id IS NULL THEN
+        NEW.lineage_id := NEW.id;
+        NEW.version_number := 1;
+        RETURN NEW;
+    END IF;
+
+    SELECT experiment_id, status, lineage_id, version_number
+    INTO prev_experiment_id, prev_status, prev_lineage_id, prev_version_number
+    FROM attachments
+    WHERE id = NEW.supersedes_attachment_id;
+
+    IF prev_experiment_id IS NULL THEN
+        RAISE EXCEPTION 'supersedes_attachment_id does not exist' USING ERRCODE = '55000';
+    END IF;
+
+    IF prev_experiment_id <> NEW.experiment_id THEN
+        RAISE EXCEPTION 'attachment version must supersede an attachment in the same experiment' USING ERRCODE = '55000';
+    END IF;
+
+    IF prev_status <> 'completed' THEN
+        RAISE EXCEPTION 'only completed attachments can be superseded' USING ERRCODE = '55000';
+    END IF;
+
+    NEW.lineage_id := prev_lineage_id;
+    NEW.version_number := prev_version_number + 1;
+    RETURN NEW;
+END;
+$$;
+
+DROP TRIGGER IF EXISTS trg_attachments_version_rules ON attachments;
+CREATE TRIGGER trg_attachments_version_rules
+BEFORE INSERT ON attachments
+FOR EACH ROW EXECUTE FUNCTION enforce_attachment_version_rules();
+
+CREATE OR REPLACE FUNCTION enforce_attachment_update_rules()
+RETURNS TRIGGER
+LANGUAGE plpgsql
+AS $$
+BEGIN
+    IF NEW.experiment_id <> OLD.experiment_id THEN
+        RAISE EXCEPTION 'experiment_id is immutable for attachments' USING ERRCODE = '55000';
+    END IF;
+
+    IF NEW.uploader_user_id <> OLD.uploader_user_id THEN
+        RAISE EXCEPTION 'uploader_user_id is immutable for attachments' USING ERRCODE = '55000';
+    END IF;
+
+    IF NEW.object_key <> OLD.object_key THEN
+        RAISE EXCEPTION 'object_key is immutable for attachments' USING ERRCODE = '55000';
+    END IF;
+
+    IF NEW.size_bytes <> OLD.size_bytes THEN
+        RAISE EXCEPTION 'size_bytes is immutable for attachments' USING ERRCODE = '55000';
+    END IF;
+
+    IF NEW.mime_type <> OLD.mime_type THEN
+        RAISE EXCEPTION 'mime_type is immutable for attachments' USING ERRCODE = '55000';
+    END IF;
+
+    IF NEW.supersedes_attachment_id IS DISTINCT FROM OLD.supersedes_attachment_id
+       OR NEW.lineage_id <> OLD.lineage_id
+       OR NEW.version_number <> OLD.version_number THEN
+        RAISE EXCEPTION 'attachment version chain is immutable' USING ERRCODE = '55000';
+    END IF;
+
+    IF OLD.status = 'completed' THEN
+        IF NEW.status <> 'completed' THEN
+            RAISE EXCEPTION 'completed attachments are immutable' USING ERRCODE = '55000';
+        END IF;
+
+        IF COALESCE(NEW.checksum, '') <> COALESCE(OLD.checksum, '') THEN
+            RAISE EXCEPTION 'checksum cannot be changed after completion' USING ERRCODE = '55000';
+        END IF;
+
+        IF NEW.completed_at IS DISTINCT FROM OLD.completed_at THEN
+            RAISE EXCEPTION 'completed_at cannot be changed after completion' USING ERRCODE = '55000';
+        END IF;
+
+        IF NEW.verification_status <> OLD.verification_status
+           OR NEW.verified_sha256 IS DISTINCT FROM OLD.verified_sha256
+           OR NEW.verification_details <> OLD.verification_details
+           OR NEW.verified_at IS DISTINCT FROM OLD.verified_at THEN
+            RAISE EXCEPTION 'verification result cannot be changed after completion' USING ERRCODE = '55000';
+        END IF;
+
+        RETURN NEW;
+    END IF;
+
+    IF NEW.status NOT IN ('initiated', 'completed') THEN
+        RAISE EXCEPTION 'invalid attachment status transition' USING ERRCODE = '55000';
+    END IF;
+
+    IF NEW.status = 'initiated' THEN
+        IF COALESCE(BTRIM(NEW.checksum), '') <> '' THEN
+            RAISE EXCEPTION 'initiated attachments must not include checksum' USING ERRCODE = '55000';
+        END IF;
+        IF NEW.completed_at IS NOT NULL THEN
+            RAISE EXCEPTION 'initiated attachments must not include completed_at' USING ERRCODE = '55000';
+        END IF;
+        IF NEW.verified_sha256 IS NOT NULL THEN
+            RAISE EXCEPTION 'initiated attachments must not include verified_sha256' USING ERRCODE = '55000';
+        END IF;
+    END IF;
+
+    IF NEW.status = 'completed' THEN
+        IF NEW.completed_at IS NULL THEN
+            RAISE EXCEPTION 'completed attachments must set completed_at' USING ERRCODE = '55000';
+        END IF;
+        IF COALESCE(BTRIM(NEW.checksum), '') = '' THEN
+            RAISE EXCEPTION 'completed attachments must include checksum' USING ERRCODE = '55000';
+        END IF;
+        IF NEW.verification_status = 'verified' AND COALESCE(BTRIM(NEW.verified_sha256), '') = '' THEN
+            RAISE EXCEPTION 'verified attachments must include verified_sha256' USING ERRCODE = '55000';
+        END IF;
+    END IF;
+
+    RETURN NEW;
+END;
+$$;
@@ -0,0 +1,50 @@
+-- 000018_attachment_entry_links.sql
+-- Optionally binds an attachment to the experiment entry (original or
+-- addendum) it documents. The binding is fixed at upload time.
+
+ALTER TABLE attachments
+    ADD COLUMN IF NOT EXISTS entry_id UUID REFERENCES experiment_entries(id) ON DELETE RESTRICT;
+
+CREATE INDEX IF NOT EXISTS idx_attachments_entry_id
+    ON attachments (entry_id)
+    WHERE entry_id IS NOT NULL;
+
+CREATE OR REPLACE FUNCTION enforce_attachment_entry_rules()
+RETURNS TRIGGER
+LANGUAGE plpgsql
+AS $$
+DECLARE
+    entry_experiment_id UUID;
+BEGIN
+    IF TG_OP = 'UPDATE' THEN
+        IF NEW.entry_id IS DISTINCT FROM OLD.entry_id THEN
+            RAISE EXCEPTION 'entry_id is immutable for attachments' USING ERRCODE = '55000';
+        END IF;
+        RETURN NEW;
+    END IF;
+
+    IF NEW.entry_id IS NULL THEN
+        RETURN NEW;
+    END IF;
+
+    SELECT experiment_id
+    INTO entry_experiment_id
+    FROM experiment_entries
+    WHERE id = NEW.entry_id;
+
+    IF entry_experiment_id IS NULL THEN
+        RAISE EXCEPTION 'entry_id does not exist' USING ERRCODE = '55000';
+    END IF;
+
+    IF entry_experiment_id <> NEW.experiment_id THEN
+        RAISE EXCEPTION 'attachment entry must belong to the same experiment' USING ERRCODE = '55000';
+    END IF;
+
+    RETURN NEW;
+END;
+$$;
+
+DROP TRIGGER IF EXISTS trg_attachments_entry_rules ON attachments;
+CREATE TRIGGER trg_attachments_entry_rules
+BEFORE INSERT OR UPDATE ON attachments
+FOR EACH ROW EXECUTE FUNCTION enforce_attachment_entry_rules();
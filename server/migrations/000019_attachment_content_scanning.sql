@@ -0,0 +1,51 @@
+-- 000019_attachment_content_scanning.sql
+-- Content scanning stage that runs after an upload is completed. Attachments
+-- awaiting a scan or quarantined by a scanner cannot be downloaded.
+
+ALTER TABLE attachments
+    ADD COLUMN IF NOT EXISTS scan_status TEXT NOT NULL DEFAULT 'not_scanned'
+        CHECK (scan_status IN ('not_scanned', 'pending_scan', 'clean', 'quarantined', 'scan_failed')),
+    ADD COLUMN IF NOT EXISTS scan_attempts INTEGER NOT NULL DEFAULT 0 CHECK (scan_attempts >= 0),
+    ADD COLUMN IF NOT EXISTS scan_details JSONB NOT NULL DEFAULT '{}'::jsonb,
+    ADD COLUMN IF NOT EXISTS scanned_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_attachments_scan_queue
+    ON attachments (completed_at)
+    WHERE scan_status IN ('pending_scan', 'scan_failed');
+
+CREATE OR REPLACE FUNCTION enforce_attachment_scan_rules()
+RETURNS TRIGGER
+LANGUAGE plpgsql
+AS $$
+BEGIN
+    IF NEW.scan_status = OLD.scan_status
+       AND NEW.scan_attempts = OLD.scan_attempts
+       AND NEW.scan_details = OLD.scan_details
+       AND NEW.scanned_at IS NOT DISTINCT FROM OLD.scanned_at THEN
+        RETURN NEW;
+    END IF;
+
+    IF OLD.scan_status IN ('clean', 'quarantined') THEN
+        RAISE EXCEPTION 'scan verdict is immutable once recorded' USING ERRCODE = '55000';
+    END IF;
+
+    IF NEW.scan_attempts < OLD.scan_attempts THEN
+        RAISE EXCEPTION 'scan_attempts cannot decrease' USING ERRCODE = '55000';
+    END IF;
+
+    IF NEW.scan_status <> OLD.scan_status AND NOT (
+        (OLD.scan_status = 'not_scanned' AND NEW.scan_status = 'pending_scan' AND NEW.status = 'completed')
+        OR (OLD.scan_status IN ('pending_scan', 'scan_failed') AND NEW.scan_status IN ('clean', 'quarantined', 'scan_failed'))
+    ) THEN
+        RAISE EXCEPTION 'invalid attachment scan status transition from % to %', OLD.scan_status, NEW.scan_status
+            USING ERRCODE = '55000';
+    END IF;
+
+    RETURN NEW;
+END;
+$$;
+
+DROP TRIGGER IF EXISTS trg_attachments_scan_rules ON attachments;
+CREATE TRIGGER trg_attachments_scan_rules
+BEFORE UPDATE ON attachments
+FOR EACH ROW EXECUTE FUNCTION enforce_attachment_scan_rules();
@@ -0,0 +1,97 @@
+-- 000020_attachment_content_dedup.sql
+-- Content-addressed deduplication. An attachment's object_key stays its
+-- logical, unique name; content_object_key is the stored object actually
+-- served, which several attachments may share. attachment_objects counts the
+-- completed attachments referencing each verified stored object.
+
+ALTER TABLE attachments
+    ADD COLUMN IF NOT EXISTS content_object_key TEXT,
+    ADD COLUMN IF NOT EXISTS deduplicated_from_attachment_id UUID REFERENCES attachments(id) ON DELETE RESTRICT;
+
+UPDATE attachments SET content_object_key = object_key WHERE content_object_key IS NULL;
+
+ALTER TABLE attachments
+    ALTER COLUMN content_object_key SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_attachments_content_object_key
+    ON attachments (content_object_key);
+
+CREATE TABLE IF NOT EXISTS attachment_objects (
+    object_key TEXT PRIMARY KEY,
+    sha256 TEXT NOT NULL CHECK (sha256 ~ '^[0-9a-f]{64}$'),
+    size_bytes BIGINT NOT NULL CHECK (size_bytes > 0),
+    ref_count INTEGER NOT NULL DEFAULT 0 CHECK (ref_count >= 0),
+    first_attachment_id UUID NOT NULL REFERENCES attachments(id) ON DELETE RESTRICT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_attachment_objects_sha256
+    ON attachment_objects (sha256, size_bytes);
+
+INSERT INTO attachment_objects (object_key, sha256, size_bytes, ref_count, first_attachment_id, created_at, updated_at)
+SELECT DISTINCT ON (a.content_object_key)
+    a.content_object_key,
+    a.verified_sha256,
+    a.size_bytes,
+    (SELECT COUNT(*) FROM attachments r WHERE r.content_object_key = a.content_object_key AND r.status = 'completed'),
+    a.id,
+    a.completed_at,
+    NOW()
+FROM attachments a
+WHERE a.status = 'completed'
+  AND a.verification_status = 'verified'
+  AND a.verified_sha256 ~ '^[0-9a-f]{64}$'
+ORDER BY a.content_object_key, a.completed_at ASC
+ON CONFLICT (object_key) DO NOTHING;
+
+CREATE OR REPLACE FUNCTION enforce_attachment_content_rules()
+RETURNS TRIGGER
+LANGUAGE plpgsql
+AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        NEW.content_object_key := COALESCE(NULLIF(BTRIM(NEW.content_object_key), ''), NEW.object_key);
+        RETURN NEW;
+    END IF;
+
+    IF NEW.content_object_key <> OLD.content_object_key
+       OR NEW.deduplicated_from_attachment_id IS DISTINCT FROM OLD.deduplicated_from_attachment_id THEN
+        RAISE EXCEPTION 'attachment content linkage is immutable' USING ERRCODE = '55000';
+    END IF;
+
+    RETURN NEW;
+END;
+$$;
+
+DROP TRIGGER IF EXISTS trg_attachments_content_rules ON attachments;
+CREATE TRIGGER trg_attachments_content_rules
+BEFORE INSERT OR UPDATE ON attachments
+FOR EACH ROW EXECUTE FUNCTION enforce_attachment_content_rules();
+
+CREATE OR REPLACE FUNCTION enforce_attachment_object_rules()
+RETURNS TRIGGER
+LANGUAGE plpgsql
+AS $$
+BEGIN
+    IF NEW.object_key <> OLD.object_key
+       OR NEW.sha256 <> OLD.sha256
+       OR NEW.size_bytes <> OLD.size_bytes
+       OR NEW.first_attachment_id <> OLD.first_attachment_id
+       OR NEW.created_at <> OLD.created_at THEN
+        RAISE EXCEPTION 'attachment object identity is immutable' USING ERRCODE = '55000';
+    END IF;
+
+    RETURN NEW;
+END;
+$$;
+
+DROP TRIGGER IF EXISTS trg_attachment_objects_update_rules ON attachment_objects;
+CREATE TRIGGER trg_attachment_objects_update_rules
+BEFORE UPDATE ON attachment_objects
+FOR EACH ROW EXECUTE FUNCTION enforce_attachment_object_rules();
+
+DROP TRIGGER IF EXISTS trg_attachment_objects_reject_delete ON attachment_objects;
+CREATE TRIGGER trg_attachment_objects_reject_delete
+BEFORE DELETE ON attachment_objects
+FOR EACH ROW EXECUTE FUNCTION reject_delete();
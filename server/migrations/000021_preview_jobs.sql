@@ -0,0 +1,55 @@
+-- 000021_preview_jobs.sql
+-- Server-side preview generation. Each completed attachment gets at most one
+-- preview job; a background worker claims queued jobs, reads the stored
+-- object and writes attachment_previews, retrying transient failures with
+-- backoff.
+
+CREATE TABLE IF NOT EXISTS preview_jobs (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    attachment_id UUID NOT NULL UNIQUE REFERENCES attachments(id) ON DELETE RESTRICT,
+    status TEXT NOT NULL DEFAULT 'queued'
+        CHECK (status IN ('queued', 'running', 'succeeded', 'failed', 'skipped')),
+    attempts INTEGER NOT NULL DEFAULT 0 CHECK (attempts >= 0),
+    max_attempts INTEGER NOT NULL DEFAULT 5 CHECK (max_attempts > 0),
+    last_error TEXT,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    started_at TIMESTAMPTZ,
+    finished_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_preview_jobs_queue
+    ON preview_jobs (next_attempt_at)
+    WHERE status IN ('queued', 'running');
+
+CREATE OR REPLACE FUNCTION enforce_preview_job_rules()
+RETURNS TRIGGER
+LANGUAGE plpgsql
+AS $$
+BEGIN
+    IF NEW.attachment_id <> OLD.attachment_id OR NEW.created_at <> OLD.created_at THEN
+        RAISE EXCEPTION 'preview job identity is immutable' USING ERRCODE = '55000';
+    END IF;
+
+    IF NEW.attempts < OLD.attempts OR NEW.max_attempts < OLD.max_attempts THEN
+        RAISE EXCEPTION 'preview job attempts cannot decrease' USING ERRCODE = '55000';
+    END IF;
+
+    IF OLD.status IN ('succeeded', 'skipped') AND NEW.status <> OLD.status THEN
+        RAISE EXCEPTION 'preview job % is final', OLD.status USING ERRCODE = '55000';
+    END IF;
+
+    RETURN NEW;
+END;
+$$;
+
+DROP TRIGGER IF EXISTS trg_preview_jobs_update_rules ON preview_jobs;
+CREATE TRIGGER trg_preview_jobs_update_rules
+BEFORE UPDATE ON preview_jobs
+FOR EACH ROW EXECUTE FUNCTION enforce_preview_job_rules();
+
+DROP TRIGGER IF EXISTS trg_preview_jobs_reject_delete ON preview_jobs;
+CREATE TRIGGER trg_preview_jobs_reject_delete
+BEFORE DELETE ON preview_jobs
+FOR EACH ROW EXECUTE FUNCTION reject_delete();
@@ -0,0 +1,29 @@
+-- 000022_attachment_image_metadata.sql
+-- Source image properties recorded when previews are generated, so clients
+-- can show dimensions, bit depth and stack size without fetching the file.
+-- display_min/display_max hold the auto-contrast range used for high
+-- bit-depth previews.
+
+CREATE TABLE IF NOT EXISTS attachment_image_metadata (
+    attachment_id UUID PRIMARY KEY REFERENCES attachments(id) ON DELETE RESTRICT,
+    format        TEXT             NOT NULL,
+    width         INTEGER          NOT NULL CHECK (width > 0),
+    height        INTEGER          NOT NULL CHECK (height > 0),
+    bit_depth     INTEGER          NOT NULL CHECK (bit_depth > 0),
+    channels      INTEGER          NOT NULL CHECK (channels > 0),
+    page_count    INTEGER          NOT NULL DEFAULT 1 CHECK (page_count > 0),
+    sample_format TEXT             NOT NULL DEFAULT 'uint' CHECK (sample_format IN ('uint', 'int', 'float')),
+    display_min   DOUBLE PRECISION,
+    display_max   DOUBLE PRECISION,
+    created_at    TIMESTAMPTZ      NOT NULL DEFAULT NOW()
+);
+
+DROP TRIGGER IF EXISTS trg_attachment_image_metadata_reject_update ON attachment_image_metadata;
+CREATE TRIGGER trg_attachment_image_metadata_reject_update
+BEFORE UPDATE ON attachment_image_metadata
+FOR EACH ROW EXECUTE FUNCTION reject_mutation();
+
+DROP TRIGGER IF EXISTS trg_attachment_image_metadata_reject_delete ON attachment_image_metadata;
+CREATE TRIGGER trg_attachment_image_metadata_reject_delete
+BEFORE DELETE ON attachment_image_metadata
+FOR EACH ROW EXECUTE FUNCTION reject_mutation();
@@ -0,0 +1,17 @@
+-- 000023_preview_renditions.sql
+-- Previews are generated in several renditions (thumbnail, medium, large).
+-- Larger renditions may live in the object store instead of the data column;
+-- exactly one of data and object_key is set. size_bytes records the encoded
+-- size; rows written before this migration fall back to octet_length(data).
+
+ALTER TABLE attachment_previews ALTER COLUMN data DROP NOT NULL;
+ALTER TABLE attachment_previews ADD COLUMN IF NOT EXISTS object_key TEXT;
+ALTER TABLE attachment_previews ADD COLUMN IF NOT EXISTS size_bytes BIGINT CHECK (size_bytes IS NULL OR size_bytes >= 0);
+
+ALTER TABLE attachment_previews DROP CONSTRAINT IF EXISTS attachment_previews_storage_check;
+ALTER TABLE attachment_previews ADD CONSTRAINT attachment_previews_storage_check
+    CHECK ((data IS NOT NULL) <> (object_key IS NOT NULL));
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_attachment_previews_object_key
+    ON attachment_previews (object_key)
+    WHERE object_key IS NOT NULL;
@@ -0,0 +1,32 @@
+-- 000024_data_extract_rows.sql
+-- Full parsed tables for data extracts. Rows are stored in fixed-size chunks
+-- (a JSON array of row arrays per chunk) so a dataset of any size is read
+-- page by page without one huge JSONB value. sample_rows stays as the quick
+-- preview; rows_stored is false for extracts parsed before this migration,
+-- which only have their sample.
+
+ALTER TABLE data_extracts
+    ADD COLUMN IF NOT EXISTS rows_stored BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE IF NOT EXISTS data_extract_chunks (
+    data_extract_id UUID        NOT NULL REFERENCES data_extracts(id) ON DELETE RESTRICT,
+    chunk_index     INTEGER     NOT NULL CHECK (chunk_index >= 0),
+    start_row       INTEGER     NOT NULL CHECK (start_row >= 0),
+    row_count       INTEGER     NOT NULL CHECK (row_count > 0),
+    rows            JSONB       NOT NULL,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (data_extract_id, chunk_index)
+);
+
+CREATE INDEX IF NOT EXISTS idx_data_extract_chunks_start_row
+    ON data_extract_chunks (data_extract_id, start_row);
+
+DROP TRIGGER IF EXISTS trg_data_extract_chunks_reject_update ON data_extract_chunks;
+CREATE TRIGGER trg_data_extract_chunks_reject_update
+BEFORE UPDATE ON data_extract_chunks
+FOR EACH ROW EXECUTE FUNCTION reject_mutation();
+
+DROP TRIGGER IF EXISTS trg_data_extract_chunks_reject_delete ON data_extract_chunks;
+CREATE TRIGGER trg_data_extract_chunks_reject_delete
+BEFORE DELETE ON data_extract_chunks
+FOR EACH ROW EXECUTE FUNCTION reject_mutation();
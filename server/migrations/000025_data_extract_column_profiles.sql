@@ -0,0 +1,7 @@
+-- 000025_data_extract_column_profiles.sql
+-- Per-column inferred type, unit and summary statistics computed when an
+-- extract is parsed. Extracts parsed before this migration have an empty
+-- array and are profiled on read.
+
+ALTER TABLE data_extracts
+    ADD COLUMN IF NOT EXISTS column_profiles JSONB NOT NULL DEFAULT '[]';
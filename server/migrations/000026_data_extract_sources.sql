@@ -0,0 +1,9 @@
+-- 000026_data_extract_sources.sql
+-- Records where an extract came from: the file format, the workbook sheet
+-- for XLSX sources and which row held the column headers.
+
+ALTER TABLE data_extracts
+    ADD COLUMN IF NOT EXISTS source_format TEXT NOT NULL DEFAULT 'csv'
+        CHECK (source_format IN ('csv', 'tsv', 'xlsx')),
+    ADD COLUMN IF NOT EXISTS sheet_name TEXT,
+    ADD COLUMN IF NOT EXISTS header_row INTEGER NOT NULL DEFAULT 1 CHECK (header_row >= 1);
@@ -0,0 +1,32 @@
+-- 000027_plate_layouts.sql
+-- Microplate layouts describe what each well of a 96- or 384-well plate
+-- holds (sample, standard, blank or control, with a replicate group and an
+-- optional concentration). Plate-reader extracts record the plate format
+-- and the layout applied when they were parsed. Layouts are immutable so an
+-- extract always reflects the layout it was built with.
+
+CREATE TABLE IF NOT EXISTS plate_layouts (
+    id              UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    experiment_id   UUID        NOT NULL REFERENCES experiments(id) ON DELETE RESTRICT,
+    creator_user_id UUID        NOT NULL REFERENCES users(id),
+    name            TEXT        NOT NULL,
+    plate_format    INTEGER     NOT NULL CHECK (plate_format IN (96, 384)),
+    assignments     JSONB       NOT NULL DEFAULT '[]',
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_plate_layouts_experiment ON plate_layouts (experiment_id);
+
+DROP TRIGGER IF EXISTS trg_plate_layouts_reject_update ON plate_layouts;
+CREATE TRIGGER trg_plate_layouts_reject_update
+BEFORE UPDATE ON plate_layouts
+FOR EACH ROW EXECUTE FUNCTION reject_mutation();
+
+DROP TRIGGER IF EXISTS trg_plate_layouts_reject_delete ON plate_layouts;
+CREATE TRIGGER trg_plate_layouts_reject_delete
+BEFORE DELETE ON plate_layouts
+FOR EACH ROW EXECUTE FUNCTION reject_mutation();
+
+ALTER TABLE data_extracts
+    ADD COLUMN IF NOT EXISTS plate_format INTEGER CHECK (plate_format IN (96, 384)),
+    ADD COLUMN IF NOT EXISTS plate_layout_id UUID REFERENCES plate_layouts(id) ON DELETE RESTRICT;
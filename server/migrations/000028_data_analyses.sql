@@ -0,0 +1,32 @@
+-- 000028_data_analyses.sql
+-- Analyses run on data extracts: curve fits, standard-curve interpolation,
+-- replicate statistics and t-tests. Each row records the parameters used and
+-- the computed results and is never modified, so a reported number can
+-- always be traced to the inputs that produced it.
+
+CREATE TABLE IF NOT EXISTS data_analyses (
+    id              UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    experiment_id   UUID        NOT NULL REFERENCES experiments(id) ON DELETE RESTRICT,
+    data_extract_id UUID        NOT NULL REFERENCES data_extracts(id) ON DELETE RESTRICT,
+    creator_user_id UUID        NOT NULL REFERENCES users(id),
+    analysis_type   TEXT        NOT NULL,
+    parameters      JSONB       NOT NULL DEFAULT '{}',
+    results         JSONB       NOT NULL,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT data_analyses_type_check CHECK (analysis_type IN (
+        'linear_fit', 'logistic_4pl', 'interpolation', 'replicate_stats', 't_test'
+    ))
+);
+
+CREATE INDEX IF NOT EXISTS idx_data_analyses_experiment ON data_analyses (experiment_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_data_analyses_extract ON data_analyses (data_extract_id);
+
+DROP TRIGGER IF EXISTS trg_data_analyses_reject_update ON data_analyses;
+CREATE TRIGGER trg_data_analyses_reject_update
+BEFORE UPDATE ON data_analyses
+FOR EACH ROW EXECUTE FUNCTION reject_mutation();
+
+DROP TRIGGER IF EXISTS trg_data_analyses_reject_delete ON data_analyses;
+CREATE TRIGGER trg_data_analyses_reject_delete
+BEFORE DELETE ON data_analyses
+FOR EACH ROW EXECUTE FUNCTION reject_mutation();
@@ -0,0 +1,7 @@
+-- 000029_qpcr_analyses.sql
+-- Allows qPCR relative quantification (2^-ΔΔCt) as a stored analysis type.
+
+ALTER TABLE data_analyses DROP CONSTRAINT IF EXISTS data_analyses_type_check;
+ALTER TABLE data_analyses ADD CONSTRAINT data_analyses_type_check CHECK (analysis_type IN (
+    'linear_fit', 'logistic_4pl', 'interpolation', 'replicate_stats', 't_test', 'qpcr_ddct'
+));
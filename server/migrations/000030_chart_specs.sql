@@ -0,0 +1,10 @@
+-- 000030_chart_specs.sql
+-- Adds box plots and heatmaps to the chart types. chart_configs.options now
+-- holds the typed chart spec (axes, error bars, grouping, faceting), which
+-- is validated against the extract's columns before insert; existing rows
+-- are read as specs unchanged.
+
+ALTER TABLE chart_configs DROP CONSTRAINT IF EXISTS chart_configs_chart_type_check;
+ALTER TABLE chart_configs ADD CONSTRAINT chart_configs_chart_type_check CHECK (chart_type IN (
+    'line', 'scatter', 'bar', 'histogram', 'area', 'box', 'heatmap'
+));
@@ -0,0 +1,40 @@
+-- 000031_unified_search_indexes.sql
+-- Full-text indexes for the unified search over comments, proposals,
+-- attachments, data extract headers, templates and reagents. These are
+-- expression indexes rather than search_vector columns so the immutable
+-- tables need no trigger or backfill; the search queries repeat each
+-- expression exactly so the planner can use the index.
+--
+-- Attachment keys and MIME types are searched with the simple
+-- configuration after splitting on path and filename punctuation, so
+-- "plate_reader_0412.csv" matches "plate", "reader" and "0412".
+
+CREATE INDEX IF NOT EXISTS idx_record_comments_fts
+    ON record_comments USING GIN (to_tsvector('english', body));
+
+CREATE INDEX IF NOT EXISTS idx_experiment_proposals_fts
+    ON experiment_proposals USING GIN (to_tsvector('english', title || ' ' || body));
+
+CREATE INDEX IF NOT EXISTS idx_attachments_fts
+    ON attachments USING GIN (to_tsvector('simple', translate(object_key || ' ' || mime_type, '/_.-', '    ')));
+
+CREATE INDEX IF NOT EXISTS idx_data_extracts_fts
+    ON data_extracts USING GIN (to_tsvector('english', column_headers));
+
+CREATE INDEX IF NOT EXISTS idx_experiment_templates_fts
+    ON experiment_templates USING GIN (to_tsvector('english', title || ' ' || description));
+
+CREATE INDEX IF NOT EXISTS idx_reagent_antibody_fts
+    ON reagent_antibody USING GIN (to_tsvector('simple', antibody_name || ' ' || coalesce(catalog_no, '') || ' ' || coalesce(notes, '')));
+CREATE INDEX IF NOT EXISTS idx_reagent_cell_line_fts
+    ON reagent_cell_line USING GIN (to_tsvector('simple', cell_line_name || ' ' || coalesce(notes, '')));
+CREATE INDEX IF NOT EXISTS idx_reagent_virus_fts
+    ON reagent_virus USING GIN (to_tsvector('simple', virus_name || ' ' || coalesce(notes, '')));
+CREATE INDEX IF NOT EXISTS idx_reagent_dna_fts
+    ON reagent_dna USING GIN (to_tsvector('simple', dna_name || ' ' || coalesce(notes, '')));
+CREATE INDEX IF NOT EXISTS idx_reagent_oligo_fts
+    ON reagent_oligo USING GIN (to_tsvector('simple', oligo_name || ' ' || coalesce(sequence, '') || ' ' || coalesce(notes, '')));
+CREATE INDEX IF NOT EXISTS idx_reagent_chemical_fts
+    ON reagent_chemical USING GIN (to_tsvector('simple', chemical_name || ' ' || coalesce(catalog_no, '') || ' ' || coalesce(notes, '')));
+CREATE INDEX IF NOT EXISTS idx_reagent_molecular_fts
+    ON reagent_molecular USING GIN (to_tsvector('simple', mr_name || ' ' || coalesce(notes, '')));
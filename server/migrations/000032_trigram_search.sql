@@ -0,0 +1,36 @@
+-- 000032_trigram_search.sql
+-- Trigram indexes for fuzzy and prefix matching of titles and identifiers
+-- that English stemming mangles: gene names, antibody clones, catalog
+-- numbers such as sc-7392 and oligo sequences. The search matches these
+-- columns with word_similarity (<%) and ILIKE prefixes, both served by
+-- gin_trgm_ops, and draws "did you mean" corrections from the same words.
+
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX IF NOT EXISTS idx_experiments_title_trgm
+    ON experiments USING GIN (title gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_protocols_title_trgm
+    ON protocols USING GIN (title gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_experiment_templates_title_trgm
+    ON experiment_templates USING GIN (title gin_trgm_ops);
+
+CREATE INDEX IF NOT EXISTS idx_reagent_antibody_name_trgm
+    ON reagent_antibody USING GIN (antibody_name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_reagent_antibody_catalog_trgm
+    ON reagent_antibody USING GIN (catalog_no gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_reagent_cell_line_name_trgm
+    ON reagent_cell_line USING GIN (cell_line_name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_reagent_virus_name_trgm
+    ON reagent_virus USING GIN (virus_name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_reagent_dna_name_trgm
+    ON reagent_dna USING GIN (dna_name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_reagent_oligo_name_trgm
+    ON reagent_oligo USING GIN (oligo_name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_reagent_oligo_sequence_trgm
+    ON reagent_oligo USING GIN (sequence gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_reagent_chemical_name_trgm
+    ON reagent_chemical USING GIN (chemical_name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_reagent_chemical_catalog_trgm
+    ON reagent_chemical USING GIN (catalog_no gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_reagent_molecular_name_trgm
+    ON reagent_molecular USING GIN (mr_name gin_trgm_ops);
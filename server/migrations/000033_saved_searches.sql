@@ -0,0 +1,32 @@
+-- 000033_saved_searches.sql
+-- Named searches a user can re-run, optionally subscribed to alerts.
+-- criteria holds the query, hit types and facet selections as saved.
+-- alert_cursor is the last audit_log id the alert worker has checked for
+-- the search; it starts at the log's head when the user subscribes, so only
+-- records changed afterwards raise alerts. saved_search_alerts remembers
+-- which records have been alerted, so each record alerts once per search.
+
+CREATE TABLE IF NOT EXISTS saved_searches (
+    id            UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    owner_user_id UUID        NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name          TEXT        NOT NULL,
+    criteria      JSONB       NOT NULL,
+    subscribed    BOOLEAN     NOT NULL DEFAULT FALSE,
+    alert_cursor  BIGINT      NOT NULL DEFAULT 0,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT saved_searches_owner_name_unique UNIQUE (owner_user_id, name)
+);
+
+CREATE INDEX IF NOT EXISTS idx_saved_searches_subscribed
+    ON saved_searches (alert_cursor)
+    WHERE subscribed;
+
+CREATE TABLE IF NOT EXISTS saved_search_alerts (
+    saved_search_id UUID        NOT NULL REFERENCES saved_searches(id) ON DELETE CASCADE,
+    record_type     TEXT        NOT NULL CHECK (record_type IN ('experiment', 'protocol')),
+    record_id       UUID        NOT NULL,
+    audit_log_id    BIGINT      NOT NULL,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (saved_search_id, record_type, record_id)
+);
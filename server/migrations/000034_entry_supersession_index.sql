@@ -0,0 +1,10 @@
+-- 000034_entry_supersession_index.sql
+-- Every entry body stays in the full-text index, so search still finds
+-- text that a later addendum corrected. Search now labels each entry hit
+-- effective or historical, and can leave historical ones out, by looking
+-- up whether an addendum supersedes the entry; this index serves that
+-- lookup.
+
+CREATE INDEX IF NOT EXISTS idx_experiment_entries_supersedes
+    ON experiment_entries (supersedes_entry_id)
+    WHERE supersedes_entry_id IS NOT NULL;
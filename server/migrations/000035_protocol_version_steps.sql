@@ -0,0 +1,11 @@
+-- 000035_protocol_version_steps.sql
+-- A protocol version may now carry structured steps alongside its body:
+-- ordered, nestable steps with typed parameters (temperature, duration,
+-- volume, concentration, each with a unit), required reagents and safety
+-- notes. steps is NULL for free-text versions. When a version has steps,
+-- body holds their rendered text, so clients and search that read body
+-- keep working unchanged.
+
+ALTER TABLE protocol_versions
+    ADD COLUMN IF NOT EXISTS steps JSONB
+    CHECK (steps IS NULL OR jsonb_typeof(steps) = 'array');
@@ -0,0 +1,22 @@
+-- 000036_reagent_mention_indexes.sql
+-- Full-text indexes over each reagent's name and identifiers only, without
+-- notes. Related experiments look up the reagents an entry mentions by
+-- matching the entry's words against these, so only reagents that share a
+-- word with the entry are checked for a full phrase match instead of every
+-- reagent row. The related query repeats each expression exactly so the
+-- planner can use the index.
+
+CREATE INDEX IF NOT EXISTS idx_reagent_antibody_mention
+    ON reagent_antibody USING GIN (to_tsvector('simple', antibody_name || ' ' || coalesce(catalog_no, '')));
+CREATE INDEX IF NOT EXISTS idx_reagent_cell_line_mention
+    ON reagent_cell_line USING GIN (to_tsvector('simple', cell_line_name));
+CREATE INDEX IF NOT EXISTS idx_reagent_virus_mention
+    ON reagent_virus USING GIN (to_tsvector('simple', virus_name));
+CREATE INDEX IF NOT EXISTS idx_reagent_dna_mention
+    ON reagent_dna USING GIN (to_tsvector('simple', dna_name));
+CREATE INDEX IF NOT EXISTS idx_reagent_oligo_mention
+    ON reagent_oligo USING GIN (to_tsvector('simple', oligo_name || ' ' || coalesce(sequence, '')));
+CREATE INDEX IF NOT EXISTS idx_reagent_chemical_mention
+    ON reagent_chemical USING GIN (to_tsvector('simple', chemical_name || ' ' || coalesce(catalog_no, '')));
+CREATE INDEX IF NOT EXISTS idx_reagent_molecular_mention
+    ON reagent_molecular USING GIN (to_tsvector('simple', mr_name));